@@ -0,0 +1,598 @@
+package geoqlparser
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// FindingKind describes the result of the satisfiability analysis.
+type FindingKind uint8
+
+const (
+	Unsatisfiable FindingKind = iota + 1
+	Tautology
+)
+
+func (k FindingKind) String() (s string) {
+	switch k {
+	case Unsatisfiable:
+		s = "unsatisfiable"
+	case Tautology:
+		s = "tautology"
+	}
+	return
+}
+
+// Finding reports a condition that can never be true or is always true.
+type Finding struct {
+	Kind FindingKind
+	Pos  Pos
+	End  Pos
+	Msg  string
+}
+
+// Analyze tracks per-selector interval constraints in Trigger.When
+// through and, or, xor, not, not in and the comparison operators and reports
+// conditions that can never be true or are always true.
+//
+//	when tracker_speed > 100Kph and tracker_speed < 50Kph  // unsatisfiable
+//	when tracker_speed > 10 or tracker_speed <= 10         // tautology
+func Analyze(t *Trigger) []Finding {
+	if t == nil || t.When == nil {
+		return nil
+	}
+	a := newAnalyzer(t)
+	a.walk(t.When)
+	sort.SliceStable(a.findings, func(i, j int) bool {
+		return a.findings[i].Pos < a.findings[j].Pos
+	})
+	return a.findings
+}
+
+type analyzer struct {
+	trigger  *Trigger
+	names    map[string]string
+	idents   map[string]string // keys of selectors of the current device without properties
+	findings []Finding
+}
+
+func newAnalyzer(t *Trigger) *analyzer {
+	return &analyzer{trigger: t, names: make(map[string]string), idents: make(map[string]string)}
+}
+
+// fact describes what is known about an expression. Constraints form a conjunction
+// of per-selector domains implied by the expression. When exact is set, the
+// expression is also implied by the constraints.
+type fact struct {
+	cons  map[string]*domain
+	exact bool
+	unsat bool
+	taut  bool
+}
+
+var (
+	unknownFact = &fact{}
+	unsatFact   = &fact{exact: true, unsat: true}
+	tautFact    = &fact{exact: true, taut: true}
+)
+
+func (a *analyzer) report(kind FindingKind, expr Expr, key string) {
+	var msg string
+	name := a.names[key]
+	switch kind {
+	case Unsatisfiable:
+		msg = "condition can never be true"
+	case Tautology:
+		msg = "condition is always true"
+	}
+	if len(name) > 0 {
+		msg += " for " + name
+	}
+	a.findings = append(a.findings, Finding{Kind: kind, Pos: expr.Pos(), End: expr.End(), Msg: msg})
+}
+
+func (a *analyzer) walk(expr Expr) *fact {
+	switch typ := expr.(type) {
+	case *ParenExpr:
+		return a.walk(typ.Expr)
+	case *BooleanTyp:
+		if typ.Val {
+			return tautFact
+		}
+		return unsatFact
+	case *BinaryExpr:
+		switch typ.Op {
+		case AND:
+			return a.and(typ, a.walk(typ.Left), a.walk(typ.Right))
+		case OR:
+			return a.or(typ, a.walk(typ.Left), a.walk(typ.Right))
+		case XOR:
+			return a.xor(a.walk(typ.Left), a.walk(typ.Right))
+		case FOR:
+			// The condition must hold now, but whether it held
+			// for the whole period depends on the history.
+			if f := a.walk(typ.Left); !f.taut {
+				return f
+			}
+			return unknownFact
+		}
+		return a.atom(typ)
+	case *UnaryExpr:
+		if typ.Op == NOT {
+			return a.not(a.walk(typ.X))
+		}
+	}
+	return unknownFact
+}
+
+// not negates the fact. Only a constraint on a single selector stays
+// exact, as the negation of a conjunction is a disjunction.
+func (a *analyzer) not(f *fact) *fact {
+	switch {
+	case f.unsat:
+		return tautFact
+	case f.taut:
+		return unsatFact
+	case !f.exact || len(f.cons) != 1:
+		return unknownFact
+	}
+	for k, d := range f.cons {
+		return &fact{cons: map[string]*domain{k: d.complement()}, exact: true}
+	}
+	return unknownFact
+}
+
+func (a *analyzer) xor(l, r *fact) *fact {
+	switch {
+	case l.unsat:
+		return r
+	case r.unsat:
+		return l
+	case l.taut:
+		return a.not(r)
+	case r.taut:
+		return a.not(l)
+	}
+	return unknownFact
+}
+
+func (a *analyzer) and(e *BinaryExpr, l, r *fact) *fact {
+	switch {
+	case l.unsat || r.unsat:
+		return unsatFact
+	case l.taut:
+		return r
+	case r.taut:
+		return l
+	}
+	f := &fact{cons: make(map[string]*domain), exact: l.exact && r.exact}
+	for k, d := range l.cons {
+		f.cons[k] = d
+	}
+	for k, d := range r.cons {
+		if prev, ok := f.cons[k]; ok {
+			d = prev.intersect(d)
+		}
+		if d.empty() {
+			a.report(Unsatisfiable, e, k)
+			return unsatFact
+		}
+		f.cons[k] = d
+	}
+	return f
+}
+
+func (a *analyzer) or(e *BinaryExpr, l, r *fact) *fact {
+	switch {
+	case l.unsat:
+		return r
+	case r.unsat:
+		return l
+	case l.taut || r.taut:
+		return tautFact
+	}
+	f := &fact{cons: make(map[string]*domain)}
+	var key string
+	for k, d := range l.cons {
+		other, ok := r.cons[k]
+		if !ok {
+			continue
+		}
+		key = k
+		if u := d.union(other); !u.full() {
+			f.cons[k] = u
+		}
+	}
+	f.exact = l.exact && r.exact && len(l.cons) == 1 && len(r.cons) == 1 && len(key) > 0
+	if f.exact && len(f.cons) == 0 {
+		a.report(Tautology, e, key)
+		return tautFact
+	}
+	return f
+}
+
+func (a *analyzer) atom(e *BinaryExpr) *fact {
+	op := e.Op
+	selector, ok := e.Left.(*Selector)
+	other := e.Right
+	if !ok {
+		if selector, ok = e.Right.(*Selector); !ok {
+			return unknownFact
+		}
+		other = e.Left
+		switch op {
+		case LSS:
+			op = GTR
+		case LEQ:
+			op = GEQ
+		case GTR:
+			op = LSS
+		case GEQ:
+			op = LEQ
+		case EQL, LEQL, NOT_EQ, LNEQ:
+		default:
+			return unknownFact
+		}
+	}
+	if selector.Quantifier != ILLEGAL {
+		// Different devices may satisfy the comparisons of a quantified selector.
+		return unknownFact
+	}
+	d, ok := a.domainOf(op, a.resolve(other))
+	if !ok {
+		return unknownFact
+	}
+	name := formatExpr(selector)
+	key := name + "/" + strconv.Itoa(int(d.dim))
+	a.names[key] = name
+	if !selector.multi() && len(selector.Props) == 0 {
+		a.idents[key] = selector.Ident
+	}
+	switch {
+	case d.empty():
+		a.report(Unsatisfiable, e, key)
+		return unsatFact
+	case d.full():
+		a.report(Tautology, e, key)
+		return tautFact
+	}
+	return &fact{cons: map[string]*domain{key: d}, exact: true}
+}
+
+func (a *analyzer) resolve(expr Expr) Expr {
+	ref, ok := expr.(*Ref)
+	if !ok {
+		return expr
+	}
+	assign, err := a.trigger.findAssign(ref.ID)
+	if err != nil {
+		return expr
+	}
+	return assign.Right
+}
+
+func (a *analyzer) domainOf(op Token, expr Expr) (d *domain, ok bool) {
+	switch op {
+	case IN, NOT_IN:
+		d, ok = a.setOf(expr)
+	case EQL, LEQL, NOT_EQ, LNEQ:
+		d, ok = valueOf(expr)
+	case LSS, LEQ, GTR, GEQ:
+		var v float64
+		var dim dimension
+		v, dim, ok = baseValue(expr)
+		if !ok {
+			return
+		}
+		d = &domain{dim: dim}
+		inf := bound{v: math.Inf(1)}
+		ninf := bound{v: math.Inf(-1)}
+		switch op {
+		case LSS:
+			d.set = intervalSet{{lo: ninf, hi: bound{v: v, open: true}}}
+		case LEQ:
+			d.set = intervalSet{{lo: ninf, hi: bound{v: v}}}
+		case GTR:
+			d.set = intervalSet{{lo: bound{v: v, open: true}, hi: inf}}
+		case GEQ:
+			d.set = intervalSet{{lo: bound{v: v}, hi: inf}}
+		}
+		d.normalize()
+	}
+	if ok && (op == NOT_IN || op == NOT_EQ || op == LNEQ) {
+		d = d.complement()
+	}
+	return
+}
+
+func (a *analyzer) setOf(expr Expr) (d *domain, ok bool) {
+	switch typ := expr.(type) {
+	case *Range:
+		return rangeOf(typ)
+	case *ArrayTyp:
+		for _, item := range typ.List {
+			var next *domain
+			switch it := a.resolve(item).(type) {
+			case *Range:
+				next, ok = rangeOf(it)
+			default:
+				next, ok = valueOf(it)
+			}
+			if !ok || (d != nil && d.dim != next.dim) {
+				return nil, false
+			}
+			if d == nil {
+				d = next
+			} else {
+				d = d.union(next)
+			}
+		}
+		return d, d != nil
+	}
+	return
+}
+
+func valueOf(expr Expr) (d *domain, ok bool) {
+	switch typ := expr.(type) {
+	case *StringTyp:
+		return &domain{dim: dimString, values: map[string]struct{}{typ.Val: {}}}, true
+	case *BooleanTyp:
+		return &domain{dim: dimBoolean, values: map[string]struct{}{strconv.FormatBool(typ.Val): {}}}, true
+	}
+	v, dim, ok := baseValue(expr)
+	if !ok {
+		return
+	}
+	d = &domain{dim: dim, set: intervalSet{{lo: bound{v: v}, hi: bound{v: v}}}}
+	d.normalize()
+	return d, true
+}
+
+func rangeOf(r *Range) (d *domain, ok bool) {
+	lo, ldim, lok := baseValue(r.Low)
+	hi, hdim, hok := baseValue(r.High)
+	if !lok || !hok || ldim != hdim {
+		return
+	}
+	d = &domain{dim: ldim}
+	if lo > hi && isCyclic(ldim) {
+		// weekday[Fri .. Mon], time[22:00 .. 06:00]
+		u := universe(ldim)
+		d.set = intervalSet{{lo: u.lo, hi: bound{v: hi}}, {lo: bound{v: lo}, hi: u.hi}}
+	} else {
+		d.set = intervalSet{{lo: bound{v: lo}, hi: bound{v: hi}}}
+	}
+	d.normalize()
+	return d, true
+}
+
+type bound struct {
+	v    float64
+	open bool
+}
+
+type interval struct {
+	lo, hi bound
+}
+
+func (i interval) empty() bool {
+	return i.lo.v > i.hi.v || (i.lo.v == i.hi.v && (i.lo.open || i.hi.open))
+}
+
+// intervalSet is a sorted list of disjoint intervals.
+type intervalSet []interval
+
+// domain is a set of values a selector may take. Numeric dimensions
+// use intervals, strings and booleans use a set of allowed or excluded values.
+type domain struct {
+	dim      dimension
+	set      intervalSet
+	values   map[string]struct{}
+	excluded bool
+}
+
+func isEnum(dim dimension) bool {
+	return dim == dimString || dim == dimBoolean
+}
+
+func isDiscrete(dim dimension) bool {
+	switch dim {
+	case dimTime, dimDate, dimWeekday, dimMonth:
+		return true
+	}
+	return false
+}
+
+func isCyclic(dim dimension) bool {
+	switch dim {
+	case dimTime, dimWeekday, dimMonth:
+		return true
+	}
+	return false
+}
+
+// universe returns the values of the dimension. Speeds, distances and durations
+// cannot be negative, while percents are often changes, e.g. delta(tracker_fuel) < -10%.
+func universe(dim dimension) interval {
+	inf := bound{v: math.Inf(1)}
+	switch dim {
+	case dimSpeed, dimDistance, dimDuration:
+		return interval{lo: bound{v: 0}, hi: inf}
+	case dimTime:
+		return interval{lo: bound{v: 0}, hi: bound{v: secondsPerDay}}
+	case dimWeekday:
+		return interval{lo: bound{v: 0}, hi: bound{v: 6}}
+	case dimMonth:
+		return interval{lo: bound{v: 1}, hi: bound{v: 12}}
+	}
+	return interval{lo: bound{v: math.Inf(-1)}, hi: inf}
+}
+
+func (d *domain) normalize() {
+	if isEnum(d.dim) {
+		if d.dim == dimBoolean && d.excluded {
+			values := make(map[string]struct{})
+			for _, v := range []string{"true", "false"} {
+				if _, ok := d.values[v]; !ok {
+					values[v] = struct{}{}
+				}
+			}
+			d.values, d.excluded = values, false
+		}
+		return
+	}
+	u := universe(d.dim)
+	set := make(intervalSet, 0, len(d.set))
+	for _, i := range d.set {
+		i = intersectInterval(i, u)
+		if isDiscrete(d.dim) {
+			if i.lo.open {
+				i.lo = bound{v: math.Floor(i.lo.v) + 1}
+			} else {
+				i.lo.v = math.Ceil(i.lo.v)
+			}
+			if i.hi.open {
+				i.hi = bound{v: math.Ceil(i.hi.v) - 1}
+			} else {
+				i.hi.v = math.Floor(i.hi.v)
+			}
+		}
+		if !i.empty() {
+			set = append(set, i)
+		}
+	}
+	sort.Slice(set, func(i, j int) bool {
+		if set[i].lo.v == set[j].lo.v {
+			return !set[i].lo.open && set[j].lo.open
+		}
+		return set[i].lo.v < set[j].lo.v
+	})
+	merged := set[:0]
+	for _, i := range set {
+		if n := len(merged); n > 0 && touches(merged[n-1], i, isDiscrete(d.dim)) {
+			last := &merged[n-1]
+			if i.hi.v > last.hi.v || (i.hi.v == last.hi.v && !i.hi.open) {
+				last.hi = i.hi
+			}
+			continue
+		}
+		merged = append(merged, i)
+	}
+	d.set = merged
+}
+
+func touches(a, b interval, discrete bool) bool {
+	if discrete && b.lo.v <= a.hi.v+1 {
+		return true
+	}
+	return b.lo.v < a.hi.v || (b.lo.v == a.hi.v && !(a.hi.open && b.lo.open))
+}
+
+func intersectInterval(a, b interval) interval {
+	lo, hi := a.lo, a.hi
+	if b.lo.v > lo.v || (b.lo.v == lo.v && b.lo.open) {
+		lo = b.lo
+	}
+	if b.hi.v < hi.v || (b.hi.v == hi.v && b.hi.open) {
+		hi = b.hi
+	}
+	return interval{lo: lo, hi: hi}
+}
+
+func (d *domain) empty() bool {
+	if isEnum(d.dim) {
+		return !d.excluded && len(d.values) == 0
+	}
+	return len(d.set) == 0
+}
+
+func (d *domain) full() bool {
+	return d.complement().empty()
+}
+
+func (d *domain) complement() *domain {
+	out := &domain{dim: d.dim}
+	if isEnum(d.dim) {
+		out.values, out.excluded = d.values, !d.excluded
+		out.normalize()
+		return out
+	}
+	u := universe(d.dim)
+	start := u.lo
+	for _, i := range d.set {
+		out.set = append(out.set, interval{lo: start, hi: bound{v: i.lo.v, open: !i.lo.open}})
+		start = bound{v: i.hi.v, open: !i.hi.open}
+	}
+	out.set = append(out.set, interval{lo: start, hi: u.hi})
+	out.normalize()
+	return out
+}
+
+func (d *domain) intersect(o *domain) *domain {
+	out := &domain{dim: d.dim}
+	if isEnum(d.dim) {
+		switch {
+		case !d.excluded && !o.excluded:
+			out.values = filter(d.values, o.values, true)
+		case !d.excluded && o.excluded:
+			out.values = filter(d.values, o.values, false)
+		case d.excluded && !o.excluded:
+			out.values = filter(o.values, d.values, false)
+		default:
+			out.values, out.excluded = join(d.values, o.values), true
+		}
+		out.normalize()
+		return out
+	}
+	for _, a := range d.set {
+		for _, b := range o.set {
+			out.set = append(out.set, intersectInterval(a, b))
+		}
+	}
+	out.normalize()
+	return out
+}
+
+func (d *domain) union(o *domain) *domain {
+	out := &domain{dim: d.dim}
+	if isEnum(d.dim) {
+		switch {
+		case !d.excluded && !o.excluded:
+			out.values = join(d.values, o.values)
+		case !d.excluded && o.excluded:
+			out.values, out.excluded = filter(o.values, d.values, false), true
+		case d.excluded && !o.excluded:
+			out.values, out.excluded = filter(d.values, o.values, false), true
+		default:
+			out.values, out.excluded = filter(d.values, o.values, true), true
+		}
+		out.normalize()
+		return out
+	}
+	out.set = append(append(out.set, d.set...), o.set...)
+	out.normalize()
+	return out
+}
+
+// filter returns the values of a that are (keep=true) or are not (keep=false) in b.
+func filter(a, b map[string]struct{}, keep bool) map[string]struct{} {
+	out := make(map[string]struct{})
+	for k := range a {
+		if _, ok := b[k]; ok == keep {
+			out[k] = struct{}{}
+		}
+	}
+	return out
+}
+
+func join(a, b map[string]struct{}) map[string]struct{} {
+	out := make(map[string]struct{}, len(a)+len(b))
+	for k := range a {
+		out[k] = struct{}{}
+	}
+	for k := range b {
+		out[k] = struct{}{}
+	}
+	return out
+}
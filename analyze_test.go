@@ -0,0 +1,165 @@
+package geoqlparser
+
+import (
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	testCases := []struct {
+		name string
+		s    string
+		want []FindingKind
+		pos  [][2]Pos
+	}{
+		{
+			name: "satisfiable",
+			s:    `when tracker_speed > 10Kph and tracker_speed < 50Kph`,
+		},
+		{
+			name: "contradiction",
+			s:    `when tracker_speed > 100Kph and tracker_speed < 50Kph`,
+			want: []FindingKind{Unsatisfiable},
+			pos:  [][2]Pos{{5, 52}},
+		},
+		{
+			name: "contradiction with normalized units",
+			s:    `when tracker_speed > 100Kph and tracker_speed < 60Mph`,
+			want: []FindingKind{Unsatisfiable},
+		},
+		{
+			name: "satisfiable with normalized units",
+			s:    `when tracker_speed > 90Kph and tracker_speed < 60Mph`,
+		},
+		{
+			name: "weekday range and equality",
+			s:    `when tracker_week in weekday[Sun .. Fri] and tracker_week == weekday[Sat]`,
+			want: []FindingKind{Unsatisfiable},
+		},
+		{
+			name: "cyclic weekday range",
+			s:    `when tracker_week in weekday[Fri .. Mon] and tracker_week == weekday[Sun]`,
+		},
+		{
+			name: "not in",
+			s:    `when tracker_a in 1 .. 10 and tracker_a not in 0 .. 20`,
+			want: []FindingKind{Unsatisfiable},
+		},
+		{
+			name: "empty range",
+			s:    `when tracker_a in 10 .. 5 or tracker_b > 1`,
+			want: []FindingKind{Unsatisfiable},
+		},
+		{
+			name: "or keeps the constraint",
+			s:    `when (tracker_a < 1 or tracker_a > 10) and tracker_a in 2 .. 9`,
+			want: []FindingKind{Unsatisfiable},
+		},
+		{
+			name: "or of different selectors",
+			s:    `when (tracker_a < 1 or tracker_b > 10) and tracker_a in 2 .. 9`,
+		},
+		{
+			name: "strings",
+			s:    `when tracker_model == "a" and tracker_model in ["b", "c"]`,
+			want: []FindingKind{Unsatisfiable},
+		},
+		{
+			name: "strings not eq",
+			s:    `when tracker_model != "a" and tracker_model in ["a", "c"]`,
+		},
+		{
+			name: "booleans",
+			s:    `when tracker_status == true and tracker_status != true`,
+			want: []FindingKind{Unsatisfiable},
+		},
+		{
+			name: "tautology",
+			s:    `when tracker_a > 10 or tracker_a <= 10`,
+			want: []FindingKind{Tautology},
+		},
+		{
+			name: "tautology with booleans",
+			s:    `when tracker_status == true or tracker_status == false`,
+			want: []FindingKind{Tautology},
+		},
+		{
+			name: "tautology of a single comparison",
+			s:    `when tracker_speed >= 0Kph`,
+			want: []FindingKind{Tautology},
+		},
+		{
+			name: "negative percent",
+			s:    `when tracker_change < -5% and tracker_change > -10%`,
+		},
+		{
+			name: "percent may be negative",
+			s:    `when tracker_change >= 0%`,
+		},
+		{
+			name: "negative duration",
+			s:    `when tracker_d < 0s`,
+			want: []FindingKind{Unsatisfiable},
+		},
+		{
+			name: "literal on the left",
+			s:    `when 100 < tracker_a and tracker_a < 50`,
+			want: []FindingKind{Unsatisfiable},
+		},
+		{
+			name: "variables",
+			s:    `trigger set low=100Kph; when tracker_speed > @low and tracker_speed < 50Kph`,
+			want: []FindingKind{Unsatisfiable},
+		},
+		{
+			name: "discrete months",
+			s:    `when tracker_month > month[Jan] and tracker_month < month[Feb]`,
+			want: []FindingKind{Unsatisfiable},
+		},
+		{
+			name: "not",
+			s:    `when not (tracker_a > 10) and tracker_a > 20`,
+			want: []FindingKind{Unsatisfiable},
+		},
+		{
+			name: "not of a conjunction",
+			s:    `when not (tracker_a > 10 and tracker_b > 1) and tracker_a > 20`,
+		},
+		{
+			name: "xor with a tautology",
+			s:    `when (tracker_a > 10 or tracker_a <= 10) xor tracker_b > 1`,
+			want: []FindingKind{Tautology},
+		},
+		{
+			name: "for qualifier",
+			s:    `when tracker_a > 10 for 5m and tracker_a < 5`,
+			want: []FindingKind{Unsatisfiable},
+		},
+		{
+			name: "independent findings",
+			s:    `when (tracker_a > 2 and tracker_a < 1) or (tracker_b > 2 or tracker_b <= 2)`,
+			want: []FindingKind{Unsatisfiable, Tautology},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := Parse(tc.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			findings := Analyze(stmt.(*Trigger))
+			if have, want := len(findings), len(tc.want); have != want {
+				t.Fatalf("have %d findings %v, want %d", have, findings, want)
+			}
+			for i, f := range findings {
+				if have, want := f.Kind, tc.want[i]; have != want {
+					t.Fatalf("have %s, want %s", have, want)
+				}
+				if i < len(tc.pos) {
+					if have, want := [2]Pos{f.Pos, f.End}, tc.pos[i]; have != want {
+						t.Fatalf("have %v, want %v position", have, want)
+					}
+				}
+			}
+		})
+	}
+}
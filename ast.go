@@ -3,6 +3,8 @@ package geoqlparser
 import (
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -22,15 +24,82 @@ func (t *Trigger) isStatement() {}
 
 // Trigger represents a TRIGGER statement.
 type Trigger struct {
+	Doc            *CommentGroup // comments before the statement
+	SetDoc         *CommentGroup // comments before the SET section
 	Vars           []*Assign
+	WhenDoc        *CommentGroup // comments before the WHEN section
 	When           Expr
+	WhenComment    *CommentGroup // comments after the condition on the same line
+	RepeatDoc      *CommentGroup // comments before the REPEAT section
 	RepeatCount    Expr
 	RepeatInterval Expr
+	RepeatComment  *CommentGroup // comments in the REPEAT section and after it on the same line
+	ResetDoc       *CommentGroup // comments before the RESET section
 	ResetAfter     Expr
+	ResetComment   *CommentGroup // comments in the RESET section and after it on the same line
+	Comment        *CommentGroup // comments after the statement
 	lpos           Pos
 	rpos           Pos
 }
 
+// Comment represents a single //-style or /*-style comment.
+type Comment struct {
+	Text     string // comment text including the // or /* */ markers
+	lpos     Pos
+	rpos     Pos
+	trailing bool // on the same line as the previous token
+}
+
+func (c *Comment) Pos() Pos { return c.lpos }
+func (c *Comment) End() Pos { return c.rpos }
+
+// CommentGroup represents a sequence of comments
+// with no other tokens in between.
+type CommentGroup struct {
+	List []*Comment
+}
+
+func (g *CommentGroup) Pos() Pos { return g.List[0].Pos() }
+func (g *CommentGroup) End() Pos { return g.List[len(g.List)-1].End() }
+
+// Text returns the text of the comments without the comment markers.
+func (g *CommentGroup) Text() string {
+	if g == nil {
+		return ""
+	}
+	lines := make([]string, 0, len(g.List))
+	for _, c := range g.List {
+		text := c.Text
+		switch {
+		case strings.HasPrefix(text, "//"):
+			text = text[2:]
+		case strings.HasPrefix(text, "/*"):
+			text = strings.TrimSuffix(text[2:], "*/")
+		}
+		lines = append(lines, strings.TrimSpace(text))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func newCommentGroup(list []*Comment) *CommentGroup {
+	if len(list) == 0 {
+		return nil
+	}
+	return &CommentGroup{List: list}
+}
+
+func joinComments(a, b *CommentGroup) *CommentGroup {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	}
+	list := make([]*Comment, 0, len(a.List)+len(b.List))
+	list = append(list, a.List...)
+	return &CommentGroup{List: append(list, b.List...)}
+}
+
 func (t *Trigger) SetVar(v *Assign) error {
 	if t.isAssigned(v.Left.Val) {
 		return fmt.Errorf("variable %s already assigned", v.Left.Val)
@@ -65,9 +134,11 @@ func (t *Trigger) findAssign(varname string) (*Assign, error) {
 }
 
 type Assign struct {
-	Left   *Ident
-	Right  Expr
-	TokPos Pos
+	Doc     *CommentGroup // comments before the variable
+	Left    *Ident
+	Right   Expr
+	Comment *CommentGroup // comments after the variable on the same line
+	TokPos  Pos
 }
 
 type ArrayTyp struct {
@@ -78,12 +149,50 @@ type ArrayTyp struct {
 }
 
 type BinaryExpr struct {
+	Op      Token
+	Left    Expr
+	Right   Expr
+	Comment *CommentGroup // comments between the operands
+	OpPos   Pos
+}
+
+// UnaryExpr represents a prefix operator expression: not x, !x.
+type UnaryExpr struct {
 	Op    Token
-	Left  Expr
-	Right Expr
+	X     Expr
 	OpPos Pos
 }
 
+// CallExpr represents a function call: abs(tracker_delta), distance(tracker_coords, @depot).
+type CallExpr struct {
+	Func string
+	Args []Expr
+	lpos Pos
+	rpos Pos
+}
+
+// WindowExpr aggregates the values of an operand over a sliding time window:
+// avg(tracker_speed, 5m).
+type WindowExpr struct {
+	Func   string
+	X      Expr
+	Window *DurationTyp
+	lpos   Pos
+	rpos   Pos
+}
+
+// HistoryExpr refers to the previous samples of a selector: prev(tracker_speed),
+// changed(tracker_status), delta(tracker_fuel), rising(tracker_temp, 2C, 5m)
+// and falling(tracker_temp, 2C, 5m).
+type HistoryExpr struct {
+	Func   string
+	X      *Selector
+	Amount Expr         // rising and falling only
+	Within *DurationTyp // rising and falling only
+	lpos   Pos
+	rpos   Pos
+}
+
 type ParenExpr struct {
 	Expr Expr
 	lpos Pos
@@ -119,6 +228,15 @@ type MonthTyp struct {
 	rpos Pos
 }
 
+// CellTyp is a cell of a discrete global grid: h3[8928308280fffff],
+// geohash["u4pruyd"] or s2[89c25].
+type CellTyp struct {
+	Kind Token  // H3, GEOHASH or S2
+	Val  string // hex index of h3, geohash or token of s2
+	lpos Pos
+	rpos Pos
+}
+
 type GeometryPointTyp struct {
 	Val    [2]float64
 	Radius *DistanceTyp
@@ -140,7 +258,10 @@ type GeometryLineTyp struct {
 	rpos   Pos
 }
 
-func (e *GeometryLineTyp) needExpand() bool {
+func (e *GeometryLineTyp) needExpand(width int) bool {
+	if width > 0 {
+		return pointsWidth(e.Val) > width
+	}
 	return len(e.Val) > 4
 }
 
@@ -150,9 +271,9 @@ type GeometryPolygonTyp struct {
 	rpos Pos
 }
 
-func (e *GeometryPolygonTyp) needExpand() (ok bool) {
+func (e *GeometryPolygonTyp) needExpand(width int) (ok bool) {
 	for i := 0; i < len(e.Val); i++ {
-		if len(e.Val[i]) > 4 {
+		if width > 0 && pointsWidth(e.Val[i]) > width || width == 0 && len(e.Val[i]) > 4 {
 			ok = true
 			break
 		}
@@ -249,40 +370,75 @@ type Ref struct {
 }
 
 type Selector struct {
-	Ident    string              // selector name
-	Args     map[string]struct{} // device ids
-	Wildcard bool                // indicates the current device
-	Props    []Expr              // some props
-	lpos     Pos
-	rpos     Pos
-}
-
-func (e *Selector) calculateEnd(p Pos) {
+	Ident      string              // selector name
+	Args       map[string]struct{} // device ids
+	Groups     map[string]struct{} // device groups
+	Tags       map[string]struct{} // device tags
+	Wildcard   bool                // indicates the current device
+	Quantifier Token               // ANY or ALL for several devices, ILLEGAL otherwise
+	Props      []Expr              // some props
+	lpos       Pos
+	rpos       Pos
+}
+
+// calculateEnd sets the end of the selector to the end of the last
+// property, or to end, the last byte of the name or of the braces.
+func (e *Selector) calculateEnd(end Pos) {
 	if len(e.Props) > 0 {
 		e.rpos = e.Props[len(e.Props)-1].End()
 	} else {
-		if p > 0 {
-			p -= 1
-		}
-		e.rpos = p
+		e.rpos = end
+	}
+}
+
+func (e *Selector) sortedArgs() []string {
+	return sortedKeys(e.Args)
+}
+
+// filters returns the device ids, groups and tags as they are written.
+func (e *Selector) filters() []string {
+	list := make([]string, 0, len(e.Args)+len(e.Groups)+len(e.Tags))
+	for _, k := range e.sortedArgs() {
+		list = append(list, `"`+k+`"`)
+	}
+	for _, k := range sortedKeys(e.Groups) {
+		list = append(list, `group:"`+k+`"`)
+	}
+	for _, k := range sortedKeys(e.Tags) {
+		list = append(list, `tag:"`+k+`"`)
 	}
+	return list
 }
 
-func (e *Selector) needExpand() (ok bool) {
+// multi reports whether the selector refers to other devices than the current one.
+func (e *Selector) multi() bool {
+	return len(e.Args) > 0 || len(e.Groups) > 0 || len(e.Tags) > 0
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (e *Selector) needExpand(width int) bool {
 	var n int
-	var i int
-	for k := range e.Args {
-		n += len(k)
-		if n > 64 {
-			ok = true
-			break
+	if width == 0 {
+		for _, m := range []map[string]struct{}{e.Args, e.Groups, e.Tags} {
+			for k := range m {
+				n += len(k)
+			}
 		}
-		if i > 3 {
-			break
-		}
-		i++
+		return n > defaultSelectorWidth
 	}
-	return
+	n = len(e.Ident) + 2
+	for _, k := range e.filters() {
+		n += len(k) + 2
+	}
+	return n > width
 }
 
 type BooleanTyp struct {
@@ -302,7 +458,11 @@ func (e *BooleanTyp) format(b io.StringWriter, padding string, inline bool) {
 }
 
 func (e *BinaryExpr) isExpr()             {}
+func (e *UnaryExpr) isExpr()              {}
 func (e *ParenExpr) isExpr()              {}
+func (e *CallExpr) isExpr()               {}
+func (e *WindowExpr) isExpr()             {}
+func (e *HistoryExpr) isExpr()            {}
 func (e *Selector) isExpr()               {}
 func (e *WildcardTyp) isExpr()            {}
 func (e *BooleanTyp) isExpr()             {}
@@ -327,14 +487,23 @@ func (t *Trigger) isExpr()                {}
 func (e *Ident) isExpr()                  {}
 func (e *Assign) isExpr()                 {}
 func (e *DateTyp) isExpr()                {}
+func (e *CellTyp) isExpr()                {}
 func (e *TimeTyp) isExpr()                {}
 func (e *WeekdayTyp) isExpr()             {}
 func (e *MonthTyp) isExpr()               {}
 
 func (e *BinaryExpr) Pos() Pos             { return e.Left.Pos() }
-func (e *BinaryExpr) End() Pos             { return e.Right.Pos() }
+func (e *BinaryExpr) End() Pos             { return e.Right.End() }
+func (e *UnaryExpr) Pos() Pos              { return e.OpPos }
+func (e *UnaryExpr) End() Pos              { return e.X.End() }
 func (e *ParenExpr) Pos() Pos              { return e.lpos }
 func (e *ParenExpr) End() Pos              { return e.Expr.End() }
+func (e *CallExpr) Pos() Pos               { return e.lpos }
+func (e *CallExpr) End() Pos               { return e.rpos }
+func (e *WindowExpr) Pos() Pos             { return e.lpos }
+func (e *WindowExpr) End() Pos             { return e.rpos }
+func (e *HistoryExpr) Pos() Pos            { return e.lpos }
+func (e *HistoryExpr) End() Pos            { return e.rpos }
 func (e *Selector) Pos() Pos               { return e.lpos }
 func (e *Selector) End() Pos               { return e.rpos }
 func (e *WildcardTyp) Pos() Pos            { return e.lpos }
@@ -383,6 +552,8 @@ func (e *Assign) Pos() Pos                 { return e.Left.Pos() }
 func (e *Assign) End() Pos                 { return e.Right.End() }
 func (e *DateTyp) Pos() Pos                { return e.lpos }
 func (e *DateTyp) End() Pos                { return e.rpos }
+func (e *CellTyp) Pos() Pos                { return e.lpos }
+func (e *CellTyp) End() Pos                { return e.rpos }
 func (e *TimeTyp) Pos() Pos                { return e.lpos }
 func (e *TimeTyp) End() Pos                { return e.rpos }
 func (e *WeekdayTyp) Pos() Pos             { return e.lpos }
@@ -0,0 +1,782 @@
+package geoqlparser
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// TriggerBuilder constructs a Trigger without going through the parser.
+//
+//	stmt, err := When(Sel("tracker_speed").In(Between(Speed(10, Kph), Speed(40, Kph)))).
+//		Repeat(3, 10*time.Second).
+//		Build()
+type TriggerBuilder struct {
+	trigger *Trigger
+	err     error
+}
+
+// When starts a new trigger with the given condition.
+func When(cond Expr) *TriggerBuilder {
+	b := &TriggerBuilder{trigger: new(Trigger)}
+	expr, err := unwrap(cond)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	if expr == nil {
+		b.err = errors.New("geoql: WHEN condition is nil")
+		return b
+	}
+	b.trigger.When = expr
+	return b
+}
+
+// Set declares a variable that can be referenced with Var.
+func (b *TriggerBuilder) Set(name string, val Expr) *TriggerBuilder {
+	if b.err != nil {
+		return b
+	}
+	if err := checkName("variable", name); err != nil {
+		b.err = err
+		return b
+	}
+	expr, err := unwrap(val)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	switch typ := expr.(type) {
+	case nil:
+		b.err = fmt.Errorf("geoql: variable %s has no value", name)
+		return b
+	case *Ref:
+		b.err = fmt.Errorf("geoql: variable %s cannot refer to another variable", name)
+		return b
+	case *ArrayTyp:
+		if typ.Kind == IDENT {
+			b.err = fmt.Errorf("geoql: variable %s cannot refer to another variable", name)
+			return b
+		}
+	}
+	b.trigger.initVars()
+	if err = b.trigger.SetVar(&Assign{Left: &Ident{Val: name}, Right: expr}); err != nil {
+		b.err = err
+	}
+	return b
+}
+
+// Repeat sets the REPEAT section. A zero interval omits the every clause.
+func (b *TriggerBuilder) Repeat(count int, interval time.Duration) *TriggerBuilder {
+	if b.err != nil {
+		return b
+	}
+	if count < 0 || interval < 0 {
+		b.err = fmt.Errorf("geoql: repeat: %w", errNegativeValue)
+		return b
+	}
+	b.trigger.RepeatCount = &IntTyp{Val: count}
+	if interval > 0 {
+		b.trigger.RepeatInterval = &DurationTyp{Val: interval}
+	}
+	return b
+}
+
+// ResetAfter sets the RESET section.
+func (b *TriggerBuilder) ResetAfter(d time.Duration) *TriggerBuilder {
+	if b.err != nil {
+		return b
+	}
+	if d <= 0 {
+		b.err = fmt.Errorf("geoql: reset: %w", errNegativeValue)
+		return b
+	}
+	b.trigger.ResetAfter = &DurationTyp{Val: d}
+	return b
+}
+
+// Build returns the constructed trigger or the first error that occurred.
+func (b *TriggerBuilder) Build() (*Trigger, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.trigger, nil
+}
+
+// Operand wraps an expression and provides fluent operator methods.
+// It implements Expr, so it can be passed anywhere an expression is expected.
+type Operand struct {
+	Expr
+	err error
+}
+
+// Of wraps an existing expression into an Operand.
+func Of(expr Expr) Operand {
+	if op, ok := expr.(Operand); ok {
+		return op
+	}
+	return Operand{Expr: expr}
+}
+
+// Err returns the first error that occurred while building the operand.
+func (o Operand) Err() error { return o.err }
+
+func unwrap(expr Expr) (Expr, error) {
+	for {
+		op, ok := expr.(Operand)
+		if !ok {
+			return expr, nil
+		}
+		if op.err != nil {
+			return nil, op.err
+		}
+		expr = op.Expr
+	}
+}
+
+func failed(err error) Operand {
+	return Operand{err: err}
+}
+
+func (o Operand) binary(op Token, right Expr) Operand {
+	if o.err != nil {
+		return o
+	}
+	r, err := unwrap(right)
+	if err != nil {
+		return failed(err)
+	}
+	if o.Expr == nil || r == nil {
+		return failed(fmt.Errorf("geoql: missing operand for %s", KeywordString(op)))
+	}
+	return Operand{Expr: binary(op, o.Expr, r)}
+}
+
+// binary creates a BinaryExpr and wraps operands in parentheses
+// where it is required to keep the precedence when the tree is printed.
+func binary(op Token, left, right Expr) *BinaryExpr {
+	return &BinaryExpr{
+		Op:    op,
+		Left:  parenthesize(left, op, false),
+		Right: parenthesize(right, op, true),
+	}
+}
+
+func parenthesize(expr Expr, op Token, right bool) Expr {
+	if node, ok := expr.(*UnaryExpr); ok {
+		if node.Op.Precedence() < op.Precedence() {
+			return &ParenExpr{Expr: expr}
+		}
+		return expr
+	}
+	node, ok := expr.(*BinaryExpr)
+	if !ok {
+		return expr
+	}
+	p, q := node.Op.Precedence(), op.Precedence()
+	if p > q || (p == q && !right) {
+		return expr
+	}
+	if p == q && node.Op == op && (op == AND || op == OR || op == XOR) {
+		return expr
+	}
+	return &ParenExpr{Expr: expr}
+}
+
+func (o Operand) And(right Expr) Operand           { return o.binary(AND, right) }
+func (o Operand) Or(right Expr) Operand            { return o.binary(OR, right) }
+func (o Operand) Xor(right Expr) Operand           { return o.binary(XOR, right) }
+func (o Operand) Eq(right Expr) Operand            { return o.binary(LEQL, right) }
+func (o Operand) NotEq(right Expr) Operand         { return o.binary(LNEQ, right) }
+func (o Operand) Gt(right Expr) Operand            { return o.binary(GTR, right) }
+func (o Operand) Gte(right Expr) Operand           { return o.binary(GEQ, right) }
+func (o Operand) Lt(right Expr) Operand            { return o.binary(LSS, right) }
+func (o Operand) Lte(right Expr) Operand           { return o.binary(LEQ, right) }
+func (o Operand) In(right Expr) Operand            { return o.binary(IN, right) }
+func (o Operand) NotIn(right Expr) Operand         { return o.binary(NOT_IN, right) }
+func (o Operand) Intersects(right Expr) Operand    { return o.binary(INTERSECTS, right) }
+func (o Operand) NotIntersects(right Expr) Operand { return o.binary(NOT_INTERSECTS, right) }
+func (o Operand) Enters(right Expr) Operand        { return o.binary(ENTERS, right) }
+func (o Operand) Exits(right Expr) Operand         { return o.binary(EXITS, right) }
+func (o Operand) Nearby(right Expr) Operand        { return o.binary(NEARBY, right) }
+func (o Operand) NotNearby(right Expr) Operand     { return o.binary(NOT_NEARBY, right) }
+func (o Operand) Add(right Expr) Operand           { return o.binary(ADD, right) }
+func (o Operand) Sub(right Expr) Operand           { return o.binary(SUB, right) }
+func (o Operand) Mul(right Expr) Operand           { return o.binary(MUL, right) }
+func (o Operand) Quo(right Expr) Operand           { return o.binary(QUO, right) }
+func (o Operand) Rem(right Expr) Operand           { return o.binary(REM, right) }
+
+// Not negates the expression.
+func Not(x Expr) Operand {
+	expr, err := unwrap(x)
+	if err != nil {
+		return failed(err)
+	}
+	if expr == nil {
+		return failed(fmt.Errorf("geoql: missing operand for %s", KeywordString(NOT)))
+	}
+	return Operand{Expr: &UnaryExpr{Op: NOT, X: parenthesize(expr, NOT, true)}}
+}
+
+// Group wraps the expression in parentheses.
+func Group(expr Expr) Operand {
+	x, err := unwrap(expr)
+	if err != nil {
+		return failed(err)
+	}
+	return Operand{Expr: &ParenExpr{Expr: x}}
+}
+
+// Sel creates a selector. Without device ids the selector refers to the current device.
+func Sel(ident string, devices ...string) Operand {
+	if len(ident) == 0 {
+		return failed(errors.New("geoql: empty selector name"))
+	}
+	if err := checkName("selector", ident); err != nil {
+		return failed(err)
+	}
+	selector := &Selector{Ident: ident, Wildcard: len(devices) == 0}
+	for _, id := range devices {
+		if err := checkText(id); err != nil {
+			return failed(err)
+		}
+		if selector.Args == nil {
+			selector.Args = make(map[string]struct{})
+		}
+		selector.Args[id] = struct{}{}
+	}
+	return Operand{Expr: selector}
+}
+
+// WithProps sets the selector properties, e.g. tracker_coords:1km.
+func (o Operand) WithProps(props ...Expr) Operand {
+	if o.err != nil {
+		return o
+	}
+	selector, ok := o.selector()
+	if !ok {
+		return failed(fmt.Errorf("geoql: properties can only be set on a selector, got %T", o.Expr))
+	}
+	for _, prop := range props {
+		p, err := unwrap(prop)
+		if err != nil {
+			return failed(err)
+		}
+		selector.Props = append(selector.Props, p)
+	}
+	return Operand{Expr: selector}
+}
+
+// selector returns a copy of the selector of the operand, so that operands
+// built from the same selector do not change each other.
+func (o Operand) selector() (*Selector, bool) {
+	selector, ok := o.Expr.(*Selector)
+	if !ok {
+		return nil, false
+	}
+	clone := *selector
+	clone.Args = copySet(selector.Args)
+	clone.Groups = copySet(selector.Groups)
+	clone.Tags = copySet(selector.Tags)
+	clone.Props = append([]Expr(nil), selector.Props...)
+	return &clone, true
+}
+
+func copySet(m map[string]struct{}) map[string]struct{} {
+	if m == nil {
+		return nil
+	}
+	clone := make(map[string]struct{}, len(m))
+	for k := range m {
+		clone[k] = struct{}{}
+	}
+	return clone
+}
+
+// Call creates a call of a built-in or registered function.
+func Call(name string, args ...Expr) Operand {
+	if len(name) == 0 {
+		return failed(errors.New("geoql: empty function name"))
+	}
+	call := &CallExpr{Func: strings.ToLower(name)}
+	if isWindowFunc(call.Func) || isHistoryFunc(call.Func) {
+		return failed(fmt.Errorf("geoql: %s has its own builder", call.Func))
+	}
+	for _, arg := range args {
+		a, err := unwrap(arg)
+		if err != nil {
+			return failed(err)
+		}
+		if a == nil {
+			return failed(fmt.Errorf("geoql: missing argument of %s", call.Func))
+		}
+		call.Args = append(call.Args, a)
+	}
+	return Operand{Expr: call}
+}
+
+// Avg, Min, Max, Sum and Count aggregate the operand over the window of the last d.
+func Avg(x Expr, d time.Duration) Operand   { return window("avg", x, d) }
+func Min(x Expr, d time.Duration) Operand   { return window("min", x, d) }
+func Max(x Expr, d time.Duration) Operand   { return window("max", x, d) }
+func Sum(x Expr, d time.Duration) Operand   { return window("sum", x, d) }
+func Count(x Expr, d time.Duration) Operand { return window("count", x, d) }
+
+func window(fn string, x Expr, d time.Duration) Operand {
+	expr, err := unwrap(x)
+	if err != nil {
+		return failed(err)
+	}
+	if expr == nil {
+		return failed(fmt.Errorf("geoql: missing operand of %s", fn))
+	}
+	if d <= 0 {
+		return failed(fmt.Errorf("geoql: invalid window %s: %s, expected positive duration", fn, d))
+	}
+	return Operand{Expr: &WindowExpr{Func: fn, X: unparen(expr), Window: &DurationTyp{Val: d}}}
+}
+
+// For requires the condition to hold for at least d, e.g. tracker_temp > 8C for 10m.
+func (o Operand) For(d time.Duration) Operand {
+	if d < 0 {
+		return failed(errNegativeValue)
+	}
+	return o.binary(FOR, &DurationTyp{Val: d})
+}
+
+// DwellsIn requires the operand to stay inside the geometry for at least d.
+func (o Operand) DwellsIn(right Expr, d time.Duration) Operand {
+	return o.binary(DWELLS, right).For(d)
+}
+
+// Prev, Changed and Delta refer to the previous sample of the selector.
+func Prev(selector Expr) Operand    { return history("prev", selector, nil, 0) }
+func Changed(selector Expr) Operand { return history("changed", selector, nil, 0) }
+func Delta(selector Expr) Operand   { return history("delta", selector, nil, 0) }
+
+// Rising and Falling require the selector to grow or drop by at least the amount within d.
+func Rising(selector, amount Expr, d time.Duration) Operand {
+	return history("rising", selector, amount, d)
+}
+
+func Falling(selector, amount Expr, d time.Duration) Operand {
+	return history("falling", selector, amount, d)
+}
+
+func history(fn string, selector, amount Expr, d time.Duration) Operand {
+	x, err := unwrap(selector)
+	if err != nil {
+		return failed(err)
+	}
+	sel, ok := x.(*Selector)
+	if !ok {
+		return failed(fmt.Errorf("geoql: %s requires a selector, got %T", fn, x))
+	}
+	expr := &HistoryExpr{Func: fn, X: sel}
+	if amount != nil {
+		if expr.Amount, err = unwrap(amount); err != nil {
+			return failed(err)
+		}
+		if d <= 0 {
+			return failed(fmt.Errorf("geoql: invalid %s: %s, expected positive duration", fn, d))
+		}
+		expr.Within = &DurationTyp{Val: d}
+	}
+	return Operand{Expr: expr}
+}
+
+// InGroup adds device groups to the selector, e.g. tracker_speed{group:"north-fleet"}.
+func (o Operand) InGroup(groups ...string) Operand {
+	return o.filter(groups, func(s *Selector) *map[string]struct{} { return &s.Groups })
+}
+
+// WithTag adds device tags to the selector, e.g. tracker_speed{tag:"refrigerated"}.
+func (o Operand) WithTag(tags ...string) Operand {
+	return o.filter(tags, func(s *Selector) *map[string]struct{} { return &s.Tags })
+}
+
+func (o Operand) filter(names []string, set func(s *Selector) *map[string]struct{}) Operand {
+	if o.err != nil {
+		return o
+	}
+	selector, ok := o.selector()
+	if !ok {
+		return failed(fmt.Errorf("geoql: groups and tags can only be set on a selector, got %T", o.Expr))
+	}
+	if len(selector.Args) == 0 {
+		selector.Wildcard = false
+	}
+	m := set(selector)
+	for _, name := range names {
+		if err := checkText(name); err != nil {
+			return failed(err)
+		}
+		if *m == nil {
+			*m = make(map[string]struct{})
+		}
+		(*m)[name] = struct{}{}
+	}
+	return Operand{Expr: selector}
+}
+
+// Any and All quantify a selector of several devices.
+func (o Operand) Any() Operand { return o.quantify(ANY) }
+func (o Operand) All() Operand { return o.quantify(ALL) }
+
+func (o Operand) quantify(quant Token) Operand {
+	if o.err != nil {
+		return o
+	}
+	selector, ok := o.selector()
+	if !ok || !selector.multi() {
+		return failed(fmt.Errorf("geoql: %s requires a selector of device ids, groups or tags", KeywordString(quant)))
+	}
+	selector.Quantifier = quant
+	return Operand{Expr: selector}
+}
+
+// Var creates a reference to a variable declared with TriggerBuilder.Set.
+func Var(name string) Operand {
+	if err := checkName("variable", name); err != nil {
+		return failed(err)
+	}
+	return Operand{Expr: &Ref{ID: name}}
+}
+
+// checkName reports an error if name is not scanned as a single selector,
+// e.g. a keyword or a name that starts with a digit.
+func checkName(kind, name string) error {
+	if tok, ok := scanToken(name); !ok || tok != SELECTOR {
+		return fmt.Errorf("geoql: invalid %s name %q", kind, name)
+	}
+	return nil
+}
+
+// checkText reports an error if v cannot be written between double quotes,
+// quotes and backslashes must be escaped as in the query.
+func checkText(v string) error {
+	if tok, ok := scanToken(`"` + v + `"`); !ok || tok != STRING {
+		return fmt.Errorf("geoql: invalid string %q: unescaped quote, backslash or newline", v)
+	}
+	return nil
+}
+
+// scanToken returns the token of text if text is exactly one token.
+func scanToken(text string) (Token, bool) {
+	t := newTokenizer(strings.NewReader(text), 0)
+	tok, lit := t.Scan()
+	if lit != strings.ToLower(text) {
+		return tok, false
+	}
+	if next, _ := t.Scan(); next != EOF || t.Err() != nil {
+		return tok, false
+	}
+	return tok, true
+}
+
+func Wildcard() Operand                  { return Operand{Expr: &WildcardTyp{}} }
+func Integer(v int) Operand              { return Operand{Expr: &IntTyp{Val: v}} }
+func Number(v float64) Operand           { return valid(&FloatTyp{Val: v}, checkFinite(v)) }
+func Text(v string) Operand              { return valid(&StringTyp{Val: v}, checkText(v)) }
+func Bool(v bool) Operand                { return Operand{Expr: &BooleanTyp{Val: v}} }
+func Duration(v time.Duration) Operand   { return nonNegative(&DurationTyp{Val: v}, v < 0) }
+func Pct(v float64) Operand              { return valid(&PercentTyp{Val: v}, checkFinite(v)) }
+func Pressure(v float64, u Unit) Operand { return measure(&PressureTyp{Val: v, U: u}, v, u, Bar, Psi) }
+func Speed(v float64, u Unit) Operand    { return measure(&SpeedTyp{Val: v, U: u}, v, u, Kph, Mph) }
+func Distance(v float64, u Unit) Operand {
+	return measure(&DistanceTyp{Val: v, U: u}, v, u, Kilometer, Meter)
+}
+func Weekday(d time.Weekday) Operand {
+	if d < time.Sunday || d > time.Saturday {
+		return failed(fmt.Errorf("geoql: invalid weekday %d, expected 0-6", d))
+	}
+	return Operand{Expr: &WeekdayTyp{Val: int(d)}}
+}
+func Month(m time.Month) Operand {
+	if m < time.January || m > time.December {
+		return failed(fmt.Errorf("geoql: invalid month %d, expected 1-12", m))
+	}
+	return Operand{Expr: &MonthTyp{Val: int(m)}}
+}
+func Date(y int, m time.Month, d int) Operand {
+	if err := checkDate(y, int(m), d); err != nil {
+		return failed(fmt.Errorf("geoql: %w", err))
+	}
+	return Operand{Expr: &DateTyp{Year: y, Month: int(m), Day: d}}
+}
+
+// Cell creates a cell literal of the H3, GEOHASH or S2 grid, e.g. Cell(H3, "8928308280fffff").
+func Cell(kind Token, id string) Operand {
+	cell, err := newCell(kind, id)
+	if err != nil {
+		return failed(fmt.Errorf("geoql: %w", err))
+	}
+	return Operand{Expr: cell}
+}
+
+// TimeOfDay creates a time literal. Pass AM or PM to use the 12-hour clock.
+func TimeOfDay(h, m, s int, u ...Unit) Operand {
+	typ := &TimeTyp{Hours: h, Minutes: m, Seconds: s}
+	if err := checkTime(h, m, s); err != nil {
+		return failed(fmt.Errorf("geoql: %w", err))
+	}
+	if len(u) > 0 {
+		typ.U = u[0]
+		return unit(typ, typ.U, AM, PM)
+	}
+	return Operand{Expr: typ}
+}
+
+func Temperature(v float64, u Unit) Operand {
+	if err := checkFinite(v); err != nil {
+		return failed(err)
+	}
+	typ := &TemperatureTyp{Val: v, U: u}
+	if v < 0 {
+		typ.Val = -v
+		typ.Vec = Minus
+	}
+	return unit(typ, u, Celsius, Fahrenheit)
+}
+
+func valid(expr Expr, err error) Operand {
+	if err != nil {
+		return failed(err)
+	}
+	return Operand{Expr: expr}
+}
+
+func checkFinite(v float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("geoql: invalid number %v", v)
+	}
+	return nil
+}
+
+func nonNegative(expr Expr, negative bool) Operand {
+	if negative {
+		return failed(errNegativeValue)
+	}
+	return Operand{Expr: expr}
+}
+
+func measure(expr Expr, v float64, u Unit, units ...Unit) Operand {
+	if err := checkFinite(v); err != nil {
+		return failed(err)
+	}
+	if v < 0 {
+		return failed(errNegativeValue)
+	}
+	return unit(expr, u, units...)
+}
+
+func unit(expr Expr, u Unit, units ...Unit) Operand {
+	for i := 0; i < len(units); i++ {
+		if units[i] == u {
+			return Operand{Expr: expr}
+		}
+	}
+	return failed(fmt.Errorf("geoql: unexpected unit %s for %T", u, expr))
+}
+
+// Point creates a point from longitude and latitude.
+func Point(lon, lat float64) Operand {
+	return Operand{Expr: &GeometryPointTyp{Val: [2]float64{lon, lat}}}
+}
+
+// Circle creates a point with a radius.
+func Circle(lon, lat float64, radius Expr) Operand {
+	dist, err := distanceOf(radius)
+	if err != nil {
+		return failed(err)
+	}
+	return Operand{Expr: &GeometryPointTyp{Val: [2]float64{lon, lat}, Radius: dist}}
+}
+
+// Line creates a line. Use WithMargin to set a margin.
+func Line(points ...[2]float64) Operand {
+	if len(points) < 2 {
+		return failed(errors.New("geoql: line requires at least two points"))
+	}
+	return Operand{Expr: &GeometryLineTyp{Val: points}}
+}
+
+// WithMargin returns a copy of the line with the margin.
+func (o Operand) WithMargin(margin Expr) Operand {
+	if o.err != nil {
+		return o
+	}
+	line, ok := o.Expr.(*GeometryLineTyp)
+	if !ok {
+		return failed(fmt.Errorf("geoql: margin can only be set on a line, got %T", o.Expr))
+	}
+	dist, err := distanceOf(margin)
+	if err != nil {
+		return failed(err)
+	}
+	clone := *line
+	clone.Margin = dist
+	o.Expr = &clone
+	return o
+}
+
+// Polygon creates a polygon. Rings after the first one describe holes.
+func Polygon(rings ...[][2]float64) Operand {
+	if len(rings) == 0 {
+		return failed(errors.New("geoql: polygon requires at least one ring"))
+	}
+	return Operand{Expr: &GeometryPolygonTyp{Val: rings}}
+}
+
+func MultiPoint(objects ...Expr) Operand   { return multi(GEOMETRY_MULTIPOINT, objects) }
+func MultiLine(objects ...Expr) Operand    { return multi(GEOMETRY_MULTILINE, objects) }
+func MultiPolygon(objects ...Expr) Operand { return multi(GEOMETRY_MULTIPOLYGON, objects) }
+
+func multi(kind Token, objects []Expr) Operand {
+	if len(objects) == 0 {
+		return failed(errors.New("geoql: empty multi geometry"))
+	}
+	typ := &GeometryMultiObjectTyp{Kind: kind, Val: make([]Expr, 0, len(objects))}
+	for _, object := range objects {
+		expr, err := unwrap(object)
+		if err != nil {
+			return failed(err)
+		}
+		var ok bool
+		switch expr.(type) {
+		case *GeometryPointTyp:
+			ok = kind == GEOMETRY_MULTIPOINT
+		case *GeometryLineTyp:
+			ok = kind == GEOMETRY_MULTILINE
+		case *GeometryPolygonTyp:
+			ok = kind == GEOMETRY_MULTIPOLYGON
+		}
+		if !ok {
+			return failed(fmt.Errorf("geoql: unexpected %T in %s", expr, KeywordString(kind)))
+		}
+		typ.Val = append(typ.Val, expr)
+	}
+	return Operand{Expr: typ}
+}
+
+// Collection creates a collection of geometries.
+func Collection(objects ...Expr) Operand {
+	if len(objects) == 0 {
+		return failed(errors.New("geoql: empty collection"))
+	}
+	typ := &GeometryCollectionTyp{Objects: make([]Expr, 0, len(objects))}
+	for _, object := range objects {
+		expr, err := unwrap(object)
+		if err != nil {
+			return failed(err)
+		}
+		switch expr.(type) {
+		case *GeometryPointTyp, *GeometryLineTyp, *GeometryPolygonTyp, *GeometryMultiObjectTyp:
+		default:
+			return failed(fmt.Errorf("geoql: unexpected %T in collection", expr))
+		}
+		typ.Objects = append(typ.Objects, expr)
+	}
+	return Operand{Expr: typ}
+}
+
+// Between creates a range low .. high.
+func Between(low, high Expr) Operand {
+	l, err := unwrap(low)
+	if err != nil {
+		return failed(err)
+	}
+	h, err := unwrap(high)
+	if err != nil {
+		return failed(err)
+	}
+	if l == nil || h == nil {
+		return failed(errors.New("geoql: range requires both bounds"))
+	}
+	for _, bound := range []Expr{l, h} {
+		switch bound.(type) {
+		case *BinaryExpr, *ParenExpr, *Range, *ArrayTyp:
+			return failed(fmt.Errorf("geoql: unexpected range bound %T", bound))
+		}
+	}
+	return Operand{Expr: &Range{Low: l, High: h}}
+}
+
+// Array creates an array. All items must be of the same kind.
+func Array(items ...Expr) Operand {
+	if len(items) == 0 {
+		return failed(errors.New("geoql: empty array"))
+	}
+	array := &ArrayTyp{Kind: ILLEGAL, List: make([]Expr, 0, len(items))}
+	for _, item := range items {
+		expr, err := unwrap(item)
+		if err != nil {
+			return failed(err)
+		}
+		kind := arrayKind(expr)
+		if kind == ILLEGAL {
+			return failed(fmt.Errorf("geoql: unexpected array item %T", expr))
+		}
+		if array.Kind != ILLEGAL && array.Kind != kind {
+			return failed(fmt.Errorf("geoql: mixed array of %s and %s",
+				KeywordString(array.Kind), KeywordString(kind)))
+		}
+		array.Kind = kind
+		array.List = append(array.List, expr)
+	}
+	return Operand{Expr: array}
+}
+
+func arrayKind(expr Expr) (kind Token) {
+	switch typ := expr.(type) {
+	case *Selector:
+		kind = SELECTOR
+	case *DurationTyp:
+		kind = DURATION
+	case *SpeedTyp:
+		kind = SPEED
+	case *PressureTyp:
+		kind = PRESSURE
+	case *TemperatureTyp:
+		kind = TEMPERATURE
+	case *DistanceTyp:
+		kind = DISTANCE
+	case *PercentTyp:
+		kind = PERCENT
+	case *IntTyp:
+		kind = INT
+	case *FloatTyp:
+		kind = FLOAT
+	case *StringTyp:
+		kind = STRING
+	case *Ref:
+		kind = IDENT
+	case *Range:
+		kind = RANGE
+	case *DateTyp:
+		kind = DATE
+	case *TimeTyp:
+		kind = TIME
+	case *WeekdayTyp:
+		kind = WEEKDAY
+	case *MonthTyp:
+		kind = MONTH
+	case *CellTyp:
+		kind = typ.Kind
+	}
+	return
+}
+
+func distanceOf(expr Expr) (*DistanceTyp, error) {
+	x, err := unwrap(expr)
+	if err != nil {
+		return nil, err
+	}
+	dist, ok := x.(*DistanceTyp)
+	if !ok {
+		return nil, fmt.Errorf("geoql: expected distance, got %T", x)
+	}
+	return dist, nil
+}
@@ -0,0 +1,265 @@
+package geoqlparser
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuilder(t *testing.T) {
+	dict := Dict()
+	dict["tracker_speed"] = Float
+	dict["tracker_model"] = String
+	dict["tracker_index"] = Int
+	dict["tracker_coords"] = ArrayFloat
+
+	testCases := []struct {
+		name    string
+		builder *TriggerBuilder
+		want    string
+	}{
+		{
+			name: "speed in range",
+			builder: When(Sel("tracker_speed").In(Between(Speed(10, Kph), Speed(40, Kph)))).
+				Repeat(3, 10*time.Second),
+			want: "tracker_speed in 10Kph .. 40Kph",
+		},
+		{
+			name: "precedence is kept",
+			builder: When(Sel("tracker_model").Eq(Text("ER54x3")).
+				And(Sel("tracker_index").Gt(Integer(1)).Or(Sel("tracker_index").Lt(Integer(-1))))).
+				ResetAfter(time.Hour),
+			want: "tracker_model == \"ER54x3\" \n\tand (\n\t\ttracker_index > 1 \n\t\tor tracker_index < -1\n\t)",
+		},
+		{
+			name: "arithmetic",
+			builder: When(Sel("tracker_index").Sub(Integer(1).Sub(Integer(2))).Mul(Integer(3)).
+				Gte(Var("limit"))).
+				Set("limit", Integer(100)),
+			want: "(tracker_index-(1-2))*3 >= @limit",
+		},
+		{
+			name: "variables",
+			builder: When(Sel("tracker_speed").Intersects(Var("place")).And(Sel("tracker_index").In(Var("index")))).
+				Set("speeds", Array(Between(Speed(1, Kph), Speed(2, Kph)), Between(Speed(3, Mph), Speed(4, Mph)))).
+				Set("index", Array(Integer(1), Integer(2), Integer(3))).
+				Set("place", Collection(Circle(1.1, 2.2, Distance(1, Kilometer)), Line([2]float64{1, 1}, [2]float64{2, 2}).WithMargin(Distance(5, Meter)))),
+			want: "tracker_speed intersects @place \n\tand tracker_index in @index",
+		},
+		{
+			name:    "function call",
+			builder: When(Call("ABS", Sel("tracker_speed").Sub(Number(1.5))).Gt(Call("sqrt", Integer(4)))),
+			want:    "abs(tracker_speed-1.5) > sqrt(4)",
+		},
+		{
+			name: "window",
+			builder: When(Avg(Sel("tracker_speed"), 5*time.Minute).Gt(Speed(80, Kph)).
+				And(Sel("tracker_speed").Gt(Speed(1, Kph)).Or(Sel("tracker_index").Gt(Integer(1))).For(time.Minute))),
+			want: "avg(tracker_speed, 5m0s) > 80Kph \n\tand (\n\t\ttracker_speed > 1Kph \n\t\tor tracker_index > 1\n\t) for 1m0s",
+		},
+		{
+			name: "geofence",
+			builder: When(Sel("tracker_coords").Enters(Var("w")).Or(Sel("tracker_coords").DwellsIn(Var("w"), time.Hour))).
+				Set("w", Point(1, 1)),
+			want: "tracker_coords enters @w \n\tor tracker_coords dwells in @w for 1h0m0s",
+		},
+		{
+			name: "history",
+			builder: When(Delta(Sel("tracker_speed")).Lt(Pct(-10)).
+				Or(Rising(Sel("tracker_speed"), Speed(20, Kph), 5*time.Minute))),
+			want: "delta(tracker_speed) < -10% \n\tor rising(tracker_speed, 20Kph, 5m0s)",
+		},
+		{
+			name:    "groups and tags",
+			builder: When(Sel("tracker_speed").InGroup("north-fleet").WithTag("van").Any().Gt(Speed(80, Kph))),
+			want:    `any tracker_speed{group:"north-fleet", tag:"van"} > 80Kph`,
+		},
+		{
+			name:    "cells",
+			builder: When(Sel("tracker_coords").In(Array(Cell(GEOHASH, "u4pr"), Cell(GEOHASH, "U4PS")))),
+			want:    `tracker_coords in geohash["u4pr", "u4ps"]`,
+		},
+		{
+			name: "not and xor",
+			builder: When(Not(Sel("tracker_speed").Gt(Number(1)).And(Sel("tracker_index").Lt(Integer(2)))).
+				Xor(Not(Sel("tracker_model").Eq(Text("a"))))),
+			want: "\tnot (\n\t\ttracker_speed > 1.0 \n\t\tand tracker_index < 2\n\t) \n\txor not tracker_model == \"a\"",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			trigger, err := tc.builder.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := bytes.NewBuffer(nil)
+			if err = Format(buf, trigger); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(buf.String(), tc.want) {
+				t.Fatalf("have %q, want %q", buf.String(), tc.want)
+			}
+			stmt, err := Parse(buf.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = CheckType(trigger, dict); err != nil {
+				t.Fatal(err)
+			}
+			if err = CheckType(stmt, dict); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		builder *TriggerBuilder
+	}{
+		{name: "nil condition", builder: When(nil)},
+		{name: "nil not", builder: When(Not(nil))},
+		{name: "negative speed", builder: When(Sel("s").Gt(Speed(-1, Kph)))},
+		{name: "wrong unit", builder: When(Sel("s").Gt(Speed(1, Celsius)))},
+		{name: "negative pressure", builder: When(Sel("s").Gt(Pressure(-1, Bar)))},
+		{name: "mixed array", builder: When(Sel("s").In(Array(Integer(1), Text("a"))))},
+		{name: "empty selector", builder: When(Sel("").Gt(Integer(1)))},
+		{name: "props on literal", builder: When(Integer(1).WithProps(Integer(1)))},
+		{name: "duplicate variable", builder: When(Var("a")).Set("a", Integer(1)).Set("a", Integer(2))},
+		{name: "variable refers to variable", builder: When(Var("a")).Set("a", Var("b"))},
+		{name: "negative repeat", builder: When(Var("a")).Repeat(-1, 0)},
+		{name: "invalid multi geometry", builder: When(Sel("s").Intersects(MultiPoint(Line([2]float64{1, 1}, [2]float64{2, 2}))))},
+		{name: "quantifier on current device", builder: When(Sel("s").All().Gt(Integer(1)))},
+		{name: "invalid cell", builder: When(Sel("s").In(Cell(H3, "8928308280ffff7")))},
+		{name: "binary range bound", builder: When(Sel("s").In(Between(Integer(1).Add(Integer(1)), Integer(3))))},
+		{name: "month out of range", builder: When(Sel("s").Eq(Month(13)))},
+		{name: "weekday out of range", builder: When(Sel("s").Eq(Weekday(7)))},
+		{name: "hour out of range", builder: When(Sel("s").Eq(TimeOfDay(25, 0, 0)))},
+		{name: "time with a unit of speed", builder: When(Sel("s").Eq(TimeOfDay(1, 0, 0, Kph)))},
+		{name: "year out of range", builder: When(Sel("s").Eq(Date(2020, 1, 1)))},
+		{name: "quote in text", builder: When(Sel("s").Eq(Text("a\"b")))},
+		{name: "backslash at the end of text", builder: When(Sel("s").Eq(Text(`a\`)))},
+		{name: "newline in text", builder: When(Sel("s").Eq(Text("a\nb")))},
+		{name: "keyword selector", builder: When(Sel("and").Gt(Integer(1)))},
+		{name: "selector starts with digit", builder: When(Sel("1abc").Gt(Integer(1)))},
+		{name: "quote in device id", builder: When(Sel("s", `a"b`).Any().Gt(Integer(1)))},
+		{name: "quote in group", builder: When(Sel("s").InGroup(`a"b`).Any().Gt(Integer(1)))},
+		{name: "keyword variable", builder: When(Var("when"))},
+		{name: "keyword variable in set", builder: When(Sel("s").Gt(Integer(1))).Set("set", Integer(1))},
+		{name: "not a number", builder: When(Sel("s").Gt(Number(math.NaN())))},
+		{name: "infinite speed", builder: When(Sel("s").Gt(Speed(math.Inf(1), Kph)))},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := tc.builder.Build(); err == nil {
+				t.Fatalf("%s: got nil, expected error", tc.name)
+			}
+		})
+	}
+}
+
+func TestBuilderLiterals(t *testing.T) {
+	testCases := []struct {
+		name string
+		expr Expr
+		want string
+	}{
+		{name: "wildcard", expr: Wildcard(), want: "*"},
+		{name: "integer", expr: Integer(-3), want: "-3"},
+		{name: "number", expr: Number(3), want: "3.0"},
+		{name: "text", expr: Text(`a \"b\" \\ c`), want: `"a \"b\" \\ c"`},
+		{name: "bool", expr: Bool(true), want: "true"},
+		{name: "duration", expr: Duration(90 * time.Second), want: "1m30s"},
+		{name: "percent", expr: Pct(-10), want: "-10%"},
+		{name: "pressure", expr: Pressure(2.5, Bar), want: "2.5Bar"},
+		{name: "speed", expr: Speed(40, Mph), want: "40Mph"},
+		{name: "distance", expr: Distance(1, Kilometer), want: "1Km"},
+		{name: "temperature", expr: Temperature(-5, Celsius), want: "-5C"},
+		{name: "weekday", expr: Weekday(time.Saturday), want: "weekday[Sat]"},
+		{name: "month", expr: Month(time.December), want: "month[Dec]"},
+		{name: "date", expr: Date(2030, time.October, 2), want: "date[2030-10-02]"},
+		{name: "time", expr: TimeOfDay(9, 5, 0), want: "time[09:05]"},
+		{name: "time of the 12-hour clock", expr: TimeOfDay(5, 30, 0, PM), want: "time[5:30PM]"},
+		{name: "cell", expr: Cell(GEOHASH, "u4pr"), want: `geohash["u4pr"]`},
+		{name: "selector", expr: Sel("tracker_x", "a"), want: `tracker_x{"a"}`},
+		{name: "selector with groups", expr: Sel("tracker_x").InGroup("north").Any(), want: `any tracker_x{group:"north"}`},
+		{name: "selector with props", expr: Sel("tracker_x").WithProps(Distance(1, Meter)), want: "tracker_x:1M"},
+		{name: "point", expr: Point(1.5, 2), want: "point[1.5, 2]"},
+		{name: "circle", expr: Circle(1, 2, Distance(5, Meter)), want: "point[1, 2]:5M"},
+		{name: "line", expr: Line([2]float64{1, 1}, [2]float64{2, 2}).WithMargin(Distance(1, Meter)), want: "line[[1, 1], [2, 2]]:1M"},
+		{name: "polygon", expr: Polygon([][2]float64{{1, 1}, {2, 1}, {2, 2}, {1, 1}}), want: "polygon[[[1, 1], [2, 1], [2, 2], [1, 1]]]"},
+		{name: "multi point", expr: MultiPoint(Point(1, 1), Point(2, 2)), want: "multipoint[point[1, 1], point[2, 2]]"},
+		{name: "collection", expr: Collection(Point(1, 1)), want: "collection[point[1, 1]]"},
+		{name: "range", expr: Between(Integer(1), Integer(2)), want: "1 .. 2"},
+		{name: "array", expr: Array(Text("a"), Text("b")), want: `["a", "b"]`},
+		{name: "call", expr: Call("abs", Integer(1)), want: "abs(1)"},
+		{name: "window", expr: Avg(Sel("tracker_x"), time.Minute), want: "avg(tracker_x, 1m0s)"},
+		{name: "history", expr: Rising(Sel("tracker_x"), Integer(1), time.Minute), want: "rising(tracker_x, 1, 1m0s)"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			trigger, err := When(Sel("tracker_y").Eq(tc.expr)).Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := bytes.NewBuffer(nil)
+			if err = Format(buf, trigger); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(buf.String(), tc.want) {
+				t.Fatalf("have %q, want %q", buf.String(), tc.want)
+			}
+			stmt, err := Parse(buf.String())
+			if err != nil {
+				t.Fatalf("%s: %v", buf.String(), err)
+			}
+			again := bytes.NewBuffer(nil)
+			if err = Format(again, stmt); err != nil {
+				t.Fatal(err)
+			}
+			if again.String() != buf.String() {
+				t.Fatalf("have %q, want %q", again.String(), buf.String())
+			}
+		})
+	}
+}
+
+func TestBuilderSelectorIsCopied(t *testing.T) {
+	speed := Sel("tracker_speed", "a", "b")
+	any := speed.Any().WithProps(Distance(1, Meter))
+	all := speed.All().InGroup("north")
+	trigger, err := When(any.Gt(Integer(1)).And(all.Gt(Integer(2))).Or(speed.Gt(Integer(3)))).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.NewBuffer(nil)
+	if err = FormatWithOptions(buf, trigger, FormatOptions{Compact: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := `TRIGGER WHEN any tracker_speed{"a", "b"}:1M > 1 and all tracker_speed{"a", "b", group:"north"} > 2 or tracker_speed{"a", "b"} > 3`
+	if buf.String() != want {
+		t.Fatalf("have %q, want %q", buf.String(), want)
+	}
+}
+
+func TestBuilderLineIsCopied(t *testing.T) {
+	route := Line([2]float64{1, 1}, [2]float64{2, 2})
+	near := route.WithMargin(Distance(1, Meter))
+	far := route.WithMargin(Distance(2, Kilometer))
+	coords := Sel("tracker_coords")
+	trigger, err := When(coords.Intersects(near).Or(coords.Intersects(far)).Or(coords.Intersects(route))).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.NewBuffer(nil)
+	if err = FormatWithOptions(buf, trigger, FormatOptions{Compact: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := `TRIGGER WHEN tracker_coords intersects line[[1, 1], [2, 2]]:1M or tracker_coords intersects line[[1, 1], [2, 2]]:2Km or tracker_coords intersects line[[1, 1], [2, 2]]`
+	if buf.String() != want {
+		t.Fatalf("have %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,232 @@
+package geoqlparser
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// fingerprintVersion prefixes the hashed canonical form. It must be changed
+// whenever the canonical form changes, so that fingerprints stay stable
+// across library versions for the same version prefix.
+//
+// v2: floats are written with a fraction, 1.0 is no longer written as 1,
+// and rem is written with spaces around it.
+const fingerprintVersion = "geoql-fingerprint-v2\n"
+
+// fingerprintFormat is pinned so that changes of the default format
+// options do not change fingerprints.
+var fingerprintFormat = FormatOptions{Indent: "\t"}
+
+// Canonicalize rewrites the trigger in place into a canonical form:
+//   - eq and not eq become == and !=;
+//   - operands of and/or/xor chains are sorted;
+//   - double negations are removed;
+//   - comparisons are written with the selector on the left;
+//   - items of arrays on the right side of in and not in are sorted;
+//   - speed, distance, temperature and pressure are converted to Kph, M, C and Bar,
+//     amounts of change are converted without the temperature offset;
+//   - redundant parentheses are removed;
+//   - variables are sorted by name;
+//   - comments are removed.
+func Canonicalize(t *Trigger) {
+	if t == nil {
+		return
+	}
+	t.Doc, t.SetDoc, t.WhenDoc, t.WhenComment = nil, nil, nil, nil
+	t.RepeatDoc, t.RepeatComment, t.ResetDoc, t.ResetComment, t.Comment = nil, nil, nil, nil, nil
+	for _, assign := range t.Vars {
+		assign.Doc, assign.Comment = nil, nil
+		assign.Right = canonical(assign.Right)
+	}
+	sort.SliceStable(t.Vars, func(i, j int) bool {
+		return t.Vars[i].Left.Val < t.Vars[j].Left.Val
+	})
+	if t.When != nil {
+		t.When = unparen(canonical(t.When))
+	}
+}
+
+// Fingerprint returns the SHA-256 hash of the canonical form of the trigger.
+// Equivalent triggers that differ only in formatting, operator spelling,
+// operand order of and/or or units have the same fingerprint.
+// It fails if the trigger is nil or cannot be formatted.
+// The trigger is not modified.
+func Fingerprint(t *Trigger) (sum [32]byte, err error) {
+	if t == nil {
+		return sum, errors.New("geoql: nil trigger")
+	}
+	c := clone(t).(*Trigger)
+	Canonicalize(c)
+	buf := bytes.NewBufferString(fingerprintVersion)
+	if err = FormatWithOptions(buf, c, fingerprintFormat); err != nil {
+		return sum, fmt.Errorf("geoql: fingerprint: %w", err)
+	}
+	return sha256.Sum256(buf.Bytes()), nil
+}
+
+func canonical(expr Expr) Expr {
+	switch typ := expr.(type) {
+	case *ParenExpr:
+		inner := canonical(typ.Expr)
+		if !isOperator(inner) {
+			return inner
+		}
+		typ.Expr = inner
+		return typ
+	case *BinaryExpr:
+		return canonicalBinary(typ)
+	case *UnaryExpr:
+		typ.X = canonical(typ.X)
+		if x, ok := unparen(typ.X).(*UnaryExpr); ok && typ.Op == NOT && x.Op == NOT {
+			return x.X
+		}
+		typ.X = unparenOperand(typ.X, typ.Op, true)
+	case *CallExpr:
+		for i := 0; i < len(typ.Args); i++ {
+			typ.Args[i] = unparen(canonical(typ.Args[i]))
+		}
+	case *WindowExpr:
+		typ.X = unparen(canonical(typ.X))
+	case *HistoryExpr:
+		if typ.Amount != nil {
+			typ.Amount = unparen(canonicalDelta(typ.Amount))
+		}
+	case *Range:
+		typ.Low = canonical(typ.Low)
+		typ.High = canonical(typ.High)
+	case *ArrayTyp:
+		for i := 0; i < len(typ.List); i++ {
+			typ.List[i] = canonical(typ.List[i])
+		}
+	case *Selector:
+		for i := 0; i < len(typ.Props); i++ {
+			typ.Props[i] = canonical(typ.Props[i])
+		}
+	case *GeometryPointTyp:
+		if typ.Radius != nil {
+			canonical(typ.Radius)
+		}
+	case *GeometryLineTyp:
+		if typ.Margin != nil {
+			canonical(typ.Margin)
+		}
+	case *GeometryMultiObjectTyp:
+		for i := 0; i < len(typ.Val); i++ {
+			typ.Val[i] = canonical(typ.Val[i])
+		}
+	case *GeometryCollectionTyp:
+		for i := 0; i < len(typ.Objects); i++ {
+			typ.Objects[i] = canonical(typ.Objects[i])
+		}
+	case *SpeedTyp:
+		if typ.U == Mph {
+			typ.Val, typ.U = roundFloat(typ.Val*kphPerMph), Kph
+		}
+	case *DistanceTyp:
+		if typ.U == Kilometer {
+			typ.Val, typ.U = roundFloat(typ.Val*metersPerKm), Meter
+		}
+	case *PressureTyp:
+		if typ.U == Psi {
+			typ.Val, typ.U = roundFloat(typ.Val*barPerPsi), Bar
+		}
+	case *TemperatureTyp:
+		val, _, _ := baseValue(typ)
+		val = roundFloat(val)
+		typ.U, typ.Val, typ.Vec = Celsius, math.Abs(val), 0
+		if val < 0 {
+			typ.Vec = Minus
+		}
+	}
+	return expr
+}
+
+func canonicalBinary(e *BinaryExpr) Expr {
+	switch e.Op {
+	case AND, OR, XOR:
+		list := flatten(e.Op, e, nil)
+		keys := make(map[Expr]string, len(list))
+		for i := 0; i < len(list); i++ {
+			list[i] = unparen(canonical(list[i]))
+			keys[list[i]] = formatExpr(list[i])
+		}
+		sort.SliceStable(list, func(i, j int) bool {
+			return keys[list[i]] < keys[list[j]]
+		})
+		return rebuild(e.Op, list)
+	}
+	e.Comment = nil
+	switch e.Op {
+	case EQL:
+		e.Op = LEQL
+	case NOT_EQ:
+		e.Op = LNEQ
+	}
+	switch {
+	case isDelta(e.Left):
+		e.Right = canonicalDelta(e.Right)
+	case isDelta(e.Right):
+		e.Left = canonicalDelta(e.Left)
+	}
+	e.Left = canonical(e.Left)
+	e.Right = canonical(e.Right)
+	if _, ok := e.Right.(*Selector); ok && isLiteral(e.Left) {
+		if op, ok := flipComparison(e.Op); ok {
+			e.Op, e.Left, e.Right = op, e.Right, e.Left
+		}
+	}
+	if array, ok := e.Right.(*ArrayTyp); ok && (e.Op == IN || e.Op == NOT_IN) {
+		keys := make(map[Expr]string, len(array.List))
+		for _, item := range array.List {
+			keys[item] = formatExpr(item)
+		}
+		sort.SliceStable(array.List, func(i, j int) bool {
+			return keys[array.List[i]] < keys[array.List[j]]
+		})
+	}
+	e.Left = unparenOperand(e.Left, e.Op, false)
+	e.Right = unparenOperand(e.Right, e.Op, true)
+	return e
+}
+
+func flipComparison(op Token) (Token, bool) {
+	switch op {
+	case LSS:
+		return GTR, true
+	case LEQ:
+		return GEQ, true
+	case GTR:
+		return LSS, true
+	case GEQ:
+		return LEQ, true
+	case LEQL, LNEQ:
+		return op, true
+	}
+	return op, false
+}
+
+func isLiteral(expr Expr) bool {
+	_, _, ok := baseValue(expr)
+	if ok {
+		return true
+	}
+	switch expr.(type) {
+	case *StringTyp, *BooleanTyp, *Ref:
+		return true
+	}
+	return false
+}
+
+// roundFloat drops the noise of unit conversions, so that 30Mph and 48.28032Kph are equal.
+func roundFloat(v float64) float64 {
+	f, err := strconv.ParseFloat(strconv.FormatFloat(v, 'g', 12, 64), 64)
+	if err != nil {
+		return v
+	}
+	return f
+}
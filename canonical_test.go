@@ -0,0 +1,247 @@
+package geoqlparser
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	testCases := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{
+			name: "operator spelling",
+			s:    `when tracker_a eq 1 and tracker_b not eq 2`,
+			want: `tracker_a == 1 and tracker_b != 2`,
+		},
+		{
+			name: "sort and operands",
+			s:    `when tracker_c > 1 and (tracker_b > 1 and tracker_a > 1)`,
+			want: `tracker_a > 1 and tracker_b > 1 and tracker_c > 1`,
+		},
+		{
+			name: "keep required parens",
+			s:    `when tracker_c > 1 and (tracker_b > 1 or tracker_a > 1)`,
+			want: `(tracker_a > 1 or tracker_b > 1) and tracker_c > 1`,
+		},
+		{
+			name: "selector on the left",
+			s:    `when 10 < tracker_a`,
+			want: `tracker_a > 10`,
+		},
+		{
+			name: "sort in array",
+			s:    `when tracker_a in [3, 1, 2]`,
+			want: `tracker_a in [1, 2, 3]`,
+		},
+		{
+			name: "keep array order for equality",
+			s:    `when tracker_a == [3, 1, 2]`,
+			want: `tracker_a == [3, 1, 2]`,
+		},
+		{
+			name: "units",
+			s:    `when tracker_speed > 30Mph and tracker_dist < 1.5Km and tracker_temp > 32F and tracker_tyre > 14.5Psi`,
+			want: `tracker_dist < 1500M and tracker_speed > 48.28032Kph and tracker_temp > 0C and tracker_tyre > 0.99973980705Bar`,
+		},
+		{
+			name: "negative temperature",
+			s:    `when tracker_temp > -4F`,
+			want: `tracker_temp > -20C`,
+		},
+		{
+			name: "sort xor operands",
+			s:    `when tracker_b > 1 xor tracker_a > 1`,
+			want: `tracker_a > 1 xor tracker_b > 1`,
+		},
+		{
+			name: "double negation",
+			s:    `when not not tracker_a > 1`,
+			want: `tracker_a > 1`,
+		},
+		{
+			name: "keep arithmetic order",
+			s:    `when tracker_b - tracker_a > 1`,
+			want: `tracker_b-tracker_a > 1`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := Parse(tc.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			trigger := stmt.(*Trigger)
+			Canonicalize(trigger)
+			if have := oneLine(formatExpr(trigger.When)); have != tc.want {
+				t.Fatalf("have %s, want %s", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeVars(t *testing.T) {
+	stmt, err := Parse(`trigger set b=1; a=2; when tracker_a > @a and tracker_b > @b`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trigger := stmt.(*Trigger)
+	Canonicalize(trigger)
+	if have, want := trigger.Vars[0].Left.Val, "a"; have != want {
+		t.Fatalf("have %s, want %s", have, want)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	testCases := []struct {
+		name  string
+		a, b  string
+		equal bool
+	}{
+		{
+			name:  "whitespace and case",
+			a:     `when tracker_a > 1 and tracker_b < 2`,
+			b:     "WHEN   tracker_a>1\n\tAND tracker_b<2",
+			equal: true,
+		},
+		{
+			name:  "operand order",
+			a:     `when tracker_a eq 1 or (tracker_b > 2 and tracker_c < 3)`,
+			b:     `when (tracker_c < 3 and tracker_b > 2) or tracker_a == 1`,
+			equal: true,
+		},
+		{
+			name:  "units",
+			a:     `when tracker_speed > 30Mph`,
+			b:     `when tracker_speed > 48.28032Kph`,
+			equal: true,
+		},
+		{
+			name:  "vars order",
+			a:     `trigger set a=1; b=2; when tracker_a > @a and tracker_b > @b`,
+			b:     `trigger set b=2; a=1; when tracker_b > @b and tracker_a > @a`,
+			equal: true,
+		},
+		{
+			name: "different values",
+			a:    `when tracker_a > 1`,
+			b:    `when tracker_a > 2`,
+		},
+		{
+			name: "different arithmetic order",
+			a:    `when tracker_a - tracker_b > 1`,
+			b:    `when tracker_b - tracker_a > 1`,
+		},
+		{
+			name: "float and int",
+			a:    `when tracker_a > 1.0`,
+			b:    `when tracker_a > 1`,
+		},
+		{
+			name: "different repeat",
+			a:    `trigger when tracker_a > 1 repeat 5 times 10s`,
+			b:    `trigger when tracker_a > 1 repeat 5 times 20s`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := Parse(tc.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := Parse(tc.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fa, err := Fingerprint(a.(*Trigger))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fb, err := Fingerprint(b.(*Trigger))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have, want := fa == fb, tc.equal; have != want {
+				t.Fatalf("have equal=%v, want %v", have, want)
+			}
+		})
+	}
+}
+
+func TestFingerprintStable(t *testing.T) {
+	// The golden values must only change together with fingerprintVersion.
+	testCases := []struct {
+		s      string
+		golden string
+	}{
+		{
+			s:      `trigger set limit=30Mph; when tracker_speed > @limit and tracker_coords intersects point[1, 1] repeat 5 times 10s`,
+			golden: "5601c94b20c6c037fbd9fb5af975959fc8758bba7329f91094076a8c6b024ee8",
+		},
+		{
+			s:      `when tracker_a > 1.0 and tracker_b rem 2 == 1`,
+			golden: "630002ee88686e8059a515fb7af896ee8b60dd72053210c25ea2d32a23c62743",
+		},
+	}
+	for _, tc := range testCases {
+		stmt, err := Parse(tc.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trigger := stmt.(*Trigger)
+		before := bytes.NewBuffer(nil)
+		if err = Format(before, trigger); err != nil {
+			t.Fatal(err)
+		}
+		sum, err := Fingerprint(trigger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		after := bytes.NewBuffer(nil)
+		if err = Format(after, trigger); err != nil {
+			t.Fatal(err)
+		}
+		if before.String() != after.String() {
+			t.Fatal("fingerprint modified the trigger")
+		}
+		if have := hex.EncodeToString(sum[:]); have != tc.golden {
+			t.Fatalf("%s: have %s, want %s", tc.s, have, tc.golden)
+		}
+	}
+}
+
+func TestFingerprintIgnoresComments(t *testing.T) {
+	src := "// doc\nwhen tracker_a > 1 // too big\n\tand tracker_b < 2"
+	a, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ParseWithMode(src, ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fa, err := Fingerprint(a.(*Trigger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fb, err := Fingerprint(b.(*Trigger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fa != fb {
+		t.Fatal("have different fingerprints, want comments to be ignored")
+	}
+}
+
+func TestFingerprintError(t *testing.T) {
+	if _, err := Fingerprint(nil); err == nil {
+		t.Fatal("have nil, want error for nil trigger")
+	}
+	trigger := &Trigger{When: &BinaryExpr{Op: GTR, Left: &Selector{Ident: "tracker_a"}}}
+	if _, err := Fingerprint(trigger); err == nil {
+		t.Fatal("have nil, want error for trigger that cannot be formatted")
+	}
+}
@@ -0,0 +1,748 @@
+package geoqlparser
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+func (s *parser) parseCellExpr() (Expr, error) {
+	kind, lpos := s.tok, s.t.Offset()
+	name := KeywordString(kind)
+	s.next()
+	if !s.except(LBRACK) {
+		s.err = fmt.Errorf("invalid %s: got %s without body, expected %s[cell]", name, name, name)
+		return nil, s.error()
+	}
+	var list []Expr
+	var isRange bool
+	for {
+		cell, err := s.parseCell(kind)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, cell)
+		s.next()
+		if s.except(COMMA) && !isRange {
+			continue
+		}
+		if s.except(RANGE) && len(list) == 1 {
+			isRange = true
+			continue
+		}
+		if !s.except(RBRACK) {
+			s.err = fmt.Errorf("invalid %s: expected , or .. or ]", name)
+			return nil, s.error()
+		}
+		break
+	}
+	rpos := s.t.Offset() + 1
+	s.next()
+	switch {
+	case isRange:
+		low, high := list[0].(*CellTyp), list[1].(*CellTyp)
+		if low.Level() != high.Level() || compareCells(low, high) > 0 {
+			s.err = fmt.Errorf("invalid %s range: %s .. %s", name, low.Val, high.Val)
+			return nil, s.error()
+		}
+		return &Range{Low: low, High: high, lpos: lpos, rpos: rpos}, nil
+	case len(list) > 1:
+		return &ArrayTyp{Kind: kind, List: list, lpos: lpos, rpos: rpos}, nil
+	}
+	cell := list[0].(*CellTyp)
+	cell.lpos, cell.rpos = lpos, rpos
+	return cell, nil
+}
+
+// parseCell parses a quoted or a bare cell, the next token is not scanned.
+func (s *parser) parseCell(kind Token) (*CellTyp, error) {
+	var val string
+	var lpos, rpos Pos
+	if s.t.peek() == '"' {
+		s.next()
+		val, lpos = trim(s.t.TokenText()), s.t.Offset()
+		rpos = lpos + Pos(len(s.t.TokenText()))
+	} else {
+		val, lpos = s.t.scanWord()
+		rpos = lpos + Pos(len(val))
+	}
+	cell, err := newCell(kind, val)
+	if err != nil {
+		s.err = err
+		return nil, s.error()
+	}
+	cell.lpos, cell.rpos = lpos, rpos
+	return cell, nil
+}
+
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+func newCell(kind Token, val string) (*CellTyp, error) {
+	val = strings.ToLower(val)
+	switch kind {
+	case H3:
+		id, err := strconv.ParseUint(val, 16, 64)
+		if err != nil || !isH3(id) {
+			return nil, fmt.Errorf("invalid h3 index %q", val)
+		}
+		val = strconv.FormatUint(id, 16)
+	case GEOHASH:
+		if len(val) == 0 || len(val) > 12 || strings.Trim(val, geohashBase32) != "" {
+			return nil, fmt.Errorf("invalid geohash %q", val)
+		}
+	case S2:
+		id, ok := s2FromToken(val)
+		if !ok {
+			return nil, fmt.Errorf("invalid s2 token %q", val)
+		}
+		val = s2Token(id)
+	default:
+		return nil, fmt.Errorf("invalid cell kind %s", KeywordString(kind))
+	}
+	return &CellTyp{Kind: kind, Val: val}, nil
+}
+
+// Level returns the resolution of an h3 cell, the precision of a geohash
+// or the level of an s2 cell.
+func (e *CellTyp) Level() int {
+	switch e.Kind {
+	case H3:
+		return int(e.id()>>52) & 0xf
+	case S2:
+		return s2Level(e.id())
+	}
+	return len(e.Val)
+}
+
+func (e *CellTyp) id() uint64 {
+	if e.Kind == S2 {
+		id, _ := s2FromToken(e.Val)
+		return id
+	}
+	id, _ := strconv.ParseUint(e.Val, 16, 64)
+	return id
+}
+
+// Contains reports whether the cell contains the other cell of the same grid:
+// the cells are equal or the other is a descendant of the cell.
+func (e *CellTyp) Contains(c *CellTyp) bool {
+	if e.Kind != c.Kind || c.Level() < e.Level() {
+		return false
+	}
+	switch e.Kind {
+	case H3:
+		return h3Parent(c.id(), e.Level()) == e.id()
+	case S2:
+		return s2Parent(c.id(), e.Level()) == e.id()
+	}
+	return strings.HasPrefix(c.Val, e.Val)
+}
+
+// compareCells orders the cells of the same grid and level.
+func compareCells(a, b *CellTyp) int {
+	if a.Kind == GEOHASH {
+		return strings.Compare(a.Val, b.Val)
+	}
+	x, y := a.id(), b.id()
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// CellAt returns the cell of the grid at the level that contains the point.
+func CellAt(kind Token, level int, lon, lat float64) (*CellTyp, error) {
+	switch kind {
+	case H3:
+		if level < 0 || level > 15 {
+			return nil, fmt.Errorf("geoql: invalid h3 resolution %d", level)
+		}
+		id, err := h3FromLonLat(lon, lat, level)
+		if err != nil {
+			return nil, err
+		}
+		return newCell(H3, strconv.FormatUint(id, 16))
+	case GEOHASH:
+		if level < 1 || level > 12 {
+			return nil, fmt.Errorf("geoql: invalid geohash precision %d", level)
+		}
+		return &CellTyp{Kind: GEOHASH, Val: encodeGeohash(lon, lat, level)}, nil
+	case S2:
+		if level < 0 || level > s2MaxLevel {
+			return nil, fmt.Errorf("geoql: invalid s2 level %d", level)
+		}
+		return &CellTyp{Kind: S2, Val: s2Token(s2Parent(s2FromLonLat(lon, lat), level))}, nil
+	}
+	return nil, fmt.Errorf("geoql: invalid cell kind %s", KeywordString(kind))
+}
+
+// CellContains reports whether the point lies in the cell, in one of the array
+// of cells or within the range of cells, e.g. the right operand of
+// tracker_coords in h3[8928308280fffff].
+func CellContains(cells Expr, lon, lat float64) (bool, error) {
+	switch typ := cells.(type) {
+	case *CellTyp:
+		cell, err := CellAt(typ.Kind, typ.Level(), lon, lat)
+		if err != nil {
+			return false, err
+		}
+		return cell.Val == typ.Val, nil
+	case *ArrayTyp:
+		for _, item := range typ.List {
+			ok, err := CellContains(item, lon, lat)
+			if ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+	case *Range:
+		low, lok := typ.Low.(*CellTyp)
+		high, hok := typ.High.(*CellTyp)
+		if lok && hok {
+			cell, err := CellAt(low.Kind, low.Level(), lon, lat)
+			if err != nil {
+				return false, err
+			}
+			return compareCells(low, cell) <= 0 && compareCells(cell, high) <= 0, nil
+		}
+	}
+	return false, fmt.Errorf("geoql: %s is not a cell", formatExpr(cells))
+}
+
+func isCellSet(expr Expr) bool {
+	switch typ := expr.(type) {
+	case *CellTyp:
+		return true
+	case *ArrayTyp:
+		return typ.Kind == H3 || typ.Kind == GEOHASH || typ.Kind == S2
+	case *Range:
+		_, ok := typ.Low.(*CellTyp)
+		return ok
+	}
+	return false
+}
+
+// isH3 reports whether the index is a valid H3 cell index.
+func isH3(h uint64) bool {
+	if h>>63 != 0 || (h>>59)&0xf != 1 || (h>>56)&0x7 != 0 || (h>>45)&0x7f >= 122 {
+		return false
+	}
+	res := int(h>>52) & 0xf
+	for r := 1; r <= 15; r++ {
+		digit := (h >> ((15 - r) * 3)) & 0x7
+		if r <= res && digit == 7 || r > res && digit != 7 {
+			return false
+		}
+	}
+	return true
+}
+
+func h3Parent(h uint64, res int) uint64 {
+	h = h&^(0xf<<52) | uint64(res)<<52
+	for r := res + 1; r <= 15; r++ {
+		h |= 0x7 << ((15 - r) * 3)
+	}
+	return h
+}
+
+// H3 cells are hexagons on the faces of an icosahedron projected onto the sphere,
+// see https://h3geo.org/docs/core-library/overview. Points are projected onto the
+// nearest face and the hexagon is found in the ijk coordinates of each resolution.
+const (
+	h3Res0UGnomonic = 0.38196601125010500003
+	h3Ap7RotRads    = 0.333473172251832115336090755351601070065900389
+	h3KAxesDigit    = 1
+)
+
+var (
+	// h3FaceCenters holds the latitudes and longitudes in radians of the centers
+	// of the icosahedron faces.
+	h3FaceCenters = [20][2]float64{
+		{0.80358264971899, 1.2483974196173961},
+		{1.3077478834556382, 2.5369450098779214},
+		{1.054751253523952, -1.3475173589003966},
+		{0.6001915955381868, -0.45060390946975576},
+		{0.49171542819877384, 0.40198820291130694},
+		{0.1727453274156187, 1.6781468852804338},
+		{0.6059293215713507, 2.9539233298124117},
+		{0.42737051832897965, -1.8888762003362853},
+		{-0.07906611854921283, -0.7334295133808677},
+		{-0.23096164445538364, 0.506495587332349},
+		{0.07906611854921283, 2.4081631402089254},
+		{0.23096164445538364, -2.635097066257444},
+		{-0.1727453274156187, -1.4634457683093596},
+		{-0.6059293215713507, -0.18766932377738163},
+		{-0.42737051832897965, 1.2527164532535078},
+		{-0.6001915955381868, 2.6909887441200375},
+		{-0.49171542819877384, -2.7396044506784865},
+		{-0.80358264971899, -1.8931952339723972},
+		{-1.3077478834556382, -0.6046476437118721},
+		{-1.054751253523952, 1.7940752946893965},
+	}
+	// h3FaceAxesAz holds the azimuths in radians of the i axes of the faces.
+	h3FaceAxesAz = [20]float64{
+		5.6199582685239395, 5.7603390817141875, 0.78021365439343, 0.4304693639799999,
+		6.130269123335111, 2.692877706530643, 2.982963003477244, 3.532912002790141,
+		3.494305004259568, 3.0032141694995382, 5.930472956509812, 0.13837848409025486,
+		0.4487149470591504, 0.15862965011254937, 5.891865957979238, 2.711123289609793,
+		3.294508837434268, 3.80481969224544, 3.6644388790551923, 2.361378999196363,
+	}
+	// h3BaseCells holds the base cell of the resolution 0 ijk coordinates of
+	// the faces and the count of 60 degree counter-clockwise rotations into
+	// the orientation of the base cell.
+	h3BaseCells = [20][3][3][3][2]int{
+		{
+			{{{16, 0}, {18, 0}, {24, 0}}, {{33, 0}, {30, 0}, {32, 3}}, {{49, 1}, {48, 3}, {50, 3}}},
+			{{{8, 0}, {5, 5}, {10, 5}}, {{22, 0}, {16, 0}, {18, 0}}, {{41, 1}, {33, 0}, {30, 0}}},
+			{{{4, 0}, {0, 5}, {2, 5}}, {{15, 1}, {8, 0}, {5, 5}}, {{31, 1}, {22, 0}, {16, 0}}},
+		},
+		{
+			{{{2, 0}, {6, 0}, {14, 0}}, {{10, 0}, {11, 0}, {17, 3}}, {{24, 1}, {23, 3}, {25, 3}}},
+			{{{0, 0}, {1, 5}, {9, 5}}, {{5, 0}, {2, 0}, {6, 0}}, {{18, 1}, {10, 0}, {11, 0}}},
+			{{{4, 1}, {3, 5}, {7, 5}}, {{8, 1}, {0, 0}, {1, 5}}, {{16, 1}, {5, 0}, {2, 0}}},
+		},
+		{
+			{{{7, 0}, {21, 0}, {38, 0}}, {{9, 0}, {19, 0}, {34, 3}}, {{14, 1}, {20, 3}, {36, 3}}},
+			{{{3, 0}, {13, 5}, {29, 5}}, {{1, 0}, {7, 0}, {21, 0}}, {{6, 1}, {9, 0}, {19, 0}}},
+			{{{4, 2}, {12, 5}, {26, 5}}, {{0, 1}, {3, 0}, {13, 5}}, {{2, 1}, {1, 0}, {7, 0}}},
+		},
+		{
+			{{{26, 0}, {42, 0}, {58, 0}}, {{29, 0}, {43, 0}, {62, 3}}, {{38, 1}, {47, 3}, {64, 3}}},
+			{{{12, 0}, {28, 5}, {44, 5}}, {{13, 0}, {26, 0}, {42, 0}}, {{21, 1}, {29, 0}, {43, 0}}},
+			{{{4, 3}, {15, 5}, {31, 5}}, {{3, 1}, {12, 0}, {28, 5}}, {{7, 1}, {13, 0}, {26, 0}}},
+		},
+		{
+			{{{31, 0}, {41, 0}, {49, 0}}, {{44, 0}, {53, 0}, {61, 3}}, {{58, 1}, {65, 3}, {75, 3}}},
+			{{{15, 0}, {22, 5}, {33, 5}}, {{28, 0}, {31, 0}, {41, 0}}, {{42, 1}, {44, 0}, {53, 0}}},
+			{{{4, 4}, {8, 5}, {16, 5}}, {{12, 1}, {15, 0}, {22, 5}}, {{26, 1}, {28, 0}, {31, 0}}},
+		},
+		{
+			{{{50, 0}, {48, 0}, {49, 3}}, {{32, 0}, {30, 3}, {33, 3}}, {{24, 3}, {18, 3}, {16, 3}}},
+			{{{70, 0}, {67, 0}, {66, 3}}, {{52, 3}, {50, 0}, {48, 0}}, {{37, 3}, {32, 0}, {30, 3}}},
+			{{{83, 0}, {87, 3}, {85, 3}}, {{74, 3}, {70, 0}, {67, 0}}, {{57, 3}, {52, 3}, {50, 0}}},
+		},
+		{
+			{{{25, 0}, {23, 0}, {24, 3}}, {{17, 0}, {11, 3}, {10, 3}}, {{14, 3}, {6, 3}, {2, 3}}},
+			{{{45, 0}, {39, 0}, {37, 3}}, {{35, 3}, {25, 0}, {23, 0}}, {{27, 3}, {17, 0}, {11, 3}}},
+			{{{63, 0}, {59, 3}, {57, 3}}, {{56, 3}, {45, 0}, {39, 0}}, {{46, 3}, {35, 3}, {25, 0}}},
+		},
+		{
+			{{{36, 0}, {20, 0}, {14, 3}}, {{34, 0}, {19, 3}, {9, 3}}, {{38, 3}, {21, 3}, {7, 3}}},
+			{{{55, 0}, {40, 0}, {27, 3}}, {{54, 3}, {36, 0}, {20, 0}}, {{51, 3}, {34, 0}, {19, 3}}},
+			{{{72, 0}, {60, 3}, {46, 3}}, {{73, 3}, {55, 0}, {40, 0}}, {{71, 3}, {54, 3}, {36, 0}}},
+		},
+		{
+			{{{64, 0}, {47, 0}, {38, 3}}, {{62, 0}, {43, 3}, {29, 3}}, {{58, 3}, {42, 3}, {26, 3}}},
+			{{{84, 0}, {69, 0}, {51, 3}}, {{82, 3}, {64, 0}, {47, 0}}, {{76, 3}, {62, 0}, {43, 3}}},
+			{{{97, 0}, {89, 3}, {71, 3}}, {{98, 3}, {84, 0}, {69, 0}}, {{96, 3}, {82, 3}, {64, 0}}},
+		},
+		{
+			{{{75, 0}, {65, 0}, {58, 3}}, {{61, 0}, {53, 3}, {44, 3}}, {{49, 3}, {41, 3}, {31, 3}}},
+			{{{94, 0}, {86, 0}, {76, 3}}, {{81, 3}, {75, 0}, {65, 0}}, {{66, 3}, {61, 0}, {53, 3}}},
+			{{{107, 0}, {104, 3}, {96, 3}}, {{101, 3}, {94, 0}, {86, 0}}, {{85, 3}, {81, 3}, {75, 0}}},
+		},
+		{
+			{{{57, 0}, {59, 0}, {63, 3}}, {{74, 0}, {78, 3}, {79, 3}}, {{83, 3}, {92, 3}, {95, 3}}},
+			{{{37, 0}, {39, 3}, {45, 3}}, {{52, 0}, {57, 0}, {59, 0}}, {{70, 3}, {74, 0}, {78, 3}}},
+			{{{24, 0}, {23, 3}, {25, 3}}, {{32, 3}, {37, 0}, {39, 3}}, {{50, 3}, {52, 0}, {57, 0}}},
+		},
+		{
+			{{{46, 0}, {60, 0}, {72, 3}}, {{56, 0}, {68, 3}, {80, 3}}, {{63, 3}, {77, 3}, {90, 3}}},
+			{{{27, 0}, {40, 3}, {55, 3}}, {{35, 0}, {46, 0}, {60, 0}}, {{45, 3}, {56, 0}, {68, 3}}},
+			{{{14, 0}, {20, 3}, {36, 3}}, {{17, 3}, {27, 0}, {40, 3}}, {{25, 3}, {35, 0}, {46, 0}}},
+		},
+		{
+			{{{71, 0}, {89, 0}, {97, 3}}, {{73, 0}, {91, 3}, {103, 3}}, {{72, 3}, {88, 3}, {105, 3}}},
+			{{{51, 0}, {69, 3}, {84, 3}}, {{54, 0}, {71, 0}, {89, 0}}, {{55, 3}, {73, 0}, {91, 3}}},
+			{{{38, 0}, {47, 3}, {64, 3}}, {{34, 3}, {51, 0}, {69, 3}}, {{36, 3}, {54, 0}, {71, 0}}},
+		},
+		{
+			{{{96, 0}, {104, 0}, {107, 3}}, {{98, 0}, {110, 3}, {115, 3}}, {{97, 3}, {111, 3}, {119, 3}}},
+			{{{76, 0}, {86, 3}, {94, 3}}, {{82, 0}, {96, 0}, {104, 0}}, {{84, 3}, {98, 0}, {110, 3}}},
+			{{{58, 0}, {65, 3}, {75, 3}}, {{62, 3}, {76, 0}, {86, 3}}, {{64, 3}, {82, 0}, {96, 0}}},
+		},
+		{
+			{{{85, 0}, {87, 0}, {83, 3}}, {{101, 0}, {102, 3}, {100, 3}}, {{107, 3}, {112, 3}, {114, 3}}},
+			{{{66, 0}, {67, 3}, {70, 3}}, {{81, 0}, {85, 0}, {87, 0}}, {{94, 3}, {101, 0}, {102, 3}}},
+			{{{49, 0}, {48, 3}, {50, 3}}, {{61, 3}, {66, 0}, {67, 3}}, {{75, 3}, {81, 0}, {85, 0}}},
+		},
+		{
+			{{{95, 0}, {92, 0}, {83, 0}}, {{79, 0}, {78, 0}, {74, 3}}, {{63, 1}, {59, 3}, {57, 3}}},
+			{{{109, 0}, {108, 0}, {100, 5}}, {{93, 1}, {95, 0}, {92, 0}}, {{77, 1}, {79, 0}, {78, 0}}},
+			{{{117, 2}, {118, 5}, {114, 5}}, {{106, 1}, {109, 0}, {108, 0}}, {{90, 1}, {93, 1}, {95, 0}}},
+		},
+		{
+			{{{90, 0}, {77, 0}, {63, 0}}, {{80, 0}, {68, 0}, {56, 3}}, {{72, 1}, {60, 3}, {46, 3}}},
+			{{{106, 0}, {93, 0}, {79, 5}}, {{99, 1}, {90, 0}, {77, 0}}, {{88, 1}, {80, 0}, {68, 0}}},
+			{{{117, 1}, {109, 5}, {95, 5}}, {{113, 1}, {106, 0}, {93, 0}}, {{105, 1}, {99, 1}, {90, 0}}},
+		},
+		{
+			{{{105, 0}, {88, 0}, {72, 0}}, {{103, 0}, {91, 0}, {73, 3}}, {{97, 1}, {89, 3}, {71, 3}}},
+			{{{113, 0}, {99, 0}, {80, 5}}, {{116, 1}, {105, 0}, {88, 0}}, {{111, 1}, {103, 0}, {91, 0}}},
+			{{{117, 0}, {106, 5}, {90, 5}}, {{121, 1}, {113, 0}, {99, 0}}, {{119, 1}, {116, 1}, {105, 0}}},
+		},
+		{
+			{{{119, 0}, {111, 0}, {97, 0}}, {{115, 0}, {110, 0}, {98, 3}}, {{107, 1}, {104, 3}, {96, 3}}},
+			{{{121, 0}, {116, 0}, {103, 5}}, {{120, 1}, {119, 0}, {111, 0}}, {{112, 1}, {115, 0}, {110, 0}}},
+			{{{117, 4}, {113, 5}, {105, 5}}, {{118, 1}, {121, 0}, {116, 0}}, {{114, 1}, {120, 1}, {119, 0}}},
+		},
+		{
+			{{{114, 0}, {112, 0}, {107, 0}}, {{100, 0}, {102, 0}, {101, 3}}, {{83, 1}, {87, 3}, {85, 3}}},
+			{{{118, 0}, {120, 0}, {115, 5}}, {{108, 1}, {114, 0}, {112, 0}}, {{92, 1}, {100, 0}, {102, 0}}},
+			{{{117, 3}, {121, 5}, {119, 5}}, {{109, 1}, {118, 0}, {120, 0}}, {{95, 1}, {108, 1}, {114, 0}}},
+		},
+	}
+	// h3Pentagons holds the faces of the pentagon base cells whose coordinates
+	// are rotated clockwise out of the deleted k axes subsequence.
+	h3Pentagons = map[int][2]int{
+		4: {-1, -1}, 14: {2, 6}, 24: {1, 5}, 38: {3, 7}, 49: {0, 9}, 58: {4, 8},
+		63: {11, 15}, 72: {12, 16}, 83: {10, 19}, 97: {13, 17}, 107: {14, 18}, 117: {-1, -1},
+	}
+	h3FacePoints [20][3]float64
+
+	h3RotateCCW = [7]int{0, 5, 3, 1, 6, 4, 2}
+	h3RotateCW  = [7]int{0, 3, 6, 2, 5, 1, 4}
+)
+
+func init() {
+	for f, c := range h3FaceCenters {
+		h3FacePoints[f] = [3]float64{math.Cos(c[0]) * math.Cos(c[1]), math.Cos(c[0]) * math.Sin(c[1]), math.Sin(c[0])}
+	}
+}
+
+func h3FromLonLat(lon, lat float64, res int) (uint64, error) {
+	if math.IsNaN(lon) || math.IsNaN(lat) || math.IsInf(lon, 0) || math.IsInf(lat, 0) {
+		return 0, fmt.Errorf("geoql: invalid point %v, %v", lon, lat)
+	}
+	phi, theta := lat*math.Pi/180, lon*math.Pi/180
+	xyz := [3]float64{math.Cos(phi) * math.Cos(theta), math.Cos(phi) * math.Sin(theta), math.Sin(phi)}
+	face, sqd := 0, 5.0
+	for f, p := range h3FacePoints {
+		dx, dy, dz := xyz[0]-p[0], xyz[1]-p[1], xyz[2]-p[2]
+		if d := dx*dx + dy*dy + dz*dz; d < sqd {
+			face, sqd = f, d
+		}
+	}
+	var x, y float64
+	if r := math.Acos(1 - sqd/2); r >= 1e-16 {
+		c := h3FaceCenters[face]
+		az := math.Atan2(math.Cos(phi)*math.Sin(theta-c[1]),
+			math.Cos(c[0])*math.Sin(phi)-math.Sin(c[0])*math.Cos(phi)*math.Cos(theta-c[1]))
+		a := h3PosAngle(h3FaceAxesAz[face] - h3PosAngle(az))
+		if res%2 == 1 {
+			a = h3PosAngle(a - h3Ap7RotRads)
+		}
+		r = math.Tan(r) / h3Res0UGnomonic
+		for n := 0; n < res; n++ {
+			r *= math.Sqrt(7)
+		}
+		x, y = r*math.Cos(a), r*math.Sin(a)
+	}
+	ijk := h3HexToIJK(x, y)
+	digits := make([]int, res)
+	for r := res; r > 0; r-- {
+		last := ijk
+		var center [3]int
+		if r%2 == 1 {
+			ijk = h3UpAp7(ijk, false)
+			center = h3DownAp7(ijk, false)
+		} else {
+			ijk = h3UpAp7(ijk, true)
+			center = h3DownAp7(ijk, true)
+		}
+		d := h3Normalize([3]int{last[0] - center[0], last[1] - center[1], last[2] - center[2]})
+		digits[r-1] = d[0]<<2 | d[1]<<1 | d[2]
+	}
+	if ijk[0] > 2 || ijk[1] > 2 || ijk[2] > 2 {
+		return 0, fmt.Errorf("geoql: no h3 cell at %v, %v", lon, lat)
+	}
+	base := h3BaseCells[face][ijk[0]][ijk[1]][ijk[2]]
+	if cw, ok := h3Pentagons[base[0]]; ok {
+		if h3LeadingDigit(digits) == h3KAxesDigit {
+			if face == cw[0] || face == cw[1] {
+				h3Rotate(digits, &h3RotateCW)
+			} else {
+				h3Rotate(digits, &h3RotateCCW)
+			}
+		}
+		for n := 0; n < base[1]; n++ {
+			h3RotatePent(digits)
+		}
+	} else {
+		for n := 0; n < base[1]; n++ {
+			h3Rotate(digits, &h3RotateCCW)
+		}
+	}
+	h := uint64(1)<<59 | uint64(res)<<52 | uint64(base[0])<<45 | (1<<45 - 1)
+	for r, d := range digits {
+		shift := (14 - r) * 3
+		h = h&^(0x7<<shift) | uint64(d)<<shift
+	}
+	return h, nil
+}
+
+func h3PosAngle(a float64) float64 {
+	if a = math.Mod(a, 2*math.Pi); a < 0 {
+		a += 2 * math.Pi
+	}
+	return a
+}
+
+// h3HexToIJK returns the coordinates of the hexagon that contains the point
+// of the plane, the nearest of the centers of the enclosing rhombus.
+func h3HexToIJK(x, y float64) [3]int {
+	j := y / (math.Sqrt(3) / 2)
+	i := x + j/2
+	fi, fj := math.Floor(i), math.Floor(j)
+	var ijk [3]int
+	best := math.Inf(1)
+	for _, c := range [4][2]float64{{fi, fj}, {fi + 1, fj}, {fi, fj + 1}, {fi + 1, fj + 1}} {
+		dx, dy := c[0]-c[1]/2-x, c[1]*math.Sqrt(3)/2-y
+		if d := dx*dx + dy*dy; d < best {
+			best, ijk = d, [3]int{int(c[0]), int(c[1]), 0}
+		}
+	}
+	return h3Normalize(ijk)
+}
+
+func h3Normalize(ijk [3]int) [3]int {
+	for n := range ijk {
+		if ijk[n] < 0 {
+			for m := range ijk {
+				if m != n {
+					ijk[m] -= ijk[n]
+				}
+			}
+			ijk[n] = 0
+		}
+	}
+	low := ijk[0]
+	if ijk[1] < low {
+		low = ijk[1]
+	}
+	if ijk[2] < low {
+		low = ijk[2]
+	}
+	return [3]int{ijk[0] - low, ijk[1] - low, ijk[2] - low}
+}
+
+// h3UpAp7 returns the coordinates of the parent in the aperture 7 grid that
+// is rotated counter-clockwise or, for class II resolutions, clockwise.
+func h3UpAp7(ijk [3]int, cw bool) [3]int {
+	i, j := float64(ijk[0]-ijk[2]), float64(ijk[1]-ijk[2])
+	if cw {
+		return h3Normalize([3]int{int(math.Round((2*i + j) / 7)), int(math.Round((3*j - i) / 7)), 0})
+	}
+	return h3Normalize([3]int{int(math.Round((3*i - j) / 7)), int(math.Round((i + 2*j) / 7)), 0})
+}
+
+// h3DownAp7 returns the coordinates of the center child of the cell.
+func h3DownAp7(ijk [3]int, cw bool) [3]int {
+	vecs := [3][3]int{{3, 0, 1}, {1, 3, 0}, {0, 1, 3}}
+	if cw {
+		vecs = [3][3]int{{3, 1, 0}, {0, 3, 1}, {1, 0, 3}}
+	}
+	var c [3]int
+	for n, v := range vecs {
+		for m := range c {
+			c[m] += ijk[n] * v[m]
+		}
+	}
+	return h3Normalize(c)
+}
+
+func h3LeadingDigit(digits []int) int {
+	for _, d := range digits {
+		if d != 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func h3Rotate(digits []int, rot *[7]int) {
+	for r, d := range digits {
+		digits[r] = rot[d]
+	}
+}
+
+// h3RotatePent rotates the digits of a pentagon cell counter-clockwise
+// and skips the deleted k axes subsequence.
+func h3RotatePent(digits []int) {
+	found := false
+	for r, d := range digits {
+		digits[r] = h3RotateCCW[d]
+		if !found && digits[r] != 0 {
+			found = true
+			if digits[r] == h3KAxesDigit {
+				h3Rotate(digits, &h3RotateCCW)
+			}
+		}
+	}
+}
+
+func encodeGeohash(lon, lat float64, precision int) string {
+	minLat, maxLat, minLon, maxLon := -90.0, 90.0, -180.0, 180.0
+	hash := make([]byte, 0, precision)
+	var ch, bit int
+	even := true
+	for len(hash) < precision {
+		if even {
+			mid := (minLon + maxLon) / 2
+			if lon >= mid {
+				ch |= 1 << (4 - bit)
+				minLon = mid
+			} else {
+				maxLon = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if lat >= mid {
+				ch |= 1 << (4 - bit)
+				minLat = mid
+			} else {
+				maxLat = mid
+			}
+		}
+		even = !even
+		if bit++; bit == 5 {
+			hash = append(hash, geohashBase32[ch])
+			ch, bit = 0, 0
+		}
+	}
+	return string(hash)
+}
+
+// S2 cells are numbered along a Hilbert curve on the six faces of a cube,
+// see https://s2geometry.io/devguide/s2cell_hierarchy.
+const (
+	s2MaxLevel   = 30
+	s2MaxSize    = 1 << s2MaxLevel
+	s2LookupBits = 4
+	s2SwapMask   = 1
+	s2InvertMask = 2
+)
+
+var (
+	s2PosToIJ = [4][4]int{
+		{0, 1, 3, 2},
+		{0, 2, 3, 1},
+		{3, 2, 0, 1},
+		{3, 1, 0, 2},
+	}
+	s2PosToOrientation = [4]int{s2SwapMask, 0, 0, s2InvertMask | s2SwapMask}
+	s2LookupPos        [1 << (2*s2LookupBits + 2)]int
+)
+
+func init() {
+	for _, o := range []int{0, s2SwapMask, s2InvertMask, s2SwapMask | s2InvertMask} {
+		s2InitLookup(0, 0, 0, o, 0, o)
+	}
+}
+
+func s2InitLookup(level, i, j, origOrientation, pos, orientation int) {
+	if level == s2LookupBits {
+		ij := i<<s2LookupBits + j
+		s2LookupPos[ij<<2+origOrientation] = pos<<2 + orientation
+		return
+	}
+	level++
+	i, j, pos = i<<1, j<<1, pos<<2
+	r := s2PosToIJ[orientation]
+	for k := 0; k < 4; k++ {
+		s2InitLookup(level, i+r[k]>>1, j+r[k]&1, origOrientation, pos+k, orientation^s2PosToOrientation[k])
+	}
+}
+
+func s2FromLonLat(lon, lat float64) uint64 {
+	phi, theta := lat*math.Pi/180, lon*math.Pi/180
+	xyz := [3]float64{math.Cos(phi) * math.Cos(theta), math.Cos(phi) * math.Sin(theta), math.Sin(phi)}
+	face := 0
+	for axis := 1; axis < 3; axis++ {
+		if math.Abs(xyz[axis]) > math.Abs(xyz[face]) {
+			face = axis
+		}
+	}
+	if xyz[face] < 0 {
+		face += 3
+	}
+	x, y, z := xyz[0], xyz[1], xyz[2]
+	var u, v float64
+	switch face {
+	case 0:
+		u, v = y/x, z/x
+	case 1:
+		u, v = -x/y, z/y
+	case 2:
+		u, v = -x/z, -y/z
+	case 3:
+		u, v = z/x, y/x
+	case 4:
+		u, v = z/y, -x/y
+	default:
+		u, v = -y/z, -x/z
+	}
+	i, j := s2STToIJ(s2UVToST(u)), s2STToIJ(s2UVToST(v))
+	n := uint64(face) << (2 * s2MaxLevel)
+	bits := face & s2SwapMask
+	const mask = 1<<s2LookupBits - 1
+	for k := 7; k >= 0; k-- {
+		bits += (i >> (k * s2LookupBits) & mask) << (s2LookupBits + 2)
+		bits += (j >> (k * s2LookupBits) & mask) << 2
+		bits = s2LookupPos[bits]
+		n |= uint64(bits>>2) << (k * 2 * s2LookupBits)
+		bits &= s2SwapMask | s2InvertMask
+	}
+	return n*2 + 1
+}
+
+// s2UVToST applies the quadratic projection of the cube faces.
+func s2UVToST(u float64) float64 {
+	if u >= 0 {
+		return 0.5 * math.Sqrt(1+3*u)
+	}
+	return 1 - 0.5*math.Sqrt(1-3*u)
+}
+
+func s2STToIJ(s float64) int {
+	ij := int(math.Floor(s2MaxSize * s))
+	switch {
+	case ij < 0:
+		return 0
+	case ij >= s2MaxSize:
+		return s2MaxSize - 1
+	}
+	return ij
+}
+
+func s2Level(id uint64) int {
+	return s2MaxLevel - bits.TrailingZeros64(id)/2
+}
+
+func s2Parent(id uint64, level int) uint64 {
+	lsb := uint64(1) << (2 * (s2MaxLevel - level))
+	return id&-lsb | lsb
+}
+
+func s2Token(id uint64) string {
+	if id == 0 {
+		return "x"
+	}
+	return strings.TrimRight(fmt.Sprintf("%016x", id), "0")
+}
+
+func s2FromToken(token string) (uint64, bool) {
+	if len(token) == 0 || len(token) > 16 {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(token+strings.Repeat("0", 16-len(token)), 16, 64)
+	if err != nil || id>>61 > 5 || id&-id&0x5555555555555555 == 0 {
+		return 0, false
+	}
+	return id, true
+}
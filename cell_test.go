@@ -0,0 +1,205 @@
+package geoqlparser
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestParseCellExpr(t *testing.T) {
+	testCases := []struct {
+		name string
+		s    string
+		want string
+		err  bool
+	}{
+		{
+			name: "h3",
+			s:    `when tracker_coords in h3[8928308280fffff]`,
+			want: `in(tracker_coords, h3[8928308280fffff])`,
+		},
+		{
+			name: "h3 quoted upper case",
+			s:    `when tracker_coords in h3["8928308280FFFFF"]`,
+			want: `in(tracker_coords, h3[8928308280fffff])`,
+		},
+		{
+			name: "geohash array",
+			s:    `when tracker_coords intersects geohash["u4pruyd", "U4PRUYE"]`,
+			want: `intersects(tracker_coords, geohash["u4pruyd", "u4pruye"])`,
+		},
+		{
+			name: "s2 range",
+			s:    `when tracker_coords in s2[89c25 .. 89c27] and tracker_speed > 1`,
+			want: `and(in(tracker_coords, s2[89c25 .. 89c27]), >(tracker_speed, 1))`,
+		},
+		{
+			name: "s2 with exponent like token",
+			s:    `when tracker_coords not in s2[ 89e4 ]`,
+			want: `not in(tracker_coords, s2[89e4])`,
+		},
+		{
+			name: "variable",
+			s:    `trigger set zone=h3[8928308280fffff, 8928308280bffff]; when tracker_coords in @zone`,
+			want: `in(tracker_coords, @zone)`,
+		},
+		{name: "without body", s: `when tracker_coords in h3`, err: true},
+		{name: "empty", s: `when tracker_coords in h3[]`, err: true},
+		{name: "invalid h3", s: `when tracker_coords in h3[8928308280ffff7]`, err: true},
+		{name: "invalid geohash", s: `when tracker_coords in geohash["u4pa"]`, err: true},
+		{name: "invalid s2", s: `when tracker_coords in s2[c]`, err: true},
+		{name: "range of levels", s: `when tracker_coords in s2[89c25 .. 89c3]`, err: true},
+		{name: "reversed range", s: `when tracker_coords in geohash["u4pz" .. "u4p0"]`, err: true},
+		{name: "range and array", s: `when tracker_coords in s2[89c25 .. 89c27, 89c29]`, err: true},
+		{name: "unclosed", s: `when tracker_coords in s2[89c25`, err: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := Parse(tc.s)
+			if tc.err {
+				if err == nil {
+					t.Fatal("have nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := sexpr(stmt.(*Trigger).When); have != tc.want {
+				t.Fatalf("have %s, want %s", have, tc.want)
+			}
+			buf := bytes.NewBuffer(nil)
+			if err = Format(buf, stmt); err != nil {
+				t.Fatal(err)
+			}
+			again, err := Parse(buf.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := sexpr(again.(*Trigger).When); have != tc.want {
+				t.Fatalf("have %s, want %s after format", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckCell(t *testing.T) {
+	dict := Dict()
+	dict["tracker_coords"] = ArrayFloat
+	dict["tracker_speed"] = Float
+	for s, isErr := range map[string]bool{
+		`when tracker_coords in h3[8928308280fffff]`:                                      false,
+		`when tracker_coords intersects geohash["u4pruyd", "u4pruye"]`:                    false,
+		`when tracker_coords not in s2[89c25 .. 89c27]`:                                   false,
+		`trigger set z=s2[89c25]; when tracker_coords enters @z`:                          false,
+		`when h3[8928308280fffff] > tracker_speed`:                                        true,
+		`when distance(tracker_coords, geohash["u4pruyd"]) < 1km and tracker_speed > 1.0`: false,
+	} {
+		stmt, err := Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = CheckType(stmt, dict); (err != nil) != isErr {
+			t.Fatalf("%s: have %v, want error %v", s, err, isErr)
+		}
+	}
+}
+
+func TestCellAt(t *testing.T) {
+	testCases := []struct {
+		kind     Token
+		level    int
+		lon, lat float64
+		want     string
+	}{
+		{kind: GEOHASH, level: 11, lon: 10.40744, lat: 57.64911, want: "u4pruydqqvj"},
+		{kind: GEOHASH, level: 5, lon: -0.1276, lat: 51.5072, want: "gcpvj"},
+		{kind: S2, level: 8, lon: -74.0060, lat: 40.7128, want: "89c25"},
+		{kind: S2, level: 0, lon: -74.0060, lat: 40.7128, want: "9"},
+		{kind: H3, level: 9, lon: -122.41795063018799, lat: 37.775938728915946, want: "8928308280fffff"},
+		{kind: H3, level: 9, lon: -122.388903, lat: 37.769377, want: "89283082e73ffff"},
+		{kind: H3, level: 7, lon: -122.0553238, lat: 37.3615593, want: "87283472bffffff"},
+		{kind: H3, level: 5, lon: -122.0553238, lat: 37.3615593, want: "85283473fffffff"},
+		{kind: H3, level: 0, lon: 10.5362, lat: 64.7, want: "8009fffffffffff"},
+		{kind: H3, level: 0, lon: -169.4638, lat: -64.7, want: "80ebfffffffffff"},
+	}
+	for _, tc := range testCases {
+		cell, err := CellAt(tc.kind, tc.level, tc.lon, tc.lat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cell.Val != tc.want || cell.Level() != tc.level {
+			t.Fatalf("%s %d: have %s at level %d, want %s", KeywordString(tc.kind), tc.level, cell.Val, cell.Level(), tc.want)
+		}
+	}
+	if _, err := CellAt(H3, 16, 1, 1); err == nil {
+		t.Fatal("have nil, want error for invalid resolution")
+	}
+	if _, err := CellAt(H3, 9, math.NaN(), 1); err == nil {
+		t.Fatal("have nil, want error for invalid point")
+	}
+	if _, err := CellAt(S2, 31, 1, 1); err == nil {
+		t.Fatal("have nil, want error for invalid level")
+	}
+}
+
+func TestCellContains(t *testing.T) {
+	testCases := []struct {
+		cells string
+		want  bool
+		err   bool
+	}{
+		{cells: `h3[891f24ac55bffff]`, want: true},
+		{cells: `h3[8928308280fffff, 871f24ac5ffffff]`, want: true},
+		{cells: `h3[8928308280fffff]`, want: false},
+		{cells: `geohash["u4pruyd"]`, want: true},
+		{cells: `geohash["u4pruye", "u4pr"]`, want: true},
+		{cells: `geohash["u4p0" .. "u4pz"]`, want: true},
+		{cells: `geohash["u4p0" .. "u4pq"]`, want: false},
+		{cells: `s2[464f3 .. 464f7]`, want: true},
+		{cells: `s2[89c25]`, want: false},
+		{cells: `[1, 2]`, err: true},
+	}
+	for _, tc := range testCases {
+		stmt, err := Parse(`when tracker_coords in ` + tc.cells)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cells := stmt.(*Trigger).When.(*BinaryExpr).Right
+		have, err := CellContains(cells, 10.40744, 57.64911)
+		if (err != nil) != tc.err {
+			t.Fatalf("%s: have %v, want error %v", tc.cells, err, tc.err)
+		}
+		if have != tc.want {
+			t.Fatalf("%s: have %v, want %v", tc.cells, have, tc.want)
+		}
+	}
+}
+
+func TestCellTypContains(t *testing.T) {
+	cell := func(kind Token, val string) *CellTyp {
+		c, err := newCell(kind, val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	testCases := []struct {
+		a, b *CellTyp
+		want bool
+	}{
+		{a: cell(H3, "8828308281fffff"), b: cell(H3, "8928308280fffff"), want: true},
+		{a: cell(H3, "8928308280fffff"), b: cell(H3, "8828308281fffff"), want: false},
+		{a: cell(H3, "8928308280fffff"), b: cell(H3, "8928308280fffff"), want: true},
+		{a: cell(GEOHASH, "u4p"), b: cell(GEOHASH, "u4pruyd"), want: true},
+		{a: cell(GEOHASH, "u4q"), b: cell(GEOHASH, "u4pruyd"), want: false},
+		{a: cell(S2, "89c"), b: cell(S2, "89c25"), want: true},
+		{a: cell(S2, "89c25"), b: cell(S2, "89c"), want: false},
+		{a: cell(S2, "89c"), b: cell(GEOHASH, "u4p"), want: false},
+	}
+	for _, tc := range testCases {
+		if have := tc.a.Contains(tc.b); have != tc.want {
+			t.Fatalf("%s contains %s: have %v, want %v", formatExpr(tc.a), formatExpr(tc.b), have, tc.want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package geoqlparser
+
+func clone(expr Expr) Expr {
+	switch typ := expr.(type) {
+	case nil:
+		return nil
+	case *BinaryExpr:
+		n := *typ
+		n.Left = clone(typ.Left)
+		n.Right = clone(typ.Right)
+		return &n
+	case *UnaryExpr:
+		n := *typ
+		n.X = clone(typ.X)
+		return &n
+	case *ParenExpr:
+		n := *typ
+		n.Expr = clone(typ.Expr)
+		return &n
+	case *CallExpr:
+		n := *typ
+		n.Args = cloneList(typ.Args)
+		return &n
+	case *HistoryExpr:
+		n := *typ
+		n.X = clone(typ.X).(*Selector)
+		if typ.Amount != nil {
+			n.Amount = clone(typ.Amount)
+			n.Within = clone(typ.Within).(*DurationTyp)
+		}
+		return &n
+	case *WindowExpr:
+		n := *typ
+		n.X = clone(typ.X)
+		n.Window = clone(typ.Window).(*DurationTyp)
+		return &n
+	case *Range:
+		n := *typ
+		n.Low = clone(typ.Low)
+		n.High = clone(typ.High)
+		return &n
+	case *ArrayTyp:
+		n := *typ
+		n.List = cloneList(typ.List)
+		return &n
+	case *Selector:
+		n := *typ
+		n.Args = cloneSet(typ.Args)
+		n.Groups = cloneSet(typ.Groups)
+		n.Tags = cloneSet(typ.Tags)
+		n.Props = cloneList(typ.Props)
+		return &n
+	case *GeometryPointTyp:
+		n := *typ
+		if typ.Radius != nil {
+			n.Radius = clone(typ.Radius).(*DistanceTyp)
+		}
+		return &n
+	case *GeometryLineTyp:
+		n := *typ
+		n.Val = append([][2]float64(nil), typ.Val...)
+		if typ.Margin != nil {
+			n.Margin = clone(typ.Margin).(*DistanceTyp)
+		}
+		return &n
+	case *GeometryPolygonTyp:
+		n := *typ
+		n.Val = make([][][2]float64, len(typ.Val))
+		for i := 0; i < len(typ.Val); i++ {
+			n.Val[i] = append([][2]float64(nil), typ.Val[i]...)
+		}
+		return &n
+	case *GeometryMultiObjectTyp:
+		n := *typ
+		n.Val = cloneList(typ.Val)
+		return &n
+	case *GeometryCollectionTyp:
+		n := *typ
+		n.Objects = cloneList(typ.Objects)
+		return &n
+	case *Assign:
+		n := *typ
+		n.Left = clone(typ.Left).(*Ident)
+		n.Right = clone(typ.Right)
+		return &n
+	case *Trigger:
+		n := *typ
+		if typ.Vars != nil {
+			n.Vars = make([]*Assign, len(typ.Vars))
+			for i := 0; i < len(typ.Vars); i++ {
+				n.Vars[i] = clone(typ.Vars[i]).(*Assign)
+			}
+		}
+		n.When = clone(typ.When)
+		n.RepeatCount = clone(typ.RepeatCount)
+		n.RepeatInterval = clone(typ.RepeatInterval)
+		n.ResetAfter = clone(typ.ResetAfter)
+		return &n
+	case *Ident:
+		n := *typ
+		return &n
+	case *Ref:
+		n := *typ
+		return &n
+	case *WildcardTyp:
+		n := *typ
+		return &n
+	case *BooleanTyp:
+		n := *typ
+		return &n
+	case *IntTyp:
+		n := *typ
+		return &n
+	case *FloatTyp:
+		n := *typ
+		return &n
+	case *StringTyp:
+		n := *typ
+		return &n
+	case *PercentTyp:
+		n := *typ
+		return &n
+	case *DurationTyp:
+		n := *typ
+		return &n
+	case *SpeedTyp:
+		n := *typ
+		return &n
+	case *DistanceTyp:
+		n := *typ
+		return &n
+	case *TemperatureTyp:
+		n := *typ
+		return &n
+	case *PressureTyp:
+		n := *typ
+		return &n
+	case *DateTyp:
+		n := *typ
+		return &n
+	case *TimeTyp:
+		n := *typ
+		return &n
+	case *WeekdayTyp:
+		n := *typ
+		return &n
+	case *MonthTyp:
+		n := *typ
+		return &n
+	case *CellTyp:
+		n := *typ
+		return &n
+	}
+	return expr
+}
+
+func cloneSet(set map[string]struct{}) map[string]struct{} {
+	if set == nil {
+		return nil
+	}
+	n := make(map[string]struct{}, len(set))
+	for k := range set {
+		n[k] = struct{}{}
+	}
+	return n
+}
+
+func cloneList(list []Expr) []Expr {
+	if list == nil {
+		return nil
+	}
+	out := make([]Expr, len(list))
+	for i := 0; i < len(list); i++ {
+		out[i] = clone(list[i])
+	}
+	return out
+}
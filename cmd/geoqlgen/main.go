@@ -0,0 +1,110 @@
+// Command geoqlgen generates a Go function from a trigger.
+//
+// Usage:
+//
+//	geoqlgen -dict dict.json [-pkg rules] [-func Match] [-o match.go] rule.geoql
+//
+// The dictionary is a JSON object of selector types, e.g.
+// {"tracker_speed": "float", "tracker_coords": "geometry", "tracker_tags": "array of string"}.
+// With -o the function is written to the file and a test scaffold to the
+// corresponding _test.go file unless it exists, otherwise to the standard output.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	geoqlparser "github.com/mmadfox/go-geoql-parser"
+)
+
+func main() {
+	dictFile := flag.String("dict", "", "JSON file of selector types")
+	pkg := flag.String("pkg", "rules", "package name")
+	fn := flag.String("func", "Match", "function name")
+	out := flag.String("o", "", "output file")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: geoqlgen -dict dict.json [-pkg rules] [-func Match] [-o match.go] rule.geoql")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *dictFile == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0), *dictFile, *out, geoqlparser.GoOptions{Package: *pkg, Func: *fn}); err != nil {
+		fmt.Fprintln(os.Stderr, "geoqlgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ruleFile, dictFile, out string, opts geoqlparser.GoOptions) error {
+	src, err := os.ReadFile(ruleFile)
+	if err != nil {
+		return err
+	}
+	stmt, err := geoqlparser.Parse(string(src))
+	if err != nil {
+		return err
+	}
+	trigger, ok := stmt.(*geoqlparser.Trigger)
+	if !ok {
+		return fmt.Errorf("%s is not a trigger", ruleFile)
+	}
+	dict, err := readDict(dictFile)
+	if err != nil {
+		return err
+	}
+	buf := bytes.NewBuffer(nil)
+	if err = geoqlparser.GenerateGo(buf, trigger, dict, opts); err != nil {
+		return err
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	if err = os.WriteFile(out, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	testFile := strings.TrimSuffix(out, ".go") + "_test.go"
+	if _, err = os.Stat(testFile); err == nil {
+		return nil
+	}
+	buf.Reset()
+	if err = geoqlparser.GenerateGoTest(buf, trigger, dict, opts); err != nil {
+		return err
+	}
+	return os.WriteFile(testFile, buf.Bytes(), 0o644)
+}
+
+func readDict(file string) (geoqlparser.Dictionary, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var types map[string]string
+	if err = json.Unmarshal(data, &types); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	dict := geoqlparser.Dict()
+	for selector, name := range types {
+		typ, ok := selectorType(name)
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown type %q of selector %s", file, name, selector)
+		}
+		dict[selector] = typ
+	}
+	return dict, nil
+}
+
+func selectorType(name string) (geoqlparser.SelectorType, bool) {
+	for typ := geoqlparser.Int; typ < geoqlparser.Any; typ++ {
+		if typ.String() == name {
+			return typ, true
+		}
+	}
+	return 0, false
+}
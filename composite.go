@@ -1,5 +1,7 @@
 package geoqlparser
 
+import "fmt"
+
 func (s *parser) parseArrayExpr() (expr Expr, err error) {
 	if !s.except(LBRACK) {
 		return nil, s.error()
@@ -9,6 +11,7 @@ func (s *parser) parseArrayExpr() (expr Expr, err error) {
 	startPos := s.t.Offset()
 	checkKind := func(k1, k2 Token) error {
 		if k1 != ILLEGAL && k1 != k2 {
+			s.err = fmt.Errorf("invalid array: elements of different types")
 			return s.error()
 		}
 		return nil
@@ -20,6 +23,10 @@ func (s *parser) parseArrayExpr() (expr Expr, err error) {
 			return nil, err
 		}
 
+		if !s.except(COMMA, RBRACK) {
+			s.err = fmt.Errorf("invalid array: expected , or ]")
+			return nil, s.errorHint("separate the elements with ,")
+		}
 		if s.except(COMMA) {
 			s.t.Unwind()
 		}
@@ -30,6 +37,7 @@ func (s *parser) parseArrayExpr() (expr Expr, err error) {
 
 		switch expr.(type) {
 		default:
+			s.err = fmt.Errorf("invalid array: unexpected %s", formatExpr(expr))
 			err = s.error()
 		case *Selector:
 			err = checkKind(arrayExpr.Kind, SELECTOR)
@@ -84,31 +92,39 @@ func (s *parser) parseArrayExpr() (expr Expr, err error) {
 }
 
 func (s *parser) parseRangeExpr(low Expr) (expr Expr, err error) {
-	_, isRangeExpr := low.(*Range)
-	if isRangeExpr {
+	if _, isRangeExpr := low.(*Range); isRangeExpr {
+		s.err = fmt.Errorf("invalid range: range of ranges")
 		return nil, s.error()
 	}
-	startPos := s.t.Offset()
 	high, err := s.parseUnaryExpr()
 	if err != nil {
 		return
 	}
+	if _, isRangeExpr := high.(*Range); isRangeExpr {
+		s.err = fmt.Errorf("invalid range: range of ranges")
+		return nil, s.error()
+	}
 	return &Range{
 		Low:  low,
 		High: high,
-		lpos: startPos,
-		rpos: s.t.Offset(),
+		lpos: low.Pos(),
+		rpos: high.End(),
 	}, nil
 }
 
 func (s *parser) parseSelectorExpr() (expr Expr, err error) {
 	selector := &Selector{Ident: s.lit, lpos: s.t.Offset()}
+	end := selector.lpos + Pos(len(selector.Ident)) - 1
 
 	s.next()
 
+	if s.except(LPAREN) {
+		return s.parseCallExpr(selector.Ident, selector.lpos)
+	}
+
 	if !s.except(LBRACE, COLON) {
 		selector.Wildcard = true
-		selector.calculateEnd(s.t.Offset())
+		selector.calculateEnd(end)
 		return selector, nil
 	}
 
@@ -118,36 +134,46 @@ func (s *parser) parseSelectorExpr() (expr Expr, err error) {
 			return nil, err
 		}
 		selector.Wildcard = true
-		selector.calculateEnd(s.t.Offset())
+		selector.calculateEnd(end)
 		return selector, nil
 	}
 
 	if s.except(LBRACE) {
 		var i int
-		for {
-			s.next()
-			if s.except(EOF, RBRACE) {
-				break
-			}
-			if s.except(COMMA) {
-				continue
-			}
-			if s.except(MUL) {
+		s.next()
+		for !s.except(RBRACE) {
+			switch s.tok {
+			default:
+				s.err = fmt.Errorf("invalid selector %s: expected *, device id, group or tag", selector.Ident)
+				return nil, s.error()
+			case MUL:
 				selector.Wildcard = true
-				continue
+			case SELECTOR:
+				i++
+				if err = s.parseSelectorFilter(selector); err != nil {
+					return nil, err
+				}
+			case STRING:
+				i++
+				if selector.Args == nil {
+					selector.Args = make(map[string]struct{})
+				}
+				selector.Args[trim(s.t.TokenText())] = struct{}{}
 			}
-			i++
-			if !s.except(STRING) {
-				return nil, s.error()
+			s.next()
+			if s.except(RBRACE) {
+				break
 			}
-			if selector.Args == nil {
-				selector.Args = make(map[string]struct{})
+			if !s.except(COMMA) {
+				s.err = fmt.Errorf("invalid selector %s: expected , or }", selector.Ident)
+				return nil, s.errorHint("separate the device ids, groups and tags with ,")
 			}
-			selector.Args[trim(s.t.TokenText())] = struct{}{}
+			s.next()
 		}
 		if i == 0 {
 			selector.Wildcard = true
 		}
+		end = s.t.Offset()
 	}
 
 	s.next()
@@ -158,7 +184,58 @@ func (s *parser) parseSelectorExpr() (expr Expr, err error) {
 			return nil, err
 		}
 	}
-	selector.calculateEnd(s.t.Offset())
+	selector.calculateEnd(end)
+	return selector, nil
+}
+
+// parseSelectorFilter parses group:"name" and tag:"name" of a selector.
+func (s *parser) parseSelectorFilter(selector *Selector) error {
+	var filter *map[string]struct{}
+	switch s.lit {
+	case "group":
+		filter = &selector.Groups
+	case "tag":
+		filter = &selector.Tags
+	default:
+		s.err = fmt.Errorf("invalid selector filter %s, expected group or tag", s.lit)
+		return s.error()
+	}
+	name := s.lit
+	s.next()
+	if !s.except(COLON) {
+		s.err = fmt.Errorf("invalid selector filter: expected %s:\"name\"", name)
+		return s.error()
+	}
+	s.next()
+	if !s.except(STRING) {
+		s.err = fmt.Errorf("invalid selector filter: expected %s:\"name\"", name)
+		return s.error()
+	}
+	if *filter == nil {
+		*filter = make(map[string]struct{})
+	}
+	(*filter)[trim(s.t.TokenText())] = struct{}{}
+	return nil
+}
+
+// parseQuantifiedExpr parses any and all of a selector of several devices.
+func (s *parser) parseQuantifiedExpr() (Expr, error) {
+	quant, pos := s.tok, s.t.Offset()
+	s.next()
+	if !s.except(SELECTOR) {
+		s.err = fmt.Errorf("invalid %s: expected selector", KeywordString(quant))
+		return nil, s.error()
+	}
+	expr, err := s.parseSelectorExpr()
+	if err != nil {
+		return nil, err
+	}
+	selector, ok := expr.(*Selector)
+	if !ok || !selector.multi() {
+		s.err = fmt.Errorf("invalid %s: expected selector of device ids, groups or tags", KeywordString(quant))
+		return nil, s.error()
+	}
+	selector.Quantifier, selector.lpos = quant, pos
 	return selector, nil
 }
 
@@ -0,0 +1,269 @@
+package geoqlparser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the expected results of testdata/conformance")
+
+// The conformance suite is described in testdata/conformance/README.md.
+func TestConformance(t *testing.T) {
+	for _, dir := range []string{"valid", "invalid"} {
+		files, err := filepath.Glob(filepath.Join("testdata", "conformance", dir, "*.geoql"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) == 0 {
+			t.Fatalf("no conformance tests in %s", dir)
+		}
+		for _, file := range files {
+			file, valid := file, dir == "valid"
+			t.Run(dir+"/"+strings.TrimSuffix(filepath.Base(file), ".geoql"), func(t *testing.T) {
+				src, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				have, ext, err := conformanceResult(string(src))
+				if valid != (ext == ".json") {
+					t.Fatalf("unexpected result:\n%s", have)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				golden := strings.TrimSuffix(file, ".geoql") + ext
+				if *update {
+					if err = os.WriteFile(golden, have, 0o644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(have, want) {
+					t.Fatalf("have:\n%s\nwant:\n%s", have, want)
+				}
+			})
+		}
+	}
+}
+
+// conformanceResult returns the AST of a valid statement with the .json
+// extension or the error of an invalid statement with the .err extension.
+func conformanceResult(src string) ([]byte, string, error) {
+	stmt, err := Parse(src)
+	if err != nil {
+		var pe *Error
+		if !errors.As(err, &pe) {
+			return nil, "", err
+		}
+		msg := "syntax error"
+		if pe.Err != nil {
+			msg = pe.Err.Error()
+		}
+		return []byte(fmt.Sprintf("%d: %s\n", pe.Offset, msg)), ".err", nil
+	}
+	b, err := json.MarshalIndent(nodeJSON(stmt), "", "  ")
+	if err != nil {
+		return nil, "", err
+	}
+	return append(b, '\n'), ".json", nil
+}
+
+type node map[string]interface{}
+
+// nodeJSON returns the language-neutral form of the AST without positions
+// and comments.
+func nodeJSON(n interface{}) interface{} {
+	switch n := n.(type) {
+	case *Trigger:
+		o := node{"node": "Trigger", "when": nodeJSON(n.When)}
+		if len(n.Vars) > 0 {
+			vars := make([]interface{}, len(n.Vars))
+			for i, v := range n.Vars {
+				vars[i] = node{"name": v.Left.Val, "value": nodeJSON(v.Right)}
+			}
+			o["vars"] = vars
+		}
+		o.set("repeatCount", n.RepeatCount)
+		o.set("repeatInterval", n.RepeatInterval)
+		o.set("resetAfter", n.ResetAfter)
+		return o
+	case *BinaryExpr:
+		return node{"node": "Binary", "op": KeywordString(n.Op), "left": nodeJSON(n.Left), "right": nodeJSON(n.Right)}
+	case *UnaryExpr:
+		return node{"node": "Unary", "op": KeywordString(n.Op), "x": nodeJSON(n.X)}
+	case *ParenExpr:
+		return node{"node": "Paren", "x": nodeJSON(n.Expr)}
+	case *CallExpr:
+		return node{"node": "Call", "func": n.Func, "args": listJSON(n.Args)}
+	case *WindowExpr:
+		return node{"node": "Window", "func": n.Func, "x": nodeJSON(n.X), "window": nodeJSON(n.Window)}
+	case *HistoryExpr:
+		o := node{"node": "History", "func": n.Func, "x": nodeJSON(n.X)}
+		if n.Within != nil {
+			o["amount"], o["within"] = nodeJSON(n.Amount), nodeJSON(n.Within)
+		}
+		return o
+	case *Selector:
+		o := node{"node": "Selector", "name": n.Ident, "wildcard": n.Wildcard}
+		if n.Quantifier != ILLEGAL {
+			o["quantifier"] = KeywordString(n.Quantifier)
+		}
+		for key, set := range map[string]map[string]struct{}{"ids": n.Args, "groups": n.Groups, "tags": n.Tags} {
+			if len(set) > 0 {
+				o[key] = setJSON(set)
+			}
+		}
+		if len(n.Props) > 0 {
+			o["props"] = listJSON(n.Props)
+		}
+		return o
+	case *WildcardTyp:
+		return node{"node": "Wildcard"}
+	case *Ref:
+		return node{"node": "Variable", "name": n.ID}
+	case *IntTyp:
+		return node{"node": "Int", "value": n.Val}
+	case *FloatTyp:
+		return node{"node": "Float", "value": n.Val}
+	case *StringTyp:
+		return node{"node": "String", "value": n.Val}
+	case *BooleanTyp:
+		return node{"node": "Boolean", "value": n.Val}
+	case *PercentTyp:
+		return node{"node": "Percent", "value": n.Val}
+	case *DurationTyp:
+		return node{"node": "Duration", "seconds": n.Val.Seconds()}
+	case *SpeedTyp:
+		return node{"node": "Speed", "value": n.Val, "unit": n.U.String()}
+	case *DistanceTyp:
+		return node{"node": "Distance", "value": n.Val, "unit": n.U.String()}
+	case *PressureTyp:
+		return node{"node": "Pressure", "value": n.Val, "unit": n.U.String()}
+	case *TemperatureTyp:
+		val := n.Val
+		if n.Vec == Minus {
+			val = -val
+		}
+		return node{"node": "Temperature", "value": val, "unit": n.U.String()}
+	case *TimeTyp:
+		o := node{"node": "Time", "hours": n.Hours, "minutes": n.Minutes, "seconds": n.Seconds}
+		if n.U != Unknown {
+			o["unit"] = n.U.String()
+		}
+		return o
+	case *DateTyp:
+		return node{"node": "Date", "year": n.Year, "month": n.Month, "day": n.Day}
+	case *WeekdayTyp:
+		return node{"node": "Weekday", "value": n.Val}
+	case *MonthTyp:
+		return node{"node": "Month", "value": n.Val}
+	case *CellTyp:
+		return node{"node": "Cell", "kind": KeywordString(n.Kind), "value": n.Val}
+	case *GeometryPointTyp:
+		o := node{"node": "Point", "coordinates": n.Val}
+		if n.Radius != nil {
+			o["radius"] = nodeJSON(n.Radius)
+		}
+		return o
+	case *GeometryLineTyp:
+		o := node{"node": "Line", "coordinates": n.Val}
+		if n.Margin != nil {
+			o["margin"] = nodeJSON(n.Margin)
+		}
+		return o
+	case *GeometryPolygonTyp:
+		return node{"node": "Polygon", "coordinates": n.Val}
+	case *GeometryMultiObjectTyp:
+		name := map[Token]string{
+			GEOMETRY_MULTIPOINT:   "MultiPoint",
+			GEOMETRY_MULTILINE:    "MultiLine",
+			GEOMETRY_MULTIPOLYGON: "MultiPolygon",
+		}[n.Kind]
+		return node{"node": name, "geometries": listJSON(n.Val)}
+	case *GeometryCollectionTyp:
+		return node{"node": "Collection", "geometries": listJSON(n.Objects)}
+	case *ArrayTyp:
+		return node{"node": "Array", "items": listJSON(n.List)}
+	case *Range:
+		return node{"node": "Range", "low": nodeJSON(n.Low), "high": nodeJSON(n.High)}
+	}
+	panic(fmt.Sprintf("nodeJSON: unexpected %T", n))
+}
+
+func (o node) set(key string, expr Expr) {
+	if expr != nil {
+		o[key] = nodeJSON(expr)
+	}
+}
+
+func listJSON(list []Expr) []interface{} {
+	out := make([]interface{}, len(list))
+	for i, expr := range list {
+		out[i] = nodeJSON(expr)
+	}
+	return out
+}
+
+func setJSON(set map[string]struct{}) []string {
+	out := make([]string, 0, len(set))
+	for key := range set {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+var (
+	ebnfComment    = regexp.MustCompile(`(?s)\(\*.*?\*\)`)
+	ebnfLiteral    = regexp.MustCompile("\"[^\"]*\"|`[^`]*`")
+	ebnfProduction = regexp.MustCompile(`(?m)^([A-Za-z_]+)\s*=`)
+	ebnfName       = regexp.MustCompile(`[A-Za-z_]+`)
+)
+
+// TestGrammar checks that every production of grammar.ebnf is defined once
+// and used, and that the names used are defined. Statement and comment
+// are not used by other productions.
+func TestGrammar(t *testing.T) {
+	b, err := os.ReadFile("grammar.ebnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := ebnfComment.ReplaceAllString(string(b), "")
+	src = ebnfLiteral.ReplaceAllString(src, `""`)
+	defined := make(map[string]bool)
+	for _, m := range ebnfProduction.FindAllStringSubmatch(src, -1) {
+		if _, ok := defined[m[1]]; ok {
+			t.Errorf("production %s is defined twice", m[1])
+		}
+		defined[m[1]] = false
+	}
+	for _, prod := range ebnfProduction.Split(src, -1)[1:] {
+		if !strings.HasSuffix(strings.TrimSpace(prod), ".") {
+			t.Errorf("production %q does not end with a period", strings.TrimSpace(prod))
+		}
+		for _, name := range ebnfName.FindAllString(prod, -1) {
+			if _, ok := defined[name]; !ok {
+				t.Errorf("production %s is not defined", name)
+			}
+			defined[name] = true
+		}
+	}
+	for name, used := range defined {
+		if !used && name != "Statement" && name != "comment" {
+			t.Errorf("production %s is not used", name)
+		}
+	}
+}
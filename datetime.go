@@ -5,439 +5,215 @@ import (
 	"strconv"
 )
 
+var calendarFormats = map[Token]string{
+	DATE:    "date[YYYY-MM-DD]",
+	TIME:    "time[HH:MM:SS]",
+	WEEKDAY: "weekday[Mon]",
+	MONTH:   "month[Jan]",
+}
+
+var weekdayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
 func (s *parser) parseDateExpr() (expr Expr, err error) {
-	lpos := s.t.Offset()
+	return s.parseCalendarExpr(s.parseDateValue)
+}
+
+func (s *parser) parseTimeExpr() (expr Expr, err error) {
+	return s.parseCalendarExpr(s.parseTimeValue)
+}
+
+func (s *parser) parseWeekdayExpr() (expr Expr, err error) {
+	if s.t.peek() == '(' {
+		lpos := s.t.Offset()
+		s.next()
+		return s.parseCallExpr("weekday", lpos)
+	}
+	return s.parseCalendarExpr(s.parseWeekdayValue)
+}
+
+func (s *parser) parseMonthExpr() (expr Expr, err error) {
+	if s.t.peek() == '(' {
+		lpos := s.t.Offset()
+		s.next()
+		return s.parseCallExpr("month", lpos)
+	}
+	return s.parseCalendarExpr(s.parseMonthValue)
+}
+
+// parseCalendarExpr parses a value, an array of values or a range of values
+// of a date, time, weekday or month literal, e.g. date[2030-10-02 .. 2030-10-09].
+// value parses a value at the current token and scans the token after it.
+func (s *parser) parseCalendarExpr(value func(lpos Pos) (Expr, error)) (Expr, error) {
+	kind, lpos := s.tok, s.t.Offset()
+	name, format := KeywordString(kind), calendarFormats[kind]
 	s.next()
 	if !s.except(LBRACK) {
-		s.err = fmt.Errorf("invalid date format: got date without body, expected date[YYYY-MM-DD]")
+		s.err = fmt.Errorf("invalid %s format: got %s without body, expected %s", name, name, format)
 		return nil, s.error()
 	}
-	var arrayExpr *ArrayTyp
-	var rangeExpr *Range
-	isDay := func(n int) bool { return n == 3 }
-	isMonth := func(n int) bool { return n == 1 }
-	isArrayTyp := func() bool { return arrayExpr != nil }
-	isRangeTyp := func() bool { return rangeExpr != nil }
+	var list []Expr
+	var isRange bool
 	for {
-		var y, m, d int
 		s.next()
-		if s.except(EOF, RBRACK) {
-			if y == 0 {
-				s.err = fmt.Errorf("invalid date format: got date[], expected date[YYYY-MM-DD]")
-				return nil, s.error()
-			}
-			break
-		}
-		if !s.except(INT, SUB, COMMA, RANGE) {
-			return nil, s.error()
-		}
-		y, err = strconv.Atoi(s.lit)
-		if err != nil {
-			s.err = err
+		if s.except(RBRACK) && len(list) == 0 {
+			s.err = fmt.Errorf("invalid %s format: got %s[], expected %s", name, name, format)
 			return nil, s.error()
 		}
-		var sep int
-		for i := 0; i <= 3; i++ {
-			s.next()
-			if s.except(SUB) {
-				sep++
-				continue
-			}
-			if !s.except(SUB, INT) || s.except(EOF) {
-				err = fmt.Errorf("invalid date format: expected date[YYYY-MM-DD]")
-			}
-			switch {
-			case isMonth(i):
-				m, err = strconv.Atoi(s.lit)
-			case isDay(i):
-				d, err = strconv.Atoi(s.lit)
-			}
-			if err != nil {
-				break
-			}
-		}
+		val, err := value(lpos)
 		if err != nil {
-			s.err = err
-			return nil, s.error()
+			return nil, err
 		}
-		if d < 1 || d > 31 {
-			s.err = fmt.Errorf("invalid day format: got %d, expected 1-31", d)
-			return nil, s.error()
+		list = append(list, val)
+		if s.except(COMMA) && !isRange {
+			continue
 		}
-		if m < 1 || m > 12 {
-			s.err = fmt.Errorf("invalid month format: got %d, expected 1-12", m)
-			return nil, s.error()
-		}
-		if y < 2022 || y > 2200 {
-			s.err = fmt.Errorf("invalid year format: got %d, expected 2022-2200", y)
-			return nil, s.error()
+		if s.except(RANGE) && len(list) == 1 {
+			isRange = true
+			continue
 		}
-		if sep < 1 {
-			s.err = fmt.Errorf("invalid date format")
+		if !s.except(RBRACK) {
+			s.err = fmt.Errorf("invalid %s format: expected , or .. or ]", name)
 			return nil, s.error()
 		}
-		s.next()
-		date := &DateTyp{
-			Year:  y,
-			Month: m,
-			Day:   d,
-			lpos:  lpos,
-			rpos:  s.t.Offset(),
-		}
-		switch s.tok {
-		case COMMA:
-			if rangeExpr != nil {
-				return nil, s.error()
-			}
-			if arrayExpr == nil {
-				arrayExpr = &ArrayTyp{Kind: DATE, List: make([]Expr, 0)}
-			}
-			arrayExpr.List = append(arrayExpr.List, date)
-		case RANGE, PERIOD:
-			if arrayExpr != nil {
-				return nil, s.error()
-			}
-			if rangeExpr == nil {
-				rangeExpr = &Range{}
-			}
-			rangeExpr.Low = date
-		}
-		if s.except(RBRACK) {
-			switch {
-			default:
-				s.next()
-				return date, nil
-			case isArrayTyp():
-				arrayExpr.List = append(arrayExpr.List, date)
-				arrayExpr.lpos = lpos
-				arrayExpr.rpos = s.t.Offset()
-				s.next()
-				return arrayExpr, nil
-			case isRangeTyp():
-				rangeExpr.High = date
-				rangeExpr.lpos = lpos
-				rangeExpr.rpos = s.t.Offset()
-				s.next()
-				return rangeExpr, nil
-			}
-		}
+		break
 	}
-	return
-}
-
-func (s *parser) parseTimeExpr() (expr Expr, err error) {
-	lpos := s.t.Offset()
+	rpos := s.t.Offset()
 	s.next()
-	if !s.except(LBRACK) {
-		s.err = fmt.Errorf("invalid time format: got time without body, expected time[HH:MM:SS] or time[HH:MM]")
-		return nil, s.error()
+	switch {
+	case isRange:
+		return &Range{Low: list[0], High: list[1], lpos: lpos, rpos: rpos}, nil
+	case len(list) > 1:
+		return &ArrayTyp{Kind: kind, List: list, lpos: lpos, rpos: rpos}, nil
 	}
-	var arrayExpr *ArrayTyp
-	var rangeExpr *Range
-	isSeconds := func(n int) bool { return n == 3 }
-	isMinutes := func(n int) bool { return n == 1 }
-	isArrayTyp := func() bool { return arrayExpr != nil }
-	isRangeTyp := func() bool { return rangeExpr != nil }
-	for {
-		var h, m, c int
-		s.next()
-		if s.except(EOF, RBRACK) {
-			if h == 0 {
-				s.err = fmt.Errorf("invalid time format: got time[], expected time[HH:MM:SS]")
+	return list[0], nil
+}
+
+// parseDateValue parses YYYY-MM-DD.
+func (s *parser) parseDateValue(lpos Pos) (Expr, error) {
+	var parts [3]int
+	for i := range parts {
+		if i > 0 {
+			if !s.except(SUB) {
+				s.err = fmt.Errorf("invalid date format: expected date[YYYY-MM-DD]")
 				return nil, s.error()
 			}
-			break
-		}
-		if !s.except(INT, COLON, COMMA, RANGE) {
-			return nil, s.error()
+			s.next()
 		}
-		h, err = strconv.Atoi(s.lit)
-		if err != nil {
-			s.err = err
+		if !s.except(INT) {
+			s.err = fmt.Errorf("invalid date format: expected date[YYYY-MM-DD]")
 			return nil, s.error()
 		}
-		var sep int
-		for i := 0; i <= 3; i++ {
-			s.next()
-			if s.except(COLON) {
-				sep++
-				continue
-			}
-			if s.except(RBRACK, COMMA, RANGE, SELECTOR) {
-				s.t.Reset()
-				break
-			}
-			if !s.except(COLON, INT) || s.except(EOF) {
-				err = fmt.Errorf("invalid time format: expected time[HH:MM:SS]")
-			}
-			switch {
-			case isMinutes(i):
-				m, err = strconv.Atoi(s.lit)
-			case isSeconds(i):
-				c, err = strconv.Atoi(s.lit)
-			}
-			if err != nil {
-				break
-			}
-		}
+		n, err := strconv.Atoi(s.lit)
 		if err != nil {
 			s.err = err
 			return nil, s.error()
 		}
-		if h < 0 || h > 24 {
-			s.err = fmt.Errorf("invalid hour: got %d, expected 0-24", h)
-			return nil, s.error()
-		}
-		if m < 0 || m > 59 {
-			s.err = fmt.Errorf("invalid minutes: got %d, expected 0-59", m)
-			return nil, s.error()
-		}
-		if c < 0 || c > 59 {
-			s.err = fmt.Errorf("invalid seconds: got %d, expected 0-59", c)
-			return nil, s.error()
-		}
-		if sep < 1 {
-			s.err = fmt.Errorf("invalid time format")
-			return nil, s.error()
-		}
+		parts[i] = n
 		s.next()
-		time_ := &TimeTyp{
-			Hours:   h,
-			Minutes: m,
-			Seconds: c,
-			lpos:    lpos,
-			rpos:    s.t.Offset(),
-		}
-
-		if s.except(SELECTOR) {
-			if !isTimeUnit(s.lit) {
-				s.err = fmt.Errorf("invalid unit time: got %s, expected AM or PM", s.lit)
-				return nil, s.error()
-			}
-			time_.U = unitFromString(s.lit)
-			time_.rpos = s.t.Offset() + time_.U.size()
-			s.next()
-		}
+	}
+	y, m, d := parts[0], parts[1], parts[2]
+	if s.err = checkDate(y, m, d); s.err != nil {
+		return nil, s.error()
+	}
+	return &DateTyp{Year: y, Month: m, Day: d, lpos: lpos, rpos: s.t.Offset()}, nil
+}
 
-		switch s.tok {
-		case COMMA:
-			if rangeExpr != nil {
-				return nil, s.error()
-			}
-			if arrayExpr == nil {
-				arrayExpr = &ArrayTyp{Kind: TIME, List: make([]Expr, 0)}
-			}
-			arrayExpr.List = append(arrayExpr.List, time_)
-		case RANGE, PERIOD:
-			if arrayExpr != nil {
-				return nil, s.error()
-			}
-			if rangeExpr == nil {
-				rangeExpr = &Range{}
-			}
-			rangeExpr.Low = time_
-		}
-		if s.except(RBRACK) {
-			switch {
-			default:
-				s.next()
-				return time_, nil
-			case isArrayTyp():
-				arrayExpr.List = append(arrayExpr.List, time_)
-				arrayExpr.lpos = lpos
-				arrayExpr.rpos = s.t.Offset()
-				s.next()
-				return arrayExpr, nil
-			case isRangeTyp():
-				rangeExpr.High = time_
-				rangeExpr.lpos = lpos
-				rangeExpr.rpos = s.t.Offset()
-				s.next()
-				return rangeExpr, nil
-			}
-		}
+// checkDate reports an error if the date is out of the range of date literals.
+func checkDate(y, m, d int) error {
+	if d < 1 || d > 31 {
+		return fmt.Errorf("invalid day format: got %d, expected 1-31", d)
+	}
+	if m < 1 || m > 12 {
+		return fmt.Errorf("invalid month format: got %d, expected 1-12", m)
+	}
+	if y < 2022 || y > 2200 {
+		return fmt.Errorf("invalid year format: got %d, expected 2022-2200", y)
 	}
-	return
+	return nil
 }
 
-func (s *parser) parseWeekdayExpr() (expr Expr, err error) {
-	lpos := s.t.Offset()
-	s.next()
-	if !s.except(LBRACK) {
-		s.err = fmt.Errorf("invalid weekday format: got without body, expected weekday[Mon]")
-		return nil, s.error()
+// checkTime reports an error if the time is out of the range of time literals.
+func checkTime(h, m, c int) error {
+	if h < 0 || h > 24 {
+		return fmt.Errorf("invalid hour: got %d, expected 0-24", h)
 	}
-	var arrayExpr *ArrayTyp
-	var rangeExpr *Range
-	isArrayTyp := func() bool { return arrayExpr != nil }
-	isRangeTyp := func() bool { return rangeExpr != nil }
-	for {
-		var weekday int
-		s.next()
-		if s.except(EOF, RBRACK) {
-			if weekday == 0 {
-				s.err = fmt.Errorf("invalid weekday format: got weekday[], expected weekday[Mon]")
-				return nil, s.error()
+	if m < 0 || m > 59 {
+		return fmt.Errorf("invalid minutes: got %d, expected 0-59", m)
+	}
+	if c < 0 || c > 59 {
+		return fmt.Errorf("invalid seconds: got %d, expected 0-59", c)
+	}
+	return nil
+}
+
+// parseTimeValue parses HH:MM or HH:MM:SS with an optional AM or PM.
+func (s *parser) parseTimeValue(lpos Pos) (Expr, error) {
+	var parts [3]int
+	var n int
+	for n < len(parts) {
+		if n > 0 {
+			if !s.except(COLON) {
+				break
 			}
-			break
+			s.next()
 		}
-		if !s.except(SELECTOR) {
+		if !s.except(INT) {
+			s.err = fmt.Errorf("invalid time format: expected time[HH:MM:SS]")
 			return nil, s.error()
 		}
-		switch s.lit {
-		default:
-			s.err = fmt.Errorf("invalid weekday format got %s, expected weekday[Mon, ...]", s.lit)
+		v, err := strconv.Atoi(s.lit)
+		if err != nil {
+			s.err = err
 			return nil, s.error()
-		case "sun":
-			weekday = 0
-		case "mon":
-			weekday = 1
-		case "tue":
-			weekday = 2
-		case "wed":
-			weekday = 3
-		case "thu":
-			weekday = 4
-		case "fri":
-			weekday = 5
-		case "sat":
-			weekday = 6
 		}
+		parts[n] = v
+		n++
 		s.next()
-		wd := &WeekdayTyp{Val: weekday, lpos: lpos, rpos: s.t.Offset()}
-		switch s.tok {
-		case COMMA:
-			if rangeExpr != nil {
-				return nil, s.error()
-			}
-			if arrayExpr == nil {
-				arrayExpr = &ArrayTyp{Kind: WEEKDAY, List: make([]Expr, 0)}
-			}
-			arrayExpr.List = append(arrayExpr.List, wd)
-		case RANGE, PERIOD:
-			if arrayExpr != nil {
-				return nil, s.error()
-			}
-			if rangeExpr == nil {
-				rangeExpr = &Range{}
-			}
-			rangeExpr.Low = wd
-		}
-		if s.except(RBRACK) {
-			switch {
-			default:
-				s.next()
-				return wd, nil
-			case isArrayTyp():
-				arrayExpr.List = append(arrayExpr.List, wd)
-				arrayExpr.lpos = lpos
-				arrayExpr.rpos = s.t.Offset()
-				s.next()
-				return arrayExpr, nil
-			case isRangeTyp():
-				rangeExpr.High = wd
-				rangeExpr.lpos = lpos
-				rangeExpr.rpos = s.t.Offset()
-				s.next()
-				return rangeExpr, nil
-			}
-		}
 	}
-	return
-}
-
-func (s *parser) parseMonthExpr() (expr Expr, err error) {
-	lpos := s.t.Offset()
-	s.next()
-	if !s.except(LBRACK) {
-		s.err = fmt.Errorf("invalid month format: got without body, expectedl month[Jan]")
+	if n < 2 {
+		s.err = fmt.Errorf("invalid time format: expected time[HH:MM:SS]")
 		return nil, s.error()
 	}
-	var arrayExpr *ArrayTyp
-	var rangeExpr *Range
-	isArrayTyp := func() bool { return arrayExpr != nil }
-	isRangeTyp := func() bool { return rangeExpr != nil }
-	for {
-		var month int
-		s.next()
-		if s.except(EOF, RBRACK) {
-			if month == 0 {
-				s.err = fmt.Errorf("invalid month format: got month[], expected month[Jan]")
-				return nil, s.error()
-			}
-			break
-		}
-		if !s.except(SELECTOR) {
-			return nil, s.error()
-		}
-		switch s.lit {
-		default:
-			s.err = fmt.Errorf("invalid month format got %s, expected month[Mon, ...]", s.lit)
+	h, m, c := parts[0], parts[1], parts[2]
+	if s.err = checkTime(h, m, c); s.err != nil {
+		return nil, s.error()
+	}
+	t := &TimeTyp{Hours: h, Minutes: m, Seconds: c, lpos: lpos}
+	if s.except(SELECTOR) {
+		if !isTimeUnit(s.lit) {
+			s.err = fmt.Errorf("invalid unit time: got %s, expected AM or PM", s.lit)
 			return nil, s.error()
-		case "jan":
-			month = 1
-		case "feb":
-			month = 2
-		case "mar":
-			month = 3
-		case "apr":
-			month = 4
-		case "may":
-			month = 5
-		case "jun":
-			month = 6
-		case "jul":
-			month = 7
-		case "aug":
-			month = 8
-		case "sep":
-			month = 9
-		case "oct":
-			month = 10
-		case "nov":
-			month = 11
-		case "dec":
-			month = 12
 		}
+		t.U = unitFromString(s.lit)
 		s.next()
-		wd := &MonthTyp{Val: month, lpos: lpos, rpos: s.t.Offset()}
-		switch s.tok {
-		case COMMA:
-			if rangeExpr != nil {
-				return nil, s.error()
-			}
-			if arrayExpr == nil {
-				arrayExpr = &ArrayTyp{Kind: MONTH, List: make([]Expr, 0)}
-			}
-			arrayExpr.List = append(arrayExpr.List, wd)
-		case RANGE, PERIOD:
-			if arrayExpr != nil {
-				return nil, s.error()
-			}
-			if rangeExpr == nil {
-				rangeExpr = &Range{}
-			}
-			rangeExpr.Low = wd
-		}
-		if s.except(RBRACK) {
-			switch {
-			default:
-				s.next()
-				return wd, nil
-			case isArrayTyp():
-				arrayExpr.List = append(arrayExpr.List, wd)
-				arrayExpr.lpos = lpos
-				arrayExpr.rpos = s.t.Offset()
-				s.next()
-				return arrayExpr, nil
-			case isRangeTyp():
-				rangeExpr.High = wd
-				rangeExpr.lpos = lpos
-				rangeExpr.rpos = s.t.Offset()
-				s.next()
-				return rangeExpr, nil
-			}
-		}
 	}
-	return
+	t.rpos = s.t.Offset()
+	return t, nil
+}
+
+func (s *parser) parseWeekdayValue(lpos Pos) (Expr, error) {
+	day, ok := weekdayNames[s.lit]
+	if !s.except(SELECTOR) || !ok {
+		s.err = fmt.Errorf("invalid weekday format got %s, expected weekday[Mon, ...]", s.lit)
+		return nil, s.error()
+	}
+	s.next()
+	return &WeekdayTyp{Val: day, lpos: lpos, rpos: s.t.Offset()}, nil
+}
+
+func (s *parser) parseMonthValue(lpos Pos) (Expr, error) {
+	month, ok := monthNames[s.lit]
+	if !s.except(SELECTOR) || !ok {
+		s.err = fmt.Errorf("invalid month format got %s, expected month[Jan, ...]", s.lit)
+		return nil, s.error()
+	}
+	s.next()
+	return &MonthTyp{Val: month, lpos: lpos, rpos: s.t.Offset()}, nil
 }
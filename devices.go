@@ -0,0 +1,61 @@
+package geoqlparser
+
+import "fmt"
+
+// DeviceResolver expands the groups and tags of selectors into device ids
+// at evaluation time, e.g. tracker_speed{group:"north-fleet"}.
+type DeviceResolver interface {
+	GroupDevices(group string) ([]string, error)
+	TagDevices(tag string) ([]string, error)
+}
+
+// ResolveDevices returns the sorted ids of the devices the selector refers to:
+// the device ids, the devices of the groups and the tagged devices.
+// The wildcard refers to the current device. The resolver may be nil
+// when the selector has neither groups nor tags.
+func ResolveDevices(r DeviceResolver, s *Selector, current string) ([]string, error) {
+	set := make(map[string]struct{}, len(s.Args))
+	if s.Wildcard && len(current) > 0 {
+		set[current] = struct{}{}
+	}
+	for id := range s.Args {
+		set[id] = struct{}{}
+	}
+	if (len(s.Groups) > 0 || len(s.Tags) > 0) && r == nil {
+		return nil, fmt.Errorf("geoql: %s: no device resolver", formatExpr(s))
+	}
+	for _, group := range sortedKeys(s.Groups) {
+		ids, err := r.GroupDevices(group)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			set[id] = struct{}{}
+		}
+	}
+	for _, tag := range sortedKeys(s.Tags) {
+		ids, err := r.TagDevices(tag)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			set[id] = struct{}{}
+		}
+	}
+	return sortedKeys(set), nil
+}
+
+// Quantify combines the results of a comparison evaluated for each device of the selector.
+// any requires at least one true result. all and selectors without a quantifier require
+// every result to be true. There must be at least one result.
+func Quantify(s *Selector, results []bool) bool {
+	if len(results) == 0 {
+		return false
+	}
+	for _, ok := range results {
+		if ok == (s.Quantifier == ANY) {
+			return ok
+		}
+	}
+	return s.Quantifier != ANY
+}
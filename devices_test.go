@@ -0,0 +1,162 @@
+package geoqlparser
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseSelectorFilters(t *testing.T) {
+	testCases := []struct {
+		name string
+		s    string
+		want string
+		err  bool
+	}{
+		{
+			name: "group",
+			s:    `when tracker_speed{group:"north-fleet"} > 80Kph`,
+			want: `>(tracker_speed{group:"north-fleet"}, 80Kph)`,
+		},
+		{
+			name: "ids groups and tags",
+			s:    `when tracker_speed{tag:"van", "b", group:"g", "a", *} > 1`,
+			want: `>(tracker_speed{*, "a", "b", group:"g", tag:"van"}, 1)`,
+		},
+		{
+			name: "any",
+			s:    `when any tracker_speed{"a", tag:"x"} > 80Kph`,
+			want: `>(any tracker_speed{"a", tag:"x"}, 80Kph)`,
+		},
+		{
+			name: "all",
+			s:    `when all tracker_coords{group:"g"} intersects @zone and tracker_speed > 1`,
+			want: `and(intersects(all tracker_coords{group:"g"}, @zone), >(tracker_speed, 1))`,
+		},
+		{
+			name: "quantifier without devices",
+			s:    `when any tracker_speed > 1`,
+			err:  true,
+		},
+		{
+			name: "quantifier of wildcard",
+			s:    `when all tracker_speed{*} > 1`,
+			err:  true,
+		},
+		{
+			name: "quantifier of literal",
+			s:    `when any 1 > 1`,
+			err:  true,
+		},
+		{
+			name: "unknown filter",
+			s:    `when tracker_speed{foo:"x"} > 1`,
+			err:  true,
+		},
+		{
+			name: "filter without name",
+			s:    `when tracker_speed{group 1} > 1`,
+			err:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := Parse(tc.s)
+			if tc.err {
+				if err == nil {
+					t.Fatal("have nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := sexpr(stmt.(*Trigger).When); have != tc.want {
+				t.Fatalf("have %s, want %s", have, tc.want)
+			}
+			buf := bytes.NewBuffer(nil)
+			if err = Format(buf, stmt); err != nil {
+				t.Fatal(err)
+			}
+			again, err := Parse(buf.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := sexpr(again.(*Trigger).When); have != tc.want {
+				t.Fatalf("have %s, want %s after format", have, tc.want)
+			}
+		})
+	}
+}
+
+type testResolver map[string][]string
+
+func (r testResolver) GroupDevices(group string) ([]string, error) {
+	ids, ok := r["group:"+group]
+	if !ok {
+		return nil, errors.New("unknown group " + group)
+	}
+	return ids, nil
+}
+
+func (r testResolver) TagDevices(tag string) ([]string, error) {
+	return r["tag:"+tag], nil
+}
+
+func TestResolveDevices(t *testing.T) {
+	r := testResolver{
+		"group:north": {"b", "c"},
+		"tag:van":     {"c", "d"},
+	}
+	testCases := []struct {
+		s    string
+		want []string
+		err  bool
+	}{
+		{s: `when tracker_speed > 1`, want: []string{"cur"}},
+		{s: `when tracker_speed{"a"} > 1`, want: []string{"a"}},
+		{s: `when tracker_speed{*, "a", group:"north", tag:"van"} > 1`, want: []string{"a", "b", "c", "cur", "d"}},
+		{s: `when tracker_speed{tag:"truck"} > 1`, want: []string{}},
+		{s: `when tracker_speed{group:"south"} > 1`, err: true},
+	}
+	for _, tc := range testCases {
+		stmt, err := Parse(tc.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		selector := stmt.(*Trigger).When.(*BinaryExpr).Left.(*Selector)
+		have, err := ResolveDevices(r, selector, "cur")
+		if (err != nil) != tc.err {
+			t.Fatalf("%s: have %v, want error %v", tc.s, err, tc.err)
+		}
+		if !tc.err && !reflect.DeepEqual(have, tc.want) {
+			t.Fatalf("%s: have %v, want %v", tc.s, have, tc.want)
+		}
+	}
+	if _, err := ResolveDevices(nil, &Selector{Ident: "s", Groups: map[string]struct{}{"g": {}}}, ""); err == nil {
+		t.Fatal("have nil, want error without resolver")
+	}
+}
+
+func TestQuantify(t *testing.T) {
+	testCases := []struct {
+		quant   Token
+		results []bool
+		want    bool
+	}{
+		{quant: ANY, results: []bool{false, true}, want: true},
+		{quant: ANY, results: []bool{false, false}, want: false},
+		{quant: ANY, results: nil, want: false},
+		{quant: ALL, results: []bool{true, true}, want: true},
+		{quant: ALL, results: []bool{true, false}, want: false},
+		{quant: ALL, results: nil, want: false},
+		{quant: ILLEGAL, results: []bool{true}, want: true},
+		{quant: ILLEGAL, results: []bool{false, true}, want: false},
+	}
+	for _, tc := range testCases {
+		if have := Quantify(&Selector{Quantifier: tc.quant}, tc.results); have != tc.want {
+			t.Fatalf("%s %v: have %v, want %v", KeywordString(tc.quant), tc.results, have, tc.want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package geoqlparser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// TypeError is an error of CheckType at the span of an expression.
+type TypeError struct {
+	Pos  Pos
+	End  Pos
+	Err  error
+	Hint string
+}
+
+func (e *TypeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TypeError) Unwrap() error {
+	return e.Err
+}
+
+// RenderOptions controls RenderErrorWithOptions.
+type RenderOptions struct {
+	// Context is the number of source lines written before and after
+	// the line of the error.
+	Context int
+	// Color highlights the output with ANSI escape sequences.
+	Color bool
+}
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiError = "\x1b[1;31m"
+	ansiFrame = "\x1b[34m"
+	ansiHint  = "\x1b[36m"
+)
+
+// RenderError writes err with the line of src at which it occurred.
+func RenderError(w io.StringWriter, src string, err error) error {
+	return RenderErrorWithOptions(w, src, err, RenderOptions{})
+}
+
+// RenderErrorWithOptions writes err with the line of src at which it occurred,
+// a caret range under the span of the error and the hint. err is an *Error of
+// Parse, a *TypeError of CheckType or a *LimitError of ParseReader, other
+// errors are written without the source.
+func RenderErrorWithOptions(w io.StringWriter, src string, err error, opts RenderOptions) error {
+	if err == nil {
+		return nil
+	}
+	paint := func(color, s string) string {
+		if !opts.Color {
+			return s
+		}
+		return color + s + ansiReset
+	}
+	var b strings.Builder
+	msg, hint, pos, end, ok := errorSpan(err)
+	b.WriteString(paint(ansiError, "error") + paint(ansiBold, ": "+msg) + "\n")
+	if !ok {
+		_, err = w.WriteString(b.String())
+		return err
+	}
+
+	lines := strings.Split(src, "\n")
+	if pos >= len(src) {
+		// errors at the end of the source point after the last character
+		pos = len(strings.TrimRight(src, " \t\r\n"))
+		end = pos
+	}
+	if end < pos {
+		end = pos
+	}
+	line, col := 0, pos
+	for col > len(lines[line]) {
+		col -= len(lines[line]) + 1
+		line++
+	}
+	text := strings.TrimSuffix(lines[line], "\r")
+	width := end - pos + 1
+	if col+width > len(text) {
+		width = len(text) - col
+	}
+	for width > 1 && (text[col+width-1] == ' ' || text[col+width-1] == '\t') {
+		width--
+	}
+
+	first, last := line-opts.Context, line+opts.Context
+	if first < 0 {
+		first = 0
+	}
+	if last >= len(lines) {
+		last = len(lines) - 1
+	}
+	gutter := len(strconv.Itoa(last + 1))
+	margin := strings.Repeat(" ", gutter)
+	b.WriteString(fmt.Sprintf("%s%s line %d, column %d\n", margin, paint(ansiFrame, "-->"),
+		line+1, utf8.RuneCountInString(text[:col])+1))
+	b.WriteString(margin + paint(ansiFrame, " |") + "\n")
+	for i := first; i <= last; i++ {
+		num := strconv.Itoa(i + 1)
+		b.WriteString(paint(ansiFrame, strings.Repeat(" ", gutter-len(num))+num+" |"))
+		if s := strings.TrimRight(lines[i], " \t\r"); s != "" {
+			b.WriteString(" " + s)
+		}
+		b.WriteString("\n")
+		if i != line {
+			continue
+		}
+		carets := 1
+		if width > 0 {
+			carets = utf8.RuneCountInString(text[col : col+width])
+		}
+		b.WriteString(margin + paint(ansiFrame, " |") + " " + indentOf(text[:col]) +
+			paint(ansiError, strings.Repeat("^", carets)) + "\n")
+	}
+	if hint != "" {
+		b.WriteString(margin + paint(ansiFrame, " =") + " " + paint(ansiHint, "hint: "+hint) + "\n")
+	}
+	_, err = w.WriteString(b.String())
+	return err
+}
+
+// errorSpan returns the message, the hint and the span of the source
+// at which err occurred, end is the last byte of the span.
+func errorSpan(err error) (msg, hint string, pos, end int, ok bool) {
+	var (
+		pe *Error
+		te *TypeError
+		le *LimitError
+	)
+	switch {
+	case errors.As(err, &pe):
+		msg = "syntax error"
+		if pe.Err != nil {
+			msg = pe.Err.Error()
+		}
+		end = pe.Offset + len(pe.Lit) - 1
+		return msg, pe.Hint, pe.Offset, end, true
+	case errors.As(err, &te):
+		return te.Err.Error(), te.Hint, int(te.Pos), int(te.End), true
+	case errors.As(err, &le):
+		return le.Error(), "", le.Offset, le.Offset, true
+	}
+	return err.Error(), "", 0, 0, false
+}
+
+// indentOf returns the white space that aligns the text after s,
+// tabs are kept to match the width of the source.
+func indentOf(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
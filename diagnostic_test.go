@@ -0,0 +1,137 @@
+package geoqlparser
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRenderError(t *testing.T) {
+	testCases := []struct {
+		name  string
+		s     string
+		check bool
+		opts  RenderOptions
+		want  string
+	}{
+		{
+			name: "syntax error with hint",
+			s:    `when tracker_a in [1 2]`,
+			want: `error: invalid array: expected , or ]
+ --> line 1, column 22
+  |
+1 | when tracker_a in [1 2]
+  |                      ^
+  = hint: separate the elements with ,
+`,
+		},
+		{
+			name: "context and tabs",
+			s:    "trigger\nset\n\ta = 1\nwhen\n\ttracker_a > 1 tracker_b\n\tand c",
+			opts: RenderOptions{Context: 1},
+			want: `error: unexpected tracker_b after the statement
+ --> line 5, column 16
+  |
+4 | when
+5 | 	tracker_a > 1 tracker_b
+  | 	              ^^^^^^^^^
+6 | 	and c
+  = hint: join the conditions with and, or or xor
+`,
+		},
+		{
+			name: "end of source",
+			s:    "when (tracker_a > 1\n",
+			want: `error: invalid parenthesized expression: expected )
+ --> line 1, column 20
+  |
+1 | when (tracker_a > 1
+  |                    ^
+  = hint: close the parenthesis with )
+`,
+		},
+		{
+			name:  "type error",
+			s:     "when s_int > 1\n  and s_int == \"x\"",
+			check: true,
+			opts:  RenderOptions{Context: 5},
+			want: `error: invalid operator: s_int == "x" (mismatched types)
+ --> line 2, column 7
+  |
+1 | when s_int > 1
+2 |   and s_int == "x"
+  |       ^^^^^^^^^^^^
+`,
+		},
+		{
+			name:  "type error of a call",
+			s:     `when abs(s_string) > 1`,
+			check: true,
+			want: `error: invalid call of abs(s_string): argument 1 is not float
+ --> line 1, column 6
+  |
+1 | when abs(s_string) > 1
+  |      ^^^^^^^^^^^^^
+`,
+		},
+		{
+			name: "color",
+			s:    `when a > 1)`,
+			opts: RenderOptions{Color: true},
+			want: "\x1b[1;31merror\x1b[0m\x1b[1m: unexpected ) after the statement\x1b[0m\n" +
+				" \x1b[34m-->\x1b[0m line 1, column 11\n" +
+				" \x1b[34m |\x1b[0m\n" +
+				"\x1b[34m1 |\x1b[0m when a > 1)\n" +
+				" \x1b[34m |\x1b[0m           \x1b[1;31m^\x1b[0m\n" +
+				" \x1b[34m =\x1b[0m \x1b[36mhint: remove the unmatched )\x1b[0m\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := Parse(tc.s)
+			if tc.check {
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = CheckType(stmt, describeSelectors)
+			}
+			if err == nil {
+				t.Fatal("have nil, want error")
+			}
+			var b strings.Builder
+			if err = RenderErrorWithOptions(&b, tc.s, err, tc.opts); err != nil {
+				t.Fatal(err)
+			}
+			if have := b.String(); have != tc.want {
+				t.Fatalf("have:\n%s\nwant:\n%s", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestRenderErrorWithoutSource(t *testing.T) {
+	var b strings.Builder
+	if err := RenderError(&b, `when a`, context.Canceled); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := b.String(), "error: context canceled\n"; have != want {
+		t.Fatalf("have %q, want %q", have, want)
+	}
+}
+
+func TestCheckTypeError(t *testing.T) {
+	s := `when s_int > 1 and (s_float < 2 or s_string > 3)`
+	stmt, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = CheckType(stmt, describeSelectors)
+	var te *TypeError
+	if !errors.As(err, &te) {
+		t.Fatalf("have %T, want *TypeError", err)
+	}
+	if have, want := s[te.Pos:te.End+1], `s_string > 3`; have != want {
+		t.Fatalf("have span %q, want %q", have, want)
+	}
+}
@@ -0,0 +1,346 @@
+package geoqlparser
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// ToElastic translates Trigger.When to an Elasticsearch or OpenSearch query,
+// the value of the query field of a search request. The mapping maps selectors
+// to document fields. Comparisons become term and range queries, arrays become
+// terms queries, circles become geo_distance queries, geohash cells become
+// geo_bounding_box queries and other geometries become geo_shape queries.
+// Numbers are normalized to Kph, meters, C, Bar and seconds. Expressions that
+// have no equivalent, e.g. arithmetic or times of day, are listed in a *TranslateError.
+func ToElastic(t *Trigger, m Mapping) (map[string]interface{}, error) {
+	w := &esWriter{trigger: t, m: m}
+	query := w.query(t.When)
+	if len(w.failed) > 0 {
+		return nil, &TranslateError{Target: "elasticsearch", Exprs: w.failed}
+	}
+	return query, nil
+}
+
+type esWriter struct {
+	trigger *Trigger
+	m       Mapping
+	failed  []Expr
+}
+
+type esQuery = map[string]interface{}
+
+func (w *esWriter) fail(expr Expr) esQuery {
+	w.failed = append(w.failed, expr)
+	return esQuery{"match_none": esQuery{}}
+}
+
+func (w *esWriter) resolve(expr Expr) Expr {
+	expr = unparen(expr)
+	if ref, ok := expr.(*Ref); ok {
+		if assign, err := w.trigger.findAssign(ref.ID); err == nil {
+			return unparen(assign.Right)
+		}
+	}
+	return expr
+}
+
+func esBool(clause string, queries ...esQuery) esQuery {
+	list := make([]interface{}, len(queries))
+	for i, q := range queries {
+		list[i] = q
+	}
+	b := esQuery{clause: list}
+	if clause == "should" {
+		b["minimum_should_match"] = 1
+	}
+	return esQuery{"bool": b}
+}
+
+func esNot(q esQuery) esQuery {
+	return esBool("must_not", q)
+}
+
+// esAny returns the query or a should query of several queries.
+func esAny(queries []esQuery) esQuery {
+	if len(queries) == 1 {
+		return queries[0]
+	}
+	return esBool("should", queries...)
+}
+
+func (w *esWriter) query(expr Expr) esQuery {
+	switch typ := expr.(type) {
+	case *ParenExpr:
+		return w.query(typ.Expr)
+	case *BooleanTyp:
+		if typ.Val {
+			return esQuery{"match_all": esQuery{}}
+		}
+		return esQuery{"match_none": esQuery{}}
+	case *UnaryExpr:
+		return esNot(w.query(typ.X))
+	case *BinaryExpr:
+		switch typ.Op {
+		case AND:
+			return esBool("filter", w.flatten(typ, AND, nil)...)
+		case OR:
+			return esBool("should", w.flatten(typ, OR, nil)...)
+		case XOR:
+			l, r := w.query(typ.Left), w.query(typ.Right)
+			return esBool("should", esBool("filter", l, esNot(r)), esBool("filter", esNot(l), r))
+		case IN, NOT_IN, INTERSECTS, NOT_INTERSECTS:
+			q := w.in(typ)
+			if typ.Op == NOT_IN || typ.Op == NOT_INTERSECTS {
+				return esNot(q)
+			}
+			return q
+		case EQL, LEQL, NOT_EQ, LNEQ, LSS, LEQ, GTR, GEQ:
+			return w.compare(typ)
+		}
+	case *Selector:
+		if field, ok := w.field(typ); ok {
+			return esQuery{"term": esQuery{field: true}}
+		}
+	}
+	return w.fail(expr)
+}
+
+// flatten collects the operands of nested operators of the same kind.
+func (w *esWriter) flatten(expr Expr, op Token, list []esQuery) []esQuery {
+	if e, ok := unparen(expr).(*BinaryExpr); ok && e.Op == op {
+		list = w.flatten(e.Left, op, list)
+		return w.flatten(e.Right, op, list)
+	}
+	return append(list, w.query(expr))
+}
+
+func (w *esWriter) field(expr Expr) (string, bool) {
+	selector, ok := unparen(expr).(*Selector)
+	if !ok || selector.multi() || len(selector.Props) > 0 {
+		return "", false
+	}
+	field, ok := w.m[selector.Ident]
+	return field, ok
+}
+
+func (w *esWriter) value(expr Expr) (interface{}, bool) {
+	switch typ := w.resolve(expr).(type) {
+	case *StringTyp:
+		return typ.Val, true
+	case *BooleanTyp:
+		return typ.Val, true
+	case *IntTyp:
+		return typ.Val, true
+	case *DateTyp:
+		return fmt.Sprintf("%04d-%02d-%02d", typ.Year, typ.Month, typ.Day), true
+	case *TimeTyp:
+		return nil, false
+	case *Selector, *Ref:
+		return nil, false
+	}
+	v, dim, ok := baseValue(w.resolve(expr))
+	return v, ok && dim != dimTime && dim != dimDate
+}
+
+var esRangeOps = map[Token]string{LSS: "lt", LEQ: "lte", GTR: "gt", GEQ: "gte"}
+
+func (w *esWriter) compare(e *BinaryExpr) esQuery {
+	op, left, right := e.Op, e.Left, e.Right
+	if _, ok := w.field(left); !ok {
+		left, right = right, left
+		switch op {
+		case LSS:
+			op = GTR
+		case LEQ:
+			op = GEQ
+		case GTR:
+			op = LSS
+		case GEQ:
+			op = LEQ
+		}
+	}
+	field, fok := w.field(left)
+	val, vok := w.value(right)
+	if !fok || !vok {
+		return w.fail(e)
+	}
+	switch op {
+	case EQL, LEQL:
+		return esQuery{"term": esQuery{field: val}}
+	case NOT_EQ, LNEQ:
+		return esNot(esQuery{"term": esQuery{field: val}})
+	}
+	return esQuery{"range": esQuery{field: esQuery{esRangeOps[op]: val}}}
+}
+
+func (w *esWriter) in(e *BinaryExpr) esQuery {
+	left, right := e.Left, w.resolve(e.Right)
+	if e.Op == INTERSECTS || e.Op == NOT_INTERSECTS {
+		if _, ok := w.field(right); ok {
+			left, right = e.Right, w.resolve(e.Left)
+		}
+	}
+	if field, ok := w.field(right); ok {
+		// "urgent" in tracker_tags
+		if val, ok := w.value(left); ok {
+			return esQuery{"term": esQuery{field: val}}
+		}
+		return w.fail(e)
+	}
+	field, ok := w.field(left)
+	if !ok {
+		return w.fail(e)
+	}
+	if q, ok := w.geo(field, right); ok {
+		return q
+	}
+	switch typ := right.(type) {
+	case *Range:
+		if q, ok := w.between(field, typ); ok {
+			return q
+		}
+	case *ArrayTyp:
+		var values []interface{}
+		var queries []esQuery
+		for _, item := range typ.List {
+			if r, ok := w.resolve(item).(*Range); ok {
+				q, ok := w.between(field, r)
+				if !ok {
+					return w.fail(e)
+				}
+				queries = append(queries, q)
+				continue
+			}
+			val, ok := w.value(item)
+			if !ok {
+				return w.fail(e)
+			}
+			values = append(values, val)
+		}
+		if len(values) > 0 {
+			queries = append([]esQuery{{"terms": esQuery{field: values}}}, queries...)
+		}
+		return esAny(queries)
+	}
+	return w.fail(e)
+}
+
+func (w *esWriter) between(field string, r *Range) (esQuery, bool) {
+	low, lok := w.value(r.Low)
+	high, hok := w.value(r.High)
+	if !lok || !hok {
+		return nil, false
+	}
+	return esQuery{"range": esQuery{field: esQuery{"gte": low, "lte": high}}}, true
+}
+
+// geo returns the query of a position field intersecting the geometry.
+func (w *esWriter) geo(field string, expr Expr) (esQuery, bool) {
+	switch typ := expr.(type) {
+	case *GeometryPointTyp:
+		if typ.Radius != nil {
+			r, _, _ := baseValue(typ.Radius)
+			return esQuery{"geo_distance": esQuery{
+				"distance": strconv.FormatFloat(r, 'f', -1, 64) + "m",
+				field:      esQuery{"lon": typ.Val[0], "lat": typ.Val[1]},
+			}}, true
+		}
+	case *CellTyp:
+		if typ.Kind != GEOHASH {
+			return nil, false
+		}
+		box := geohashBox(typ.Val)
+		return esQuery{"geo_bounding_box": esQuery{field: esQuery{
+			"top_left":     esQuery{"lon": box.MinLon, "lat": box.MaxLat},
+			"bottom_right": esQuery{"lon": box.MaxLon, "lat": box.MinLat},
+		}}}, true
+	case *ArrayTyp:
+		if typ.Kind != GEOHASH {
+			return nil, false
+		}
+		return w.geoList(field, typ.List)
+	case *GeometryMultiObjectTyp:
+		if hasMargins(typ.Val) {
+			return w.geoList(field, typ.Val)
+		}
+	case *GeometryCollectionTyp:
+		if hasMargins(typ.Objects) {
+			return w.geoList(field, typ.Objects)
+		}
+	}
+	shape, ok := geoJSON(expr)
+	if !ok {
+		return nil, false
+	}
+	return esQuery{"geo_shape": esQuery{field: esQuery{"shape": shape, "relation": "intersects"}}}, true
+}
+
+func (w *esWriter) geoList(field string, list []Expr) (esQuery, bool) {
+	queries := make([]esQuery, 0, len(list))
+	for _, item := range list {
+		q, ok := w.geo(field, item)
+		if !ok {
+			return nil, false
+		}
+		queries = append(queries, q)
+	}
+	return esAny(queries), len(queries) > 0
+}
+
+func hasMargins(list []Expr) bool {
+	for _, item := range list {
+		if margin(item) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// geoJSON returns the GeoJSON object of the geometry. Geometries with
+// a radius or a margin have no GeoJSON equivalent.
+func geoJSON(expr Expr) (esQuery, bool) {
+	switch typ := expr.(type) {
+	case *GeometryPointTyp:
+		if typ.Radius != nil {
+			return nil, false
+		}
+		return esQuery{"type": "point", "coordinates": typ.Val[:]}, true
+	case *GeometryLineTyp:
+		if typ.Margin != nil {
+			return nil, false
+		}
+		return esQuery{"type": "linestring", "coordinates": typ.Val}, true
+	case *GeometryPolygonTyp:
+		return esQuery{"type": "polygon", "coordinates": typ.Val}, true
+	case *GeometryMultiObjectTyp:
+		var kind string
+		switch typ.Kind {
+		case GEOMETRY_MULTIPOINT:
+			kind = "multipoint"
+		case GEOMETRY_MULTILINE:
+			kind = "multilinestring"
+		case GEOMETRY_MULTIPOLYGON:
+			kind = "multipolygon"
+		}
+		coords := make([]interface{}, 0, len(typ.Val))
+		for _, item := range typ.Val {
+			obj, ok := geoJSON(item)
+			if !ok {
+				return nil, false
+			}
+			coords = append(coords, obj["coordinates"])
+		}
+		return esQuery{"type": kind, "coordinates": coords}, true
+	case *GeometryCollectionTyp:
+		geometries := make([]interface{}, 0, len(typ.Objects))
+		for _, item := range typ.Objects {
+			obj, ok := geoJSON(item)
+			if !ok {
+				return nil, false
+			}
+			geometries = append(geometries, obj)
+		}
+		return esQuery{"type": "geometrycollection", "geometries": geometries}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,131 @@
+package geoqlparser
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestToElastic(t *testing.T) {
+	m := Mapping{
+		"tracker_speed":  "speed",
+		"tracker_model":  "model",
+		"tracker_coords": "location",
+		"tracker_temp":   "temp",
+		"tracker_time":   "ts",
+		"tracker_tags":   "tags",
+		"tracker_on":     "engine_on",
+	}
+	testCases := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{
+			name: "comparisons",
+			s:    `when tracker_speed > 50Mph and (tracker_model eq "ER54x3" or tracker_on != true)`,
+			want: `{"bool":{"filter":[{"range":{"speed":{"gt":80.4672}}},{"bool":{"minimum_should_match":1,"should":[{"term":{"model":"ER54x3"}},{"bool":{"must_not":[{"term":{"engine_on":true}}]}}]}}]}}`,
+		},
+		{
+			name: "flipped comparison",
+			s:    `when 10 <= tracker_speed and tracker_on`,
+			want: `{"bool":{"filter":[{"range":{"speed":{"gte":10}}},{"term":{"engine_on":true}}]}}`,
+		},
+		{
+			name: "range",
+			s:    `when tracker_temp in 32F .. 40C and tracker_time < date[2030-10-02]`,
+			want: `{"bool":{"filter":[{"range":{"temp":{"gte":0,"lte":40}}},{"range":{"ts":{"lt":"2030-10-02"}}}]}}`,
+		},
+		{
+			name: "terms",
+			s:    `trigger set m=["A", "B"]; when tracker_model not in @m or tracker_speed in [1 .. 2, 5 .. 10]`,
+			want: `{"bool":{"minimum_should_match":1,"should":[{"bool":{"must_not":[{"terms":{"model":["A","B"]}}]}},{"bool":{"minimum_should_match":1,"should":[{"range":{"speed":{"gte":1,"lte":2}}},{"range":{"speed":{"gte":5,"lte":10}}}]}}]}}`,
+		},
+		{
+			name: "array field",
+			s:    `when "urgent" in tracker_tags and not tracker_speed > 1`,
+			want: `{"bool":{"filter":[{"term":{"tags":"urgent"}},{"bool":{"must_not":[{"range":{"speed":{"gt":1}}}]}}]}}`,
+		},
+		{
+			name: "xor",
+			s:    `when tracker_on xor tracker_speed > 1`,
+			want: `{"bool":{"minimum_should_match":1,"should":[{"bool":{"filter":[{"term":{"engine_on":true}},{"bool":{"must_not":[{"range":{"speed":{"gt":1}}}]}}]}},{"bool":{"filter":[{"bool":{"must_not":[{"term":{"engine_on":true}}]}},{"range":{"speed":{"gt":1}}}]}}]}}`,
+		},
+		{
+			name: "polygon",
+			s:    `when tracker_coords in polygon[[[1, 1], [2, 1], [2, 2], [1, 1]]]`,
+			want: `{"geo_shape":{"location":{"relation":"intersects","shape":{"coordinates":[[[1,1],[2,1],[2,2],[1,1]]],"type":"polygon"}}}}`,
+		},
+		{
+			name: "circle",
+			s:    `trigger set depot=point[13.4, 52.5]:500M; when tracker_coords in @depot`,
+			want: `{"geo_distance":{"distance":"500m","location":{"lat":52.5,"lon":13.4}}}`,
+		},
+		{
+			name: "multi with margins",
+			s:    `when multipoint[point[1, 1]:1Km, point[3, 3]] intersects tracker_coords`,
+			want: `{"bool":{"minimum_should_match":1,"should":[{"geo_distance":{"distance":"1000m","location":{"lat":1,"lon":1}}},{"geo_shape":{"location":{"relation":"intersects","shape":{"coordinates":[3,3],"type":"point"}}}}]}}`,
+		},
+		{
+			name: "collection",
+			s:    `when tracker_coords not intersects collection[point[1, 1], multipoint[point[2, 2], point[3, 3]]]`,
+			want: `{"bool":{"must_not":[{"geo_shape":{"location":{"relation":"intersects","shape":{"geometries":[{"coordinates":[1,1],"type":"point"},{"coordinates":[[2,2],[3,3]],"type":"multipoint"}],"type":"geometrycollection"}}}}]}}`,
+		},
+		{
+			name: "geohash",
+			s:    `when tracker_coords in geohash[u4pr]`,
+			want: `{"geo_bounding_box":{"location":{"bottom_right":{"lat":57.48046875,"lon":10.546875},"top_left":{"lat":57.65625,"lon":10.1953125}}}}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := Parse(tc.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			query, err := ToElastic(stmt.(*Trigger), m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			have, err := json.Marshal(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(have) != tc.want {
+				t.Fatalf("have %s, want %s", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestToElasticErrors(t *testing.T) {
+	m := Mapping{"tracker_speed": "speed", "tracker_coords": "location", "tracker_time": "ts"}
+	testCases := []struct {
+		s    string
+		want []string
+	}{
+		{s: `when tracker_unknown > 1`, want: []string{"tracker_unknown > 1"}},
+		{s: `when tracker_speed * 2 > 1 or abs(tracker_speed) > 1`, want: []string{"tracker_speed*2 > 1", "abs(tracker_speed) > 1"}},
+		{s: `when tracker_time in time[9:00AM .. 5:30PM]`, want: []string{"tracker_time in time[9:00AM .. 5:30PM]"}},
+		{s: `when tracker_coords in line[[1, 1], [2, 2]]:10M and tracker_coords in s2[89c25]`, want: []string{"tracker_coords in line[[1, 1], [2, 2]]:10M", "tracker_coords in s2[89c25]"}},
+	}
+	for _, tc := range testCases {
+		stmt, err := Parse(tc.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ToElastic(stmt.(*Trigger), m)
+		var terr *TranslateError
+		if !errors.As(err, &terr) {
+			t.Fatalf("%s: have %v, want *TranslateError", tc.s, err)
+		}
+		have := make([]string, len(terr.Exprs))
+		for i, expr := range terr.Exprs {
+			have[i] = formatExpr(expr)
+		}
+		if !reflect.DeepEqual(have, tc.want) {
+			t.Fatalf("%s: have %q, want %q", tc.s, have, tc.want)
+		}
+	}
+}
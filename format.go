@@ -1,9 +1,12 @@
 package geoqlparser
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -11,15 +14,92 @@ const (
 	padding = "\t"
 )
 
+// KeywordCase controls the letter case of keywords in the formatted output.
+type KeywordCase int
+
+const (
+	// DefaultCase prints section keywords in upper case and operators in lower case.
+	DefaultCase KeywordCase = iota
+	// UpperCase prints all keywords in upper case.
+	UpperCase
+	// LowerCase prints all keywords in lower case.
+	LowerCase
+)
+
+// FormatOptions configures FormatWithOptions.
+// The zero value gives the same output as Format.
+type FormatOptions struct {
+	// Indent is the indentation unit. Defaults to a tab.
+	Indent string
+	// MaxLineWidth is the width after which selector args, lines and
+	// polygons are expanded onto several lines. If zero, selector args
+	// are expanded after 64 chars and geometries after 4 points.
+	MaxLineWidth int
+	// KeywordCase is the letter case of keywords.
+	KeywordCase KeywordCase
+	// OmitTriggerHeader omits the TRIGGER keyword. It is kept for
+	// triggers with variables, where the keyword is required.
+	OmitTriggerHeader bool
+	// NormalizeEq prints eq and not eq as == and !=.
+	NormalizeEq bool
+	// Compact prints the whole statement on a single line.
+	Compact bool
+}
+
+const defaultSelectorWidth = 64
+
+var defaultFormatOptions = FormatOptions{Indent: padding}
+
+func (o *FormatOptions) section(s string) string {
+	if o.KeywordCase == LowerCase {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+func (o *FormatOptions) keyword(s string) string {
+	if o.KeywordCase == UpperCase {
+		return strings.ToUpper(s)
+	}
+	return s
+}
+
+// printer passes the format options down to the format methods of the nodes.
+type printer struct {
+	io.StringWriter
+	opts FormatOptions
+}
+
+func optionsOf(w io.StringWriter) *FormatOptions {
+	if p, ok := w.(*printer); ok {
+		return &p.opts
+	}
+	return &defaultFormatOptions
+}
+
 func Format(w io.StringWriter, stmt Statement) error {
+	return FormatWithOptions(w, stmt, FormatOptions{})
+}
+
+// FormatWithOptions writes the statement to w according to the options.
+func FormatWithOptions(w io.StringWriter, stmt Statement, opts FormatOptions) error {
+	if opts.Indent == "" {
+		opts.Indent = padding
+	}
 	switch typ := stmt.(type) {
 	default:
 		return fmt.Errorf("todo")
 	case *Trigger:
-		return formatTriggerStmt(typ, w)
+		return formatTriggerStmt(typ, &printer{StringWriter: w, opts: opts})
 	}
 }
 
+func formatExpr(expr Expr) string {
+	buf := bytes.NewBuffer(nil)
+	expr.format(buf, "", true)
+	return buf.String()
+}
+
 func checkError(_ int, err error) {
 	if err != nil {
 		panic(err)
@@ -30,48 +110,137 @@ func writeNewLine(w io.StringWriter) {
 	checkError(w.WriteString(nl))
 }
 
-func formatTriggerStmt(t *Trigger, w io.StringWriter) (err error) {
+// writeBreak writes a line break followed by the padding,
+// or the separator in compact mode.
+func writeBreak(w io.StringWriter, padding string, sep string) {
+	if optionsOf(w).Compact {
+		checkError(w.WriteString(sep))
+		return
+	}
+	checkError(w.WriteString(nl + padding))
+}
+
+func formatTriggerStmt(t *Trigger, w *printer) (err error) {
 	defer func() {
 		if er := recover(); er != nil {
 			err = er.(error)
 		}
 	}()
 
-	checkError(w.WriteString("TRIGGER"))
-	writeNewLine(w)
+	opts := &w.opts
+	indent := opts.Indent
+	var started bool
+	lead := t.Doc
+	section := func(name string, doc *CommentGroup) {
+		if started {
+			writeBreak(w, "", " ")
+		}
+		started = true
+		writeDoc(w, joinComments(lead, doc), "")
+		lead = nil
+		checkError(w.WriteString(opts.section(name)))
+	}
+
+	if !opts.OmitTriggerHeader || len(t.Vars) > 0 {
+		section("TRIGGER", nil)
+	}
 
 	if len(t.Vars) > 0 {
-		checkError(w.WriteString("SET"))
-		writeNewLine(w)
+		section("SET", t.SetDoc)
 		for i := 0; i < len(t.Vars); i++ {
-			t.Vars[i].format(w, padding, false)
-			writeNewLine(w)
+			writeBreak(w, "", " ")
+			if opts.Compact {
+				t.Vars[i].format(w, "", false)
+			} else {
+				t.Vars[i].format(w, indent, false)
+			}
 		}
 	}
 
-	checkError(w.WriteString("WHEN\n" + padding))
-	t.When.format(w, padding, true)
-	writeNewLine(w)
+	section("WHEN", t.WhenDoc)
+	writeBreak(w, indent, " ")
+	t.When.format(w, indent, true)
+	writeLineComment(w, t.WhenComment, indent)
 
 	if t.RepeatCount != nil || t.RepeatInterval != nil {
-		checkError(w.WriteString("REPEAT "))
+		section("REPEAT", t.RepeatDoc)
+		checkError(w.WriteString(" "))
 		if t.RepeatCount != nil {
-			t.RepeatCount.format(w, padding, true)
+			t.RepeatCount.format(w, indent, true)
 		}
 		if t.RepeatInterval != nil {
-			checkError(w.WriteString(" every "))
-			t.RepeatInterval.format(w, padding, true)
+			checkError(w.WriteString(" " + opts.keyword("every") + " "))
+			t.RepeatInterval.format(w, indent, true)
 		}
-		writeNewLine(w)
+		writeLineComment(w, t.RepeatComment, "")
 	}
 
 	if t.ResetAfter != nil {
-		checkError(w.WriteString("RESET after "))
-		t.ResetAfter.format(w, padding, true)
+		section("RESET", t.ResetDoc)
+		checkError(w.WriteString(" " + opts.keyword("after") + " "))
+		t.ResetAfter.format(w, indent, true)
+		writeLineComment(w, t.ResetComment, "")
+	}
+	if !opts.Compact && (t.ResetAfter == nil || t.Comment != nil) {
+		writeNewLine(w)
+	}
+	if opts.Compact {
+		writeLineComment(w, t.Comment, "")
+	} else {
+		writeDoc(w, t.Comment, "")
 	}
 	return
 }
 
+// writeDoc writes the comments on separate lines before a node.
+func writeDoc(w io.StringWriter, g *CommentGroup, padding string) {
+	if g == nil {
+		return
+	}
+	compact := optionsOf(w).Compact
+	for _, c := range g.List {
+		if compact {
+			checkError(w.WriteString(compactComment(c.Text) + " "))
+			continue
+		}
+		checkError(w.WriteString(padding + c.Text + nl))
+	}
+}
+
+// writeLineComment writes the comments after a node on the same line.
+// The caller must break the line after a //-style comment.
+func writeLineComment(w io.StringWriter, g *CommentGroup, padding string) {
+	if g == nil {
+		return
+	}
+	checkError(w.WriteString(" "))
+	writeComments(w, g, padding)
+}
+
+func writeComments(w io.StringWriter, g *CommentGroup, padding string) {
+	compact := optionsOf(w).Compact
+	for i, c := range g.List {
+		if i > 0 {
+			writeBreak(w, padding, " ")
+		}
+		if compact {
+			checkError(w.WriteString(compactComment(c.Text)))
+		} else {
+			checkError(w.WriteString(c.Text))
+		}
+	}
+}
+
+// compactComment converts a //-style comment to a /*-style comment,
+// so that it can be followed by other tokens on the same line.
+func compactComment(text string) string {
+	if !strings.HasPrefix(text, "//") {
+		return text
+	}
+	text = strings.ReplaceAll(strings.TrimSpace(text[2:]), "*/", "* /")
+	return "/* " + text + " */"
+}
+
 func (t *Trigger) format(_ io.StringWriter, _ string, _ bool) {}
 
 func formatFloat(w io.StringWriter, v float64) {
@@ -89,8 +258,7 @@ func (e *GeometryMultiObjectTyp) format(w io.StringWriter, padding string, inlin
 	}
 	for i := 0; i < len(e.Val); i++ {
 		if !inline {
-			writeNewLine(w)
-			checkError(w.WriteString(padding))
+			writeBreak(w, padding, "")
 		}
 		e.Val[i].format(w, padding, inline)
 		if i+1 < len(e.Val) {
@@ -101,25 +269,24 @@ func (e *GeometryMultiObjectTyp) format(w io.StringWriter, padding string, inlin
 }
 
 func (e *GeometryLineTyp) format(w io.StringWriter, padding string, inline bool) {
-	needExpand := e.needExpand()
+	opts := optionsOf(w)
+	needExpand := !opts.Compact && e.needExpand(opts.MaxLineWidth)
 	checkError(w.WriteString("line["))
-	pad2 := padding + padding
+	pad2 := padding + opts.Indent
 	if needExpand && !inline {
 		writeNewLine(w)
 		checkError(w.WriteString(pad2))
 	}
-	var block int
+	var block, width int
 	for i := 0; i < len(e.Val); i++ {
-		checkError(w.WriteString("["))
-		formatFloat(w, e.Val[i][0])
-		checkError(w.WriteString(", "))
-		formatFloat(w, e.Val[i][1])
-		checkError(w.WriteString("]"))
+		point := formatPoint(e.Val[i])
+		checkError(w.WriteString(point))
 		if i+1 < len(e.Val) {
 			checkError(w.WriteString(", "))
 		}
-		if block > 3 {
-			block = 0
+		width += len(point) + 2
+		if opts.wrapPoints(needExpand && !inline, block, len(pad2)+width+nextPointWidth(e.Val, i)) {
+			block, width = 0, 0
 			writeNewLine(w)
 			if i+2 < len(e.Val) {
 				checkError(w.WriteString(pad2))
@@ -142,11 +309,12 @@ func (e *GeometryLineTyp) format(w io.StringWriter, padding string, inline bool)
 }
 
 func (e *GeometryPolygonTyp) format(w io.StringWriter, padding string, inline bool) {
-	needExpand := e.needExpand()
+	opts := optionsOf(w)
+	needExpand := !opts.Compact && e.needExpand(opts.MaxLineWidth)
 	checkError(w.WriteString("polygon["))
-	pad2 := padding + padding
-	pad3 := padding + padding + padding
-	var block int
+	pad2 := padding + opts.Indent
+	pad3 := pad2 + opts.Indent
+	var block, width int
 	for i := 0; i < len(e.Val); i++ {
 		if needExpand && !inline {
 			writeNewLine(w)
@@ -158,22 +326,21 @@ func (e *GeometryPolygonTyp) format(w io.StringWriter, padding string, inline bo
 			checkError(w.WriteString(pad3))
 		}
 		for j := 0; j < len(e.Val[i]); j++ {
-			checkError(w.WriteString("["))
-			formatFloat(w, e.Val[i][j][0])
-			checkError(w.WriteString(", "))
-			formatFloat(w, e.Val[i][j][1])
-			checkError(w.WriteString("]"))
+			point := formatPoint(e.Val[i][j])
+			checkError(w.WriteString(point))
 			if j+1 < len(e.Val[i]) {
 				checkError(w.WriteString(", "))
 			}
-			if block > 3 {
-				block = 0
+			width += len(point) + 2
+			if opts.wrapPoints(needExpand && !inline, block, len(pad3)+width+nextPointWidth(e.Val[i], j)) {
+				block, width = 0, 0
 				writeNewLine(w)
 				checkError(w.WriteString(pad3))
 				continue
 			}
 			block++
 		}
+		width = 0
 		if needExpand && !inline {
 			writeNewLine(w)
 			checkError(w.WriteString(pad2))
@@ -190,12 +357,41 @@ func (e *GeometryPolygonTyp) format(w io.StringWriter, padding string, inline bo
 	checkError(w.WriteString("]"))
 }
 
+func formatPoint(p [2]float64) string {
+	return "[" + strconv.FormatFloat(p[0], 'f', -1, 64) + ", " + strconv.FormatFloat(p[1], 'f', -1, 64) + "]"
+}
+
+func nextPointWidth(points [][2]float64, i int) int {
+	if i+1 < len(points) {
+		return len(formatPoint(points[i+1])) + 2
+	}
+	return 0
+}
+
+func pointsWidth(points [][2]float64) (n int) {
+	for i := 0; i < len(points); i++ {
+		n += len(formatPoint(points[i])) + 2
+	}
+	return
+}
+
+// wrapPoints reports whether the list of points is broken after the current point.
+func (o *FormatOptions) wrapPoints(expand bool, block int, width int) bool {
+	switch {
+	case o.Compact:
+		return false
+	case o.MaxLineWidth == 0:
+		return block > 3
+	default:
+		return expand && width > o.MaxLineWidth
+	}
+}
+
 func (e *GeometryCollectionTyp) format(w io.StringWriter, padding string, inline bool) {
 	checkError(w.WriteString("collection["))
 	for i := 0; i < len(e.Objects); i++ {
 		if !inline {
-			writeNewLine(w)
-			checkError(w.WriteString(padding))
+			writeBreak(w, padding, "")
 		}
 		e.Objects[i].format(w, padding, inline)
 		if i+1 < len(e.Objects) {
@@ -206,27 +402,25 @@ func (e *GeometryCollectionTyp) format(w io.StringWriter, padding string, inline
 }
 
 func (e *Range) format(w io.StringWriter, padding string, inline bool) {
-	switch e.Low.(type) {
-	case *TimeTyp:
-		checkError(w.WriteString("time["))
-		inline = true
-	case *MonthTyp:
-		checkError(w.WriteString("month["))
-		inline = true
-	case *DateTyp:
-		checkError(w.WriteString("date["))
-		inline = true
-	case *WeekdayTyp:
-		checkError(w.WriteString("weekday["))
-		inline = true
+	switch low := e.Low.(type) {
+	case calendarTyp:
+		high, ok := e.High.(calendarTyp)
+		if !ok {
+			break
+		}
+		checkError(w.WriteString(low.keyword() + "["))
+		low.formatValue(w)
+		checkError(w.WriteString(" .. "))
+		high.formatValue(w)
+		checkError(w.WriteString("]"))
+		return
+	case *CellTyp:
+		formatCells(w, low.Kind, " .. ", e.Low, e.High)
+		return
 	}
 	e.Low.format(w, padding, inline)
 	checkError(w.WriteString(" .. "))
 	e.High.format(w, padding, inline)
-	switch e.Low.(type) {
-	case *TimeTyp, *MonthTyp, *DateTyp, *WeekdayTyp:
-		checkError(w.WriteString("]"))
-	}
 }
 
 func (e *PercentTyp) format(w io.StringWriter, _ string, _ bool) {
@@ -241,11 +435,41 @@ func (e *StringTyp) format(w io.StringWriter, _ string, _ bool) {
 }
 
 func (e *FloatTyp) format(w io.StringWriter, _ string, _ bool) {
-	formatFloat(w, e.Val)
+	str := strconv.FormatFloat(e.Val, 'f', -1, 64)
+	if !strings.Contains(str, ".") {
+		// keep the literal a float, 3.0 is not an int
+		str += ".0"
+	}
+	checkError(w.WriteString(str))
 }
 
 func (e *DurationTyp) format(b io.StringWriter, _ string, _ bool) {
-	checkError(b.WriteString(e.Val.String()))
+	checkError(b.WriteString(formatDuration(e.Val)))
+}
+
+// formatDuration writes the duration as time.Duration.String does, if the
+// scanner reads it back. A duration must start with a number of hours, minutes
+// or seconds and only the seconds of durations under a minute may have a fraction,
+// so 1h0m0.001s is written as 1h0m0s1ms and 500µs as 0s500us.
+func formatDuration(d time.Duration) string {
+	frac := d % time.Second
+	if frac == 0 || d >= time.Millisecond && d < time.Minute {
+		return d.String()
+	}
+	var str string
+	if d >= time.Second || frac < time.Millisecond {
+		str = (d - frac).String()
+	}
+	for _, u := range []struct {
+		d    time.Duration
+		name string
+	}{{time.Millisecond, "ms"}, {time.Microsecond, "us"}, {time.Nanosecond, "ns"}} {
+		if n := frac / u.d; n > 0 {
+			str += strconv.FormatInt(int64(n), 10) + u.name
+		}
+		frac %= u.d
+	}
+	return str
 }
 
 func (e *TemperatureTyp) format(w io.StringWriter, _ string, _ bool) {
@@ -275,33 +499,31 @@ func (e *SpeedTyp) format(w io.StringWriter, _ string, _ bool) {
 }
 
 func (e *Selector) format(b io.StringWriter, padding string, inline bool) {
+	if e.Quantifier == ANY || e.Quantifier == ALL {
+		checkError(b.WriteString(optionsOf(b).keyword(KeywordString(e.Quantifier)) + " "))
+	}
 	checkError(b.WriteString(e.Ident))
-	if len(e.Args) > 0 {
+	if filters := e.filters(); len(filters) > 0 {
 		checkError(b.WriteString("{"))
-		var i int
 		var expand bool
 		var pad2 string
-		if !inline {
-			expand = e.needExpand()
+		if opts := optionsOf(b); !inline && !opts.Compact {
+			expand = e.needExpand(opts.MaxLineWidth)
 			if expand {
-				pad2 = padding + "\t"
+				pad2 = padding + opts.Indent
 			}
 		}
 		if e.Wildcard {
-			checkError(b.WriteString("*"))
-			if len(e.Args) > 0 {
-				checkError(b.WriteString(", "))
-			}
+			checkError(b.WriteString("*, "))
 		}
-		for k := range e.Args {
+		for i, k := range filters {
 			if !inline && expand {
 				checkError(b.WriteString("\n" + pad2))
 			}
-			checkError(b.WriteString(`"` + k + `"`))
-			if i+1 < len(e.Args) {
+			checkError(b.WriteString(k))
+			if i+1 < len(filters) {
 				checkError(b.WriteString(", "))
 			}
-			i++
 		}
 		if !inline && expand {
 			checkError(b.WriteString("\n" + padding))
@@ -333,24 +555,21 @@ func (e *GeometryPointTyp) format(w io.StringWriter, padding string, inline bool
 
 func (e *ArrayTyp) format(b io.StringWriter, padding string, inline bool) {
 	switch e.Kind {
-	case TIME:
-		checkError(b.WriteString("time"))
-		inline = true
-	case MONTH:
-		checkError(b.WriteString("month"))
-		inline = true
-	case DATE:
-		checkError(b.WriteString("date"))
-		inline = true
-	case WEEKDAY:
-		checkError(b.WriteString("weekday"))
-		inline = true
+	case TIME, MONTH, DATE, WEEKDAY:
+		checkError(b.WriteString(KeywordString(e.Kind)))
+	case H3, GEOHASH, S2:
+		formatCells(b, e.Kind, ", ", e.List...)
+		return
 	}
 
 	checkError(b.WriteString("["))
 
 	for i, expr := range e.List {
-		expr.format(b, padding, inline)
+		if c, ok := expr.(calendarTyp); ok {
+			c.formatValue(b)
+		} else {
+			expr.format(b, padding, inline)
+		}
 		if i+1 < len(e.List) {
 			checkError(b.WriteString(", "))
 		}
@@ -360,20 +579,38 @@ func (e *ArrayTyp) format(b io.StringWriter, padding string, inline bool) {
 
 func (e *BinaryExpr) format(w io.StringWriter, padding string, inline bool) {
 	e.Left.format(w, padding, inline)
+	opts := optionsOf(w)
 	var nospace bool
-	op := KeywordString(e.Op)
+	tok := e.Op
+	if opts.NormalizeEq {
+		switch tok {
+		case EQL:
+			tok = LEQL
+		case NOT_EQ:
+			tok = LNEQ
+		}
+	}
+	op := opts.keyword(KeywordString(tok))
 	var nl bool
 	switch e.Op {
-	case AND, OR:
+	case AND, OR, XOR:
 		nl = true
-	case ADD, SUB, MUL, QUO, REM:
+	case ADD, SUB, MUL, QUO:
 		nospace = true
 	}
 	if !nospace {
 		checkError(w.WriteString(" "))
 	}
+	if e.Comment != nil {
+		if nospace {
+			checkError(w.WriteString(" "))
+		}
+		writeComments(w, e.Comment, padding)
+		writeBreak(w, padding, " ")
+		nl = false
+	}
 	if nl {
-		checkError(w.WriteString("\n" + padding))
+		writeBreak(w, padding, "")
 	}
 	checkError(w.WriteString(op))
 	if !nospace {
@@ -382,8 +619,44 @@ func (e *BinaryExpr) format(w io.StringWriter, padding string, inline bool) {
 	e.Right.format(w, padding, inline)
 }
 
+func (e *UnaryExpr) format(w io.StringWriter, padding string, inline bool) {
+	checkError(w.WriteString(optionsOf(w).keyword(KeywordString(e.Op)) + " "))
+	parenthesize(e.X, e.Op, true).format(w, padding, inline)
+}
+
+func (e *CallExpr) format(w io.StringWriter, padding string, inline bool) {
+	checkError(w.WriteString(e.Func + "("))
+	for i, arg := range e.Args {
+		if i > 0 {
+			checkError(w.WriteString(", "))
+		}
+		arg.format(w, padding, true)
+	}
+	checkError(w.WriteString(")"))
+}
+
+func (e *WindowExpr) format(w io.StringWriter, padding string, inline bool) {
+	checkError(w.WriteString(e.Func + "("))
+	e.X.format(w, padding, true)
+	checkError(w.WriteString(", "))
+	e.Window.format(w, padding, true)
+	checkError(w.WriteString(")"))
+}
+
+func (e *HistoryExpr) format(w io.StringWriter, padding string, inline bool) {
+	checkError(w.WriteString(e.Func + "("))
+	e.X.format(w, padding, true)
+	if e.Amount != nil {
+		checkError(w.WriteString(", "))
+		e.Amount.format(w, padding, true)
+		checkError(w.WriteString(", "))
+		e.Within.format(w, padding, true)
+	}
+	checkError(w.WriteString(")"))
+}
+
 func (e *ParenExpr) format(w io.StringWriter, padding string, inline bool) {
-	expand := true
+	expand := !optionsOf(w).Compact
 	switch node := e.Expr.(type) {
 	case *BinaryExpr:
 		_, lok := node.Left.(*BinaryExpr)
@@ -392,7 +665,7 @@ func (e *ParenExpr) format(w io.StringWriter, padding string, inline bool) {
 			expand = false
 		}
 	}
-	pad2 := padding + padding
+	pad2 := padding + optionsOf(w).Indent
 	checkError(w.WriteString("("))
 	if expand {
 		checkError(w.WriteString("\n" + pad2))
@@ -405,11 +678,13 @@ func (e *ParenExpr) format(w io.StringWriter, padding string, inline bool) {
 }
 
 func (e *Assign) format(w io.StringWriter, padding string, inline bool) {
+	writeDoc(w, e.Doc, padding)
 	checkError(w.WriteString(padding))
 	e.Left.format(w, padding, inline)
 	checkError(w.WriteString(" = "))
 	e.Right.format(w, padding, inline)
 	checkError(w.WriteString(";"))
+	writeLineComment(w, e.Comment, padding)
 }
 
 func (e *Ident) format(w io.StringWriter, _ string, _ bool) {
@@ -453,24 +728,63 @@ func (e *IntTyp) format(w io.StringWriter, _ string, _ bool) {
 	checkError(w.WriteString(strconv.Itoa(e.Val)))
 }
 
-func (e *DateTyp) format(w io.StringWriter, _ string, inline bool) {
-	if !inline {
-		checkError(w.WriteString("date["))
+func (e *CellTyp) format(w io.StringWriter, _ string, _ bool) {
+	formatCells(w, e.Kind, " .. ", e)
+}
+
+// formatCells writes cells of the same grid in a single literal, e.g. h3[a, b] or s2[a .. b].
+func formatCells(w io.StringWriter, kind Token, sep string, cells ...Expr) {
+	checkError(w.WriteString(KeywordString(kind) + "["))
+	for i, expr := range cells {
+		if i > 0 {
+			checkError(w.WriteString(sep))
+		}
+		cell := expr.(*CellTyp)
+		if kind == GEOHASH {
+			checkError(w.WriteString(`"` + cell.Val + `"`))
+		} else {
+			checkError(w.WriteString(cell.Val))
+		}
 	}
+	checkError(w.WriteString("]"))
+}
+
+// calendarTyp is a date, time, weekday or month literal. Ranges and arrays
+// of them write the keyword once, e.g. time[9:00 .. 18:00].
+type calendarTyp interface {
+	Expr
+	keyword() string
+	formatValue(w io.StringWriter)
+}
+
+func formatCalendar(w io.StringWriter, e calendarTyp) {
+	checkError(w.WriteString(e.keyword() + "["))
+	e.formatValue(w)
+	checkError(w.WriteString("]"))
+}
+
+func (e *DateTyp) keyword() string    { return "date" }
+func (e *TimeTyp) keyword() string    { return "time" }
+func (e *WeekdayTyp) keyword() string { return "weekday" }
+func (e *MonthTyp) keyword() string   { return "month" }
+
+func (e *DateTyp) format(w io.StringWriter, _ string, _ bool) {
+	formatCalendar(w, e)
+}
+
+func (e *DateTyp) formatValue(w io.StringWriter) {
 	checkError(w.WriteString(d2s(e.Year)))
 	checkError(w.WriteString("-"))
 	checkError(w.WriteString(d2s(e.Month)))
 	checkError(w.WriteString("-"))
 	checkError(w.WriteString(d2s(e.Day)))
-	if !inline {
-		checkError(w.WriteString("]"))
-	}
 }
 
-func (e *TimeTyp) format(w io.StringWriter, _ string, inline bool) {
-	if !inline {
-		checkError(w.WriteString("time["))
-	}
+func (e *TimeTyp) format(w io.StringWriter, _ string, _ bool) {
+	formatCalendar(w, e)
+}
+
+func (e *TimeTyp) formatValue(w io.StringWriter) {
 	if e.U == AM || e.U == PM {
 		checkError(w.WriteString(strconv.Itoa(e.Hours)))
 	} else {
@@ -485,29 +799,22 @@ func (e *TimeTyp) format(w io.StringWriter, _ string, inline bool) {
 	if e.U == AM || e.U == PM {
 		checkError(w.WriteString(e.U.String()))
 	}
-	if !inline {
-		checkError(w.WriteString("]"))
-	}
 }
 
-func (e *WeekdayTyp) format(w io.StringWriter, _ string, inline bool) {
-	if !inline {
-		checkError(w.WriteString("weekday["))
-	}
+func (e *WeekdayTyp) format(w io.StringWriter, _ string, _ bool) {
+	formatCalendar(w, e)
+}
+
+func (e *WeekdayTyp) formatValue(w io.StringWriter) {
 	checkError(w.WriteString(shortDayNames[e.Val]))
-	if !inline {
-		checkError(w.WriteString("]"))
-	}
 }
 
-func (e *MonthTyp) format(w io.StringWriter, _ string, inline bool) {
-	if !inline {
-		checkError(w.WriteString("month["))
-	}
-	checkError(w.WriteString(shortDayNames[e.Val-1]))
-	if !inline {
-		checkError(w.WriteString("]"))
-	}
+func (e *MonthTyp) format(w io.StringWriter, _ string, _ bool) {
+	formatCalendar(w, e)
+}
+
+func (e *MonthTyp) formatValue(w io.StringWriter) {
+	checkError(w.WriteString(shortMonthNames[e.Val-1]))
 }
 
 func d2s(n int) string {
@@ -2,7 +2,9 @@ package geoqlparser
 
 import (
 	"bytes"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestFormat(t *testing.T) {
@@ -94,3 +96,301 @@ reset after 34h
 		t.Fatal(err)
 	}
 }
+
+func TestFormatWithOptions(t *testing.T) {
+	const src = `trigger set a=1; when tracker_a eq @a and (tracker_b > 1 or tracker_c not eq 2) repeat 5 every 10s`
+	testCases := []struct {
+		name string
+		opts FormatOptions
+		want string
+	}{
+		{
+			name: "default",
+			want: "TRIGGER\nSET\n\ta = 1;\nWHEN\n\ttracker_a eq @a \n\tand (\n\t\ttracker_b > 1 \n\t\tor tracker_c not eq 2\n\t)\nREPEAT 5 every 10s\n",
+		},
+		{
+			name: "indent",
+			opts: FormatOptions{Indent: "  "},
+			want: "TRIGGER\nSET\n  a = 1;\nWHEN\n  tracker_a eq @a \n  and (\n    tracker_b > 1 \n    or tracker_c not eq 2\n  )\nREPEAT 5 every 10s\n",
+		},
+		{
+			name: "compact",
+			opts: FormatOptions{Compact: true},
+			want: "TRIGGER SET a = 1; WHEN tracker_a eq @a and (tracker_b > 1 or tracker_c not eq 2) REPEAT 5 every 10s",
+		},
+		{
+			name: "compact with normalized eq",
+			opts: FormatOptions{Compact: true, NormalizeEq: true},
+			want: "TRIGGER SET a = 1; WHEN tracker_a == @a and (tracker_b > 1 or tracker_c != 2) REPEAT 5 every 10s",
+		},
+		{
+			name: "keep required header",
+			opts: FormatOptions{OmitTriggerHeader: true, Compact: true},
+			want: "TRIGGER SET a = 1; WHEN tracker_a eq @a and (tracker_b > 1 or tracker_c not eq 2) REPEAT 5 every 10s",
+		},
+		{
+			name: "lower case",
+			opts: FormatOptions{Compact: true, KeywordCase: LowerCase},
+			want: "trigger set a = 1; when tracker_a eq @a and (tracker_b > 1 or tracker_c not eq 2) repeat 5 every 10s",
+		},
+		{
+			name: "upper case",
+			opts: FormatOptions{Compact: true, KeywordCase: UpperCase},
+			want: "TRIGGER SET a = 1; WHEN tracker_a EQ @a AND (tracker_b > 1 OR tracker_c NOT EQ 2) REPEAT 5 EVERY 10s",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := Parse(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := bytes.NewBuffer(nil)
+			if err = FormatWithOptions(buf, stmt, tc.opts); err != nil {
+				t.Fatal(err)
+			}
+			if have := buf.String(); have != tc.want {
+				t.Fatalf("have %q, want %q", have, tc.want)
+			}
+			if _, err = Parse(buf.String()); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestFormatWithOptionsOmitTriggerHeader(t *testing.T) {
+	stmt, err := Parse(`trigger when tracker_a > 1 reset after 1h`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.NewBuffer(nil)
+	if err = FormatWithOptions(buf, stmt, FormatOptions{OmitTriggerHeader: true}); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := buf.String(), "WHEN\n\ttracker_a > 1\nRESET after 1h0m0s"; have != want {
+		t.Fatalf("have %q, want %q", have, want)
+	}
+	if _, err = Parse(buf.String()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFormatWithOptionsNestedIndent(t *testing.T) {
+	stmt, err := Parse(`when a > 1 and (b > 1 or (c > 1 and (d > 1 or e > 1) and f > 1) or g > 1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.NewBuffer(nil)
+	if err = FormatWithOptions(buf, stmt, FormatOptions{Indent: "  ", OmitTriggerHeader: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := "WHEN\n" +
+		"  a > 1 \n" +
+		"  and (\n" +
+		"    b > 1 \n" +
+		"    or (\n" +
+		"      c > 1 \n" +
+		"      and (\n" +
+		"        d > 1 \n" +
+		"        or e > 1\n" +
+		"      ) \n" +
+		"      and f > 1\n" +
+		"    ) \n" +
+		"    or g > 1\n" +
+		"  )\n"
+	if have := buf.String(); have != want {
+		t.Fatalf("have %q, want %q", have, want)
+	}
+	if _, err = Parse(buf.String()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFormatWithOptionsMaxLineWidth(t *testing.T) {
+	stmt, err := Parse(`trigger set l=line[[1, 1], [2, 2], [3, 3], [4, 4], [5, 5], [6, 6]]; when tracker_a intersects @l`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		width int
+		want  string
+	}{
+		{
+			width: 80,
+			want:  "\tl = line[[1, 1], [2, 2], [3, 3], [4, 4], [5, 5], [6, 6]];",
+		},
+		{
+			width: 30,
+			want:  "\tl = line[\n\t\t[1, 1], [2, 2], [3, 3], \n\t\t[4, 4], [5, 5], [6, 6]\n\t];",
+		},
+	}
+	for _, tc := range testCases {
+		buf := bytes.NewBuffer(nil)
+		if err = FormatWithOptions(buf, stmt, FormatOptions{MaxLineWidth: tc.width}); err != nil {
+			t.Fatal(err)
+		}
+		if have := buf.String(); !strings.Contains(have, tc.want) {
+			t.Fatalf("width %d: have %q, want %q", tc.width, have, tc.want)
+		}
+		if _, err = Parse(buf.String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFormatWithOptionsCompactGeometry(t *testing.T) {
+	stmt, err := Parse(`trigger set m=multipoint[point[1,1], point[2,2]]; p=polygon[[[1,1],[2,2],[3,3],[4,4],[5,5],[6,6]]]; when tracker{"a", "b"} intersects @m`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.NewBuffer(nil)
+	if err = FormatWithOptions(buf, stmt, FormatOptions{Compact: true}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "\n") {
+		t.Fatalf("have %q, want a single line", buf.String())
+	}
+	if _, err = Parse(buf.String()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFormatComments(t *testing.T) {
+	src := `// speed control
+trigger
+set
+	// upper limit
+	max = 60Kph; // in kph
+when
+	tracker_speed > @max // too fast
+	or tracker_speed < 10Kph // too slow
+reset after 1h
+// end`
+	testCases := []struct {
+		name string
+		opts FormatOptions
+		want string
+	}{
+		{
+			name: "default",
+			want: "// speed control\nTRIGGER\nSET\n\t// upper limit\n\tmax = 60Kph; // in kph\nWHEN\n\ttracker_speed > @max // too fast\n\tor tracker_speed < 10Kph // too slow\nRESET after 1h0m0s\n// end\n",
+		},
+		{
+			name: "compact",
+			opts: FormatOptions{Compact: true},
+			want: "/* speed control */ TRIGGER SET /* upper limit */ max = 60Kph; /* in kph */ WHEN tracker_speed > @max /* too fast */ or tracker_speed < 10Kph /* too slow */ RESET after 1h0m0s /* end */",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := ParseWithMode(src, ParseComments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := bytes.NewBuffer(nil)
+			if err = FormatWithOptions(buf, stmt, tc.opts); err != nil {
+				t.Fatal(err)
+			}
+			if have := buf.String(); have != tc.want {
+				t.Fatalf("have %q, want %q", have, tc.want)
+			}
+			again, err := ParseWithMode(buf.String(), ParseComments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf2 := bytes.NewBuffer(nil)
+			if err = FormatWithOptions(buf2, again, tc.opts); err != nil {
+				t.Fatal(err)
+			}
+			if buf2.String() != buf.String() {
+				t.Fatalf("have %q, want stable output %q", buf2.String(), buf.String())
+			}
+		})
+	}
+}
+
+func TestFormatCommentsRoundTrip(t *testing.T) {
+	testCases := []struct {
+		name    string
+		s       string
+		want    string
+		compact string
+	}{
+		{
+			name:    "inside repeat",
+			s:       "when a > 1 repeat /* c */ 5 every 10s",
+			want:    "TRIGGER\nWHEN\n\ta > 1\nREPEAT 5 every 10s /* c */\n",
+			compact: "TRIGGER WHEN a > 1 REPEAT 5 every 10s /* c */",
+		},
+		{
+			name:    "after repeat and reset",
+			s:       "when a > 1 repeat 5 every 10s // repeat\nreset after 1h // reset",
+			want:    "TRIGGER\nWHEN\n\ta > 1\nREPEAT 5 every 10s // repeat\nRESET after 1h0m0s // reset",
+			compact: "TRIGGER WHEN a > 1 REPEAT 5 every 10s /* repeat */ RESET after 1h0m0s /* reset */",
+		},
+		{
+			name:    "before reset and after the statement",
+			s:       "when a > 1 repeat 5 every 10s\n// reset\nreset after 1h\n// end",
+			want:    "TRIGGER\nWHEN\n\ta > 1\nREPEAT 5 every 10s\n// reset\nRESET after 1h0m0s\n// end\n",
+			compact: "TRIGGER WHEN a > 1 REPEAT 5 every 10s /* reset */ RESET after 1h0m0s /* end */",
+		},
+		{
+			name:    "assignment",
+			s:       "trigger set /* the place */ p = point[1, 1]; when a in @p",
+			want:    "TRIGGER\nSET\n\t/* the place */\n\tp = point[1, 1];\nWHEN\n\ta in @p\n",
+			compact: "TRIGGER SET /* the place */ p = point[1, 1]; WHEN a in @p",
+		},
+	}
+	for _, tc := range testCases {
+		for _, opts := range []FormatOptions{{}, {Compact: true}} {
+			want := tc.want
+			if opts.Compact {
+				want = tc.compact
+			}
+			src := tc.s
+			for i := 0; i < 2; i++ {
+				stmt, err := ParseWithMode(src, ParseComments)
+				if err != nil {
+					t.Fatalf("%s: %v", tc.name, err)
+				}
+				buf := bytes.NewBuffer(nil)
+				if err = FormatWithOptions(buf, stmt, opts); err != nil {
+					t.Fatalf("%s: %v", tc.name, err)
+				}
+				if have := buf.String(); have != want {
+					t.Fatalf("%s: have %q, want %q", tc.name, have, want)
+				}
+				src = buf.String()
+			}
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	testCases := []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: 90 * time.Second, want: "1m30s"},
+		{d: 1500 * time.Millisecond, want: "1.5s"},
+		{d: 1500 * time.Microsecond, want: "1.5ms"},
+		{d: time.Hour + time.Millisecond, want: "1h0m0s1ms"},
+		{d: time.Minute + 1500*time.Millisecond, want: "1m1s500ms"},
+		{d: 500 * time.Microsecond, want: "0s500us"},
+		{d: time.Nanosecond, want: "0s1ns"},
+	}
+	for _, tc := range testCases {
+		have := formatDuration(tc.d)
+		if have != tc.want {
+			t.Fatalf("%s: have %s, want %s", tc.d, have, tc.want)
+		}
+		stmt, err := Parse("when tracker_a > " + have)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val := stmt.(*Trigger).When.(*BinaryExpr).Right.(*DurationTyp).Val; val != tc.d {
+			t.Fatalf("%s: have %s after parsing", tc.d, val)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package geoqlparser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Signature describes the parameter and result types of a function
+// that can be called in expressions, e.g. abs(tracker_delta) > 5.
+type Signature struct {
+	Params []SelectorType
+	Result SelectorType
+	// Variadic allows the last parameter to be repeated.
+	Variadic bool
+}
+
+func (sig Signature) param(i int) SelectorType {
+	if i >= len(sig.Params) {
+		return sig.Params[len(sig.Params)-1]
+	}
+	return sig.Params[i]
+}
+
+func (sig Signature) arity() string {
+	if sig.Variadic {
+		return fmt.Sprintf("at least %d", len(sig.Params)-1)
+	}
+	return fmt.Sprintf("%d", len(sig.Params))
+}
+
+// builtins are available to every trigger. Time values are Unix timestamps
+// in seconds, distances are in meters and areas in square meters.
+var builtins = map[string]Signature{
+	// math
+	"abs":   {Params: []SelectorType{Float}, Result: Float},
+	"round": {Params: []SelectorType{Float}, Result: Int},
+	"floor": {Params: []SelectorType{Float}, Result: Int},
+	"ceil":  {Params: []SelectorType{Float}, Result: Int},
+	"sqrt":  {Params: []SelectorType{Float}, Result: Float},
+	"pow":   {Params: []SelectorType{Float, Float}, Result: Float},
+	// geometry
+	"distance": {Params: []SelectorType{Geometry, Geometry}, Result: Float},
+	"area":     {Params: []SelectorType{Geometry}, Result: Float},
+	"length":   {Params: []SelectorType{Geometry}, Result: Float},
+	// date
+	"hour":    {Params: []SelectorType{Int}, Result: Int},
+	"minute":  {Params: []SelectorType{Int}, Result: Int},
+	"day":     {Params: []SelectorType{Int}, Result: Int},
+	"weekday": {Params: []SelectorType{Int}, Result: Int},
+	"month":   {Params: []SelectorType{Int}, Result: Int},
+	"year":    {Params: []SelectorType{Int}, Result: Int},
+	// arrays and strings
+	"len": {Params: []SelectorType{Any}, Result: Int},
+}
+
+var (
+	funcsMu sync.RWMutex
+	funcs   = make(map[string]Signature)
+)
+
+// RegisterFunc makes the function available to CheckType. Names are case-insensitive.
+// Built-in functions and names that are keywords of the language cannot be registered,
+// the result type must not be Any. RegisterFunc is safe for concurrent use.
+func RegisterFunc(name string, sig Signature) error {
+	name = strings.ToLower(name)
+	if tok, lit := NewTokenizer(strings.NewReader(name)).Scan(); tok != SELECTOR || lit != name {
+		return fmt.Errorf("geoql: invalid function name %q", name)
+	}
+	if sig.Result < Int || sig.Result >= Any {
+		return fmt.Errorf("geoql: invalid result type of function %s", name)
+	}
+	if sig.Variadic && len(sig.Params) == 0 {
+		return fmt.Errorf("geoql: variadic function %s without parameters", name)
+	}
+	for _, p := range sig.Params {
+		if p < Int || p > Any {
+			return fmt.Errorf("geoql: invalid parameter type of function %s", name)
+		}
+	}
+	funcsMu.Lock()
+	defer funcsMu.Unlock()
+	if _, ok := builtins[name]; ok || isWindowFunc(name) || isHistoryFunc(name) {
+		return fmt.Errorf("geoql: function %s is built-in", name)
+	}
+	if _, ok := funcs[name]; ok {
+		return fmt.Errorf("geoql: function %s already registered", name)
+	}
+	sig.Params = append([]SelectorType(nil), sig.Params...)
+	funcs[name] = sig
+	return nil
+}
+
+// LookupFunc returns the signature of a built-in or registered function.
+func LookupFunc(name string) (Signature, bool) {
+	name = strings.ToLower(name)
+	if sig, ok := builtins[name]; ok {
+		return sig, true
+	}
+	funcsMu.RLock()
+	defer funcsMu.RUnlock()
+	sig, ok := funcs[name]
+	return sig, ok
+}
+
+// Funcs returns the sorted names of the built-in and registered functions.
+// Window and history functions are not included.
+func Funcs() []string {
+	funcsMu.RLock()
+	names := make([]string, 0, len(builtins)+len(funcs))
+	for name := range funcs {
+		names = append(names, name)
+	}
+	funcsMu.RUnlock()
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *parser) parseCallExpr(name string, lpos Pos) (Expr, error) {
+	call := &CallExpr{Func: name, lpos: lpos}
+	s.resetSign()
+	if s.t.peek() == ')' {
+		s.next()
+	}
+	for !s.except(RPAREN) {
+		arg, err := s.parseBinaryExpr(OR.Precedence())
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+		if !s.except(COMMA, RPAREN) {
+			s.err = fmt.Errorf("invalid call of %s: expected , or )", name)
+			return nil, s.error()
+		}
+	}
+	call.rpos = s.t.Offset() + 1
+	s.next()
+	switch {
+	case isWindowFunc(name):
+		return s.windowExpr(call)
+	case isHistoryFunc(name):
+		return s.historyExpr(call)
+	}
+	return call, nil
+}
+
+func (tc *checker) evalCall(e *CallExpr) (Expr, error) {
+	sig, ok := LookupFunc(e.Func)
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", e.Func)
+	}
+	if len(e.Args) < len(sig.Params) && !(sig.Variadic && len(e.Args) == len(sig.Params)-1) ||
+		len(e.Args) > len(sig.Params) && !sig.Variadic {
+		return nil, fmt.Errorf("invalid call of %s: have %d arguments, want %s",
+			formatExpr(e), len(e.Args), sig.arity())
+	}
+	for i, arg := range e.Args {
+		x, err := tc.walk(arg)
+		if err != nil {
+			return nil, err
+		}
+		typ := sig.param(i)
+		if !tc.isType(typ, x) {
+			return nil, fmt.Errorf("invalid call of %s: argument %d is not %s",
+				formatExpr(e), i+1, typ)
+		}
+	}
+	return typeExpr(sig.Result), nil
+}
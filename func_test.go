@@ -0,0 +1,203 @@
+package geoqlparser
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseCallExpr(t *testing.T) {
+	testCases := []struct {
+		name string
+		s    string
+		want string
+		err  bool
+	}{
+		{
+			name: "single argument",
+			s:    `when abs(tracker_delta) > 5`,
+			want: `>(abs(tracker_delta), 5)`,
+		},
+		{
+			name: "several arguments",
+			s:    `when distance(tracker_coords, @depot) < 2Km`,
+			want: `<(distance(tracker_coords, @depot), 2Km)`,
+		},
+		{
+			name: "range",
+			s:    `when hour(tracker_time) in 9 .. 17`,
+			want: `in(hour(tracker_time), 9 .. 17)`,
+		},
+		{
+			name: "keyword name",
+			s:    `when month(tracker_time) == 1 and weekday(tracker_time) in [0, 6]`,
+			want: `and(==(month(tracker_time), 1), in(weekday(tracker_time), [0, 6]))`,
+		},
+		{
+			name: "expression arguments",
+			s:    `when pow(tracker_a - 1, 2 * 2) > abs(-3)`,
+			want: `>(pow(tracker_a-1, 2*2), abs(-3))`,
+		},
+		{
+			name: "nested",
+			s:    `when sqrt(abs(tracker_a)) > 1 or len(tracker_tags) > 0`,
+			want: `or(>(sqrt(abs(tracker_a)), 1), >(len(tracker_tags), 0))`,
+		},
+		{
+			name: "no arguments",
+			s:    `when now( ) > 1`,
+			want: `>(now(), 1)`,
+		},
+		{
+			name: "case insensitive",
+			s:    `when ABS(tracker_a) > 1`,
+			want: `>(abs(tracker_a), 1)`,
+		},
+		{
+			name: "unclosed",
+			s:    `when abs(tracker_a > 1`,
+			err:  true,
+		},
+		{
+			name: "trailing comma",
+			s:    `when abs(tracker_a,) > 1`,
+			err:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := Parse(tc.s)
+			if tc.err {
+				if err == nil {
+					t.Fatal("have nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			when := stmt.(*Trigger).When
+			if have := sexpr(when); have != tc.want {
+				t.Fatalf("have %s, want %s", have, tc.want)
+			}
+			buf := bytes.NewBuffer(nil)
+			if err = Format(buf, stmt); err != nil {
+				t.Fatal(err)
+			}
+			again, err := Parse(buf.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have, want := sexpr(again.(*Trigger).When), tc.want; have != want {
+				t.Fatalf("have %s, want %s after format", have, want)
+			}
+		})
+	}
+}
+
+func TestCallExprPos(t *testing.T) {
+	stmt, err := Parse(`when distance(tracker_a, @b) > 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := stmt.(*Trigger).When.(*BinaryExpr).Left
+	if have, want := [2]Pos{call.Pos(), call.End()}, [2]Pos{5, 28}; have != want {
+		t.Fatalf("have %v, want %v", have, want)
+	}
+}
+
+func TestCheckCall(t *testing.T) {
+	dict := Dict()
+	dict["s_int"] = Int
+	dict["s_float"] = Float
+	dict["s_string"] = String
+	dict["s_coords"] = ArrayFloat
+	dict["s_place"] = Geometry
+	dict["s_tags"] = ArrayString
+	testCases := []struct {
+		name string
+		s    string
+		err  bool
+	}{
+		{name: "math", s: `when abs(s_float) > 5 and round(s_float) == 1 and pow(s_int, 2) < 10.5`},
+		{name: "geometry", s: `when distance(s_coords, point[1, 1]) < 2Km and area(s_place) > 100`},
+		{name: "geometry variable", s: `trigger set depot=point[1, 1]; when distance(s_place, @depot) < 2Km`},
+		{name: "date", s: `when hour(s_int) in 9 .. 17 and weekday(s_int) in [1, 2]`},
+		{name: "len", s: `when len(s_tags) > 0 and len(s_string) < 10`},
+		{name: "nested", s: `when sqrt(abs(s_float - s_int)) > 1`},
+		{name: "unknown function", s: `when foo(s_int) > 1`, err: true},
+		{name: "too few arguments", s: `when pow(s_int) > 1`, err: true},
+		{name: "too many arguments", s: `when abs(s_int, 1) > 1`, err: true},
+		{name: "argument type", s: `when abs(s_string) > 1`, err: true},
+		{name: "geometry argument type", s: `when area(s_string) > 1`, err: true},
+		{name: "result type", s: `when hour(s_int) == "noon"`, err: true},
+		{name: "argument with undeclared selector", s: `when abs(s_unknown) > 1`, err: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := Parse(tc.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = CheckType(stmt, dict)
+			if have, want := err != nil, tc.err; have != want {
+				t.Fatalf("have %v, want error %v", err, want)
+			}
+		})
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	sig := Signature{Params: []SelectorType{String, Int}, Result: Boolean, Variadic: true}
+	if err := RegisterFunc("HasTag", sig); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		funcsMu.Lock()
+		delete(funcs, "hastag")
+		funcsMu.Unlock()
+	}()
+	sig.Params[0] = Float
+	if have, _ := LookupFunc("hastag"); have.Params[0] != String {
+		t.Fatalf("have %s, want registered params to be copied", have.Params[0])
+	}
+	dict := Dict()
+	dict["s_tag"] = String
+	for s, isErr := range map[string]bool{
+		`when hastag(s_tag)`:                    false,
+		`when hastag(s_tag, 1, 2) and true`:     false,
+		`when hastag(s_tag, "1")`:               true,
+		`when hastag()`:                         true,
+		`when not hastag(s_tag, 1) xor s_tag`:   true,
+		`when not hastag(s_tag, 1) xor true`:    false,
+		`when hastag(s_tag, 1.5) or hastag(1)`:  true,
+		`when hastag("a") == hastag("b", 1, 2)`: false,
+	} {
+		stmt, err := Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = CheckType(stmt, dict); (err != nil) != isErr {
+			t.Fatalf("%s: have %v, want error %v", s, err, isErr)
+		}
+	}
+
+	invalid := []struct {
+		name string
+		sig  Signature
+	}{
+		{name: "hastag", sig: sig},
+		{name: "abs", sig: sig},
+		{name: "point", sig: sig},
+		{name: "not", sig: sig},
+		{name: "has tag", sig: sig},
+		{name: "", sig: sig},
+		{name: "anything", sig: Signature{Params: []SelectorType{Any}, Result: Any}},
+		{name: "variadic", sig: Signature{Result: Int, Variadic: true}},
+		{name: "unknown", sig: Signature{Params: []SelectorType{0}, Result: Int}},
+	}
+	for _, tc := range invalid {
+		if err := RegisterFunc(tc.name, tc.sig); err == nil {
+			t.Fatalf("%q: have nil, want error", tc.name)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package geoqlparser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The seed corpus is in testdata/fuzz, run e.g.
+// go test -fuzz=FuzzParse -fuzztime=1m to extend it.
+
+func FuzzParse(f *testing.F) {
+	f.Add(`when tracker_a > 1`)
+	f.Fuzz(func(t *testing.T, s string) {
+		stmt, err := parseTerminates(t, s, 0)
+		if err != nil {
+			var pe *Error
+			if !errors.As(err, &pe) {
+				t.Fatalf("Parse(%q): have %T %v, want *Error", s, err, err)
+			}
+			return
+		}
+		if stmt == nil {
+			t.Fatalf("Parse(%q): nil statement without error", s)
+		}
+	})
+}
+
+func FuzzFormat(f *testing.F) {
+	f.Add(`when tracker_a > 1`)
+	f.Fuzz(func(t *testing.T, s string) {
+		stmt, err := parseTerminates(t, s, ParseComments)
+		if err != nil {
+			return
+		}
+		var a strings.Builder
+		if err = Format(&a, stmt); err != nil {
+			return
+		}
+		again, err := parseTerminates(t, a.String(), ParseComments)
+		if err != nil {
+			t.Fatalf("Parse(Format(%q)) = %q: %v", s, a.String(), err)
+		}
+		var b strings.Builder
+		if err = Format(&b, again); err != nil {
+			t.Fatalf("Format(Parse(Format(%q))): %v", s, err)
+		}
+		if a.String() != b.String() {
+			t.Fatalf("Format is not stable for %q:\n%s\n%s", s, a.String(), b.String())
+		}
+	})
+}
+
+func FuzzCheckType(f *testing.F) {
+	f.Add(`when tracker_a > 1`)
+	f.Fuzz(func(t *testing.T, s string) {
+		stmt, err := parseTerminates(t, s, 0)
+		if err != nil {
+			return
+		}
+		dict := Dict()
+		Walk(declareVisitor(dict), stmt.(*Trigger))
+		_ = CheckType(stmt, dict)
+	})
+}
+
+// declareVisitor declares every selector with a type derived from its name.
+type declareVisitor Dictionary
+
+func (v declareVisitor) Visit(expr Expr) Visitor {
+	if sel, ok := expr.(*Selector); ok {
+		v[sel.Ident] = SelectorType(len(sel.Ident)%int(Geometry) + 1)
+	}
+	return v
+}
+
+// parseTerminates fails the test if parsing s takes longer than a second.
+func parseTerminates(t *testing.T, s string, mode Mode) (stmt Statement, err error) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		stmt, err = ParseWithMode(s, mode)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Parse(%q) does not terminate", s)
+	}
+	return
+}
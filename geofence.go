@@ -0,0 +1,108 @@
+package geoqlparser
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// GeofenceTracker evaluates the enters, exits and dwells in operators.
+// It remembers the last known containment of each device per geometry,
+// the containment itself is computed by the application.
+// GeofenceTracker is safe for concurrent use.
+type GeofenceTracker struct {
+	mu      sync.Mutex
+	devices map[string]map[string]*fence
+}
+
+type fence struct {
+	at        time.Time
+	since     time.Time // start of the current containment
+	inside    bool
+	prev      bool
+	prevSince time.Time
+	known     bool // prev holds a previous observation
+}
+
+// NewGeofenceTracker creates an empty tracker.
+func NewGeofenceTracker() *GeofenceTracker {
+	return &GeofenceTracker{devices: make(map[string]map[string]*fence)}
+}
+
+// Observe records whether the device is inside the geometry at the time. The geometry
+// is the right operand of the operator, e.g. @warehouse in tracker_coords enters @warehouse.
+// An observation at the same time as the last one replaces it, so operators that share
+// a geometry can be observed one by one. Observations older than the last one are ignored.
+func (g *GeofenceTracker) Observe(device string, geometry Expr, at time.Time, inside bool) {
+	key := formatExpr(geometry)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fences, ok := g.devices[device]
+	if !ok {
+		fences = make(map[string]*fence)
+		g.devices[device] = fences
+	}
+	f, ok := fences[key]
+	switch {
+	case !ok:
+		fences[key] = &fence{at: at, since: at, inside: inside}
+		return
+	case at.Before(f.at):
+		return
+	case at.Equal(f.at):
+		f.inside, f.since = inside, at
+		if f.known && f.prev == inside {
+			f.since = f.prevSince
+		}
+		return
+	}
+	f.prev, f.prevSince, f.known = f.inside, f.since, true
+	if f.inside != inside {
+		f.since = at
+	}
+	f.at, f.inside = at, inside
+}
+
+// Eval reports the result of the operator for the device at now:
+//   - enters is true when the device was outside at the previous observation and is inside now;
+//   - exits is true when the device was inside at the previous observation and is outside now;
+//   - dwells in ... for d is true when the device has been inside for at least d.
+//
+// Transitions are not reported for the first observation, as the previous containment is unknown.
+func (g *GeofenceTracker) Eval(device string, e *BinaryExpr, now time.Time) (bool, error) {
+	var hold time.Duration
+	if e.Op == FOR {
+		dur, ok := e.Right.(*DurationTyp)
+		inner, isBinary := unparen(e.Left).(*BinaryExpr)
+		if !ok || !isBinary || inner.Op != DWELLS {
+			return false, fmt.Errorf("geoql: %s is not a geofence operator", formatExpr(e))
+		}
+		e, hold = inner, dur.Val
+	}
+	switch e.Op {
+	case ENTERS, EXITS, DWELLS:
+	default:
+		return false, fmt.Errorf("geoql: %s is not a geofence operator", formatExpr(e))
+	}
+	key := formatExpr(e.Right)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	f, ok := g.devices[device][key]
+	if !ok {
+		return false, nil
+	}
+	switch e.Op {
+	case ENTERS:
+		return f.known && !f.prev && f.inside, nil
+	case EXITS:
+		return f.known && f.prev && !f.inside, nil
+	}
+	return f.inside && now.Sub(f.since) >= hold, nil
+}
+
+// Forget drops the state of the device.
+func (g *GeofenceTracker) Forget(device string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.devices, device)
+}
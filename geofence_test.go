@@ -0,0 +1,155 @@
+package geoqlparser
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestParseGeofence(t *testing.T) {
+	testCases := []struct {
+		name string
+		s    string
+		want string
+		err  bool
+	}{
+		{
+			name: "enters",
+			s:    `when tracker_coords enters @warehouse`,
+			want: `enters(tracker_coords, @warehouse)`,
+		},
+		{
+			name: "exits",
+			s:    `when tracker_coords exits polygon[[[1, 1], [2, 2], [3, 3], [1, 1]]] and tracker_speed > 1`,
+			want: `and(exits(tracker_coords, polygon[[[1, 1], [2, 2], [3, 3], [1, 1]]]), >(tracker_speed, 1))`,
+		},
+		{
+			name: "dwells in",
+			s:    `when tracker_coords DWELLS IN @yard for 15m or tracker_a`,
+			want: `or(for(dwells in(tracker_coords, @yard), 15m0s), tracker_a)`,
+		},
+		{
+			name: "dwells as selector",
+			s:    `when dwells > 1`,
+			want: `>(dwells, 1)`,
+		},
+		{
+			name: "dwells in without duration",
+			s:    `when tracker_coords dwells in @yard and tracker_a`,
+			err:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := Parse(tc.s)
+			if tc.err {
+				if err == nil {
+					t.Fatal("have nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := sexpr(stmt.(*Trigger).When); have != tc.want {
+				t.Fatalf("have %s, want %s", have, tc.want)
+			}
+			buf := bytes.NewBuffer(nil)
+			if err = Format(buf, stmt); err != nil {
+				t.Fatal(err)
+			}
+			again, err := Parse(buf.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := sexpr(again.(*Trigger).When); have != tc.want {
+				t.Fatalf("have %s, want %s after format", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckGeofence(t *testing.T) {
+	dict := Dict()
+	dict["s_coords"] = ArrayFloat
+	dict["s_string"] = String
+	for s, isErr := range map[string]bool{
+		`trigger set w=point[1, 1]; when s_coords enters @w or s_coords exits @w`: false,
+		`when s_coords dwells in point[1, 1]:1km for 1m`:                          false,
+		`when s_coords enters 1`:                                                  true,
+		`when s_string exits point[1, 1]`:                                         true,
+	} {
+		stmt, err := Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = CheckType(stmt, dict); (err != nil) != isErr {
+			t.Fatalf("%s: have %v, want error %v", s, err, isErr)
+		}
+	}
+}
+
+func TestGeofenceTracker(t *testing.T) {
+	stmt, err := Parse(`when tracker_coords enters @w or tracker_coords exits @w or tracker_coords dwells in @w for 10m`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []*BinaryExpr
+	Visit(stmt.(*Trigger).When, func(expr Expr) bool {
+		if e, ok := expr.(*BinaryExpr); ok && e.Op != OR {
+			ops = append(ops, e)
+			return false
+		}
+		return true
+	})
+	if len(ops) != 3 {
+		t.Fatalf("have %d, want 3 operators", len(ops))
+	}
+	enters, exits, dwells := ops[0], ops[1], ops[2]
+
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := NewGeofenceTracker()
+	steps := []struct {
+		after                 time.Duration
+		inside                bool
+		enters, exits, dwells bool
+	}{
+		{after: 0, inside: true},
+		{after: time.Minute, inside: false, exits: true},
+		{after: 2 * time.Minute, inside: true, enters: true},
+		{after: 5 * time.Minute, inside: true},
+		{after: 12 * time.Minute, inside: true, dwells: true},
+		{after: 13 * time.Minute, inside: false, exits: true},
+	}
+	for _, step := range steps {
+		at := start.Add(step.after)
+		// Each operator observes the shared geometry at the same time.
+		for range ops {
+			tracker.Observe("dev", enters.Right, at, step.inside)
+		}
+		for _, want := range []struct {
+			e    *BinaryExpr
+			want bool
+		}{{enters, step.enters}, {exits, step.exits}, {dwells, step.dwells}} {
+			have, err := tracker.Eval("dev", want.e, at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have != want.want {
+				t.Fatalf("after %s: have %v, want %v for %s", step.after, have, want.want, formatExpr(want.e))
+			}
+		}
+	}
+
+	if ok, err := tracker.Eval("other", enters, start); ok || err != nil {
+		t.Fatalf("have %v %v, want false for unknown device", ok, err)
+	}
+	other := &BinaryExpr{Op: GTR, Left: &Selector{Ident: "tracker_a"}, Right: &IntTyp{Val: 1}}
+	if _, err = tracker.Eval("dev", other, start); err == nil {
+		t.Fatal("have nil, want error")
+	}
+	tracker.Forget("dev")
+	if ok, _ := tracker.Eval("dev", exits, start.Add(13*time.Minute)); ok {
+		t.Fatal("have state after forget")
+	}
+}
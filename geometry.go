@@ -1,244 +1,234 @@
 package geoqlparser
 
-import "strconv"
+import (
+	"fmt"
+	"strconv"
+)
+
+var geometryNames = map[Token]string{
+	GEOMETRY_POINT:        "point",
+	GEOMETRY_LINE:         "line",
+	GEOMETRY_POLYGON:      "polygon",
+	GEOMETRY_MULTIPOINT:   "multipoint",
+	GEOMETRY_MULTILINE:    "multiline",
+	GEOMETRY_MULTIPOLYGON: "multipolygon",
+	GEOMETRY_COLLECTION:   "collection",
+}
+
+// multiParts are the geometries of multi objects.
+var multiParts = map[Token]Token{
+	GEOMETRY_MULTIPOINT:   GEOMETRY_POINT,
+	GEOMETRY_MULTILINE:    GEOMETRY_LINE,
+	GEOMETRY_MULTIPOLYGON: GEOMETRY_POLYGON,
+}
 
 func (s *parser) parseGeometryMultiObject() (expr Expr, err error) {
-	geotyp := s.tok
-	s.next()
-	if !s.except(LBRACK) {
-		return nil, s.error()
+	if err = s.enter(); err != nil {
+		return nil, err
 	}
-	s.next()
+	defer s.leave()
+	kind, name := s.tok, geometryNames[s.tok]
 	multiobj := &GeometryMultiObjectTyp{
-		Kind: geotyp,
+		Kind: kind,
 		Val:  make([]Expr, 0),
 		lpos: s.t.Offset(),
 	}
-	for {
-		if !isGeometryToken(s.tok) {
-			break
-		}
-		object, oer := s.parseGeometryExpr()
-		if oer != nil {
-			return nil, oer
-		}
-		switch typ := object.(type) {
-		default:
-			return nil, s.error()
-		case *GeometryPointTyp:
-			if multiobj.Kind != GEOMETRY_MULTIPOINT {
-				return nil, s.error()
-			}
-			multiobj.Val = append(multiobj.Val, typ)
-		case *GeometryLineTyp:
-			if multiobj.Kind != GEOMETRY_MULTILINE {
-				return nil, s.error()
-			}
-			multiobj.Val = append(multiobj.Val, typ)
-		case *GeometryPolygonTyp:
-			if multiobj.Kind != GEOMETRY_MULTIPOLYGON {
-				return nil, s.error()
-			}
-			multiobj.Val = append(multiobj.Val, typ)
-		}
-		if s.except(RBRACK) {
-			s.next()
-			break
+	s.next()
+	multiobj.rpos, err = s.parseList(name, func() error {
+		if part := multiParts[kind]; s.tok != part {
+			s.err = fmt.Errorf("invalid %s: expected %s", name, geometryNames[part])
+			return s.error()
 		}
-		if s.except(COMMA) {
-			s.next()
+		object, err := s.parseGeometryExpr()
+		if err != nil {
+			return err
 		}
-	}
-	multiobj.rpos = s.t.Offset()
-	if len(multiobj.Val) == 0 {
-		return nil, s.error()
+		multiobj.Val = append(multiobj.Val, object)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return multiobj, nil
 }
 
 func (s *parser) parseGeometryCollectionExpr() (expr Expr, err error) {
+	if err = s.enter(); err != nil {
+		return nil, err
+	}
+	defer s.leave()
 	collection := &GeometryCollectionTyp{
 		Objects: make([]Expr, 0),
 		lpos:    s.t.Offset(),
 	}
 	s.next()
-	if !s.except(LBRACK) {
-		return nil, s.error()
-	}
-	s.next()
-	for {
-		if !isGeometryToken(s.tok) {
-			break
-		}
+	collection.rpos, err = s.parseList("collection", func() error {
 		var object Expr
-		var oer error
+		var err error
 		switch s.tok {
 		default:
-			object, oer = s.parseGeometryExpr()
+			s.err = fmt.Errorf("invalid collection: expected geometry")
+			return s.error()
+		case GEOMETRY_POINT, GEOMETRY_LINE, GEOMETRY_POLYGON:
+			object, err = s.parseGeometryExpr()
 		case GEOMETRY_MULTIPOINT, GEOMETRY_MULTILINE, GEOMETRY_MULTIPOLYGON:
-			object, oer = s.parseGeometryMultiObject()
+			object, err = s.parseGeometryMultiObject()
 		}
-		if oer != nil {
-			return nil, oer
+		if err != nil {
+			return err
 		}
 		collection.Objects = append(collection.Objects, object)
-		if s.except(RBRACK) {
-			s.next()
-			break
-		}
-		if s.except(COMMA) {
-			s.next()
-		}
-	}
-	collection.rpos = s.t.Offset()
-	if len(collection.Objects) == 0 {
-		return nil, s.error()
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return collection, nil
 }
 
 func (s *parser) parseGeometryExpr() (expr Expr, err error) {
-	geomtyp := s.tok
-	sp := s.t.Offset()
+	kind, name, lpos := s.tok, geometryNames[s.tok], s.t.Offset()
 	s.next()
-	if !s.except(LBRACK) {
-		return nil, s.error()
-	}
-	var path int
-	var x, y float64
-	var pi uint8
-	var aa [2]float64
-	var bb [][2]float64
-	var cc [][][2]float64
-	open := true
-	q := 1
-	for {
-		s.next()
-		if s.except(EOF) {
-			break
-		}
-		if !s.except(LBRACK, SUB, COMMA, FLOAT, INT, RBRACK) {
-			break
-		}
-		if s.except(LBRACK) {
-			path++
-			q++
-			open = true
-			continue
-		}
-		if s.except(RBRACK) {
-			if open {
-				switch path {
-				case 0:
-					aa = [2]float64{x, y}
-				case 1:
-					if bb == nil {
-						bb = make([][2]float64, 0)
-					}
-					bb = append(bb, [2]float64{x, y})
-				case 2:
-					if cc == nil {
-						cc = make([][][2]float64, 0)
-					}
-					if bb == nil {
-						bb = make([][2]float64, 0)
-					}
-					bb = append(bb, [2]float64{x, y})
-				}
-			}
-			if path > 0 {
-				path--
-			}
-			if path == 0 && bb != nil && cc != nil {
-				if len(bb) > 0 {
-					cc = append(cc, bb)
-				}
-				bb = make([][2]float64, 0)
-			}
-			open = false
-			pi = 0
-			x = 0
-			y = 0
-			q--
-			if q <= 0 {
-				s.next()
-				break
-			}
-			continue
-		}
-		if s.except(COMMA) {
-			if open {
-				pi = 1
-			}
-			continue
-		}
-		if s.except(SUB) {
-			s.sign = SUB
-			s.next()
-		}
-
-		var val float64
-		switch s.tok {
-		case FLOAT:
-			val, err = strconv.ParseFloat(s.lit, 64)
-			if err != nil {
-				s.err = err
-				return nil, s.error()
-			}
-		case INT:
-			ival, err := strconv.Atoi(s.lit)
-			if err != nil {
-				s.err = err
-				return nil, s.error()
-			}
-			val = float64(ival)
-		default:
-			return nil, s.error()
-		}
-
-		if s.isSignMinus() {
-			val = -val
-		}
-		switch pi {
-		case 0:
-			x = val
-		case 1:
-			y = val
-		default:
-			return nil, s.error()
-		}
-		s.resetSign()
-	}
-	switch geomtyp {
+	switch kind {
 	case GEOMETRY_POINT:
-		point := &GeometryPointTyp{Val: aa, lpos: sp, rpos: s.t.Offset() - 1}
+		point := &GeometryPointTyp{lpos: lpos}
+		point.Val, point.rpos, err = s.parsePosition(name)
+		if err != nil {
+			return nil, err
+		}
 		if !s.except(COLON) {
 			return point, nil
 		}
-		// point with margin
-		radius, err := s.parseDistance()
-		if err != nil {
+		// point with radius
+		if point.Radius, err = s.parseDistance(); err != nil {
 			return nil, err
 		}
-		point.Radius = radius
 		point.rpos = s.t.Offset()
 		return point, nil
 	case GEOMETRY_LINE:
-		line := &GeometryLineTyp{Val: bb, lpos: sp, rpos: s.t.Offset() - 1}
+		line := &GeometryLineTyp{lpos: lpos}
+		line.Val, line.rpos, err = s.parsePositions(name)
+		if err != nil {
+			return nil, err
+		}
 		if !s.except(COLON) {
 			return line, nil
 		}
 		// line with margin
-		margin, err := s.parseDistance()
-		if err != nil {
+		if line.Margin, err = s.parseDistance(); err != nil {
 			return nil, err
 		}
-		line.Margin = margin
 		line.rpos = s.t.Offset()
 		return line, nil
 	case GEOMETRY_POLYGON:
-		return &GeometryPolygonTyp{Val: cc, lpos: sp, rpos: s.t.Offset() - 1}, nil
+		polygon := &GeometryPolygonTyp{lpos: lpos}
+		polygon.rpos, err = s.parseList(name, func() error {
+			ring, _, err := s.parsePositions(name)
+			if err != nil {
+				return err
+			}
+			polygon.Val = append(polygon.Val, ring)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return polygon, nil
+	}
+	return nil, s.error()
+}
+
+// parseList parses [item, ...] and returns the position of ]. The current
+// token is [, item is called at the first token of each item and must scan
+// the token after it.
+func (s *parser) parseList(name string, item func() error) (Pos, error) {
+	if !s.except(LBRACK) {
+		s.err = fmt.Errorf("invalid %s: expected [", name)
+		return 0, s.error()
+	}
+	s.next()
+	for {
+		if err := item(); err != nil {
+			return 0, err
+		}
+		if s.except(RBRACK) {
+			break
+		}
+		if !s.except(COMMA) {
+			s.err = fmt.Errorf("invalid %s: expected , or ]", name)
+			return 0, s.error()
+		}
+		s.next()
 	}
-	err = s.error()
-	return
+	rpos := s.t.Offset()
+	s.next()
+	return rpos, nil
+}
+
+// parsePositions parses [[lon, lat], ...].
+func (s *parser) parsePositions(name string) (list [][2]float64, rpos Pos, err error) {
+	rpos, err = s.parseList(name, func() error {
+		pos, _, err := s.parsePosition(name)
+		if err != nil {
+			return err
+		}
+		list = append(list, pos)
+		return nil
+	})
+	return list, rpos, err
+}
+
+// parsePosition parses [lon, lat].
+func (s *parser) parsePosition(name string) (pos [2]float64, rpos Pos, err error) {
+	if err = s.vertex(); err != nil {
+		return pos, 0, err
+	}
+	var n int
+	rpos, err = s.parseList(name, func() error {
+		if n == len(pos) {
+			s.err = fmt.Errorf("invalid %s: expected [lon, lat]", name)
+			return s.error()
+		}
+		val, err := s.parseCoord(name)
+		if err != nil {
+			return err
+		}
+		pos[n] = val
+		n++
+		return nil
+	})
+	if err != nil {
+		return pos, 0, err
+	}
+	if n != len(pos) {
+		s.err = fmt.Errorf("invalid %s: expected [lon, lat]", name)
+		return pos, 0, s.error()
+	}
+	return pos, rpos, nil
+}
+
+// parseCoord parses a signed number and scans the next token.
+func (s *parser) parseCoord(name string) (val float64, err error) {
+	sign := 1.0
+	if s.except(SUB) {
+		sign = -1
+		s.next()
+	}
+	switch s.tok {
+	case FLOAT:
+		val, err = strconv.ParseFloat(s.lit, 64)
+	case INT:
+		var ival int
+		ival, err = strconv.Atoi(s.lit)
+		val = float64(ival)
+	default:
+		s.err = fmt.Errorf("invalid %s: expected number", name)
+		return 0, s.error()
+	}
+	if err != nil {
+		s.err = err
+		return 0, s.error()
+	}
+	s.next()
+	return sign * val, nil
 }
@@ -0,0 +1,735 @@
+package geoqlparser
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// GoOptions configures GenerateGo and GenerateGoTest.
+type GoOptions struct {
+	Package string // package name, rules if empty
+	Func    string // exported function name, Match if empty
+}
+
+func (o GoOptions) withDefaults() (GoOptions, error) {
+	if o.Package == "" {
+		o.Package = "rules"
+	}
+	if o.Func == "" {
+		o.Func = "Match"
+	}
+	if !token.IsIdentifier(o.Package) {
+		return o, fmt.Errorf("geoql: invalid package name %q", o.Package)
+	}
+	if !token.IsIdentifier(o.Func) || !token.IsExported(o.Func) {
+		return o, fmt.Errorf("geoql: invalid function name %q", o.Func)
+	}
+	return o, nil
+}
+
+// GenerateGo writes the Go source of a function that evaluates Trigger.When over
+// a generated input struct with a typed field per selector, e.g. Match(in *MatchInput) bool.
+// The trigger is type checked against the dictionary first. A geometry selector
+// is a [lon, lat] position. Numbers are in Kph, meters, C, Bar and seconds, dates
+// are Unix timestamps of midnight UTC and times of day are seconds since midnight.
+// Geometry literals become package-level variables. Windows, history, geofence
+// transitions, nearby, selectors of other devices, properties, h3 and s2 cells
+// and divisions by a constant zero cannot be generated and are reported by a *TranslateError.
+func GenerateGo(w io.Writer, t *Trigger, dict Dictionary, opts GoOptions) error {
+	g, cond, err := newGoWriter(t, dict, opts)
+	if err != nil {
+		return err
+	}
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "// Code generated by geoqlgen. DO NOT EDIT.\n\npackage %s\n\n", g.opts.Package)
+	switch paths := sortedKeys(g.imports); len(paths) {
+	case 0:
+	case 1:
+		fmt.Fprintf(buf, "import %q\n\n", paths[0])
+	default:
+		buf.WriteString("import (\n")
+		for _, path := range paths {
+			fmt.Fprintf(buf, "%q\n", path)
+		}
+		buf.WriteString(")\n\n")
+	}
+	input := g.opts.Func + "Input"
+	fmt.Fprintf(buf, "// %s holds the selectors of %s.\ntype %s struct {\n", input, g.opts.Func, input)
+	for _, ident := range g.selectors() {
+		f := g.fields[ident]
+		fmt.Fprintf(buf, "%s %s `json:%q`\n", f.name, f.typ, ident)
+	}
+	buf.WriteString("}\n\n")
+	for _, decl := range g.decls {
+		buf.WriteString(decl)
+	}
+	fmt.Fprintf(buf, "// %s reports whether the input satisfies the condition.\n//\n//\twhen %s\n", g.opts.Func,
+		strings.ReplaceAll(formatExpr(t.When), "\n", "\n//\t"))
+	fmt.Fprintf(buf, "func %s(in *%s) bool {\nreturn %s\n}\n", g.opts.Func, input, cond.code)
+	for _, name := range sortedKeys(g.helpers) {
+		buf.WriteString("\n")
+		buf.WriteString(strings.ReplaceAll(goHelpers[name], "$", g.prefix))
+	}
+	return writeGo(w, buf.Bytes())
+}
+
+// GenerateGoTest writes a table-driven test scaffold for the function written
+// by GenerateGo with the same options.
+func GenerateGoTest(w io.Writer, t *Trigger, dict Dictionary, opts GoOptions) error {
+	g, _, err := newGoWriter(t, dict, opts)
+	if err != nil {
+		return err
+	}
+	input := g.opts.Func + "Input"
+	fields := make([]string, 0, len(g.fields))
+	for _, ident := range g.selectors() {
+		f := g.fields[ident]
+		fields = append(fields, f.name+": "+goZero[f.typ])
+	}
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "package %s\n\nimport \"testing\"\n\n", g.opts.Package)
+	fmt.Fprintf(buf, "func Test%s(t *testing.T) {\ntestCases := []struct {\nname string\nin %s\nwant bool\n}{\n", g.opts.Func, input)
+	fmt.Fprintf(buf, "// {name: \"example\", in: %s{%s}, want: true},\n}\n", input, strings.Join(fields, ", "))
+	fmt.Fprintf(buf, `for _, tc := range testCases {
+t.Run(tc.name, func(t *testing.T) {
+if have := %s(&tc.in); have != tc.want {
+t.Fatalf("have %%v, want %%v", have, tc.want)
+}
+})
+}
+}
+`, g.opts.Func)
+	return writeGo(w, buf.Bytes())
+}
+
+func writeGo(w io.Writer, src []byte) error {
+	src, err := format.Source(src)
+	if err != nil {
+		return fmt.Errorf("geoql: generated invalid Go source: %w", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// Precedence of the Go operators, higher binds tighter.
+const (
+	goOr = iota + 1
+	goAnd
+	goCmp
+	goAdd
+	goMul
+	goAtom
+)
+
+var goOps = map[Token]struct {
+	op   string
+	prec int
+}{
+	OR: {"||", goOr}, AND: {"&&", goAnd}, XOR: {"!=", goCmp},
+	LSS: {"<", goCmp}, LEQ: {"<=", goCmp}, GTR: {">", goCmp}, GEQ: {">=", goCmp},
+	EQL: {"==", goCmp}, LEQL: {"==", goCmp}, NOT_EQ: {"!=", goCmp}, LNEQ: {"!=", goCmp},
+	ADD: {"+", goAdd}, SUB: {"-", goAdd}, MUL: {"*", goMul}, QUO: {"/", goMul}, REM: {"%", goMul},
+}
+
+var goTypes = map[SelectorType]string{
+	Int:         "int",
+	Float:       "float64",
+	String:      "string",
+	Boolean:     "bool",
+	ArrayInt:    "[]int",
+	ArrayFloat:  "[]float64",
+	ArrayString: "[]string",
+	Geometry:    "[2]float64",
+}
+
+var goZero = map[string]string{
+	"int": "0", "float64": "0", "string": `""`, "bool": "false",
+	"[]int": "nil", "[]float64": "nil", "[]string": "nil", "[2]float64": "[2]float64{0, 0}",
+}
+
+// goVal is a translated expression with the precedence of its operator and its Go type.
+// Constants are untyped, e.g. 5 can be compared with a float64.
+type goVal struct {
+	code  string
+	prec  int
+	typ   string
+	konst bool
+}
+
+type goField struct {
+	name string
+	typ  string
+}
+
+type goWriter struct {
+	trigger *Trigger
+	dict    Dictionary
+	opts    GoOptions
+	prefix  string              // prefix of the package-level names
+	fields  map[string]goField  // selector fields
+	names   map[string]string   // field name to selector
+	geoms   map[string]string   // literal to variable name
+	decls   []string            // package-level variables
+	helpers map[string]struct{} // helper functions
+	imports map[string]struct{}
+	failed  []Expr
+}
+
+func newGoWriter(t *Trigger, dict Dictionary, opts GoOptions) (*goWriter, goVal, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, goVal{}, err
+	}
+	if err = CheckType(t, dict); err != nil {
+		return nil, goVal{}, err
+	}
+	g := &goWriter{
+		trigger: t,
+		dict:    dict,
+		opts:    opts,
+		prefix:  string(unicode.ToLower(rune(opts.Func[0]))) + opts.Func[1:],
+		fields:  make(map[string]goField),
+		names:   make(map[string]string),
+		geoms:   make(map[string]string),
+		helpers: make(map[string]struct{}),
+		imports: make(map[string]struct{}),
+	}
+	cond := g.node(t.When)
+	if len(g.failed) > 0 {
+		return nil, goVal{}, &TranslateError{Target: "go", Exprs: g.failed}
+	}
+	if cond.typ != "bool" {
+		return nil, goVal{}, fmt.Errorf("geoql: condition %s is not a boolean", formatExpr(t.When))
+	}
+	return g, cond, nil
+}
+
+// selectors returns the sorted selectors of the input fields.
+func (g *goWriter) selectors() []string {
+	list := make([]string, 0, len(g.fields))
+	for ident := range g.fields {
+		list = append(list, ident)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// fail reports the expression unless one of its operands has failed already.
+func (g *goWriter) fail(expr Expr, operands ...goVal) goVal {
+	for _, v := range operands {
+		if v.typ == "" {
+			return v
+		}
+	}
+	g.failed = append(g.failed, expr)
+	return goVal{code: "false", prec: goAtom}
+}
+
+func (g *goWriter) resolve(expr Expr) Expr {
+	expr = unparen(expr)
+	if ref, ok := expr.(*Ref); ok {
+		if assign, err := g.trigger.findAssign(ref.ID); err == nil {
+			return unparen(assign.Right)
+		}
+	}
+	return expr
+}
+
+func (g *goWriter) helper(name string, imports ...string) string {
+	g.helpers[name] = struct{}{}
+	for _, path := range imports {
+		g.imports[path] = struct{}{}
+	}
+	return g.prefix + name
+}
+
+// field returns the input field of the selector of the current device.
+func (g *goWriter) field(s *Selector) (goVal, bool) {
+	if s.multi() || len(s.Props) > 0 {
+		return goVal{}, false
+	}
+	decl, ok := g.dict[s.Ident]
+	if !ok || decl == nil {
+		return goVal{}, false
+	}
+	typ, ok := goTypes[decl.declType()]
+	if !ok {
+		return goVal{}, false
+	}
+	f, ok := g.fields[s.Ident]
+	if !ok {
+		f = goField{name: goName(s.Ident), typ: typ}
+		if _, dup := g.names[f.name]; dup {
+			f.name += strconv.Itoa(len(g.fields))
+		}
+		g.fields[s.Ident] = f
+		g.names[f.name] = s.Ident
+	}
+	return goVal{code: "in." + f.name, prec: goAtom, typ: f.typ}, true
+}
+
+// goName returns the exported field name of the selector, e.g. TrackerSpeed for tracker_speed.
+func goName(ident string) string {
+	var sb strings.Builder
+	upper := true
+	for _, r := range ident {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	name := sb.String()
+	if name == "" || !unicode.IsUpper(rune(name[0])) {
+		name = "S" + name
+	}
+	return name
+}
+
+func goFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func goPoint(p [2]float64) string {
+	return "{" + goFloat(p[0]) + ", " + goFloat(p[1]) + "}"
+}
+
+func goPoints(points [][2]float64) string {
+	list := make([]string, len(points))
+	for i, p := range points {
+		list[i] = goPoint(p)
+	}
+	return "{" + strings.Join(list, ", ") + "}"
+}
+
+// geom returns the package-level variable that holds the literal.
+func (g *goWriter) geom(typ, lit string) string {
+	key := typ + lit
+	if name, ok := g.geoms[key]; ok {
+		return name
+	}
+	name := g.prefix + "Geom" + strconv.Itoa(len(g.geoms))
+	g.geoms[key] = name
+	g.decls = append(g.decls, "var "+name+" = "+typ+lit+"\n\n")
+	return name
+}
+
+// operand parenthesizes the value if it binds looser than prec.
+func operand(v goVal, prec int) string {
+	if v.prec < prec {
+		return "(" + v.code + ")"
+	}
+	return v.code
+}
+
+func toFloat64(v goVal) goVal {
+	if v.typ != "int" || v.konst {
+		return v
+	}
+	return goVal{code: "float64(" + v.code + ")", prec: goAtom, typ: "float64"}
+}
+
+func isGoNumber(v goVal) bool {
+	return v.typ == "int" || v.typ == "float64"
+}
+
+// numbers converts an int operand to float64 if the other one is a float64.
+func numbers(a, b goVal) (goVal, goVal, string) {
+	if a.typ == b.typ {
+		return a, b, a.typ
+	}
+	return toFloat64(a), toFloat64(b), "float64"
+}
+
+func (g *goWriter) binary(op string, prec int, a, b goVal, typ string) goVal {
+	return goVal{
+		code:  operand(a, prec) + " " + op + " " + operand(b, prec+1),
+		prec:  prec,
+		typ:   typ,
+		konst: a.konst && b.konst,
+	}
+}
+
+func (g *goWriter) node(expr Expr) goVal {
+	switch typ := expr.(type) {
+	case *ParenExpr:
+		return g.node(typ.Expr)
+	case *Ref:
+		if val := g.resolve(typ); val != Expr(typ) {
+			return g.node(val)
+		}
+	case *BooleanTyp:
+		return goVal{code: strconv.FormatBool(typ.Val), prec: goAtom, typ: "bool", konst: true}
+	case *IntTyp:
+		return goVal{code: strconv.Itoa(typ.Val), prec: goAtom, typ: "int", konst: true}
+	case *StringTyp:
+		return goVal{code: strconv.Quote(typ.Val), prec: goAtom, typ: "string", konst: true}
+	case *DateTyp:
+		unix := time.Date(typ.Year, time.Month(typ.Month), typ.Day, 0, 0, 0, 0, time.UTC).Unix()
+		return goVal{code: strconv.FormatInt(unix, 10), prec: goAtom, typ: "int", konst: true}
+	case *TimeTyp, *WeekdayTyp, *MonthTyp:
+		v, _, _ := baseValue(typ)
+		return goVal{code: strconv.Itoa(int(v)), prec: goAtom, typ: "int", konst: true}
+	case *GeometryPointTyp:
+		if typ.Radius == nil {
+			return goVal{code: g.geom("[2]float64", goPoint(typ.Val)), prec: goAtom, typ: "[2]float64"}
+		}
+	case *Selector:
+		if v, ok := g.field(typ); ok {
+			return v
+		}
+	case *UnaryExpr:
+		x := g.node(typ.X)
+		if x.typ != "bool" {
+			return g.fail(typ, x)
+		}
+		return goVal{code: "!" + operand(x, goAtom), prec: goAtom, typ: "bool", konst: x.konst}
+	case *CallExpr:
+		return g.call(typ)
+	case *BinaryExpr:
+		return g.binaryExpr(typ)
+	}
+	if v, _, ok := baseValue(expr); ok {
+		return goVal{code: goFloat(v), prec: goAtom, typ: "float64", konst: true}
+	}
+	return g.fail(expr)
+}
+
+func (g *goWriter) binaryExpr(e *BinaryExpr) goVal {
+	switch e.Op {
+	case IN, NOT_IN, INTERSECTS, NOT_INTERSECTS:
+		return g.in(e)
+	}
+	op, ok := goOps[e.Op]
+	if !ok {
+		return g.fail(e)
+	}
+	a, b := g.node(e.Left), g.node(e.Right)
+	if a.typ == "" || b.typ == "" {
+		return g.fail(e, a, b)
+	}
+	switch e.Op {
+	case OR, AND, XOR:
+		if a.typ != "bool" || b.typ != "bool" {
+			return g.fail(e)
+		}
+		if e.Op == XOR {
+			return g.binary(op.op, op.prec, goVal{code: operand(a, goCmp+1), prec: goAtom, typ: "bool"},
+				goVal{code: operand(b, goCmp+1), prec: goAtom, typ: "bool"}, "bool")
+		}
+		return g.binary(op.op, op.prec, a, b, "bool")
+	case EQL, LEQL, NOT_EQ, LNEQ:
+		if isGoNumber(a) && isGoNumber(b) {
+			a, b, _ = numbers(a, b)
+		} else if a.typ != b.typ || strings.HasPrefix(a.typ, "[]") {
+			return g.fail(e)
+		}
+		return g.binary(op.op, op.prec, a, b, "bool")
+	case LSS, LEQ, GTR, GEQ:
+		if !isGoNumber(a) || !isGoNumber(b) {
+			return g.fail(e)
+		}
+		a, b, _ = numbers(a, b)
+		return g.binary(op.op, op.prec, a, b, "bool")
+	case ADD:
+		if a.typ == "string" && b.typ == "string" {
+			return g.binary(op.op, op.prec, a, b, "string")
+		}
+	}
+	if !isGoNumber(a) || !isGoNumber(b) {
+		return g.fail(e)
+	}
+	a, b, typ := numbers(a, b)
+	if b.konst && (e.Op == QUO || e.Op == REM && typ != "float64") && g.isZero(e.Right) {
+		// Go does not compile a division by a constant zero
+		return g.fail(e)
+	}
+	if e.Op == REM && typ == "float64" {
+		g.imports["math"] = struct{}{}
+		return goVal{code: "math.Mod(" + a.code + ", " + b.code + ")", prec: goAtom, typ: typ}
+	}
+	return g.binary(op.op, op.prec, a, b, typ)
+}
+
+// isZero reports whether the constant expression is zero.
+func (g *goWriter) isZero(expr Expr) bool {
+	o := &optimizer{trigger: g.trigger, inlined: make(map[string]struct{})}
+	v, _, ok := baseValue(unparen(o.expr(clone(expr))))
+	return ok && v == 0
+}
+
+func anyOf(conds []string) goVal {
+	if len(conds) == 1 {
+		return goVal{code: conds[0], prec: goCmp, typ: "bool"}
+	}
+	return goVal{code: strings.Join(conds, " || "), prec: goOr, typ: "bool"}
+}
+
+func (g *goWriter) in(e *BinaryExpr) goVal {
+	left, right := e.Left, g.resolve(e.Right)
+	if e.Op == INTERSECTS || e.Op == NOT_INTERSECTS {
+		if _, ok := right.(*Selector); ok {
+			left, right = e.Right, g.resolve(e.Left)
+		}
+	}
+	x := g.node(left)
+	if x.typ == "" {
+		return x
+	}
+	var v goVal
+	switch typ := right.(type) {
+	case *Selector:
+		// "urgent" in tracker_tags
+		list := g.node(typ)
+		if list.typ != "[]"+x.typ && !(x.konst && list.typ == "[]float64" && x.typ == "int") {
+			return g.fail(e)
+		}
+		v = goVal{code: g.helper("Contains") + "(" + list.code + ", " + x.code + ")", prec: goAtom, typ: "bool"}
+	case *Range:
+		cond, ok := g.between(x, typ)
+		if !ok {
+			return g.fail(e)
+		}
+		v = goVal{code: cond, prec: goAnd, typ: "bool"}
+	case *ArrayTyp:
+		if typ.Kind == GEOHASH || typ.Kind == H3 || typ.Kind == S2 {
+			return g.geoIn(e, x, right)
+		}
+		conds := make([]string, 0, len(typ.List))
+		for _, item := range typ.List {
+			if r, ok := g.resolve(item).(*Range); ok {
+				cond, ok := g.between(x, r)
+				if !ok {
+					return g.fail(e)
+				}
+				if len(typ.List) > 1 {
+					cond = "(" + cond + ")"
+				}
+				conds = append(conds, cond)
+				continue
+			}
+			y := g.node(item)
+			if isGoNumber(x) && isGoNumber(y) {
+				a, b, _ := numbers(x, y)
+				conds = append(conds, operand(a, goCmp+1)+" == "+operand(b, goCmp+1))
+			} else if x.typ == y.typ {
+				conds = append(conds, operand(x, goCmp+1)+" == "+operand(y, goCmp+1))
+			} else {
+				return g.fail(e)
+			}
+		}
+		v = anyOf(conds)
+	default:
+		return g.geoIn(e, x, right)
+	}
+	if e.Op == NOT_IN || e.Op == NOT_INTERSECTS {
+		return goVal{code: "!" + operand(v, goAtom), prec: goAtom, typ: "bool"}
+	}
+	return v
+}
+
+func (g *goWriter) between(x goVal, r *Range) (string, bool) {
+	low, high := g.node(r.Low), g.node(r.High)
+	if !isGoNumber(x) || !isGoNumber(low) || !isGoNumber(high) {
+		return "", false
+	}
+	a, low, _ := numbers(x, low)
+	b, high, _ := numbers(x, high)
+	return operand(a, goCmp+1) + " >= " + operand(low, goCmp+1) + " && " +
+		operand(b, goCmp+1) + " <= " + operand(high, goCmp+1), true
+}
+
+func (g *goWriter) geoIn(e *BinaryExpr, x goVal, geometry Expr) goVal {
+	if x.typ != "[2]float64" {
+		return g.fail(e)
+	}
+	conds, ok := g.geo(x.code, geometry)
+	if !ok {
+		return g.fail(e)
+	}
+	v := anyOf(conds)
+	if e.Op == NOT_IN || e.Op == NOT_INTERSECTS {
+		return goVal{code: "!" + operand(v, goAtom), prec: goAtom, typ: "bool"}
+	}
+	return v
+}
+
+// geo returns the conditions of the position being in the parts of the geometry.
+func (g *goWriter) geo(p string, expr Expr) ([]string, bool) {
+	switch typ := g.resolve(expr).(type) {
+	case *GeometryPointTyp:
+		point := g.geom("[2]float64", goPoint(typ.Val))
+		if typ.Radius == nil {
+			return []string{p + " == " + point}, true
+		}
+		r, _, _ := baseValue(typ.Radius)
+		return []string{g.helper("Distance", "math") + "(" + p + ", " + point + ") <= " + goFloat(r)}, true
+	case *GeometryLineTyp:
+		var m float64
+		if typ.Margin != nil {
+			m, _, _ = baseValue(typ.Margin)
+		}
+		line := g.geom("[][2]float64", goPoints(typ.Val))
+		return []string{g.helper("LineDistance", "math") + "(" + p + ", " + line + ") <= " + goFloat(m)}, true
+	case *GeometryPolygonTyp:
+		rings := make([]string, len(typ.Val))
+		for i, ring := range typ.Val {
+			rings[i] = goPoints(ring)
+		}
+		polygon := g.geom("[][][2]float64", "{"+strings.Join(rings, ", ")+"}")
+		return []string{g.helper("InPolygon") + "(" + p + ", " + polygon + ")"}, true
+	case *GeometryMultiObjectTyp:
+		return g.geoList(p, typ.Val)
+	case *GeometryCollectionTyp:
+		return g.geoList(p, typ.Objects)
+	case *CellTyp:
+		if typ.Kind != GEOHASH {
+			return nil, false
+		}
+		b := geohashBox(typ.Val)
+		box := g.geom("[4]float64", "{"+goFloat(b.MinLon)+", "+goFloat(b.MinLat)+", "+
+			goFloat(b.MaxLon)+", "+goFloat(b.MaxLat)+"}")
+		return []string{g.helper("InBox") + "(" + p + ", " + box + ")"}, true
+	case *ArrayTyp:
+		if typ.Kind != GEOHASH {
+			return nil, false
+		}
+		return g.geoList(p, typ.List)
+	}
+	return nil, false
+}
+
+func (g *goWriter) geoList(p string, list []Expr) ([]string, bool) {
+	var conds []string
+	for _, item := range list {
+		c, ok := g.geo(p, item)
+		if !ok {
+			return nil, false
+		}
+		conds = append(conds, c...)
+	}
+	return conds, len(conds) > 0
+}
+
+var goTimeParts = map[string]string{
+	"hour": "Hour()", "minute": "Minute()", "day": "Day()", "year": "Year()",
+	"weekday": "Weekday()", "month": "Month()",
+}
+
+func (g *goWriter) call(e *CallExpr) goVal {
+	args := make([]goVal, len(e.Args))
+	for i, arg := range e.Args {
+		if args[i] = g.node(arg); args[i].typ == "" {
+			return args[i]
+		}
+	}
+	switch e.Func {
+	case "abs", "sqrt", "pow", "round", "floor", "ceil":
+		list := make([]string, len(args))
+		for i, arg := range args {
+			if !isGoNumber(arg) {
+				return g.fail(e)
+			}
+			list[i] = toFloat64(arg).code
+		}
+		g.imports["math"] = struct{}{}
+		name := strings.ToUpper(e.Func[:1]) + e.Func[1:]
+		code := "math." + name + "(" + strings.Join(list, ", ") + ")"
+		if e.Func == "round" || e.Func == "floor" || e.Func == "ceil" {
+			return goVal{code: "int(" + code + ")", prec: goAtom, typ: "int"}
+		}
+		return goVal{code: code, prec: goAtom, typ: "float64"}
+	case "hour", "minute", "day", "weekday", "month", "year":
+		if !isGoNumber(args[0]) {
+			return g.fail(e)
+		}
+		g.imports["time"] = struct{}{}
+		code := "time.Unix(int64(" + args[0].code + "), 0).UTC()." + goTimeParts[e.Func]
+		if e.Func == "weekday" || e.Func == "month" {
+			code = "int(" + code + ")"
+		}
+		return goVal{code: code, prec: goAtom, typ: "int"}
+	case "len":
+		if args[0].typ != "string" && !strings.HasPrefix(args[0].typ, "[]") {
+			return g.fail(e)
+		}
+		return goVal{code: "len(" + args[0].code + ")", prec: goAtom, typ: "int"}
+	case "distance":
+		if args[0].typ != "[2]float64" || args[1].typ != "[2]float64" {
+			return g.fail(e)
+		}
+		return goVal{code: g.helper("Distance", "math") + "(" + args[0].code + ", " + args[1].code + ")",
+			prec: goAtom, typ: "float64"}
+	}
+	return g.fail(e)
+}
+
+// goHelpers are the helper functions of the generated code,
+// $ is replaced with the prefix of the package-level names.
+var goHelpers = map[string]string{
+	"Contains": `func $Contains[T comparable](list []T, v T) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+`,
+	"Distance": `// $Distance returns the great-circle distance between two [lon, lat] points in meters.
+func $Distance(a, b [2]float64) float64 {
+	const r = 6371008.8
+	lat1, lat2 := a[1]*math.Pi/180, b[1]*math.Pi/180
+	dlat, dlon := lat2-lat1, (b[0]-a[0])*math.Pi/180
+	h := math.Sin(dlat/2)*math.Sin(dlat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dlon/2)*math.Sin(dlon/2)
+	return 2 * r * math.Asin(math.Sqrt(h))
+}
+`,
+	"LineDistance": `// $LineDistance returns the distance between the point and the line in meters.
+func $LineDistance(p [2]float64, line [][2]float64) float64 {
+	kx := math.Cos(p[1] * math.Pi / 180)
+	min := math.Inf(1)
+	for i := 0; i+1 < len(line); i++ {
+		ax, ay := (line[i][0]-p[0])*kx, line[i][1]-p[1]
+		dx, dy := (line[i+1][0]-p[0])*kx-ax, line[i+1][1]-p[1]-ay
+		t := 0.0
+		if l := dx*dx + dy*dy; l > 0 {
+			t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l))
+		}
+		min = math.Min(min, math.Hypot(ax+t*dx, ay+t*dy))
+	}
+	return min * ` + strconv.Itoa(metersPerDegree) + `
+}
+`,
+	"InPolygon": `// $InPolygon reports whether the point is inside the outer ring and outside the holes.
+func $InPolygon(p [2]float64, rings [][][2]float64) bool {
+	in := false
+	for _, ring := range rings {
+		for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+			a, b := ring[i], ring[j]
+			if (a[1] > p[1]) != (b[1] > p[1]) && p[0] < (b[0]-a[0])*(p[1]-a[1])/(b[1]-a[1])+a[0] {
+				in = !in
+			}
+		}
+	}
+	return in
+}
+`,
+	"InBox": `// $InBox reports whether the point is inside the [min lon, min lat, max lon, max lat] box.
+func $InBox(p [2]float64, box [4]float64) bool {
+	return p[0] >= box[0] && p[1] >= box[1] && p[0] <= box[2] && p[1] <= box[3]
+}
+`,
+}
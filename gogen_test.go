@@ -0,0 +1,135 @@
+package geoqlparser
+
+import (
+	"bytes"
+	"errors"
+	"go/ast"
+	"go/importer"
+	goparser "go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func goDict() Dictionary {
+	dict := Dict()
+	dict["tracker_speed"] = Float
+	dict["tracker_count"] = Int
+	dict["tracker_model"] = String
+	dict["tracker_on"] = Boolean
+	dict["tracker_tags"] = ArrayString
+	dict["tracker_time"] = Int
+	dict["tracker_coords"] = Geometry
+	return dict
+}
+
+func TestGenerateGo(t *testing.T) {
+	stmt, err := Parse(`trigger set depot=point[13.4, 52.5]:500M; when tracker_speed > 50Mph and tracker_coords in @depot`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.NewBuffer(nil)
+	if err = GenerateGo(buf, stmt.(*Trigger), goDict(), GoOptions{Package: "fleet", Func: "Speeding"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "// Code generated by geoqlgen. DO NOT EDIT.\n\n" +
+		"package fleet\n\n" +
+		"import \"math\"\n\n" +
+		"// SpeedingInput holds the selectors of Speeding.\n" +
+		"type SpeedingInput struct {\n" +
+		"\tTrackerCoords [2]float64 `json:\"tracker_coords\"`\n" +
+		"\tTrackerSpeed  float64    `json:\"tracker_speed\"`\n" +
+		"}\n\n" +
+		"var speedingGeom0 = [2]float64{13.4, 52.5}\n\n" +
+		"// Speeding reports whether the input satisfies the condition.\n" +
+		"//\n" +
+		"//\twhen tracker_speed > 50Mph\n" +
+		"//\tand tracker_coords in @depot\n" +
+		"func Speeding(in *SpeedingInput) bool {\n" +
+		"\treturn in.TrackerSpeed > 80.4672 && speedingDistance(in.TrackerCoords, speedingGeom0) <= 500\n" +
+		"}\n"
+	if have := buf.String(); !strings.HasPrefix(have, want) {
+		t.Fatalf("have\n%s\nwant prefix\n%s", have, want)
+	}
+}
+
+func TestGenerateGoCompiles(t *testing.T) {
+	testCases := []string{
+		`when tracker_speed > 50Mph and tracker_count * 2 > 3.5 and (tracker_model in ["A", "B"] or "x" in tracker_tags)`,
+		`when tracker_coords intersects polygon[[[1, 1], [2, 1], [2, 2], [1, 1]]] and not tracker_on xor tracker_count mod 2 == 1`,
+		`when tracker_coords in geohash[u4pr] and hour(tracker_time) in 9 .. 17 and distance(tracker_coords, point[1, 2]) < 2Km`,
+		`when tracker_coords in multipoint[point[1, 1]:1Km, point[3, 3]] or tracker_coords not in line[[1, 1], [2, 2]]:10M`,
+		`when abs(tracker_speed - tracker_count) > 1 and tracker_count in [1, 5, 7] and round(tracker_speed) mod 2 == 0`,
+		`when tracker_speed mod 2.5 > 1 or len(tracker_tags) > 2 or tracker_model + "x" == "Ax" or true`,
+		`trigger set n = 2; when tracker_count / @n > 1 or tracker_speed / (0.5 - 1) > 1 or tracker_speed mod 0 > 1`,
+	}
+	fset := token.NewFileSet()
+	imp := importer.ForCompiler(fset, "source", nil)
+	for i, s := range testCases {
+		stmt, err := Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := GoOptions{Func: "Rule" + string(rune('A'+i))}
+		src, test := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+		if err = GenerateGo(src, stmt.(*Trigger), goDict(), opts); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		if err = GenerateGoTest(test, stmt.(*Trigger), goDict(), opts); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		files := make([]*ast.File, 2)
+		for j, buf := range []*bytes.Buffer{src, test} {
+			if files[j], err = goparser.ParseFile(fset, "", buf.Bytes(), 0); err != nil {
+				t.Fatalf("%s: %v", s, err)
+			}
+		}
+		conf := types.Config{Importer: imp}
+		if _, err = conf.Check("rules", fset, files, nil); err != nil {
+			t.Fatalf("%s: %v\n%s", s, err, src)
+		}
+	}
+}
+
+func TestGenerateGoErrors(t *testing.T) {
+	testCases := []struct {
+		s    string
+		want []string
+	}{
+		{s: `when avg(tracker_speed, 5m) > 1 or tracker_speed > 1 for 1m`, want: []string{"avg(tracker_speed, 5m0s)", "tracker_speed > 1 for 1m0s"}},
+		{s: `when tracker_coords enters point[1, 1] and tracker_coords in s2[89c25]`, want: []string{"tracker_coords enters point[1, 1]", "tracker_coords in s2[89c25]"}},
+		{s: `when tracker_speed{"a", "b"} > 1 or tracker_coords nearby point[1, 1]`, want: []string{`tracker_speed{"a", "b"}`, "tracker_coords nearby point[1, 1]"}},
+		{s: `trigger set n = 0; when tracker_count / 0 > 1 or tracker_speed / (1 - 1.0) > 1 or tracker_count mod @n == 1 or tracker_count / (1 / 2) > 1`,
+			want: []string{"tracker_count/0", "tracker_speed/(1-1.0)", "tracker_count rem @n", "tracker_count/(1/2)"}},
+	}
+	for _, tc := range testCases {
+		stmt, err := Parse(tc.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = GenerateGo(bytes.NewBuffer(nil), stmt.(*Trigger), goDict(), GoOptions{})
+		var terr *TranslateError
+		if !errors.As(err, &terr) {
+			t.Fatalf("%s: have %v, want *TranslateError", tc.s, err)
+		}
+		have := make([]string, len(terr.Exprs))
+		for i, expr := range terr.Exprs {
+			have[i] = formatExpr(expr)
+		}
+		if !reflect.DeepEqual(have, tc.want) {
+			t.Fatalf("%s: have %q, want %q", tc.s, have, tc.want)
+		}
+	}
+	stmt, _ := Parse(`when tracker_unknown > 1`)
+	if err := GenerateGo(bytes.NewBuffer(nil), stmt.(*Trigger), goDict(), GoOptions{}); err == nil {
+		t.Fatal("have nil, want type error")
+	}
+	stmt, _ = Parse(`when tracker_speed > 1`)
+	for _, opts := range []GoOptions{{Func: "match"}, {Package: "my-rules"}} {
+		if err := GenerateGo(bytes.NewBuffer(nil), stmt.(*Trigger), goDict(), opts); err == nil {
+			t.Fatalf("%+v: have nil, want error", opts)
+		}
+	}
+}
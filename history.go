@@ -0,0 +1,354 @@
+package geoqlparser
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var historyFuncs = map[string]int{
+	"prev":    1,
+	"changed": 1,
+	"delta":   1,
+	"rising":  3,
+	"falling": 3,
+}
+
+func isHistoryFunc(name string) bool {
+	_, ok := historyFuncs[name]
+	return ok
+}
+
+func (s *parser) historyExpr(call *CallExpr) (Expr, error) {
+	if n := historyFuncs[call.Func]; len(call.Args) != n {
+		s.err = fmt.Errorf("invalid %s: got %d arguments, expected %d", call.Func, len(call.Args), n)
+		return nil, s.error()
+	}
+	selector, ok := call.Args[0].(*Selector)
+	if !ok {
+		s.err = fmt.Errorf("invalid %s: got %s, expected selector", call.Func, formatExpr(call.Args[0]))
+		return nil, s.error()
+	}
+	expr := &HistoryExpr{Func: call.Func, X: selector, lpos: call.lpos, rpos: call.rpos}
+	if len(call.Args) == 3 {
+		within, ok := call.Args[2].(*DurationTyp)
+		if !ok || within.Val <= 0 {
+			s.err = fmt.Errorf("invalid %s: got %s, expected positive duration",
+				call.Func, formatExpr(call.Args[2]))
+			return nil, s.error()
+		}
+		expr.Amount, expr.Within = call.Args[1], within
+	}
+	return expr, nil
+}
+
+func (tc *checker) evalHistory(e *HistoryExpr) (Expr, error) {
+	typ, err := tc.getSelectorType(e.X.Ident)
+	if err != nil {
+		return nil, err
+	}
+	if err = tc.checkProps(e.X); err != nil {
+		return nil, err
+	}
+	switch e.Func {
+	case "prev":
+		return typ, nil
+	case "changed":
+		return opBoolean, nil
+	}
+	if !tc.isNumber(e.X) {
+		return nil, fmt.Errorf("invalid %s: %s is not a number", formatExpr(e), formatExpr(e.X))
+	}
+	if e.Func == "delta" {
+		if tc.isInt(e.X) {
+			return opInt, nil
+		}
+		return opFloat, nil
+	}
+	amount, err := tc.walk(e.Amount)
+	if err != nil {
+		return nil, err
+	}
+	if !tc.isNumber(amount) {
+		return nil, fmt.Errorf("invalid %s: %s is not an amount of change", formatExpr(e), formatExpr(e.Amount))
+	}
+	if err = tc.checkAmount(e, e.Amount); err != nil {
+		return nil, err
+	}
+	return opBoolean, nil
+}
+
+// checkDelta checks the amount delta is compared with, e.g. 5C of delta(tracker_temp) > 5C.
+func (tc *checker) checkDelta(e *BinaryExpr) error {
+	delta, amount := unparen(e.Left), e.Right
+	if !isDelta(delta) {
+		delta, amount = unparen(e.Right), e.Left
+	}
+	if h, ok := delta.(*HistoryExpr); ok && isDelta(h) {
+		return tc.checkAmount(h, amount)
+	}
+	return nil
+}
+
+// checkAmount checks that an amount of change of the selector of the history
+// expression is a number, a percent or of the measure the selector is declared with.
+func (tc *checker) checkAmount(e *HistoryExpr, amount Expr) error {
+	decl, ok := tc.dict[e.X.Ident].(SelectorDecl)
+	if !ok || decl.Measure == 0 {
+		return nil
+	}
+	expr := unparen(amount)
+	if ref, isRef := expr.(*Ref); isRef {
+		assign, err := tc.trigger.findAssign(ref.ID)
+		if err != nil {
+			return err
+		}
+		expr = assign.Right
+	}
+	_, dim, ok := baseValue(expr)
+	if !ok || dim == dimNumber || dim == dimPercent || dim == decl.Measure.dimension() {
+		return nil
+	}
+	return fmt.Errorf("invalid %s: %s is not %s", formatExpr(e), formatExpr(amount), decl.Measure)
+}
+
+// deltaValue returns the amount of a change in the base unit of its dimension.
+// Unlike baseValue it converts temperature differences without the offset, 9F is 5C.
+func deltaValue(expr Expr) (float64, dimension, bool) {
+	if t, ok := expr.(*TemperatureTyp); ok {
+		val := t.Val
+		if t.Vec == Minus {
+			val = -val
+		}
+		if t.U == Fahrenheit {
+			val = val * 5 / 9
+		}
+		return val, dimTemperature, true
+	}
+	return baseValue(expr)
+}
+
+// canonicalDelta converts an amount of change to the base unit.
+func canonicalDelta(expr Expr) Expr {
+	t, ok := expr.(*TemperatureTyp)
+	if !ok {
+		return canonical(expr)
+	}
+	val, _, _ := deltaValue(t)
+	val = roundFloat(val)
+	t.U, t.Val, t.Vec = Celsius, math.Abs(val), 0
+	if val < 0 {
+		t.Vec = Minus
+	}
+	return t
+}
+
+func isDelta(expr Expr) bool {
+	e, ok := expr.(*HistoryExpr)
+	return ok && e.Func == "delta"
+}
+
+// HistorySample is a value of a selector recorded at a time.
+type HistorySample struct {
+	At  time.Time
+	Val interface{}
+}
+
+// HistoryStore provides the previous samples of the selectors of a device
+// to EvalHistory. Samples of the current evaluation must not be visible yet.
+type HistoryStore interface {
+	// Last returns the last sample of the selector of the device.
+	Last(device, selector string) (HistorySample, bool)
+	// Since returns the samples of the selector of the device recorded
+	// after the time, the oldest first.
+	Since(device, selector string, since time.Time) []HistorySample
+}
+
+// EvalHistory evaluates the expression for the device given the current value of its selector:
+//   - prev returns the previous value, or nil if there is none;
+//   - changed reports whether the value differs from the previous one;
+//   - delta returns the difference to the previous value, or nil if there is none,
+//     see EvalDelta to compare it with a percent;
+//   - rising and falling report whether the value has grown or dropped by at least
+//     the amount since the lowest or highest value within the period.
+//
+// Numbers must be float64 or int in the base unit of the amount: Kph, M, C and Bar.
+// A percent amount is relative to the lowest or highest value.
+func EvalHistory(store HistoryStore, device string, e *HistoryExpr, now time.Time, cur interface{}) (interface{}, error) {
+	selector := e.X.Ident
+	switch e.Func {
+	case "prev", "changed", "delta":
+		last, ok := store.Last(device, selector)
+		switch {
+		case e.Func == "prev":
+			if !ok {
+				return nil, nil
+			}
+			return last.Val, nil
+		case e.Func == "changed":
+			return ok && !sameValue(last.Val, cur), nil
+		case !ok:
+			return nil, nil
+		}
+		a, aok := toFloat(cur)
+		b, bok := toFloat(last.Val)
+		if !aok || !bok {
+			return nil, fmt.Errorf("geoql: %s: values %v and %v are not numbers", formatExpr(e), cur, last.Val)
+		}
+		return a - b, nil
+	}
+	val, ok := toFloat(cur)
+	if !ok {
+		return nil, fmt.Errorf("geoql: %s: value %v is not a number", formatExpr(e), cur)
+	}
+	amount, dim, ok := deltaValue(e.Amount)
+	if !ok {
+		return nil, fmt.Errorf("geoql: %s: invalid amount %s", formatExpr(e), formatExpr(e.Amount))
+	}
+	ref := val
+	for _, smp := range store.Since(device, selector, now.Add(-e.Within.Val)) {
+		v, ok := toFloat(smp.Val)
+		if !ok {
+			continue
+		}
+		if e.Func == "rising" {
+			ref = math.Min(ref, v)
+		} else {
+			ref = math.Max(ref, v)
+		}
+	}
+	change := val - ref
+	if e.Func == "falling" {
+		change = -change
+	}
+	if dim == dimPercent {
+		if ref == 0 {
+			return false, nil
+		}
+		change = change / math.Abs(ref) * 100
+	}
+	return change > 0 && change >= amount, nil
+}
+
+// EvalDelta evaluates a comparison of delta with an amount, e.g. delta(tracker_fuel) < -10%.
+// A percent amount is compared with the change relative to the previous value,
+// other amounts with the difference as EvalHistory returns it. The comparison
+// is false if there is no previous value, or if it is zero and the amount is a percent.
+func EvalDelta(store HistoryStore, device string, e *BinaryExpr, now time.Time, cur interface{}) (bool, error) {
+	op, delta, amount := e.Op, unparen(e.Left), unparen(e.Right)
+	if !isDelta(delta) {
+		op, _ = flipComparison(op)
+		delta, amount = amount, delta
+	}
+	h, ok := delta.(*HistoryExpr)
+	if !ok || !isDelta(h) {
+		return false, fmt.Errorf("geoql: %s is not a comparison of delta", formatExpr(e))
+	}
+	want, dim, ok := deltaValue(amount)
+	if !ok {
+		return false, fmt.Errorf("geoql: %s: invalid amount %s", formatExpr(e), formatExpr(amount))
+	}
+	val, err := EvalHistory(store, device, h, now, cur)
+	if err != nil || val == nil {
+		return false, err
+	}
+	change := val.(float64)
+	if dim == dimPercent {
+		last, _ := store.Last(device, h.X.Ident)
+		ref, _ := toFloat(last.Val)
+		if ref == 0 {
+			return false, nil
+		}
+		change = change / math.Abs(ref) * 100
+	}
+	result, isCompare := compare(op, change, want)
+	if !isCompare {
+		return false, fmt.Errorf("geoql: %s is not a comparison of delta", formatExpr(e))
+	}
+	return result, nil
+}
+
+func sameValue(a, b interface{}) bool {
+	x, xok := toFloat(a)
+	y, yok := toFloat(b)
+	if xok && yok {
+		return x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// MemoryHistory is a HistoryStore that keeps the last samples
+// of each selector per device in memory. It is safe for concurrent use.
+type MemoryHistory struct {
+	mu      sync.RWMutex
+	size    int
+	samples map[[2]string][]HistorySample
+}
+
+// NewMemoryHistory creates a store that keeps at most size samples per device and selector.
+func NewMemoryHistory(size int) *MemoryHistory {
+	if size <= 0 {
+		size = DefaultWindowSize
+	}
+	return &MemoryHistory{size: size, samples: make(map[[2]string][]HistorySample)}
+}
+
+// Record adds the sample of the selector of the device.
+// Samples older than the last recorded one are ignored.
+func (h *MemoryHistory) Record(device, selector string, at time.Time, val interface{}) {
+	key := [2]string{device, selector}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	list := h.samples[key]
+	if n := len(list); n > 0 && at.Before(list[n-1].At) {
+		return
+	}
+	if len(list) == h.size {
+		list = append(list[:0], list[1:]...)
+	}
+	h.samples[key] = append(list, HistorySample{At: at, Val: val})
+}
+
+func (h *MemoryHistory) Last(device, selector string) (HistorySample, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	list := h.samples[[2]string{device, selector}]
+	if len(list) == 0 {
+		return HistorySample{}, false
+	}
+	return list[len(list)-1], true
+}
+
+func (h *MemoryHistory) Since(device, selector string, since time.Time) []HistorySample {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	list := h.samples[[2]string{device, selector}]
+	i := len(list)
+	for i > 0 && list[i-1].At.After(since) {
+		i--
+	}
+	return append([]HistorySample(nil), list[i:]...)
+}
+
+// Forget drops the samples of the device.
+func (h *MemoryHistory) Forget(device string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key := range h.samples {
+		if key[0] == device {
+			delete(h.samples, key)
+		}
+	}
+}
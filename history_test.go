@@ -0,0 +1,223 @@
+package geoqlparser
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestParseHistory(t *testing.T) {
+	testCases := []struct {
+		name string
+		s    string
+		want string
+		err  bool
+	}{
+		{
+			name: "changed",
+			s:    `when changed(tracker_status)`,
+			want: `changed(tracker_status)`,
+		},
+		{
+			name: "delta with negative percent",
+			s:    `when delta(tracker_fuel) < -10%`,
+			want: `<(delta(tracker_fuel), -10%)`,
+		},
+		{
+			name: "prev",
+			s:    `when prev(tracker_speed) < 5Kph and tracker_speed > 50Kph`,
+			want: `and(<(prev(tracker_speed), 5Kph), >(tracker_speed, 50Kph))`,
+		},
+		{
+			name: "rising and falling",
+			s:    `when rising(tracker_temperature, 2C, 5m) or falling(tracker_pressure, 0.5Bar, 1h)`,
+			want: `or(rising(tracker_temperature, 2C, 5m0s), falling(tracker_pressure, 0.5Bar, 1h0m0s))`,
+		},
+		{
+			name: "not a selector",
+			s:    `when delta(1) > 1`,
+			err:  true,
+		},
+		{
+			name: "arguments",
+			s:    `when rising(tracker_temperature, 2C) > 1`,
+			err:  true,
+		},
+		{
+			name: "period",
+			s:    `when falling(tracker_temperature, 2C, 5) > 1`,
+			err:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := Parse(tc.s)
+			if tc.err {
+				if err == nil {
+					t.Fatal("have nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := sexpr(stmt.(*Trigger).When); have != tc.want {
+				t.Fatalf("have %s, want %s", have, tc.want)
+			}
+			buf := bytes.NewBuffer(nil)
+			if err = Format(buf, stmt); err != nil {
+				t.Fatal(err)
+			}
+			again, err := Parse(buf.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := sexpr(again.(*Trigger).When); have != tc.want {
+				t.Fatalf("have %s, want %s after format", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckHistory(t *testing.T) {
+	dict := Dict()
+	dict["s_int"] = Int
+	dict["s_float"] = Float
+	dict["s_string"] = String
+	dict["s_temp"] = SelectorDecl{Type: Float, Measure: PropTemperature}
+	for s, isErr := range map[string]bool{
+		`when changed(s_string) and prev(s_string) == "on"`:        false,
+		`when delta(s_temp) > 5C or 10% < delta(s_temp)`:           false,
+		`when delta(s_temp) > 5 and rising(s_temp, 9F, 5m)`:        false,
+		`when delta(s_temp) > 5Kph`:                                true,
+		`when (1bar) > delta(s_temp)`:                              true,
+		`trigger set d=5Km; when delta(s_temp) > @d`:               true,
+		`when falling(s_temp, 5Kph, 5m)`:                           true,
+		`when delta(s_float) < -10% and delta(s_int) > 2C`:         false,
+		`when rising(s_float, 2C, 5m) or falling(s_int, 10, 1h)`:   false,
+		`trigger set limit=5Kph; when rising(s_float, @limit, 5m)`: false,
+		`when prev(s_string) > 1`:                                  true,
+		`when delta(s_string) > 1`:                                 true,
+		`when rising(s_string, 1, 5m)`:                             true,
+		`when rising(s_float, "a", 5m)`:                            true,
+		`when changed(s_unknown)`:                                  true,
+		`when rising(s_float, 1, 5m) > 1`:                          true,
+	} {
+		stmt, err := Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = CheckType(stmt, dict); (err != nil) != isErr {
+			t.Fatalf("%s: have %v, want error %v", s, err, isErr)
+		}
+	}
+}
+
+func TestCanonicalizeDelta(t *testing.T) {
+	stmt, err := Parse(`when delta(tracker_temp) > 9F and rising(tracker_temp, 18F, 5m) and tracker_temp > 41F`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trigger := stmt.(*Trigger)
+	Canonicalize(trigger)
+	want := `delta(tracker_temp) > 5C and rising(tracker_temp, 10C, 5m0s) and tracker_temp > 5C`
+	if have := oneLine(formatExpr(trigger.When)); have != want {
+		t.Fatalf("have %s, want %s", have, want)
+	}
+}
+
+func TestEvalHistory(t *testing.T) {
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryHistory(3)
+	for i, v := range []float64{100, 50, 20, 22, 25} {
+		store.Record("dev", "tracker_temp", start.Add(time.Duration(i)*time.Minute), v)
+	}
+	store.Record("dev", "tracker_status", start, "off")
+	now := start.Add(5 * time.Minute)
+
+	testCases := []struct {
+		s    string
+		cur  interface{}
+		want interface{}
+	}{
+		{s: "prev(tracker_temp)", cur: 30.0, want: 25.0},
+		{s: "delta(tracker_temp)", cur: 30, want: 5.0},
+		{s: "delta(tracker_other)", cur: 30, want: nil},
+		{s: "changed(tracker_status)", cur: "on", want: true},
+		{s: "changed(tracker_status)", cur: "off", want: false},
+		{s: "changed(tracker_other)", cur: "off", want: false},
+		{s: "rising(tracker_temp, 10C, 5m)", cur: 30.0, want: true},
+		{s: "rising(tracker_temp, 18F, 5m)", cur: 29.0, want: false},
+		{s: "rising(tracker_temp, 50%, 5m)", cur: 30.0, want: true},
+		{s: "rising(tracker_temp, 10C, 1m)", cur: 30.0, want: false},
+		{s: "falling(tracker_temp, 2C, 5m)", cur: 20.0, want: true},
+		{s: "falling(tracker_temp, 2C, 5m)", cur: 30.0, want: false},
+	}
+	for _, tc := range testCases {
+		stmt, err := Parse("when " + tc.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := EvalHistory(store, "dev", stmt.(*Trigger).When.(*HistoryExpr), now, tc.cur)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have != tc.want {
+			t.Fatalf("%s: have %v, want %v", tc.s, have, tc.want)
+		}
+	}
+
+	if samples := store.Since("dev", "tracker_temp", start); len(samples) != 3 {
+		t.Fatalf("have %d, want 3 samples", len(samples))
+	}
+	store.Forget("dev")
+	if _, ok := store.Last("dev", "tracker_temp"); ok {
+		t.Fatal("have samples after forget")
+	}
+}
+
+func TestEvalDelta(t *testing.T) {
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryHistory(3)
+	store.Record("dev", "tracker_fuel", start, 200.0)
+	store.Record("dev", "tracker_empty", start, 0.0)
+	store.Record("dev", "tracker_temp", start, 20.0)
+	now := start.Add(time.Minute)
+
+	testCases := []struct {
+		s    string
+		cur  interface{}
+		want bool
+	}{
+		// the fuel dropped by 15 liters, but only by 7.5%
+		{s: "delta(tracker_fuel) < -10%", cur: 185.0, want: false},
+		{s: "delta(tracker_fuel) < -10%", cur: 170.0, want: true},
+		{s: "delta(tracker_fuel) < -10", cur: 185.0, want: true},
+		{s: "-10% > delta(tracker_fuel)", cur: 170.0, want: true},
+		{s: "delta(tracker_fuel) >= 50%", cur: 300, want: true},
+		{s: "delta(tracker_empty) > 10%", cur: 5.0, want: false},
+		{s: "delta(tracker_other) < -10%", cur: 5.0, want: false},
+		{s: "delta(tracker_temp) > 9F", cur: 26.0, want: true},
+	}
+	for _, tc := range testCases {
+		stmt, err := Parse("when " + tc.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := EvalDelta(store, "dev", stmt.(*Trigger).When.(*BinaryExpr), now, tc.cur)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have != tc.want {
+			t.Fatalf("%s with %v: have %v, want %v", tc.s, tc.cur, have, tc.want)
+		}
+	}
+
+	stmt, err := Parse("when tracker_fuel < 10%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = EvalDelta(store, "dev", stmt.(*Trigger).When.(*BinaryExpr), now, 1.0); err == nil {
+		t.Fatal("have nil, want error without delta")
+	}
+}
@@ -0,0 +1,383 @@
+package geoqlparser
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+)
+
+// DefaultIndexCellSize is the size in degrees of the grid cells of a RuleIndex.
+const DefaultIndexCellSize = 0.1
+
+// maxIndexCells limits the grid cells a bounding box is stored in,
+// larger boxes are checked one by one.
+const maxIndexCells = 1024
+
+const metersPerDegree = 111320
+
+// Box is a bounding box in degrees.
+type Box struct {
+	MinLon, MinLat float64
+	MaxLon, MaxLat float64
+}
+
+// Contains reports whether the point lies in the box.
+func (b Box) Contains(lon, lat float64) bool {
+	return lon >= b.MinLon && lon <= b.MaxLon && lat >= b.MinLat && lat <= b.MaxLat
+}
+
+func (b *Box) extend(lon, lat float64) {
+	b.MinLon, b.MaxLon = math.Min(b.MinLon, lon), math.Max(b.MaxLon, lon)
+	b.MinLat, b.MaxLat = math.Min(b.MinLat, lat), math.Max(b.MaxLat, lat)
+}
+
+// grow extends the box by the distance in meters.
+func (b Box) grow(meters float64) Box {
+	if meters <= 0 {
+		return b
+	}
+	dlat := meters / metersPerDegree
+	b.MinLat, b.MaxLat = math.Max(b.MinLat-dlat, -90), math.Min(b.MaxLat+dlat, 90)
+	cos := math.Cos(math.Max(math.Abs(b.MinLat), math.Abs(b.MaxLat)) * math.Pi / 180)
+	if cos < 1e-6 {
+		b.MinLon, b.MaxLon = -180, 180
+		return b
+	}
+	dlon := meters / (metersPerDegree * cos)
+	b.MinLon, b.MaxLon = math.Max(b.MinLon-dlon, -180), math.Min(b.MaxLon+dlon, 180)
+	return b
+}
+
+// TriggerBounds returns the bounding boxes the position of the current device must lie in
+// for the trigger to fire. It reports false if the trigger may fire at any position, e.g.
+// it has no geometries, or they are only used with not in, exits or a selector of other devices.
+// Geometries of variables are resolved, h3 and s2 cells are not bounded.
+// Of nearby, only points with a radius are bounded, e.g. tracker_coords nearby point[1, 1]:500M.
+func TriggerBounds(t *Trigger) ([]Box, bool) {
+	return exprBounds(t, t.When)
+}
+
+func exprBounds(t *Trigger, expr Expr) ([]Box, bool) {
+	switch typ := expr.(type) {
+	case *ParenExpr:
+		return exprBounds(t, typ.Expr)
+	case *BinaryExpr:
+		switch typ.Op {
+		case AND:
+			if boxes, ok := exprBounds(t, typ.Left); ok {
+				return boxes, true
+			}
+			return exprBounds(t, typ.Right)
+		case OR:
+			left, lok := exprBounds(t, typ.Left)
+			right, rok := exprBounds(t, typ.Right)
+			return append(left, right...), lok && rok
+		case FOR:
+			return exprBounds(t, typ.Left)
+		case IN, INTERSECTS, NEARBY, ENTERS, DWELLS:
+			left, right := unparen(typ.Left), unparen(typ.Right)
+			if _, ok := right.(*Selector); ok && (typ.Op == INTERSECTS || typ.Op == NEARBY) {
+				left, right = right, left
+			}
+			selector, ok := left.(*Selector)
+			if !ok || selector.multi() {
+				return nil, false
+			}
+			if typ.Op == NEARBY && !hasRadius(t, right) {
+				return nil, false
+			}
+			var margin float64
+			if radius, ok := selector.PropValues(t, PropDistance); ok {
+				for _, r := range radius {
+					margin = math.Max(margin, r)
+				}
+			}
+			boxes, ok := geometryBounds(t, right)
+			for i := range boxes {
+				boxes[i] = boxes[i].grow(margin)
+			}
+			return boxes, ok
+		}
+	}
+	return nil, false
+}
+
+func geometryBounds(t *Trigger, expr Expr) ([]Box, bool) {
+	switch typ := expr.(type) {
+	case *Ref:
+		assign, err := t.findAssign(typ.ID)
+		if err != nil {
+			return nil, false
+		}
+		return geometryBounds(t, assign.Right)
+	case *GeometryPointTyp:
+		box := Box{typ.Val[0], typ.Val[1], typ.Val[0], typ.Val[1]}
+		if typ.Radius != nil {
+			r, _, _ := baseValue(typ.Radius)
+			box = box.grow(r)
+		}
+		return []Box{box}, true
+	case *GeometryLineTyp:
+		box := pointsBox(typ.Val)
+		if typ.Margin != nil {
+			m, _, _ := baseValue(typ.Margin)
+			box = box.grow(m)
+		}
+		return []Box{box}, len(typ.Val) > 0
+	case *GeometryPolygonTyp:
+		if len(typ.Val) == 0 {
+			return nil, false
+		}
+		// the first ring is the outer one
+		return []Box{pointsBox(typ.Val[0])}, len(typ.Val[0]) > 0
+	case *GeometryMultiObjectTyp:
+		return geometryListBounds(t, typ.Val)
+	case *GeometryCollectionTyp:
+		return geometryListBounds(t, typ.Objects)
+	case *ArrayTyp:
+		if typ.Kind != GEOHASH {
+			return nil, false
+		}
+		return geometryListBounds(t, typ.List)
+	case *CellTyp:
+		if typ.Kind != GEOHASH {
+			return nil, false
+		}
+		return []Box{geohashBox(typ.Val)}, true
+	case *Range:
+		low, lok := typ.Low.(*CellTyp)
+		high, hok := typ.High.(*CellTyp)
+		if !lok || !hok || low.Kind != GEOHASH {
+			return nil, false
+		}
+		// the hashes of the range share the prefix of its bounds
+		n := 0
+		for n < len(low.Val) && n < len(high.Val) && low.Val[n] == high.Val[n] {
+			n++
+		}
+		return []Box{geohashBox(low.Val[:n])}, true
+	}
+	return nil, false
+}
+
+// hasRadius reports whether the geometry is a point with a radius.
+func hasRadius(t *Trigger, expr Expr) bool {
+	if ref, ok := expr.(*Ref); ok {
+		assign, err := t.findAssign(ref.ID)
+		if err != nil {
+			return false
+		}
+		expr = assign.Right
+	}
+	point, ok := expr.(*GeometryPointTyp)
+	return ok && point.Radius != nil
+}
+
+func geometryListBounds(t *Trigger, list []Expr) ([]Box, bool) {
+	var boxes []Box
+	for _, item := range list {
+		b, ok := geometryBounds(t, item)
+		if !ok {
+			return nil, false
+		}
+		boxes = append(boxes, b...)
+	}
+	return boxes, len(boxes) > 0
+}
+
+func pointsBox(points [][2]float64) Box {
+	box := Box{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, p := range points {
+		box.extend(p[0], p[1])
+	}
+	return box
+}
+
+func geohashBox(hash string) Box {
+	box := Box{-180, -90, 180, 90}
+	even := true
+	for i := 0; i < len(hash); i++ {
+		ch := indexByte(geohashBase32, hash[i])
+		for bit := 4; bit >= 0; bit-- {
+			on := ch>>bit&1 == 1
+			if even {
+				mid := (box.MinLon + box.MaxLon) / 2
+				if on {
+					box.MinLon = mid
+				} else {
+					box.MaxLon = mid
+				}
+			} else {
+				mid := (box.MinLat + box.MaxLat) / 2
+				if on {
+					box.MinLat = mid
+				} else {
+					box.MaxLat = mid
+				}
+			}
+			even = !even
+		}
+	}
+	return box
+}
+
+func indexByte(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// RuleIndex finds the triggers that may fire for a position of a device, so that
+// a position is checked against the candidates only. It keeps the bounding boxes
+// of the triggers in a grid, triggers without bounds are candidates for every position.
+// RuleIndex is safe for concurrent use.
+type RuleIndex struct {
+	mu       sync.RWMutex
+	cellSize float64
+	rules    map[string]*indexedRule
+	grid     map[[2]int]map[string]struct{}
+	anywhere map[string]struct{} // triggers without bounds or with large boxes
+}
+
+type indexedRule struct {
+	trigger *Trigger
+	boxes   []Box
+	cells   [][2]int
+}
+
+// NewRuleIndex creates an empty index with grid cells of the size in degrees.
+func NewRuleIndex(cellSize float64) *RuleIndex {
+	if cellSize <= 0 {
+		cellSize = DefaultIndexCellSize
+	}
+	return &RuleIndex{
+		cellSize: cellSize,
+		rules:    make(map[string]*indexedRule),
+		grid:     make(map[[2]int]map[string]struct{}),
+		anywhere: make(map[string]struct{}),
+	}
+}
+
+func (x *RuleIndex) cell(lon, lat float64) [2]int {
+	return [2]int{int(math.Floor(lon / x.cellSize)), int(math.Floor(lat / x.cellSize))}
+}
+
+// Add indexes the trigger by the id, replacing a trigger with the same id.
+func (x *RuleIndex) Add(id string, t *Trigger) error {
+	if t == nil {
+		return errors.New("geoql: nil trigger")
+	}
+	rule := &indexedRule{trigger: t}
+	boxes, ok := TriggerBounds(t)
+	if ok {
+		rule.boxes = boxes
+		seen := make(map[[2]int]struct{})
+		for _, b := range boxes {
+			lo, hi := x.cell(b.MinLon, b.MinLat), x.cell(b.MaxLon, b.MaxLat)
+			if (hi[0]-lo[0]+1)*(hi[1]-lo[1]+1) > maxIndexCells {
+				rule.cells = nil
+				break
+			}
+			for i := lo[0]; i <= hi[0]; i++ {
+				for j := lo[1]; j <= hi[1]; j++ {
+					if _, ok := seen[[2]int{i, j}]; !ok {
+						seen[[2]int{i, j}] = struct{}{}
+						rule.cells = append(rule.cells, [2]int{i, j})
+					}
+				}
+			}
+		}
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(id)
+	x.rules[id] = rule
+	if rule.cells == nil {
+		x.anywhere[id] = struct{}{}
+		return nil
+	}
+	for _, c := range rule.cells {
+		ids, ok := x.grid[c]
+		if !ok {
+			ids = make(map[string]struct{})
+			x.grid[c] = ids
+		}
+		ids[id] = struct{}{}
+	}
+	return nil
+}
+
+// Remove drops the trigger with the id.
+func (x *RuleIndex) Remove(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(id)
+}
+
+func (x *RuleIndex) remove(id string) {
+	rule, ok := x.rules[id]
+	if !ok {
+		return
+	}
+	delete(x.rules, id)
+	delete(x.anywhere, id)
+	for _, c := range rule.cells {
+		delete(x.grid[c], id)
+		if len(x.grid[c]) == 0 {
+			delete(x.grid, c)
+		}
+	}
+}
+
+// Get returns the trigger with the id.
+func (x *RuleIndex) Get(id string) (*Trigger, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	rule, ok := x.rules[id]
+	if !ok {
+		return nil, false
+	}
+	return rule.trigger, true
+}
+
+// Len returns the number of indexed triggers.
+func (x *RuleIndex) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.rules)
+}
+
+// Candidates returns the sorted ids of the triggers that may fire for the position.
+func (x *RuleIndex) Candidates(lon, lat float64) []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	ids := make([]string, 0, len(x.anywhere))
+	for id := range x.anywhere {
+		if x.rules[id].contains(lon, lat) {
+			ids = append(ids, id)
+		}
+	}
+	for id := range x.grid[x.cell(lon, lat)] {
+		if x.rules[id].contains(lon, lat) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (r *indexedRule) contains(lon, lat float64) bool {
+	if r.boxes == nil {
+		return true
+	}
+	for _, b := range r.boxes {
+		if b.Contains(lon, lat) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package geoqlparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTriggerBounds(t *testing.T) {
+	testCases := []struct {
+		name string
+		s    string
+		want []Box
+		ok   bool
+	}{
+		{
+			name: "polygon",
+			s:    `when tracker_coords intersects polygon[[[1, 1], [3, 1], [3, 2], [1, 1]]]`,
+			want: []Box{{1, 1, 3, 2}},
+			ok:   true,
+		},
+		{
+			name: "variable and",
+			s:    `trigger set zone=multipoint[point[1, 1], point[2, 3]]; when tracker_speed > 10 and tracker_coords in @zone`,
+			want: []Box{{1, 1, 1, 1}, {2, 3, 2, 3}},
+			ok:   true,
+		},
+		{
+			name: "or of geometries",
+			s:    `trigger set z=point[5, 5]; when (tracker_coords enters line[[1, 1], [2, 2]]) or tracker_coords dwells in @z for 1m`,
+			want: []Box{{1, 1, 2, 2}, {5, 5, 5, 5}},
+			ok:   true,
+		},
+		{
+			name: "dwells in",
+			s:    `trigger set z=collection[point[5, 5], line[[1, 1], [2, 2]]]; when tracker_coords dwells in @z for 1m`,
+			want: []Box{{5, 5, 5, 5}, {1, 1, 2, 2}},
+			ok:   true,
+		},
+		{
+			name: "geometry on the left",
+			s:    `when point[1, 2] intersects tracker_coords`,
+			want: []Box{{1, 2, 1, 2}},
+			ok:   true,
+		},
+		{
+			name: "geohash",
+			s:    `when tracker_coords in geohash["u4pruyd" .. "u4pruyf"]`,
+			want: []Box{geohashBox("u4pruy")},
+			ok:   true,
+		},
+		{name: "or with a non spatial branch", s: `when tracker_coords in point[1, 1] or tracker_speed > 1`},
+		{name: "not in", s: `when tracker_coords not in point[1, 1]`},
+		{name: "not", s: `when not tracker_coords in point[1, 1]`},
+		{name: "exits", s: `when tracker_coords exits point[1, 1]`},
+		{name: "other device", s: `when tracker_coords{"a"} in point[1, 1]`},
+		{name: "h3", s: `when tracker_coords in h3[8928308280fffff]`},
+		{name: "unknown variable", s: `when tracker_coords in @zone`},
+		{name: "nearby without radius", s: `when tracker_coords nearby point[1, 1]`},
+		{name: "not nearby", s: `when tracker_coords not nearby point[1, 1]:1km`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := Parse(tc.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			have, ok := TriggerBounds(stmt.(*Trigger))
+			if ok != tc.ok {
+				t.Fatalf("have %v, want %v", ok, tc.ok)
+			}
+			if ok && !reflect.DeepEqual(have, tc.want) {
+				t.Fatalf("have %v, want %v", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestTriggerBoundsRadius(t *testing.T) {
+	for _, s := range []string{
+		`when tracker_coords:1km in point[0, 0]:1km`,
+		`trigger set r=1km; when tracker_coords:@r in point[0, 0]:1km`,
+		`when tracker_coords nearby point[0, 0]:2km`,
+		`trigger set p=point[0, 0]:2km; when @p nearby tracker_coords`,
+	} {
+		stmt, err := Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		boxes, ok := TriggerBounds(stmt.(*Trigger))
+		if !ok || len(boxes) != 1 {
+			t.Fatalf("%s: have %v %v, want one box", s, boxes, ok)
+		}
+		if !boxes[0].Contains(0.0179, 0) || boxes[0].Contains(0.0181, 0) {
+			t.Fatalf("%s: have %v, want box grown by 2km", s, boxes[0])
+		}
+	}
+}
+
+func TestRuleIndex(t *testing.T) {
+	index := NewRuleIndex(1)
+	add := func(id, s string) {
+		stmt, err := Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = index.Add(id, stmt.(*Trigger)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("depot", `when tracker_coords in polygon[[[10, 10], [10.5, 10], [10.5, 10.5], [10, 10]]]`)
+	add("road", `when tracker_coords intersects line[[9.5, 9.5], [12, 12]]`)
+	add("speed", `when tracker_speed > 80Kph`)
+	add("world", `when tracker_coords in polygon[[[-170, -80], [170, -80], [170, 80], [-170, -80]]]`)
+	add("far", `when tracker_coords in point[100, 50]:1km`)
+
+	testCases := []struct {
+		lon, lat float64
+		want     []string
+	}{
+		{lon: 10.2, lat: 10.2, want: []string{"depot", "road", "speed", "world"}},
+		{lon: 11.5, lat: 11.5, want: []string{"road", "speed", "world"}},
+		{lon: 100, lat: 50.005, want: []string{"far", "speed", "world"}},
+		{lon: 175, lat: 0, want: []string{"speed"}},
+	}
+	for _, tc := range testCases {
+		if have := index.Candidates(tc.lon, tc.lat); !reflect.DeepEqual(have, tc.want) {
+			t.Fatalf("%v, %v: have %v, want %v", tc.lon, tc.lat, have, tc.want)
+		}
+	}
+
+	add("depot", `when tracker_coords in point[0, 0]`)
+	index.Remove("road")
+	index.Remove("unknown")
+	if have, want := index.Candidates(10.2, 10.2), []string{"speed", "world"}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("have %v, want %v", have, want)
+	}
+	if have, want := index.Candidates(0, 0), []string{"depot", "speed", "world"}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("have %v, want %v", have, want)
+	}
+	if have := index.Len(); have != 4 {
+		t.Fatalf("have %d, want 4 triggers", have)
+	}
+	if _, ok := index.Get("road"); ok {
+		t.Fatal("have removed trigger")
+	}
+	if err := index.Add("nil", nil); err == nil {
+		t.Fatal("have nil, want error")
+	}
+}
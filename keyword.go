@@ -36,6 +36,10 @@ const (
 	GEOMETRY_MULTIPOLYGON // multipolygon
 	GEOMETRY_COLLECTION   // collection
 
+	H3      // h3[8928308280fffff]
+	GEOHASH // geohash["u4pruyd"]
+	S2      // s2[89c25]
+
 	ASSIGN    // =
 	SEMICOLON // ;
 	COLON     // :
@@ -70,6 +74,14 @@ const (
 	NOT_NEARBY     // not nearby
 	LNEQ           // !=
 	NOT_INTERSECTS // not intersects
+	NOT            // not, !
+	XOR            // xor
+	FOR            // for
+	ENTERS         // enters
+	EXITS          // exits
+	DWELLS         // dwells in
+	ANY            // any
+	ALL            // all
 )
 
 var keywords = map[string]Token{
@@ -113,11 +125,22 @@ var keywords = map[string]Token{
 	"not nearby":     NOT_NEARBY,
 	"intersects":     INTERSECTS,
 	"not intersects": NOT_INTERSECTS,
+	"not":            NOT,
+	"xor":            XOR,
+	"for":            FOR,
+	"enters":         ENTERS,
+	"exits":          EXITS,
+	"dwells in":      DWELLS,
+	"any":            ANY,
+	"all":            ALL,
 
 	"time":    TIME,
 	"date":    DATE,
 	"weekday": WEEKDAY,
 	"month":   MONTH,
+	"h3":      H3,
+	"geohash": GEOHASH,
+	"s2":      S2,
 }
 
 var keywordStrings = map[Token]string{}
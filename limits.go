@@ -0,0 +1,192 @@
+package geoqlparser
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Option configures ParseReader.
+type Option func(*options)
+
+type options struct {
+	mode        Mode
+	maxBytes    int
+	maxDepth    int
+	maxVertices int
+	maxVars     int
+}
+
+// WithMode sets the parser mode, e.g. ParseComments.
+func WithMode(mode Mode) Option {
+	return func(o *options) { o.mode = mode }
+}
+
+// WithMaxBytes limits the size of the source in bytes.
+func WithMaxBytes(n int) Option {
+	return func(o *options) { o.maxBytes = n }
+}
+
+// WithMaxDepth limits the nesting depth of expressions: parentheses,
+// arrays, not, function calls and geometry collections.
+func WithMaxDepth(n int) Option {
+	return func(o *options) { o.maxDepth = n }
+}
+
+// WithMaxVertices limits the total number of geometry vertices.
+func WithMaxVertices(n int) Option {
+	return func(o *options) { o.maxVertices = n }
+}
+
+// WithMaxVars limits the number of SET variables.
+func WithMaxVars(n int) Option {
+	return func(o *options) { o.maxVars = n }
+}
+
+// LimitError is returned by ParseReader when the source exceeds a limit.
+// Limit is one of bytes, depth, vertices or vars.
+type LimitError struct {
+	Limit  string
+	Max    int
+	Offset int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("geoql: %s limit of %d exceeded at offset %d", e.Limit, e.Max, e.Offset)
+}
+
+// ParseReader parses the statement read from r. Unlike Parse, it does not
+// buffer the whole source and stops with a *LimitError when a limit of
+// opts is exceeded, or with the context error when ctx is done.
+// Zero limits are unlimited.
+func ParseReader(ctx context.Context, r io.Reader, opts ...Option) (Statement, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	src := &readerSource{r: r, max: o.maxBytes}
+	s := newParser(newTokenizer(src, o.mode), src)
+	s.opts, s.ctx, s.done = o, ctx, ctx.Done()
+	stmt, err := s.parse0()
+	if s.abort == nil {
+		s.abort = src.er
+	}
+	if s.abort != nil {
+		return nil, s.abort
+	}
+	return stmt, err
+}
+
+// interrupted reports why the parser must stop: a read error of the source
+// or the done context.
+func (s *parser) interrupted() error {
+	if err := s.src.err(); err != nil {
+		return err
+	}
+	select {
+	case <-s.done:
+		return s.ctx.Err()
+	default:
+		return nil
+	}
+}
+
+// limit stops the parser with a *LimitError at the current token.
+func (s *parser) limit(name string, max int) error {
+	s.abort = &LimitError{Limit: name, Max: max, Offset: int(s.t.Offset())}
+	s.tok, s.lit = ILLEGAL, ""
+	return s.abort
+}
+
+func (s *parser) enter() error {
+	s.depth++
+	if max := s.opts.maxDepth; max > 0 && s.depth > max {
+		return s.limit("depth", max)
+	}
+	return nil
+}
+
+func (s *parser) leave() {
+	s.depth--
+}
+
+func (s *parser) vertex() error {
+	s.vertices++
+	if max := s.opts.maxVertices; max > 0 && s.vertices > max {
+		return s.limit("vertices", max)
+	}
+	return nil
+}
+
+// source is the text of the statement used in error messages.
+type source interface {
+	// before returns the text before the offset.
+	before(off int) string
+	err() error
+}
+
+type stringSource string
+
+func (s stringSource) before(off int) string {
+	if off > len(s) {
+		off = len(s)
+	}
+	return string(s[:off])
+}
+
+func (stringSource) err() error { return nil }
+
+// sourceTail is the number of bytes readerSource keeps for error messages.
+const sourceTail = 4096
+
+// readerSource reads the source of ParseReader up to max bytes and keeps
+// only the tail of what was read.
+type readerSource struct {
+	r    io.Reader
+	max  int
+	n    int
+	tail []byte
+	er   error
+}
+
+func (r *readerSource) Read(p []byte) (int, error) {
+	if r.er != nil {
+		return 0, io.EOF
+	}
+	if r.max > 0 && len(p) > r.max-r.n+1 {
+		p = p[:r.max-r.n+1]
+	}
+	n, err := r.r.Read(p)
+	if r.max > 0 && r.n+n > r.max {
+		n = r.max - r.n
+		r.er = &LimitError{Limit: "bytes", Max: r.max, Offset: r.max}
+	} else if err != nil && err != io.EOF {
+		r.er = err
+	}
+	r.n += n
+	r.tail = append(r.tail, p[:n]...)
+	if len(r.tail) > 2*sourceTail {
+		r.tail = append(r.tail[:0], r.tail[len(r.tail)-sourceTail:]...)
+	}
+	if r.er != nil {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *readerSource) before(off int) string {
+	start := r.n - len(r.tail)
+	if off > r.n {
+		off = r.n
+	}
+	if off < start {
+		return ""
+	}
+	return strings.ToValidUTF8(string(r.tail[:off-start]), "")
+}
+
+func (r *readerSource) err() error { return r.er }
@@ -0,0 +1,190 @@
+package geoqlparser
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseReader(t *testing.T) {
+	testCases := []struct {
+		name string
+		s    string
+		opts []Option
+	}{
+		{
+			name: "no limits",
+			s:    `trigger set a = 1; when tracker_a in (a) and tracker_b intersects polygon[[[1,1],[2,2],[3,3],[1,1]]]`,
+		},
+		{
+			name: "within limits",
+			s:    `trigger set a = 1; b = [1, 2]; when tracker_a in (b) and tracker_b intersects line[[1,1],[2,2]]`,
+			opts: []Option{WithMaxBytes(200), WithMaxDepth(3), WithMaxVertices(2), WithMaxVars(2)},
+		},
+		{
+			name: "exact size",
+			s:    `when tracker_a > 1`,
+			opts: []Option{WithMaxBytes(len(`when tracker_a > 1`))},
+		},
+		{
+			name: "comments",
+			s:    "// doc\nwhen tracker_a > 1 // comment",
+			opts: []Option{WithMode(ParseComments)},
+		},
+		{
+			name: "large source",
+			s:    `when tracker_a in [` + strings.Repeat(`1, `, 5000) + `2]`,
+			opts: []Option{WithMaxDepth(2)},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			have, err := ParseReader(context.Background(), strings.NewReader(tc.s), tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var o options
+			for _, opt := range tc.opts {
+				opt(&o)
+			}
+			want, err := ParseWithMode(tc.s, o.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var a, b strings.Builder
+			if err = Format(&a, want); err != nil {
+				t.Fatal(err)
+			}
+			if err = Format(&b, have); err != nil {
+				t.Fatal(err)
+			}
+			if a.String() != b.String() {
+				t.Fatalf("have %s, want %s", b.String(), a.String())
+			}
+		})
+	}
+}
+
+func TestParseReaderLimits(t *testing.T) {
+	testCases := []struct {
+		name   string
+		s      string
+		opt    Option
+		limit  string
+		offset int
+	}{
+		{
+			name:   "bytes",
+			s:      `when tracker_a > 1`,
+			opt:    WithMaxBytes(10),
+			limit:  "bytes",
+			offset: 10,
+		},
+		{
+			name:   "depth of parens",
+			s:      `when ((tracker_a > 1))`,
+			opt:    WithMaxDepth(2),
+			limit:  "depth",
+			offset: 7,
+		},
+		{
+			name:   "depth of not",
+			s:      `when not not not tracker_a`,
+			opt:    WithMaxDepth(2),
+			limit:  "depth",
+			offset: 17,
+		},
+		{
+			name:   "depth of arrays",
+			s:      `when tracker_a in [1, 2]`,
+			opt:    WithMaxDepth(1),
+			limit:  "depth",
+			offset: 19,
+		},
+		{
+			name:   "depth of collections",
+			s:      `when tracker_a intersects collection[multipoint[point[1,1]]]`,
+			opt:    WithMaxDepth(2),
+			limit:  "depth",
+			offset: 37,
+		},
+		{
+			name:   "vertices",
+			s:      `when tracker_a intersects point[1,1] or tracker_a intersects line[[1,1],[2,2]]`,
+			opt:    WithMaxVertices(2),
+			limit:  "vertices",
+			offset: 72,
+		},
+		{
+			name:   "vars",
+			s:      `trigger set a = 1; b = 2; c = 3; when tracker_a in (a, b, c)`,
+			opt:    WithMaxVars(2),
+			limit:  "vars",
+			offset: 26,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseReader(context.Background(), strings.NewReader(tc.s), tc.opt)
+			var le *LimitError
+			if !errors.As(err, &le) {
+				t.Fatalf("have %v, want *LimitError", err)
+			}
+			if le.Limit != tc.limit || le.Offset != tc.offset {
+				t.Fatalf("have %s at %d, want %s at %d", le.Limit, le.Offset, tc.limit, tc.offset)
+			}
+		})
+	}
+}
+
+type cancelReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (r *cancelReader) Read(p []byte) (int, error) {
+	r.cancel()
+	return r.r.Read(p)
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("broken")
+}
+
+func TestParseReaderInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ParseReader(ctx, strings.NewReader(`when tracker_a > 1`)); err != context.Canceled {
+		t.Fatalf("have %v, want %v", err, context.Canceled)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	r := &cancelReader{r: strings.NewReader(`when tracker_a > 1 and tracker_b > 2`), cancel: cancel}
+	if _, err := ParseReader(ctx, r); err != context.Canceled {
+		t.Fatalf("have %v, want %v", err, context.Canceled)
+	}
+
+	if _, err := ParseReader(context.Background(), errReader{}); err == nil || err.Error() != "broken" {
+		t.Fatalf("have %v, want broken", err)
+	}
+}
+
+func TestParseReaderError(t *testing.T) {
+	s := `when tracker_a in [` + strings.Repeat(`1, `, 5000) + `2] and )`
+	_, err := ParseReader(context.Background(), strings.NewReader(s))
+	var pe *Error
+	if !errors.As(err, &pe) {
+		t.Fatalf("have %v, want *Error", err)
+	}
+	if pe.Offset != len(s)-1 {
+		t.Fatalf("have offset %d, want %d", pe.Offset, len(s)-1)
+	}
+	if len(pe.Msg) == 0 || len(pe.Msg) > 2*sourceTail || !strings.HasSuffix(s[:pe.Offset], pe.Msg) {
+		t.Fatalf("invalid message %q", pe.Msg)
+	}
+}
@@ -0,0 +1,552 @@
+package geoqlparser
+
+import (
+	"math"
+)
+
+// Optimize simplifies the trigger in place. It inlines references to
+// literal variables, folds constant arithmetic and comparisons,
+// short-circuits boolean literals in and/or/xor/for, removes double
+// negations, merges overlapping ranges
+// on the same selector and removes redundant parentheses.
+// The result stays printable by Format.
+func Optimize(t *Trigger) {
+	if t == nil || t.When == nil {
+		return
+	}
+	o := &optimizer{trigger: t, inlined: make(map[string]struct{})}
+	t.When = unparen(o.expr(t.When))
+	o.dropInlinedVars()
+}
+
+type optimizer struct {
+	trigger *Trigger
+	inlined map[string]struct{}
+}
+
+func (o *optimizer) expr(expr Expr) Expr {
+	switch typ := expr.(type) {
+	case *Ref:
+		return o.inline(typ)
+	case *ParenExpr:
+		inner := o.expr(typ.Expr)
+		if !isOperator(inner) {
+			return inner
+		}
+		typ.Expr = inner
+		return typ
+	case *Range:
+		typ.Low = o.expr(typ.Low)
+		typ.High = o.expr(typ.High)
+		return typ
+	case *ArrayTyp:
+		if typ.Kind == RANGE {
+			return mergeArrayRanges(typ)
+		}
+		return typ
+	case *BinaryExpr:
+		return o.binary(typ)
+	case *UnaryExpr:
+		return o.unary(typ)
+	case *CallExpr:
+		for i := 0; i < len(typ.Args); i++ {
+			typ.Args[i] = unparen(o.expr(typ.Args[i]))
+		}
+		return typ
+	case *WindowExpr:
+		typ.X = unparen(o.expr(typ.X))
+		return typ
+	case *HistoryExpr:
+		if typ.Amount != nil {
+			typ.Amount = unparen(o.expr(typ.Amount))
+		}
+		return typ
+	}
+	return expr
+}
+
+func (o *optimizer) unary(e *UnaryExpr) Expr {
+	e.X = o.expr(e.X)
+	if e.Op != NOT {
+		return e
+	}
+	switch x := unparen(e.X).(type) {
+	case *BooleanTyp:
+		return &BooleanTyp{Val: !x.Val, lpos: e.Pos(), rpos: e.End()}
+	case *UnaryExpr:
+		if x.Op == NOT {
+			return x.X
+		}
+	}
+	e.X = unparenOperand(e.X, e.Op, true)
+	return e
+}
+
+func (o *optimizer) inline(ref *Ref) Expr {
+	assign, err := o.trigger.findAssign(ref.ID)
+	if err != nil || !isInlinable(assign.Right) {
+		return ref
+	}
+	o.inlined[ref.ID] = struct{}{}
+	return clone(assign.Right)
+}
+
+func isInlinable(expr Expr) (ok bool) {
+	switch typ := expr.(type) {
+	case *IntTyp, *FloatTyp, *StringTyp, *BooleanTyp, *PercentTyp,
+		*SpeedTyp, *DistanceTyp, *TemperatureTyp, *PressureTyp, *DurationTyp,
+		*DateTyp, *TimeTyp, *WeekdayTyp, *MonthTyp, *CellTyp:
+		ok = true
+	case *Range:
+		ok = isInlinable(typ.Low) && isInlinable(typ.High)
+	}
+	return
+}
+
+func (o *optimizer) dropInlinedVars() {
+	if len(o.inlined) == 0 {
+		return
+	}
+	used := make(map[string]struct{})
+	Visit(o.trigger.When, func(expr Expr) bool {
+		if ref, ok := expr.(*Ref); ok {
+			used[ref.ID] = struct{}{}
+		}
+		return true
+	})
+	vars := o.trigger.Vars[:0]
+	for _, assign := range o.trigger.Vars {
+		_, inlined := o.inlined[assign.Left.Val]
+		_, isUsed := used[assign.Left.Val]
+		if inlined && !isUsed {
+			continue
+		}
+		vars = append(vars, assign)
+	}
+	o.trigger.Vars = vars
+}
+
+func (o *optimizer) binary(e *BinaryExpr) Expr {
+	e.Left = o.expr(e.Left)
+	e.Right = o.expr(e.Right)
+
+	switch e.Op {
+	case AND, OR:
+		if expr, ok := shortCircuit(e); ok {
+			return expr
+		}
+		if expr := mergeRanges(e); expr != nil {
+			return expr
+		}
+	case XOR:
+		if expr, ok := shortCircuit(e); ok {
+			return expr
+		}
+	case FOR:
+		// A condition that is never true is never true for a while either.
+		if lit, ok := e.Left.(*BooleanTyp); ok && !lit.Val {
+			return lit
+		}
+	default:
+		if expr := fold(e); expr != nil {
+			return expr
+		}
+	}
+	e.Left = unparenOperand(e.Left, e.Op, false)
+	e.Right = unparenOperand(e.Right, e.Op, true)
+	return e
+}
+
+// unparenOperand removes parentheses that are not required by the operator precedence.
+func unparenOperand(expr Expr, op Token, right bool) Expr {
+	paren, ok := expr.(*ParenExpr)
+	if !ok {
+		return expr
+	}
+	inner := unparen(paren)
+	if parenthesize(inner, op, right) == inner {
+		return inner
+	}
+	return paren
+}
+
+func isOperator(expr Expr) bool {
+	switch expr.(type) {
+	case *BinaryExpr, *UnaryExpr:
+		return true
+	}
+	return false
+}
+
+func unparen(expr Expr) Expr {
+	for {
+		paren, ok := expr.(*ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = paren.Expr
+	}
+}
+
+func shortCircuit(e *BinaryExpr) (Expr, bool) {
+	for i, operand := range []Expr{e.Left, e.Right} {
+		lit, ok := operand.(*BooleanTyp)
+		if !ok {
+			continue
+		}
+		other := e.Right
+		if i == 1 {
+			other = e.Left
+		}
+		switch {
+		case e.Op == AND && lit.Val, e.Op == OR && !lit.Val, e.Op == XOR && !lit.Val:
+			return other, true
+		case e.Op == XOR:
+			if b, ok := other.(*BooleanTyp); ok {
+				return &BooleanTyp{Val: !b.Val, lpos: e.Pos(), rpos: e.End()}, true
+			}
+			return &UnaryExpr{Op: NOT, X: parenthesize(unparen(other), NOT, true), OpPos: e.Pos()}, true
+		default:
+			return &BooleanTyp{Val: lit.Val, lpos: e.Pos(), rpos: e.End()}, true
+		}
+	}
+	return nil, false
+}
+
+func fold(e *BinaryExpr) Expr {
+	lpos, rpos := e.Left.Pos(), e.Right.End()
+	switch l := e.Left.(type) {
+	case *StringTyp:
+		r, ok := e.Right.(*StringTyp)
+		if !ok {
+			return nil
+		}
+		switch e.Op {
+		case ADD:
+			return &StringTyp{Val: l.Val + r.Val, lpos: lpos, rpos: rpos}
+		case EQL, LEQL:
+			return &BooleanTyp{Val: l.Val == r.Val, lpos: lpos, rpos: rpos}
+		case NOT_EQ, LNEQ:
+			return &BooleanTyp{Val: l.Val != r.Val, lpos: lpos, rpos: rpos}
+		}
+		return nil
+	case *BooleanTyp:
+		r, ok := e.Right.(*BooleanTyp)
+		if !ok {
+			return nil
+		}
+		switch e.Op {
+		case EQL, LEQL:
+			return &BooleanTyp{Val: l.Val == r.Val, lpos: lpos, rpos: rpos}
+		case NOT_EQ, LNEQ:
+			return &BooleanTyp{Val: l.Val != r.Val, lpos: lpos, rpos: rpos}
+		}
+		return nil
+	}
+
+	if a, ok := e.Left.(*IntTyp); ok {
+		if b, ok := e.Right.(*IntTyp); ok {
+			return foldInt(e.Op, a.Val, b.Val, lpos, rpos)
+		}
+	}
+	lv, lok := numberOf(e.Left)
+	rv, rok := numberOf(e.Right)
+	if !lok || !rok {
+		return nil
+	}
+	var val float64
+	switch e.Op {
+	case ADD:
+		val = lv + rv
+	case SUB:
+		val = lv - rv
+	case MUL:
+		val = lv * rv
+	case QUO:
+		if rv == 0 {
+			return nil
+		}
+		val = lv / rv
+	case REM:
+		if rv == 0 {
+			return nil
+		}
+		val = math.Mod(lv, rv)
+	default:
+		if ok, cmp := compare(e.Op, lv, rv); cmp {
+			return &BooleanTyp{Val: ok, lpos: lpos, rpos: rpos}
+		}
+		return nil
+	}
+	return &FloatTyp{Val: val, lpos: lpos, rpos: rpos}
+}
+
+// foldInt folds the arithmetic and comparisons of integers. It returns nil
+// when the result overflows, e.g. 9223372036854775807 + 1, so the expression
+// is kept as written.
+func foldInt(op Token, a, b int, lpos, rpos Pos) Expr {
+	var val int
+	switch op {
+	case ADD:
+		val = a + b
+		if (val > a) != (b > 0) {
+			return nil
+		}
+	case SUB:
+		val = a - b
+		if (val < a) != (b > 0) {
+			return nil
+		}
+	case MUL:
+		val = a * b
+		if a != 0 && (val/a != b || a == -1 && b == math.MinInt) {
+			return nil
+		}
+	case QUO:
+		if b == 0 || b == -1 && a == math.MinInt {
+			return nil
+		}
+		val = a / b
+	case REM:
+		if b == 0 {
+			return nil
+		}
+		val = a % b
+	default:
+		var sign float64
+		switch {
+		case a < b:
+			sign = -1
+		case a > b:
+			sign = 1
+		}
+		if ok, cmp := compare(op, sign, 0); cmp {
+			return &BooleanTyp{Val: ok, lpos: lpos, rpos: rpos}
+		}
+		return nil
+	}
+	return &IntTyp{Val: val, lpos: lpos, rpos: rpos}
+}
+
+func compare(op Token, a, b float64) (ok bool, isCompare bool) {
+	isCompare = true
+	switch op {
+	case EQL, LEQL:
+		ok = a == b
+	case NOT_EQ, LNEQ:
+		ok = a != b
+	case GTR:
+		ok = a > b
+	case GEQ:
+		ok = a >= b
+	case LSS:
+		ok = a < b
+	case LEQ:
+		ok = a <= b
+	default:
+		isCompare = false
+	}
+	return
+}
+
+func numberOf(expr Expr) (val float64, ok bool) {
+	switch typ := expr.(type) {
+	case *IntTyp:
+		return float64(typ.Val), true
+	case *FloatTyp:
+		return typ.Val, true
+	}
+	return
+}
+
+// boundOf returns the value of a range bound and the kind of its unit.
+// Bounds can only be compared when they are of the same kind.
+func boundOf(expr Expr) (val float64, kind string, ok bool) {
+	switch typ := expr.(type) {
+	case *IntTyp:
+		return float64(typ.Val), "number", true
+	case *FloatTyp:
+		return typ.Val, "number", true
+	case *PercentTyp:
+		return typ.Val, "percent", true
+	case *DurationTyp:
+		return float64(typ.Val), "duration", true
+	case *SpeedTyp:
+		return typ.Val, "speed" + typ.U.String(), true
+	case *DistanceTyp:
+		return typ.Val, "distance" + typ.U.String(), true
+	case *PressureTyp:
+		return typ.Val, "pressure" + typ.U.String(), true
+	case *TemperatureTyp:
+		val = typ.Val
+		if typ.Vec == Minus {
+			val = -val
+		}
+		return val, "temperature" + typ.U.String(), true
+	}
+	return
+}
+
+type bounds struct {
+	low, high         float64
+	lowExpr, highExpr Expr
+	kind              string
+}
+
+func boundsOf(expr Expr) (b bounds, ok bool) {
+	r, isRange := expr.(*Range)
+	if !isRange {
+		return
+	}
+	low, lk, lok := boundOf(r.Low)
+	high, hk, hok := boundOf(r.High)
+	if !lok || !hok || lk != hk || low > high {
+		return
+	}
+	return bounds{low: low, high: high, lowExpr: r.Low, highExpr: r.High, kind: lk}, true
+}
+
+func (b bounds) overlaps(o bounds) bool {
+	return b.kind == o.kind && b.low <= o.high && o.low <= b.high
+}
+
+func (b bounds) union(o bounds) bounds {
+	if o.low < b.low {
+		b.low, b.lowExpr = o.low, o.lowExpr
+	}
+	if o.high > b.high {
+		b.high, b.highExpr = o.high, o.highExpr
+	}
+	return b
+}
+
+func (b bounds) intersect(o bounds) bounds {
+	if o.low > b.low {
+		b.low, b.lowExpr = o.low, o.lowExpr
+	}
+	if o.high < b.high {
+		b.high, b.highExpr = o.high, o.highExpr
+	}
+	return b
+}
+
+func (b bounds) expr() *Range {
+	return &Range{Low: b.lowExpr, High: b.highExpr, lpos: b.lowExpr.Pos(), rpos: b.highExpr.End()}
+}
+
+// flatten collects operands of a chain of the same operator from left to right.
+func flatten(op Token, expr Expr, list []Expr) []Expr {
+	node, ok := unparen(expr).(*BinaryExpr)
+	if !ok || node.Op != op {
+		return append(list, expr)
+	}
+	list = flatten(op, node.Left, list)
+	return flatten(op, node.Right, list)
+}
+
+// rebuild joins operands into a left-associative chain of the operator.
+func rebuild(op Token, list []Expr) Expr {
+	expr := unparen(list[0])
+	for i := 1; i < len(list); i++ {
+		expr = binary(op, expr, unparen(list[i]))
+	}
+	return expr
+}
+
+// mergeRanges merges `selector in low .. high` operands of an and/or chain
+// when they refer to the same selector and their ranges overlap.
+// It returns nil when there is nothing to merge.
+func mergeRanges(e *BinaryExpr) Expr {
+	list := flatten(e.Op, e, nil)
+	type candidate struct {
+		index  int
+		bounds bounds
+	}
+	seen := make(map[string][]*candidate)
+	removed := make(map[int]struct{})
+	for i, operand := range list {
+		in, ok := unparen(operand).(*BinaryExpr)
+		if !ok || in.Op != IN {
+			continue
+		}
+		selector, ok := in.Left.(*Selector)
+		if !ok || selector.Quantifier != ILLEGAL {
+			continue
+		}
+		b, ok := boundsOf(in.Right)
+		if !ok {
+			continue
+		}
+		key := formatExpr(selector)
+		var merged bool
+		for _, c := range seen[key] {
+			if !c.bounds.overlaps(b) {
+				continue
+			}
+			if e.Op == OR {
+				c.bounds = c.bounds.union(b)
+			} else {
+				c.bounds = c.bounds.intersect(b)
+			}
+			removed[i] = struct{}{}
+			merged = true
+			break
+		}
+		if !merged {
+			seen[key] = append(seen[key], &candidate{index: i, bounds: b})
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	for _, candidates := range seen {
+		for _, c := range candidates {
+			in := unparen(list[c.index]).(*BinaryExpr)
+			list[c.index] = &BinaryExpr{Op: IN, Left: in.Left, Right: c.bounds.expr(), OpPos: in.OpPos}
+		}
+	}
+	out := make([]Expr, 0, len(list)-len(removed))
+	for i, operand := range list {
+		if _, ok := removed[i]; !ok {
+			out = append(out, operand)
+		}
+	}
+	return rebuild(e.Op, out)
+}
+
+// mergeArrayRanges merges overlapping ranges inside an array of ranges.
+func mergeArrayRanges(array *ArrayTyp) *ArrayTyp {
+	list := make([]Expr, 0, len(array.List))
+	merged := make([]*bounds, 0, len(array.List))
+	for _, item := range array.List {
+		b, ok := boundsOf(item)
+		if !ok {
+			list = append(list, item)
+			merged = append(merged, nil)
+			continue
+		}
+		var done bool
+		for _, m := range merged {
+			if m != nil && m.overlaps(b) {
+				*m = m.union(b)
+				done = true
+				break
+			}
+		}
+		if done {
+			continue
+		}
+		list = append(list, item)
+		merged = append(merged, &b)
+	}
+	if len(list) == len(array.List) {
+		return array
+	}
+	for i, m := range merged {
+		if m != nil {
+			list[i] = m.expr()
+		}
+	}
+	array.List = list
+	return array
+}
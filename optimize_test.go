@@ -0,0 +1,162 @@
+package geoqlparser
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func oneLine(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	s = strings.ReplaceAll(s, "( ", "(")
+	return strings.ReplaceAll(s, " )", ")")
+}
+
+func TestOptimize(t *testing.T) {
+	testCases := []struct {
+		name string
+		s    string
+		want string
+		vars int
+	}{
+		{
+			name: "fold constant comparison",
+			s:    `when 1+2 == 3`,
+			want: `true`,
+		},
+		{
+			name: "fold constant arithmetic",
+			s:    `when tracker_a > 2*3+1.5`,
+			want: `tracker_a > 7.5`,
+		},
+		{
+			name: "keep division by zero",
+			s:    `when tracker_a > 1/0`,
+			want: `tracker_a > 1/0`,
+		},
+		{
+			name: "keep integer overflow",
+			s:    `when tracker_a > 9223372036854775807 + 1 or tracker_b > 4611686018427387904 * 2 or tracker_c > 0 - 9223372036854775807 - 2`,
+			want: `tracker_a > 9223372036854775807+1 or tracker_b > 4611686018427387904*2 or tracker_c > -9223372036854775807-2`,
+		},
+		{
+			name: "fold large integers exactly",
+			s:    `when 9007199254740993 > 9007199254740992 and tracker_a > 9007199254740993 - 1`,
+			want: `tracker_a > 9007199254740992`,
+		},
+		{
+			name: "fold strings",
+			s:    `when tracker_model == "ER" + "54"`,
+			want: `tracker_model == "ER54"`,
+		},
+		{
+			name: "remove redundant parens",
+			s:    `when ((tracker_a > 1)) and (tracker_b > 2 and tracker_c > 3)`,
+			want: `tracker_a > 1 and tracker_b > 2 and tracker_c > 3`,
+		},
+		{
+			name: "keep required parens",
+			s:    `when tracker_a > 1 and (tracker_b > 1 or tracker_c > 1) and (tracker_a+1)*2 > 1`,
+			want: `tracker_a > 1 and (tracker_b > 1 or tracker_c > 1) and (tracker_a+1)*2 > 1`,
+		},
+		{
+			name: "true and x",
+			s:    `when true and tracker_a > 1`,
+			want: `tracker_a > 1`,
+		},
+		{
+			name: "false or x",
+			s:    `when false or (tracker_a > 1 or tracker_b > 2)`,
+			want: `tracker_a > 1 or tracker_b > 2`,
+		},
+		{
+			name: "false and x",
+			s:    `when tracker_a > 1 and 1 > 2`,
+			want: `false`,
+		},
+		{
+			name: "short-circuit keeps precedence",
+			s:    `when tracker_c > 1 and (true and (tracker_a > 1 or tracker_b > 2))`,
+			want: `tracker_c > 1 and (tracker_a > 1 or tracker_b > 2)`,
+		},
+		{
+			name: "inline literal vars",
+			s:    `trigger set limit=10; speed=10Kph .. 20Kph; place=point[1, 1]; when tracker_a > @limit and tracker_speed in @speed and tracker_coords intersects @place`,
+			want: `tracker_a > 10 and tracker_speed in 10Kph .. 20Kph and tracker_coords intersects @place`,
+			vars: 1,
+		},
+		{
+			name: "merge overlapping ranges with or",
+			s:    `when tracker_speed in 10Kph .. 40Kph or tracker_speed in 30Kph .. 60Kph or tracker_speed in 100Kph .. 120Kph`,
+			want: `tracker_speed in 10Kph .. 60Kph or tracker_speed in 100Kph .. 120Kph`,
+		},
+		{
+			name: "merge overlapping ranges with and",
+			s:    `when tracker_speed in 10Kph .. 40Kph and tracker_a > 1 and tracker_speed in 30Kph .. 60Kph`,
+			want: `tracker_speed in 30Kph .. 40Kph and tracker_a > 1`,
+		},
+		{
+			name: "do not merge different units",
+			s:    `when tracker_speed in 10Kph .. 40Kph or tracker_speed in 30Mph .. 60Mph`,
+			want: `tracker_speed in 10Kph .. 40Kph or tracker_speed in 30Mph .. 60Mph`,
+		},
+		{
+			name: "double negation",
+			s:    `when not not (tracker_a > 1 or tracker_b > 1) and tracker_c > 1`,
+			want: `(tracker_a > 1 or tracker_b > 1) and tracker_c > 1`,
+		},
+		{
+			name: "negate literal",
+			s:    `when not (1 > 2) and tracker_a > 1`,
+			want: `tracker_a > 1`,
+		},
+		{
+			name: "keep parens of not",
+			s:    `when not (tracker_a > 1 and (tracker_b > 1))`,
+			want: `not (tracker_a > 1 and tracker_b > 1)`,
+		},
+		{
+			name: "false xor x",
+			s:    `when false xor tracker_a > 1`,
+			want: `tracker_a > 1`,
+		},
+		{
+			name: "true xor x",
+			s:    `when tracker_a > 1 and tracker_b > 1 xor true`,
+			want: `not (tracker_a > 1 and tracker_b > 1)`,
+		},
+		{
+			name: "fold call arguments",
+			s:    `when pow((tracker_a), 1+1) > abs(2*-3)`,
+			want: `pow(tracker_a, 2) > abs(-6)`,
+		},
+		{
+			name: "merge array of ranges",
+			s:    `when tracker_a in [1 .. 5, 3 .. 8, 10 .. 12]`,
+			want: `tracker_a in [1 .. 8, 10 .. 12]`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := Parse(tc.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			trigger := stmt.(*Trigger)
+			Optimize(trigger)
+			if have := oneLine(formatExpr(trigger.When)); have != tc.want {
+				t.Fatalf("have %s, want %s", have, tc.want)
+			}
+			if have, want := len(trigger.Vars), tc.vars; have != want {
+				t.Fatalf("have %d, want %d vars", have, want)
+			}
+			buf := bytes.NewBuffer(nil)
+			if err = Format(buf, trigger); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = Parse(buf.String()); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
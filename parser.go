@@ -1,23 +1,36 @@
 package geoqlparser
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io"
 	"strings"
 )
 
 var errNegativeValue = errors.New("value cannot be negative")
 
+// Mode controls optional parser functionality.
+type Mode uint
+
+const (
+	// ParseComments attaches comments to the AST.
+	// Without it comments are skipped.
+	ParseComments Mode = 1 << iota
+)
+
 func Parse(gql string) (Statement, error) {
-	r := strings.NewReader(gql)
-	t := NewTokenizer(r)
-	s := newParser(t, r)
+	return ParseWithMode(gql, 0)
+}
+
+// ParseWithMode parses the statement with the given mode.
+func ParseWithMode(gql string, mode Mode) (Statement, error) {
+	t := newTokenizer(strings.NewReader(gql), mode)
+	s := newParser(t, stringSource(gql))
 	return s.parse0()
 }
 
 type parser struct {
-	r    *strings.Reader
+	src  source
 	t    *Tokenizer
 	tok  Token
 	lit  string
@@ -25,42 +38,132 @@ type parser struct {
 	sign Token
 	lpos Pos
 	rpos Pos
+
+	// limits of ParseReader
+	opts     options
+	done     <-chan struct{}
+	ctx      context.Context
+	depth    int
+	vertices int
+	abort    error
 }
 
 func (s *parser) parseTriggerStmt() (stmt *Trigger, err error) {
 	if !s.except(WHEN, SET) {
-		return nil, s.error()
+		s.err = fmt.Errorf("invalid trigger: expected set or when")
+		return nil, s.errorHint(s.didYouMean("set", "when"))
 	}
 	stmt = new(Trigger)
 	stmt.lpos = s.t.Offset()
 	if s.except(SET) {
+		stmt.SetDoc = s.comments(nil)
 		if err = s.parseSet(stmt); err != nil {
 			return nil, err
 		}
 		s.next()
 		if !s.except(WHEN) {
-			return nil, s.error()
+			s.err = fmt.Errorf("invalid trigger: expected when")
+			return nil, s.errorHint(s.didYouMean("when"))
 		}
 	}
 	if s.except(WHEN) {
+		if n := len(stmt.Vars); n > 0 {
+			stmt.WhenDoc = s.comments(&stmt.Vars[n-1].Comment)
+		} else {
+			stmt.WhenDoc = s.comments(nil)
+		}
 		if err = s.parseWhen(stmt); err != nil {
 			return nil, err
 		}
+		doc := s.comments(&stmt.WhenComment)
+		switch s.tok {
+		case REPEAT:
+			stmt.RepeatDoc = doc
+		case RESET:
+			stmt.ResetDoc = doc
+		default:
+			stmt.Comment = doc
+		}
 	}
 	if s.except(REPEAT) {
+		end := s.t.Offset() + Pos(len(s.lit)) - 1
 		if err = s.parseRepeat(stmt); err != nil {
 			return nil, err
 		}
+		if stmt.RepeatInterval != nil {
+			end = stmt.RepeatInterval.End()
+		} else if stmt.RepeatCount != nil {
+			end = stmt.RepeatCount.End()
+		}
+		var doc *CommentGroup
+		stmt.RepeatComment, doc = s.clauseComments(end)
+		if s.except(RESET) {
+			stmt.ResetDoc = joinComments(stmt.ResetDoc, doc)
+		} else {
+			stmt.Comment = joinComments(stmt.Comment, doc)
+		}
 	}
 	if s.except(RESET) {
 		if err = s.parseReset(stmt); err != nil {
 			return nil, err
 		}
+		var doc *CommentGroup
+		stmt.ResetComment, doc = s.clauseComments(stmt.ResetAfter.End())
+		stmt.Comment = joinComments(stmt.Comment, doc)
+	}
+	if !s.except(EOF) {
+		s.err = fmt.Errorf("unexpected %s after the statement", s.lit)
+		if s.except(RPAREN) {
+			return nil, s.errorHint("remove the unmatched )")
+		}
+		if hint := s.didYouMean(keywordNames()...); hint != "" {
+			return nil, s.errorHint(hint)
+		}
+		return nil, s.errorHint("join the conditions with and, or or xor")
+	}
+	if s.t.Err() != nil {
+		return nil, s.scanError()
 	}
 	stmt.rpos = s.t.Offset()
+	stmt.Comment = joinComments(stmt.Comment, s.comments(nil))
 	return stmt, nil
 }
 
+// commentsBefore returns the scanned comments that end before pos.
+func (s *parser) commentsBefore(pos Pos) *CommentGroup {
+	var i int
+	for i < len(s.t.comments) && s.t.comments[i].End() <= pos {
+		i++
+	}
+	list := s.t.comments[:i]
+	s.t.comments = s.t.comments[i:]
+	return newCommentGroup(list)
+}
+
+// clauseComments returns the comments in a clause that ends at end and
+// the comments after it on the same line, and the other comments as doc.
+func (s *parser) clauseComments(end Pos) (line, doc *CommentGroup) {
+	line = s.commentsBefore(end)
+	doc = s.comments(&line)
+	return line, doc
+}
+
+// comments returns the comments scanned before the current token.
+// Comments on the line of the previous token are appended to line,
+// if it is not nil.
+func (s *parser) comments(line **CommentGroup) *CommentGroup {
+	list := s.t.Comments()
+	if line != nil {
+		var i int
+		for i < len(list) && list[i].trailing {
+			i++
+		}
+		*line = joinComments(*line, newCommentGroup(list[:i]))
+		list = list[i:]
+	}
+	return newCommentGroup(list)
+}
+
 func (s *parser) parseWhen(stmt *Trigger) error {
 	if !s.except(WHEN) {
 		return s.error()
@@ -80,6 +183,7 @@ func (s *parser) parseRepeat(stmt *Trigger) (err error) {
 	}
 
 	if !s.except(INT) {
+		s.err = fmt.Errorf("invalid repeat: expected count")
 		return s.error()
 	}
 
@@ -88,6 +192,7 @@ func (s *parser) parseRepeat(stmt *Trigger) (err error) {
 		return err
 	}
 	if _, ok := repeatCount.(*IntTyp); !ok {
+		s.err = fmt.Errorf("invalid repeat: expected count")
 		return s.error()
 	}
 
@@ -96,15 +201,24 @@ func (s *parser) parseRepeat(stmt *Trigger) (err error) {
 		return
 	}
 
-	if !s.except(SELECTOR) {
-		return s.error()
+	if !s.except(SELECTOR) || s.lit != "every" && s.lit != "times" {
+		s.err = fmt.Errorf("invalid repeat: expected every or times")
+		if hint := s.didYouMean("every", "times"); hint != "" {
+			return s.errorHint(hint)
+		}
+		return s.errorHint("e.g. repeat 3 every 10s")
 	}
 	s.next()
+	if !s.except(INT) {
+		s.err = fmt.Errorf("invalid repeat: expected interval")
+		return s.error()
+	}
 	dur, err := s.parseIntTypes()
 	if err != nil {
 		return err
 	}
 	if _, ok := dur.(*DurationTyp); !ok {
+		s.err = fmt.Errorf("invalid repeat: expected interval")
 		return s.error()
 	}
 	stmt.RepeatInterval = dur
@@ -122,13 +236,24 @@ func (s *parser) parseSet(stmt *Trigger) error {
 			break
 		}
 		if !s.except(SELECTOR) {
+			s.err = fmt.Errorf("invalid set: expected variable name")
 			return s.error()
 		}
+		if max := s.opts.maxVars; max > 0 && len(stmt.Vars) >= max {
+			return s.limit("vars", max)
+		}
+		var doc *CommentGroup
+		if n := len(stmt.Vars); n > 0 {
+			doc = s.comments(&stmt.Vars[n-1].Comment)
+		} else {
+			doc = s.comments(nil)
+		}
 		ident := Ident{Val: s.t.TokenText(), lpos: s.t.Offset()}
 		ident.rpos = s.t.Offset() + Pos(len(ident.Val)-1)
 		s.t.Unwind()
 		s.next()
 		if !s.except(ASSIGN) {
+			s.err = fmt.Errorf("invalid set: expected =")
 			return s.error()
 		}
 		tokPos := s.t.Offset() - 1
@@ -141,14 +266,17 @@ func (s *parser) parseSet(stmt *Trigger) error {
 		}
 		switch typ := expr.(type) {
 		case *Ref:
+			s.err = fmt.Errorf("invalid set: variable %s is assigned a variable", ident.Val)
 			return s.error()
 		case *ArrayTyp:
 			if typ.Kind == IDENT {
+				s.err = fmt.Errorf("invalid set: variable %s is assigned an array of variables", ident.Val)
 				return s.error()
 			}
 		}
 		stmt.initVars()
 		va := &Assign{
+			Doc:    doc,
 			Left:   &ident,
 			TokPos: tokPos,
 			Right:  expr,
@@ -163,6 +291,13 @@ func (s *parser) parseSet(stmt *Trigger) error {
 
 func (s *parser) parseReset(stmt *Trigger) (err error) {
 	s.next()
+	if !s.except(SELECTOR) || s.lit != "after" {
+		s.err = fmt.Errorf("invalid reset: expected after")
+		if hint := s.didYouMean("after"); hint != "" {
+			return s.errorHint(hint)
+		}
+		return s.errorHint("e.g. reset after 1h")
+	}
 	s.next()
 	var dur Expr
 	switch s.tok {
@@ -176,6 +311,7 @@ func (s *parser) parseReset(stmt *Trigger) (err error) {
 	}
 	_, ok := dur.(*DurationTyp)
 	if !ok {
+		s.err = fmt.Errorf("invalid reset: expected duration")
 		return s.error()
 	}
 	stmt.ResetAfter = dur
@@ -183,6 +319,13 @@ func (s *parser) parseReset(stmt *Trigger) (err error) {
 }
 
 func (s *parser) next() {
+	if s.abort == nil {
+		s.abort = s.interrupted()
+	}
+	if s.abort != nil {
+		s.tok, s.lit = ILLEGAL, ""
+		return
+	}
 	s.tok, s.lit = s.t.Scan()
 }
 
@@ -190,12 +333,19 @@ func (s *parser) parse0() (stmt Statement, err error) {
 	s.next()
 	switch s.tok {
 	case TRIGGER, WHEN:
+		doc := s.comments(nil)
 		if s.except(TRIGGER) {
 			s.next()
 		}
-		return s.parseTriggerStmt()
+		trigger, err := s.parseTriggerStmt()
+		if err != nil {
+			return nil, err
+		}
+		trigger.Doc = doc
+		return trigger, nil
 	default:
-		err = s.error()
+		s.err = fmt.Errorf("expected trigger or when")
+		err = s.errorHint(s.didYouMean("trigger", "when"))
 	}
 	return
 }
@@ -225,19 +375,32 @@ func (s *parser) parseBinaryExpr(oprec0 int) (Expr, error) {
 		if oprec < oprec0 {
 			return left, nil
 		}
+		if op == NOT {
+			s.err = fmt.Errorf("unexpected unary operator %s", s.lit)
+			return nil, s.error()
+		}
+		comment := s.comments(nil)
 
 		right, err := s.parseBinaryExpr(oprec + 1)
 		if err != nil {
 			return nil, err
 		}
-		left = &BinaryExpr{Left: left, Right: right, Op: op, OpPos: pos}
+		if _, ok := right.(*DurationTyp); op == FOR && !ok {
+			s.err = fmt.Errorf("invalid for qualifier: got %s, expected duration", formatExpr(right))
+			return nil, s.error()
+		}
+		comment = joinComments(comment, s.commentsBefore(right.Pos()))
+		left = &BinaryExpr{Left: left, Right: right, Op: op, OpPos: pos, Comment: comment}
+		if op == DWELLS && !s.except(FOR) {
+			s.err = fmt.Errorf("invalid dwells in: expected for duration")
+			return nil, s.error()
+		}
 	}
 }
 
 func (s *parser) parseUnaryExpr() (expr Expr, err error) {
 	if s.t.Err() != nil {
-		s.err = s.t.Err()
-		return nil, s.error()
+		return nil, s.scanError()
 	}
 
 	s.next()
@@ -250,8 +413,17 @@ func (s *parser) parseUnaryExpr() (expr Expr, err error) {
 			s.sign = ADD
 		}
 		s.next()
+		if !s.except(INT, FLOAT) {
+			s.err = fmt.Errorf("invalid sign: expected number")
+			return nil, s.error()
+		}
 	}
 
+	if err = s.enter(); err != nil {
+		return nil, err
+	}
+	defer s.leave()
+
 	switch s.tok {
 	default:
 		s.err = fmt.Errorf("illegal expression")
@@ -286,8 +458,14 @@ func (s *parser) parseUnaryExpr() (expr Expr, err error) {
 		expr, err = s.parseGeometryMultiObject()
 	case GEOMETRY_COLLECTION:
 		expr, err = s.parseGeometryCollectionExpr()
+	case H3, GEOHASH, S2:
+		expr, err = s.parseCellExpr()
 	case BOOLEAN:
 		expr, err = s.parseBooleanLit()
+	case NOT:
+		expr, err = s.parseNotExpr()
+	case ANY, ALL:
+		expr, err = s.parseQuantifiedExpr()
 	}
 	if err == nil {
 		switch s.tok {
@@ -300,7 +478,9 @@ func (s *parser) parseUnaryExpr() (expr Expr, err error) {
 }
 
 func (s *parser) parseWildcardLit() (expr Expr, err error) {
-	return &WildcardTyp{lpos: s.t.Offset()}, nil
+	expr = &WildcardTyp{lpos: s.t.Offset()}
+	s.next()
+	return expr, nil
 }
 
 func (s *parser) resetSign() {
@@ -315,12 +495,26 @@ func (s *parser) isSignPlus() bool {
 	return s.sign == ADD
 }
 
+func (s *parser) parseNotExpr() (expr Expr, err error) {
+	pos := s.t.Offset()
+	s.resetSign()
+	x, err := s.parseBinaryExpr(NOT.Precedence() + 1)
+	if err != nil {
+		return nil, err
+	}
+	return &UnaryExpr{Op: NOT, X: x, OpPos: pos}, nil
+}
+
 func (s *parser) parseParenExpr() (expr Expr, err error) {
 	lp := s.t.Offset()
-	expr, err = s.parseBinaryExpr(s.tok.Precedence())
+	expr, err = s.parseBinaryExpr(1)
 	if err != nil {
 		return nil, err
 	}
+	if !s.except(RPAREN) {
+		s.err = fmt.Errorf("invalid parenthesized expression: expected )")
+		return nil, s.errorHint("close the parenthesis with )")
+	}
 	rp := s.t.Offset()
 	s.next()
 	return &ParenExpr{Expr: expr, lpos: lp, rpos: rp}, nil
@@ -332,17 +526,37 @@ func (s *parser) error() error {
 		Err:    s.err,
 		Lit:    s.t.lit,
 	}
-	_, er := s.r.Seek(0, io.SeekStart)
-	if er == nil {
-		buf := make([]byte, s.t.s.Offset)
-		_, _ = s.r.Read(buf)
-		err.Msg = string(buf)
-	}
+	err.Msg = s.src.before(s.t.s.Offset)
 	return &err
 }
 
-func newParser(t *Tokenizer, r *strings.Reader) *parser {
-	return &parser{t: t, r: r}
+// scanError returns the error of the tokenizer.
+func (s *parser) scanError() error {
+	s.err = s.t.Err()
+	if s.err.Error() == "literal not terminated" {
+		return s.errorHint(`close the string with "`)
+	}
+	return s.error()
+}
+
+// didYouMean returns the hint with the names closest to the current token
+// if it is a misspelled word.
+func (s *parser) didYouMean(names ...string) string {
+	if !s.except(SELECTOR) {
+		return ""
+	}
+	return didYouMean(s.lit, names)
+}
+
+// errorHint returns the error at the current token with a hint how to fix it.
+func (s *parser) errorHint(hint string) error {
+	err := s.error().(*Error)
+	err.Hint = hint
+	return err
+}
+
+func newParser(t *Tokenizer, src source) *parser {
+	return &parser{t: t, src: src}
 }
 
 type Error struct {
@@ -350,6 +564,12 @@ type Error struct {
 	Err    error
 	Msg    string
 	Lit    string
+	// Hint tells how to fix the error, it may be empty.
+	Hint string
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
 }
 
 func (e *Error) Error() string {
@@ -372,7 +592,7 @@ func isGeometryToken(tok Token) (ok bool) {
 }
 
 func trim(lit string) string {
-	lit = strings.TrimLeft(lit, `"`)
-	lit = strings.TrimRight(lit, `"`)
+	lit = strings.TrimPrefix(lit, `"`)
+	lit = strings.TrimSuffix(lit, `"`)
 	return lit
 }
@@ -1,6 +1,7 @@
 package geoqlparser
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -122,11 +123,16 @@ func TestParseVars(t *testing.T) {
 		},
 		{
 			name: "assign array of time",
-			s:    `trigger set a=[11:11:11, 10:10:10];  when @a`,
+			s:    `trigger set a=time[11:11:11, 10:10:10];  when @a`,
 			assert: assertVars(map[string][5]Pos{
-				"a": {12, 12, 13, 14, 33},
+				"a": {12, 12, 13, 14, 37},
 			}),
 		},
+		{
+			name: "assign array of time without keyword",
+			s:    `trigger set a=[11:11:11, 10:10:10];  when @a`,
+			err:  true,
+		},
 		{
 			name: "assign geometry polygon",
 			s:    `trigger set a=polygon[[[1.1,1.1], [1.1,1.1], [1.1,1.1]], [[1.1,1.1], [1.1,1.1], [1.1,1.1]]];  when @a`,
@@ -482,3 +488,237 @@ func isType(kind Token, expr Expr) (ok bool) {
 	}
 	return
 }
+
+func TestParseComments(t *testing.T) {
+	src := `// speed control
+trigger
+// limits
+set
+	// upper limit
+	max = 60Kph; // in kph
+	min = 10Kph;
+// the main condition
+when
+	tracker_speed > @max // too fast
+	or tracker_speed < @min
+// notify twice
+repeat 2 every 1m
+reset after 1h // once an hour
+// end`
+	stmt, err := ParseWithMode(src, ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trigger := stmt.(*Trigger)
+	testCases := []struct {
+		name string
+		have *CommentGroup
+		want string
+	}{
+		{name: "doc", have: trigger.Doc, want: "speed control"},
+		{name: "set doc", have: trigger.SetDoc, want: "limits"},
+		{name: "var doc", have: trigger.Vars[0].Doc, want: "upper limit"},
+		{name: "var comment", have: trigger.Vars[0].Comment, want: "in kph"},
+		{name: "second var doc", have: trigger.Vars[1].Doc},
+		{name: "when doc", have: trigger.WhenDoc, want: "the main condition"},
+		{name: "binary expr", have: trigger.When.(*BinaryExpr).Comment, want: "too fast"},
+		{name: "repeat doc", have: trigger.RepeatDoc, want: "notify twice"},
+		{name: "reset comment", have: trigger.ResetComment, want: "once an hour"},
+		{name: "comment", have: trigger.Comment, want: "end"},
+	}
+	for _, tc := range testCases {
+		if have := tc.have.Text(); have != tc.want {
+			t.Fatalf("%s: have %q, want %q", tc.name, have, tc.want)
+		}
+	}
+
+	stmt, err = Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trigger = stmt.(*Trigger); trigger.Doc != nil || trigger.Vars[0].Comment != nil {
+		t.Fatal("have comments, want skipped comments without ParseComments")
+	}
+}
+
+func TestParseNotAndXor(t *testing.T) {
+	testCases := []struct {
+		name string
+		s    string
+		want string
+		err  bool
+	}{
+		{
+			name: "not binds tighter than and",
+			s:    `when not tracker_a > 1 and tracker_b`,
+			want: `and(not(>(tracker_a, 1)), tracker_b)`,
+		},
+		{
+			name: "not of parens",
+			s:    `when not (tracker_a or tracker_b)`,
+			want: `not((or(tracker_a, tracker_b)))`,
+		},
+		{
+			name: "bang",
+			s:    `when !tracker_a and ! tracker_b`,
+			want: `and(not(tracker_a), not(tracker_b))`,
+		},
+		{
+			name: "double negation",
+			s:    `when not not tracker_a in [1]`,
+			want: `not(not(in(tracker_a, [1])))`,
+		},
+		{
+			name: "xor between or and and",
+			s:    `when tracker_a or tracker_b xor tracker_c and tracker_d`,
+			want: `or(tracker_a, xor(tracker_b, and(tracker_c, tracker_d)))`,
+		},
+		{
+			name: "not eq keeps working",
+			s:    `when tracker_a not eq 1 and tracker_b not in [1]`,
+			want: `and(not eq(tracker_a, 1), not in(tracker_b, [1]))`,
+		},
+		{
+			name: "not is not a binary operator",
+			s:    `when tracker_a not tracker_b`,
+			err:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := Parse(tc.s)
+			if tc.err {
+				if err == nil {
+					t.Fatal("have nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := sexpr(stmt.(*Trigger).When); have != tc.want {
+				t.Fatalf("have %s, want %s", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	testCases := []struct {
+		name string
+		s    string
+		err  string
+	}{
+		{
+			name: "trailing tokens",
+			s:    `when tracker_a > 1 2`,
+			err:  "unexpected 2 after the statement",
+		},
+		{
+			name: "wildcard followed by a number",
+			s:    `when *00`,
+			err:  "unexpected 00 after the statement",
+		},
+		{
+			name: "illegal character in parens",
+			s:    `when (tracker_a # 1)`,
+			err:  "invalid parenthesized expression: expected )",
+		},
+		{
+			name: "array without commas",
+			s:    `when tracker_a in [1 2 3]`,
+			err:  "invalid array: expected , or ]",
+		},
+		{
+			name: "reference to a string",
+			s:    `when tracker_a: @"x"`,
+			err:  "invalid variable reference: expected @name",
+		},
+		{
+			name: "unterminated string",
+			s:    `when tracker_a == "x`,
+			err:  "literal not terminated",
+		},
+		{
+			name: "negative pressure",
+			s:    `when tracker_a > -1bar`,
+			err:  "value cannot be negative",
+		},
+		{
+			name: "sign without number",
+			s:    `when tracker_a > -tracker_b`,
+			err:  "invalid sign: expected number",
+		},
+		{
+			name: "repeat without every",
+			s:    `when tracker_a > 1 repeat 5 x 10s`,
+			err:  "invalid repeat: expected every or times",
+		},
+		{
+			name: "reset without after",
+			s:    `when tracker_a > 1 reset 1h`,
+			err:  "invalid reset: expected after",
+		},
+		{
+			name: "selector without commas",
+			s:    `when tracker_a{"x" "y"} > 1`,
+			err:  "invalid selector tracker_a: expected , or }",
+		},
+		{
+			name: "range of ranges",
+			s:    `when tracker_a in 1 .. 2 .. 3`,
+			err:  "invalid range: range of ranges",
+		},
+		{
+			name: "point of three coordinates",
+			s:    `when tracker_a intersects point[1, 2, 3]`,
+			err:  "invalid point: expected [lon, lat]",
+		},
+		{
+			name: "line of numbers",
+			s:    `when tracker_a intersects line[1, 1]`,
+			err:  "invalid line: expected [",
+		},
+		{
+			name: "date range of three dates",
+			s:    `when tracker_a in date[2030-10-01 .. 2030-10-02 .. 2030-10-03]`,
+			err:  "invalid date format: expected , or .. or ]",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.s)
+			var pe *Error
+			if !errors.As(err, &pe) {
+				t.Fatalf("have %v, want *Error", err)
+			}
+			if pe.Err == nil || pe.Err.Error() != tc.err {
+				t.Fatalf("have %v, want %s", pe.Err, tc.err)
+			}
+		})
+	}
+}
+
+func TestParseStringQuotes(t *testing.T) {
+	stmt, err := Parse(`when tracker_a == "\"x\""`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	str := stmt.(*Trigger).When.(*BinaryExpr).Right.(*StringTyp)
+	if have, want := str.Val, `\"x\"`; have != want {
+		t.Fatalf("have %s, want %s", have, want)
+	}
+}
+
+// sexpr prints the operator tree in prefix notation.
+func sexpr(expr Expr) string {
+	switch typ := expr.(type) {
+	case *BinaryExpr:
+		return KeywordString(typ.Op) + "(" + sexpr(typ.Left) + ", " + sexpr(typ.Right) + ")"
+	case *UnaryExpr:
+		return KeywordString(typ.Op) + "(" + sexpr(typ.X) + ")"
+	case *ParenExpr:
+		return "(" + sexpr(typ.Expr) + ")"
+	}
+	return formatExpr(expr)
+}
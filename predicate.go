@@ -0,0 +1,288 @@
+package geoqlparser
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// predicate is a constraint on the value of a selector of the current device
+// that must hold for a trigger to fire.
+type predicate struct {
+	ident string
+	d     *domain
+}
+
+// predicates returns the constraints implied by Trigger.When. It reports
+// false if the trigger can never fire.
+func predicates(t *Trigger) ([]predicate, bool) {
+	if t.When == nil {
+		return nil, true
+	}
+	a := newAnalyzer(t)
+	f := a.walk(t.When)
+	if f.unsat {
+		return nil, false
+	}
+	keys := make([]string, 0, len(f.cons))
+	for key := range f.cons {
+		if _, ok := a.idents[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	preds := make([]predicate, 0, len(keys))
+	for _, key := range keys {
+		preds = append(preds, predicate{ident: a.idents[key], d: f.cons[key]})
+	}
+	return preds, true
+}
+
+// contains reports whether the value of a record is in the domain.
+func (d *domain) contains(val interface{}) bool {
+	if isEnum(d.dim) {
+		key, ok := enumKey(d.dim, val)
+		if !ok {
+			return false
+		}
+		_, found := d.values[key]
+		return found != d.excluded
+	}
+	v, ok := toFloat(val)
+	if !ok {
+		return false
+	}
+	for _, i := range d.set {
+		if i.contains(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (i interval) contains(v float64) bool {
+	return (v > i.lo.v || v == i.lo.v && !i.lo.open) && (v < i.hi.v || v == i.hi.v && !i.hi.open)
+}
+
+func valueKey(dim dimension, v string) string {
+	return strconv.Itoa(int(dim)) + "/" + v
+}
+
+func enumKey(dim dimension, val interface{}) (string, bool) {
+	switch v := val.(type) {
+	case string:
+		return v, dim == dimString
+	case bool:
+		return strconv.FormatBool(v), dim == dimBoolean
+	}
+	return "", false
+}
+
+// PredicateIndex finds the triggers that may fire for a record of selector values.
+// It extracts the equality, range and in constraints on the selectors of the current
+// device that Trigger.When implies, e.g. tracker_model eq "ER54x3" and tracker_speed > 80Kph,
+// and counts the constraints a record satisfies. A trigger is a candidate when the record
+// satisfies all of its constraints, so a record without a constrained selector does not match.
+// Triggers without constraints are candidates for every record.
+//
+// Record values are strings, booleans, and float64 or int numbers in the base unit of
+// the constraint: Kph, M, C, Bar, seconds of durations and of the time of day,
+// YYYYMMDD dates, weekdays 0-6 from Sunday and months 1-12.
+// PredicateIndex is safe for concurrent use.
+type PredicateIndex struct {
+	mu        sync.RWMutex
+	rules     map[string]*predicateRule
+	anywhere  map[string]struct{}
+	selectors map[string]*selectorPredicates
+}
+
+type predicateRule struct {
+	trigger *Trigger
+	preds   []predicate
+	never   bool
+}
+
+type selectorPredicates struct {
+	// values holds the triggers per allowed string or boolean value
+	values map[string]map[string]struct{}
+	// ranges holds the intervals of the numeric constraints sorted by the lower bound
+	ranges []predicateRange
+	// excluded holds the constraints that exclude string or boolean values per trigger
+	excluded map[string][]*domain
+}
+
+type predicateRange struct {
+	interval
+	id string
+}
+
+func (sp *selectorPredicates) empty() bool {
+	return len(sp.values) == 0 && len(sp.ranges) == 0 && len(sp.excluded) == 0
+}
+
+// NewPredicateIndex creates an empty index.
+func NewPredicateIndex() *PredicateIndex {
+	return &PredicateIndex{
+		rules:     make(map[string]*predicateRule),
+		anywhere:  make(map[string]struct{}),
+		selectors: make(map[string]*selectorPredicates),
+	}
+}
+
+// Add indexes the trigger by the id, replacing a trigger with the same id.
+func (x *PredicateIndex) Add(id string, t *Trigger) error {
+	if t == nil {
+		return errors.New("geoql: nil trigger")
+	}
+	preds, ok := predicates(t)
+	rule := &predicateRule{trigger: t, preds: preds, never: !ok}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(id)
+	x.rules[id] = rule
+	switch {
+	case rule.never:
+		return nil
+	case len(preds) == 0:
+		x.anywhere[id] = struct{}{}
+		return nil
+	}
+	for _, p := range preds {
+		sp, ok := x.selectors[p.ident]
+		if !ok {
+			sp = &selectorPredicates{
+				values:   make(map[string]map[string]struct{}),
+				excluded: make(map[string][]*domain),
+			}
+			x.selectors[p.ident] = sp
+		}
+		if !isEnum(p.d.dim) {
+			for _, i := range p.d.set {
+				n := sort.Search(len(sp.ranges), func(k int) bool { return sp.ranges[k].lo.v > i.lo.v })
+				sp.ranges = append(sp.ranges, predicateRange{})
+				copy(sp.ranges[n+1:], sp.ranges[n:])
+				sp.ranges[n] = predicateRange{interval: i, id: id}
+			}
+			continue
+		}
+		if p.d.excluded {
+			sp.excluded[id] = append(sp.excluded[id], p.d)
+			continue
+		}
+		for v := range p.d.values {
+			ids, ok := sp.values[valueKey(p.d.dim, v)]
+			if !ok {
+				ids = make(map[string]struct{})
+				sp.values[valueKey(p.d.dim, v)] = ids
+			}
+			ids[id] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// Remove drops the trigger with the id.
+func (x *PredicateIndex) Remove(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(id)
+}
+
+func (x *PredicateIndex) remove(id string) {
+	rule, ok := x.rules[id]
+	if !ok {
+		return
+	}
+	delete(x.rules, id)
+	delete(x.anywhere, id)
+	for _, p := range rule.preds {
+		sp, ok := x.selectors[p.ident]
+		if !ok {
+			continue
+		}
+		delete(sp.excluded, id)
+		ranges := sp.ranges[:0]
+		for _, i := range sp.ranges {
+			if i.id != id {
+				ranges = append(ranges, i)
+			}
+		}
+		sp.ranges = ranges
+		for v := range p.d.values {
+			key := valueKey(p.d.dim, v)
+			delete(sp.values[key], id)
+			if len(sp.values[key]) == 0 {
+				delete(sp.values, key)
+			}
+		}
+		if sp.empty() {
+			delete(x.selectors, p.ident)
+		}
+	}
+}
+
+// Get returns the trigger with the id.
+func (x *PredicateIndex) Get(id string) (*Trigger, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	rule, ok := x.rules[id]
+	if !ok {
+		return nil, false
+	}
+	return rule.trigger, true
+}
+
+// Len returns the number of indexed triggers.
+func (x *PredicateIndex) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.rules)
+}
+
+// Candidates returns the sorted ids of the triggers that may fire for the record.
+func (x *PredicateIndex) Candidates(record map[string]interface{}) []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	counts := make(map[string]int)
+	for ident, val := range record {
+		sp, ok := x.selectors[ident]
+		if !ok {
+			continue
+		}
+		for _, dim := range []dimension{dimString, dimBoolean} {
+			if key, ok := enumKey(dim, val); ok {
+				for id := range sp.values[valueKey(dim, key)] {
+					counts[id]++
+				}
+			}
+		}
+		if v, ok := toFloat(val); ok {
+			// only the intervals that start at or below the value may contain it
+			n := sort.Search(len(sp.ranges), func(k int) bool { return sp.ranges[k].lo.v > v })
+			for _, i := range sp.ranges[:n] {
+				if i.contains(v) {
+					counts[i.id]++
+				}
+			}
+		}
+		for id, list := range sp.excluded {
+			for _, d := range list {
+				if d.contains(val) {
+					counts[id]++
+				}
+			}
+		}
+	}
+	ids := make([]string, 0, len(x.anywhere)+len(counts))
+	for id := range x.anywhere {
+		ids = append(ids, id)
+	}
+	for id, n := range counts {
+		if n == len(x.rules[id].preds) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
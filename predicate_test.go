@@ -0,0 +1,124 @@
+package geoqlparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPredicateIndex(t *testing.T) {
+	index := NewPredicateIndex()
+	rules := map[string]string{
+		"model":     `when tracker_model eq "ER54x3"`,
+		"speeding":  `when tracker_speed > 80Kph and tracker_coords intersects @zone`,
+		"both":      `when tracker_model == "ER54x3" and (tracker_speed in 10Kph .. 20Kph)`,
+		"models":    `trigger set m=["A", "B"]; when tracker_model in @m or tracker_model == "C"`,
+		"not model": `when tracker_model != "A" and tracker_on == true`,
+		"either":    `when tracker_speed > 100Kph or tracker_temp < 0C`,
+		"other":     `when tracker_speed{"dev2"} > 100Kph and tracker_temp:1 > 1`,
+		"never":     `when tracker_speed > 10 and tracker_speed < 5`,
+		"mph":       `when 50Mph <= tracker_speed`,
+	}
+	for id, s := range rules {
+		stmt, err := Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = index.Add(id, stmt.(*Trigger)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testCases := []struct {
+		name   string
+		record map[string]interface{}
+		want   []string
+	}{
+		{
+			name:   "model and speed",
+			record: map[string]interface{}{"tracker_model": "ER54x3", "tracker_speed": 15, "tracker_on": true},
+			want:   []string{"both", "either", "model", "not model", "other"},
+		},
+		{
+			name:   "fast",
+			record: map[string]interface{}{"tracker_model": "B", "tracker_speed": 120.5},
+			want:   []string{"either", "models", "mph", "other", "speeding"},
+		},
+		{
+			name:   "excluded model",
+			record: map[string]interface{}{"tracker_model": "A", "tracker_on": true},
+			want:   []string{"either", "models", "other"},
+		},
+		{
+			name:   "wrong type",
+			record: map[string]interface{}{"tracker_model": 1, "tracker_speed": "fast"},
+			want:   []string{"either", "other"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if have := index.Candidates(tc.record); !reflect.DeepEqual(have, tc.want) {
+				t.Fatalf("have %v, want %v", have, tc.want)
+			}
+		})
+	}
+
+	index.Remove("model")
+	index.Remove("both")
+	record := map[string]interface{}{"tracker_model": "ER54x3", "tracker_speed": 15}
+	if have, want := index.Candidates(record), []string{"either", "other"}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("have %v, want %v", have, want)
+	}
+	if have := index.Len(); have != 7 {
+		t.Fatalf("have %d, want 7 triggers", have)
+	}
+	if _, ok := index.Get("never"); !ok {
+		t.Fatal("have no trigger, want never")
+	}
+	if err := index.Add("nil", nil); err == nil {
+		t.Fatal("have nil, want error")
+	}
+}
+
+func TestPredicateIndexRanges(t *testing.T) {
+	index := NewPredicateIndex()
+	rules := map[string]string{
+		"neg":     `when tracker_change < -5%`,
+		"negtemp": `when tracker_t < -5C`,
+		"dur":     `when tracker_d > 0s`,
+		"between": `when tracker_change in -20% .. -8%`,
+		"weekend": `when tracker_day in weekday[Sat .. Sun]`,
+		"open":    `when tracker_change > -10% and tracker_change <= 0%`,
+	}
+	for id, s := range rules {
+		stmt, err := Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = index.Add(id, stmt.(*Trigger)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testCases := []struct {
+		record map[string]interface{}
+		want   []string
+	}{
+		{
+			record: map[string]interface{}{"tracker_change": -10.0, "tracker_t": -10.0, "tracker_d": 5},
+			want:   []string{"between", "dur", "neg", "negtemp"},
+		},
+		{record: map[string]interface{}{"tracker_change": -9}, want: []string{"between", "neg", "open"}},
+		{record: map[string]interface{}{"tracker_change": 0}, want: []string{"open"}},
+		{record: map[string]interface{}{"tracker_change": -30, "tracker_day": 6}, want: []string{"neg", "weekend"}},
+		{record: map[string]interface{}{"tracker_day": 0, "tracker_d": 0}, want: []string{"weekend"}},
+	}
+	for _, tc := range testCases {
+		if have := index.Candidates(tc.record); !reflect.DeepEqual(have, tc.want) {
+			t.Fatalf("%v: have %v, want %v", tc.record, have, tc.want)
+		}
+	}
+	index.Remove("neg")
+	index.Remove("between")
+	record := map[string]interface{}{"tracker_change": -9}
+	if have, want := index.Candidates(record), []string{"open"}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("have %v, want %v", have, want)
+	}
+}
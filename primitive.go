@@ -1,13 +1,20 @@
 package geoqlparser
 
 import (
+	"fmt"
 	"strconv"
 	"time"
 )
 
 func (s *parser) parseVarExpr() (expr Expr, err error) {
+	lpos := s.t.Offset()
 	s.next()
-	expr = &Ref{ID: s.t.TokenText(), lpos: s.t.Offset()}
+	if !s.except(SELECTOR) {
+		s.err = fmt.Errorf("invalid variable reference: expected @name")
+		return nil, s.error()
+	}
+	id := s.t.TokenText()
+	expr = &Ref{ID: id, lpos: lpos, rpos: s.t.Offset() + Pos(len(id)) - 1}
 	s.next()
 	return
 }
@@ -25,6 +32,7 @@ func (s *parser) parseStringLit() (expr Expr, err error) {
 
 func (s *parser) parseFloatTypes() (expr Expr, err error) {
 	s.lpos = s.t.Offset()
+	rpos := s.lpos + Pos(len(s.lit)) - 1
 	val, err := strconv.ParseFloat(s.lit, 64)
 	if err != nil {
 		return nil, s.error()
@@ -40,13 +48,14 @@ func (s *parser) parseFloatTypes() (expr Expr, err error) {
 		if s.isSignPlus() || s.isSignMinus() {
 			s.lpos -= 1
 		}
-		expr = &FloatTyp{Val: val, lpos: s.lpos, rpos: s.t.Offset() - 1}
+		expr = &FloatTyp{Val: val, lpos: s.lpos, rpos: rpos}
 	}
 	return
 }
 
 func (s *parser) parseIntTypes() (expr Expr, err error) {
 	s.lpos = s.t.Offset()
+	rpos := s.lpos + Pos(len(s.lit)) - 1
 	intval, err := strconv.Atoi(s.lit)
 	if err != nil {
 		return nil, s.error()
@@ -62,7 +71,7 @@ func (s *parser) parseIntTypes() (expr Expr, err error) {
 		if s.isSignPlus() || s.isSignMinus() {
 			s.lpos -= 1
 		}
-		expr = &IntTyp{Val: intval, lpos: s.lpos, rpos: s.t.Offset() - 1}
+		expr = &IntTyp{Val: intval, lpos: s.lpos, rpos: rpos}
 	}
 	return
 }
@@ -70,19 +79,24 @@ func (s *parser) parseIntTypes() (expr Expr, err error) {
 func (s *parser) parseAllTypes(v float64) (expr Expr, err error) {
 	plit := s.lit
 	s.rpos = s.t.Offset() - 1
+	unitPos := s.t.Offset() + Pos(len(plit))
 	s.next()
 	unit := s.t.TokenText()
 	litlen := Pos(len(plit))
 	switch {
 	case isPercentUnit(unit):
 		if s.isSignMinus() {
-			s.err = errNegativeValue
-			return nil, s.error()
+			v = -v
+			s.lpos -= 1
 		}
 		s.rpos += litlen + 1
 		expr = &PercentTyp{Val: v, lpos: s.lpos, rpos: s.rpos}
 		s.next()
 	case isPressureUnit(unit):
+		if s.isSignMinus() {
+			s.err = errNegativeValue
+			return nil, s.error()
+		}
 		u := unitFromString(s.lit)
 		s.rpos += litlen + u.size()
 		expr = &PressureTyp{Val: v, U: u, lpos: s.lpos, rpos: s.rpos}
@@ -133,11 +147,17 @@ func (s *parser) parseAllTypes(v float64) (expr Expr, err error) {
 			}
 			dur, er := time.ParseDuration(plit + s.lit)
 			if er != nil {
-				return nil, s.error()
+				s.err = fmt.Errorf("invalid duration %s", plit+unit)
+				return nil, s.errorHint(didYouMean(unit, unitSpellings()))
 			}
 			s.rpos = s.lpos + Pos(len(plit+s.lit)-1)
 			expr = &DurationTyp{Val: dur, lpos: s.lpos, rpos: s.rpos}
 			s.next()
+		default:
+			if s.except(SELECTOR) && s.t.Offset() == unitPos {
+				s.err = fmt.Errorf("unknown unit %s", unit)
+				return nil, s.errorHint(didYouMean(unit, unitSpellings()))
+			}
 		}
 	}
 	return
@@ -154,6 +174,7 @@ func (s *parser) parseDistance() (dist *DistanceTyp, err error) {
 		}
 		dist, ok = re.(*DistanceTyp)
 		if !ok {
+			s.err = fmt.Errorf("invalid geometry margin: expected distance")
 			return nil, s.error()
 		}
 	case FLOAT:
@@ -163,20 +184,26 @@ func (s *parser) parseDistance() (dist *DistanceTyp, err error) {
 		}
 		dist, ok = re.(*DistanceTyp)
 		if !ok {
+			s.err = fmt.Errorf("invalid geometry margin: expected distance")
 			return nil, s.error()
 		}
+	default:
+		s.err = fmt.Errorf("invalid geometry margin: expected distance")
+		return nil, s.error()
 	}
 	return
 }
 
 func (s *parser) parseBooleanLit() (expr Expr, err error) {
+	lpos := s.t.Offset()
+	rpos := lpos + Pos(len(s.lit)) - 1
 	switch s.lit {
 	default:
 		return nil, s.error()
 	case "true", "up":
-		expr = &BooleanTyp{Val: true, lpos: s.t.Offset()}
+		expr = &BooleanTyp{Val: true, lpos: lpos, rpos: rpos}
 	case "false", "down":
-		expr = &BooleanTyp{Val: false, lpos: s.t.Offset()}
+		expr = &BooleanTyp{Val: false, lpos: lpos, rpos: rpos}
 	}
 	s.next()
 	return
@@ -0,0 +1,256 @@
+package geoqlparser
+
+import (
+	"fmt"
+	"time"
+)
+
+// PropKind is the kind of the properties of a selector, e.g. the radius
+// of tracker_coords:1km or the resolutions of h3index:1,2.
+type PropKind int
+
+const (
+	PropInt PropKind = iota + 1
+	// PropFloat accepts int and float numbers.
+	PropFloat
+	PropString
+	PropDistance
+	PropDuration
+	PropSpeed
+	PropTemperature
+	PropPressure
+	PropPercent
+)
+
+func (k PropKind) String() (s string) {
+	switch k {
+	case PropInt:
+		s = "int"
+	case PropFloat:
+		s = "number"
+	case PropString:
+		s = "string"
+	case PropDistance:
+		s = "distance"
+	case PropDuration:
+		s = "duration"
+	case PropSpeed:
+		s = "speed"
+	case PropTemperature:
+		s = "temperature"
+	case PropPressure:
+		s = "pressure"
+	case PropPercent:
+		s = "percent"
+	}
+	return
+}
+
+func (k PropKind) dimension() dimension {
+	switch k {
+	case PropInt, PropFloat:
+		return dimNumber
+	case PropDistance:
+		return dimDistance
+	case PropDuration:
+		return dimDuration
+	case PropSpeed:
+		return dimSpeed
+	case PropTemperature:
+		return dimTemperature
+	case PropPressure:
+		return dimPressure
+	case PropPercent:
+		return dimPercent
+	}
+	return dimUnknown
+}
+
+// PropSpec declares the properties a selector accepts.
+type PropSpec struct {
+	Kind PropKind
+	// Min and Max bound the values in the base unit of the kind if Bounded:
+	// meters, seconds, Kph, C and Bar.
+	Min, Max float64
+	Bounded  bool
+	// MaxCount limits the number of properties, zero means no limit.
+	MaxCount int
+}
+
+// Declaration is the declaration of a selector in a Dictionary,
+// either a SelectorType or a SelectorDecl.
+type Declaration interface {
+	declType() SelectorType
+}
+
+func (t SelectorType) declType() SelectorType { return t }
+
+// SelectorDecl declares a selector with properties, e.g. the H3 resolutions of h3index:7,8:
+//
+//	dict["h3index"] = SelectorDecl{Type: Int, Props: PropSpec{Kind: PropInt, Max: 15, Bounded: true}}
+//
+// Properties of a SelectorDecl without a PropSpec are rejected, while the properties
+// of a selector declared with a bare SelectorType are not checked.
+type SelectorDecl struct {
+	Type  SelectorType
+	Props PropSpec
+	// Measure is the kind of the values of a number selector, e.g. PropTemperature.
+	// If set, the amounts of change of delta, rising and falling must be numbers,
+	// percents or of the kind.
+	Measure PropKind
+}
+
+func (d SelectorDecl) declType() SelectorType { return d.Type }
+
+// propValue returns the value of the property in the base unit of the kind.
+func propValue(kind PropKind, expr Expr) (float64, bool) {
+	switch typ := expr.(type) {
+	case *IntTyp:
+		if kind == PropInt {
+			return float64(typ.Val), true
+		}
+	case *FloatTyp:
+		if kind == PropInt {
+			return 0, false
+		}
+	case *StringTyp:
+		return 0, kind == PropString
+	}
+	val, dim, ok := baseValue(expr)
+	return val, ok && dim != dimUnknown && dim == kind.dimension()
+}
+
+func (tc *checker) checkProps(e *Selector) error {
+	if len(e.Props) == 0 {
+		return nil
+	}
+	decl, ok := tc.dict[e.Ident].(SelectorDecl)
+	if !ok {
+		return nil
+	}
+	spec := decl.Props
+	if spec.Kind == 0 {
+		return fmt.Errorf("invalid selector %s: properties are not allowed", formatExpr(e))
+	}
+	if spec.MaxCount > 0 && len(e.Props) > spec.MaxCount {
+		return fmt.Errorf("invalid selector %s: got %d properties, expected at most %d",
+			formatExpr(e), len(e.Props), spec.MaxCount)
+	}
+	for _, prop := range e.Props {
+		expr := prop
+		if ref, isRef := prop.(*Ref); isRef {
+			assign, err := tc.trigger.findAssign(ref.ID)
+			if err != nil {
+				return err
+			}
+			expr = assign.Right
+		}
+		val, ok := propValue(spec.Kind, expr)
+		if !ok {
+			return fmt.Errorf("invalid selector %s: property %s is not %s",
+				formatExpr(e), formatExpr(prop), spec.Kind)
+		}
+		if spec.Bounded && (val < spec.Min || val > spec.Max) {
+			return fmt.Errorf("invalid selector %s: property %s is out of range %v .. %v",
+				formatExpr(e), formatExpr(prop), spec.Min, spec.Max)
+		}
+	}
+	return nil
+}
+
+// props returns the properties of the selector with the references to
+// variables replaced by their values in the trigger.
+func (e *Selector) props(t *Trigger) ([]Expr, bool) {
+	props := make([]Expr, len(e.Props))
+	for i, prop := range e.Props {
+		if ref, ok := prop.(*Ref); ok {
+			if t == nil {
+				return nil, false
+			}
+			assign, err := t.findAssign(ref.ID)
+			if err != nil {
+				return nil, false
+			}
+			prop = assign.Right
+		}
+		props[i] = prop
+	}
+	return props, true
+}
+
+func (e *Selector) propValues(t *Trigger, kind PropKind) ([]float64, bool) {
+	props, ok := e.props(t)
+	if !ok {
+		return nil, false
+	}
+	vals := make([]float64, len(props))
+	for i, prop := range props {
+		val, ok := propValue(kind, prop)
+		if !ok {
+			return nil, false
+		}
+		vals[i] = val
+	}
+	return vals, true
+}
+
+// IntProps returns the int properties of the selector, e.g. 1 and 2 of h3index:1,2.
+// References to variables are resolved in the trigger of the selector, which may be nil
+// if there are none. It reports false if a property is not an int.
+func (e *Selector) IntProps(t *Trigger) ([]int, bool) {
+	vals, ok := e.propValues(t, PropInt)
+	if !ok {
+		return nil, false
+	}
+	ints := make([]int, len(vals))
+	for i, val := range vals {
+		ints[i] = int(val)
+	}
+	return ints, true
+}
+
+// StringProps returns the string properties of the selector, resolving references
+// like IntProps. It reports false if a property is not a string.
+func (e *Selector) StringProps(t *Trigger) ([]string, bool) {
+	props, ok := e.props(t)
+	if !ok {
+		return nil, false
+	}
+	strs := make([]string, len(props))
+	for i, prop := range props {
+		str, ok := prop.(*StringTyp)
+		if !ok {
+			return nil, false
+		}
+		strs[i] = str.Val
+	}
+	return strs, true
+}
+
+// DurationProps returns the duration properties of the selector, resolving references
+// like IntProps. It reports false if a property is not a duration.
+func (e *Selector) DurationProps(t *Trigger) ([]time.Duration, bool) {
+	props, ok := e.props(t)
+	if !ok {
+		return nil, false
+	}
+	durs := make([]time.Duration, len(props))
+	for i, prop := range props {
+		dur, ok := prop.(*DurationTyp)
+		if !ok {
+			return nil, false
+		}
+		durs[i] = dur.Val
+	}
+	return durs, true
+}
+
+// PropValues returns the properties of the selector of the kind in its base unit,
+// e.g. the radiuses of tracker_coords:1km,500M in meters, resolving references
+// like IntProps. It reports false if a property is not of the kind.
+func (e *Selector) PropValues(t *Trigger, kind PropKind) ([]float64, bool) {
+	if kind == PropString {
+		return nil, false
+	}
+	return e.propValues(t, kind)
+}
@@ -0,0 +1,121 @@
+package geoqlparser
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckProps(t *testing.T) {
+	dict := Dict()
+	dict["s_coords"] = SelectorDecl{Type: Geometry, Props: PropSpec{Kind: PropDistance, Max: 10000, Bounded: true, MaxCount: 2}}
+	dict["s_h3"] = SelectorDecl{Type: Int, Props: PropSpec{Kind: PropInt, Max: 15, Bounded: true}}
+	dict["s_zero"] = SelectorDecl{Type: Int, Props: PropSpec{Kind: PropInt, Bounded: true}}
+	dict["s_speed"] = SelectorDecl{Type: Float}
+	dict["s_any"] = Float
+	dict["s_avg"] = SelectorDecl{Type: Float, Props: PropSpec{Kind: PropFloat}}
+	testCases := []struct {
+		name string
+		s    string
+		err  bool
+	}{
+		{name: "distances", s: `when s_coords{*}:1km,500M intersects point[1, 1]`},
+		{name: "ints", s: `when s_h3:0,15 in [1, 2]`},
+		{name: "numbers", s: `when s_avg:1,2.5 > 1`},
+		{name: "variable", s: `trigger set r=2km; when s_coords:@r intersects point[1, 1]`},
+		{name: "not declared props", s: `when s_any:1,"a" > 1`},
+		{name: "without props", s: `when s_speed > 1 and s_coords intersects point[1, 1]`},
+		{name: "props not allowed", s: `when s_speed:1 > 1`, err: true},
+		{name: "too many", s: `when s_coords:1km,2km,3km intersects point[1, 1]`, err: true},
+		{name: "wrong kind", s: `when s_coords:1 intersects point[1, 1]`, err: true},
+		{name: "float is not int", s: `when s_h3:1.5 in [1, 2]`, err: true},
+		{name: "out of range", s: `when s_h3:16 in [1, 2]`, err: true},
+		{name: "distance out of range", s: `when s_coords:11km intersects point[1, 1]`, err: true},
+		{name: "variable of wrong kind", s: `trigger set r=2; when s_coords:@r intersects point[1, 1]`, err: true},
+		{name: "in function", s: `when abs(s_speed:1) > 1`, err: true},
+		{name: "in history", s: `when changed(s_h3:20)`, err: true},
+		{name: "zero range", s: `when s_zero:0 > 1`},
+		{name: "out of zero range", s: `when s_zero:1 > 1`, err: true},
+		{name: "not bounded", s: `when s_avg:-1000000,1000000.5 > 1`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := Parse(tc.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = CheckType(stmt, dict)
+			if have, want := err != nil, tc.err; have != want {
+				t.Fatalf("have %v, want error %v", err, want)
+			}
+		})
+	}
+}
+
+func TestSelectorProps(t *testing.T) {
+	selector := func(s string) *Selector {
+		stmt, err := Parse(`when ` + s + ` > 1`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stmt.(*Trigger).When.(*BinaryExpr).Left.(*Selector)
+	}
+	if have, ok := selector(`h3index:1,2`).IntProps(nil); !ok || !reflect.DeepEqual(have, []int{1, 2}) {
+		t.Fatalf("have %v %v, want [1 2]", have, ok)
+	}
+	if _, ok := selector(`h3index:1,2.5`).IntProps(nil); ok {
+		t.Fatal("have ok, want float to be rejected")
+	}
+	if have, ok := selector(`coords{*}:1km,500M`).PropValues(nil, PropDistance); !ok || !reflect.DeepEqual(have, []float64{1000, 500}) {
+		t.Fatalf("have %v %v, want [1000 500]", have, ok)
+	}
+	if have, ok := selector(`coords:1,2.5`).PropValues(nil, PropFloat); !ok || !reflect.DeepEqual(have, []float64{1, 2.5}) {
+		t.Fatalf("have %v %v, want [1 2.5]", have, ok)
+	}
+	if _, ok := selector(`coords:1km,@r`).PropValues(nil, PropDistance); ok {
+		t.Fatal("have ok, want variable without trigger to be rejected")
+	}
+	if have, ok := selector(`temp:5m,1h`).DurationProps(nil); !ok || !reflect.DeepEqual(have, []time.Duration{5 * time.Minute, time.Hour}) {
+		t.Fatalf("have %v %v, want [5m 1h]", have, ok)
+	}
+	if have, ok := selector(`model:"a","b"`).StringProps(nil); !ok || !reflect.DeepEqual(have, []string{"a", "b"}) {
+		t.Fatalf("have %v %v, want [a b]", have, ok)
+	}
+	if have, ok := selector(`model`).StringProps(nil); !ok || len(have) != 0 {
+		t.Fatalf("have %v %v, want no props", have, ok)
+	}
+}
+
+func TestSelectorPropsResolveVariables(t *testing.T) {
+	selector := func(s string) (*Trigger, *Selector) {
+		stmt, err := Parse(`trigger set r=500M; res=7; model="a"; d=5m; when ` + s + ` > 1`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trigger := stmt.(*Trigger)
+		return trigger, trigger.When.(*BinaryExpr).Left.(*Selector)
+	}
+	trigger, sel := selector(`tracker_coords:1km,@r`)
+	if have, ok := sel.PropValues(trigger, PropDistance); !ok || !reflect.DeepEqual(have, []float64{1000, 500}) {
+		t.Fatalf("have %v %v, want [1000 500]", have, ok)
+	}
+	trigger, sel = selector(`h3index:@res`)
+	if have, ok := sel.IntProps(trigger); !ok || !reflect.DeepEqual(have, []int{7}) {
+		t.Fatalf("have %v %v, want [7]", have, ok)
+	}
+	if _, ok := sel.StringProps(trigger); ok {
+		t.Fatal("have ok, want int variable to be rejected as a string")
+	}
+	trigger, sel = selector(`model:@model`)
+	if have, ok := sel.StringProps(trigger); !ok || !reflect.DeepEqual(have, []string{"a"}) {
+		t.Fatalf("have %v %v, want [a]", have, ok)
+	}
+	trigger, sel = selector(`temp:@d`)
+	if have, ok := sel.DurationProps(trigger); !ok || !reflect.DeepEqual(have, []time.Duration{5 * time.Minute}) {
+		t.Fatalf("have %v %v, want [5m]", have, ok)
+	}
+	trigger, sel = selector(`h3index:@missing`)
+	if _, ok := sel.IntProps(trigger); ok {
+		t.Fatal("have ok, want unknown variable to be rejected")
+	}
+}
@@ -0,0 +1,1186 @@
+package geoqlparser
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// MarshalProto encodes the trigger as a Trigger message of geoql.proto
+// in the Protocol Buffers wire format.
+func MarshalProto(t *Trigger) ([]byte, error) {
+	w := &protoWriter{}
+	w.trigger(t)
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w.buf, nil
+}
+
+// UnmarshalProto decodes a Trigger message of geoql.proto encoded by MarshalProto
+// or by any other Protocol Buffers implementation. Unknown fields are skipped.
+func UnmarshalProto(data []byte) (*Trigger, error) {
+	r := &protoReader{buf: data}
+	t := r.trigger()
+	if r.err != nil {
+		return nil, fmt.Errorf("geoql: invalid proto: %w", r.err)
+	}
+	return t, nil
+}
+
+// protoTokens are the values of the Token enum of geoql.proto.
+var protoTokens = []Token{
+	ILLEGAL,
+	INT, FLOAT, STRING, SPEED, TIME, DATE, WEEKDAY, MONTH, DURATION, TEMPERATURE,
+	PRESSURE, DISTANCE, PERCENT, IDENT, RANGE, BOOLEAN, SELECTOR,
+	GEOMETRY_POINT, GEOMETRY_LINE, GEOMETRY_POLYGON, GEOMETRY_MULTILINE,
+	GEOMETRY_MULTIPOINT, GEOMETRY_MULTIPOLYGON, GEOMETRY_COLLECTION,
+	H3, GEOHASH, S2,
+	QUO, MUL, SUB, ADD, REM,
+	GEQ, LEQ, GTR, LSS, AND, OR, IN, NOT_IN, EQL, LEQL, NEARBY, INTERSECTS,
+	NOT_EQ, NOT_NEARBY, LNEQ, NOT_INTERSECTS, NOT, XOR, FOR, ENTERS, EXITS,
+	DWELLS, ANY, ALL,
+}
+
+var protoTokenValues = func() map[Token]uint64 {
+	m := make(map[Token]uint64, len(protoTokens))
+	for i, tok := range protoTokens {
+		m[tok] = uint64(i)
+	}
+	return m
+}()
+
+// Wire types of the Protocol Buffers encoding.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+type protoWriter struct {
+	buf []byte
+	err error
+}
+
+func (w *protoWriter) uvarint(v uint64) {
+	for v >= 0x80 {
+		w.buf = append(w.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	w.buf = append(w.buf, byte(v))
+}
+
+func (w *protoWriter) key(field, wire int) {
+	w.uvarint(uint64(field)<<3 | uint64(wire))
+}
+
+// int writes a varint field, zero values are omitted as in proto3.
+func (w *protoWriter) int(field int, v int64) {
+	if v != 0 {
+		w.key(field, wireVarint)
+		w.uvarint(uint64(v))
+	}
+}
+
+func (w *protoWriter) bool(field int, v bool) {
+	if v {
+		w.int(field, 1)
+	}
+}
+
+func (w *protoWriter) double(field int, v float64) {
+	bits := math.Float64bits(v)
+	if bits == 0 {
+		return
+	}
+	w.key(field, wireFixed64)
+	for i := 0; i < 8; i++ {
+		w.buf = append(w.buf, byte(bits>>(8*i)))
+	}
+}
+
+func (w *protoWriter) bytes(field int, b []byte) {
+	w.key(field, wireBytes)
+	w.uvarint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *protoWriter) string(field int, s string) {
+	if s != "" {
+		w.bytes(field, []byte(s))
+	}
+}
+
+func (w *protoWriter) strings(field int, set map[string]struct{}) {
+	for _, s := range sortedKeys(set) {
+		w.bytes(field, []byte(s))
+	}
+}
+
+func (w *protoWriter) token(field int, tok Token) {
+	v, ok := protoTokenValues[tok]
+	if !ok {
+		w.fail(fmt.Errorf("geoql: cannot encode token %s", KeywordString(tok)))
+		return
+	}
+	w.int(field, int64(v))
+}
+
+func (w *protoWriter) fail(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// message writes an embedded message, it is written even if empty.
+func (w *protoWriter) message(field int, fn func(w *protoWriter)) {
+	sub := &protoWriter{}
+	fn(sub)
+	if sub.err != nil {
+		w.fail(sub.err)
+	}
+	w.bytes(field, sub.buf)
+}
+
+func (w *protoWriter) comments(field int, g *CommentGroup) {
+	if g == nil {
+		return
+	}
+	w.message(field, func(w *protoWriter) {
+		for _, c := range g.List {
+			w.message(1, func(w *protoWriter) {
+				w.string(1, c.Text)
+				w.int(2, int64(c.lpos))
+				w.int(3, int64(c.rpos))
+				w.bool(4, c.trailing)
+			})
+		}
+	})
+}
+
+func (w *protoWriter) trigger(t *Trigger) {
+	w.comments(1, t.Doc)
+	w.comments(2, t.SetDoc)
+	for _, v := range t.Vars {
+		v := v
+		w.message(3, func(w *protoWriter) {
+			w.comments(1, v.Doc)
+			w.message(2, func(w *protoWriter) {
+				w.string(1, v.Left.Val)
+				w.int(2, int64(v.Left.lpos))
+				w.int(3, int64(v.Left.rpos))
+			})
+			w.expr(3, v.Right)
+			w.comments(4, v.Comment)
+			w.int(5, int64(v.TokPos))
+		})
+	}
+	w.comments(4, t.WhenDoc)
+	w.expr(5, t.When)
+	w.comments(6, t.WhenComment)
+	w.comments(7, t.RepeatDoc)
+	w.expr(8, t.RepeatCount)
+	w.expr(9, t.RepeatInterval)
+	w.comments(10, t.ResetDoc)
+	w.expr(11, t.ResetAfter)
+	w.comments(12, t.Comment)
+	w.int(13, int64(t.lpos))
+	w.int(14, int64(t.rpos))
+	w.comments(15, t.RepeatComment)
+	w.comments(16, t.ResetComment)
+}
+
+func (w *protoWriter) exprs(field int, list []Expr) {
+	for _, expr := range list {
+		if expr == nil {
+			w.fail(errors.New("geoql: cannot encode nil expression"))
+			continue
+		}
+		w.expr(field, expr)
+	}
+}
+
+func (w *protoWriter) coord(field int, p [2]float64) {
+	w.message(field, func(w *protoWriter) {
+		w.double(1, p[0])
+		w.double(2, p[1])
+	})
+}
+
+func (w *protoWriter) coords(field int, points [][2]float64) {
+	for _, p := range points {
+		w.coord(field, p)
+	}
+}
+
+// expr writes an Expr message, nil expressions are omitted.
+func (w *protoWriter) expr(field int, expr Expr) {
+	if expr == nil {
+		return
+	}
+	if d, ok := expr.(*DurationTyp); ok && d == nil {
+		return
+	}
+	w.message(field, func(w *protoWriter) {
+		w.int(1, int64(expr.Pos()))
+		w.int(2, int64(expr.End()))
+		w.node(expr)
+	})
+}
+
+func (w *protoWriter) node(expr Expr) {
+	switch typ := expr.(type) {
+	case *BinaryExpr:
+		w.message(3, func(w *protoWriter) {
+			w.token(1, typ.Op)
+			w.expr(2, typ.Left)
+			w.expr(3, typ.Right)
+			w.comments(4, typ.Comment)
+			w.int(5, int64(typ.OpPos))
+		})
+	case *UnaryExpr:
+		w.message(4, func(w *protoWriter) {
+			w.token(1, typ.Op)
+			w.expr(2, typ.X)
+			w.int(3, int64(typ.OpPos))
+		})
+	case *ParenExpr:
+		w.message(5, func(w *protoWriter) { w.expr(1, typ.Expr) })
+	case *CallExpr:
+		w.message(6, func(w *protoWriter) {
+			w.string(1, typ.Func)
+			w.exprs(2, typ.Args)
+		})
+	case *WindowExpr:
+		w.message(7, func(w *protoWriter) {
+			w.string(1, typ.Func)
+			w.expr(2, typ.X)
+			w.expr(3, typ.Window)
+		})
+	case *HistoryExpr:
+		w.message(8, func(w *protoWriter) {
+			w.string(1, typ.Func)
+			w.expr(2, typ.X)
+			if typ.Amount != nil {
+				w.expr(3, typ.Amount)
+				w.expr(4, typ.Within)
+			}
+		})
+	case *Selector:
+		w.message(9, func(w *protoWriter) {
+			w.string(1, typ.Ident)
+			w.strings(2, typ.Args)
+			w.strings(3, typ.Groups)
+			w.strings(4, typ.Tags)
+			w.bool(5, typ.Wildcard)
+			w.token(6, typ.Quantifier)
+			w.exprs(7, typ.Props)
+		})
+	case *WildcardTyp:
+		w.message(10, func(w *protoWriter) {})
+	case *BooleanTyp:
+		w.message(11, func(w *protoWriter) { w.bool(1, typ.Val) })
+	case *IntTyp:
+		w.message(12, func(w *protoWriter) { w.int(1, int64(typ.Val)) })
+	case *FloatTyp:
+		w.message(13, func(w *protoWriter) { w.double(1, typ.Val) })
+	case *StringTyp:
+		w.message(14, func(w *protoWriter) { w.string(1, typ.Val) })
+	case *PercentTyp:
+		w.message(15, func(w *protoWriter) { w.double(1, typ.Val) })
+	case *DurationTyp:
+		w.message(16, func(w *protoWriter) { w.int(1, int64(typ.Val)) })
+	case *TemperatureTyp:
+		w.message(17, func(w *protoWriter) {
+			w.double(1, typ.Val)
+			w.int(2, int64(typ.U))
+			w.int(3, int64(typ.Vec))
+		})
+	case *PressureTyp:
+		w.message(18, func(w *protoWriter) {
+			w.double(1, typ.Val)
+			w.int(2, int64(typ.U))
+		})
+	case *DistanceTyp:
+		w.message(19, func(w *protoWriter) {
+			w.double(1, typ.Val)
+			w.int(2, int64(typ.U))
+		})
+	case *SpeedTyp:
+		w.message(20, func(w *protoWriter) {
+			w.double(1, typ.Val)
+			w.int(2, int64(typ.U))
+		})
+	case *TimeTyp:
+		w.message(21, func(w *protoWriter) {
+			w.int(1, int64(typ.Hours))
+			w.int(2, int64(typ.Minutes))
+			w.int(3, int64(typ.Seconds))
+			w.int(4, int64(typ.U))
+		})
+	case *DateTyp:
+		w.message(22, func(w *protoWriter) {
+			w.int(1, int64(typ.Year))
+			w.int(2, int64(typ.Month))
+			w.int(3, int64(typ.Day))
+		})
+	case *WeekdayTyp:
+		w.message(23, func(w *protoWriter) { w.int(1, int64(typ.Val)) })
+	case *MonthTyp:
+		w.message(24, func(w *protoWriter) { w.int(1, int64(typ.Val)) })
+	case *CellTyp:
+		w.message(25, func(w *protoWriter) {
+			w.token(1, typ.Kind)
+			w.string(2, typ.Val)
+		})
+	case *Ref:
+		w.message(26, func(w *protoWriter) { w.string(1, typ.ID) })
+	case *Range:
+		w.message(27, func(w *protoWriter) {
+			w.expr(1, typ.Low)
+			w.expr(2, typ.High)
+		})
+	case *ArrayTyp:
+		w.message(28, func(w *protoWriter) {
+			w.token(1, typ.Kind)
+			w.exprs(2, typ.List)
+		})
+	case *GeometryPointTyp:
+		w.message(29, func(w *protoWriter) {
+			w.coord(1, typ.Val)
+			if typ.Radius != nil {
+				w.expr(2, typ.Radius)
+			}
+		})
+	case *GeometryLineTyp:
+		w.message(30, func(w *protoWriter) {
+			w.coords(1, typ.Val)
+			if typ.Margin != nil {
+				w.expr(2, typ.Margin)
+			}
+		})
+	case *GeometryPolygonTyp:
+		w.message(31, func(w *protoWriter) {
+			for _, ring := range typ.Val {
+				ring := ring
+				w.message(1, func(w *protoWriter) { w.coords(1, ring) })
+			}
+		})
+	case *GeometryMultiObjectTyp:
+		w.message(32, func(w *protoWriter) {
+			w.token(1, typ.Kind)
+			w.exprs(2, typ.Val)
+		})
+	case *GeometryCollectionTyp:
+		w.message(33, func(w *protoWriter) { w.exprs(1, typ.Objects) })
+	default:
+		w.fail(fmt.Errorf("geoql: cannot encode %T", expr))
+	}
+}
+
+type protoReader struct {
+	buf  []byte
+	wire int
+	err  error
+}
+
+func (r *protoReader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf(format, args...)
+	}
+	r.buf = nil
+}
+
+func (r *protoReader) uvarint() uint64 {
+	var v uint64
+	for i := 0; i < 10; i++ {
+		if i >= len(r.buf) {
+			break
+		}
+		b := r.buf[i]
+		v |= uint64(b&0x7f) << (7 * i)
+		if b < 0x80 {
+			r.buf = r.buf[i+1:]
+			return v
+		}
+	}
+	r.fail("malformed varint")
+	return 0
+}
+
+// next reads the key of the next field and reports false at the end of the message.
+func (r *protoReader) next() (int, bool) {
+	if len(r.buf) == 0 || r.err != nil {
+		return 0, false
+	}
+	key := r.uvarint()
+	field := int(key >> 3)
+	r.wire = int(key & 7)
+	if field == 0 {
+		r.fail("invalid field number 0")
+		return 0, false
+	}
+	return field, r.err == nil
+}
+
+func (r *protoReader) expect(wire int) bool {
+	if r.wire != wire {
+		r.fail("unexpected wire type %d, want %d", r.wire, wire)
+		return false
+	}
+	return true
+}
+
+func (r *protoReader) int() int64 {
+	if !r.expect(wireVarint) {
+		return 0
+	}
+	return int64(r.uvarint())
+}
+
+func (r *protoReader) pos() Pos {
+	return Pos(r.int())
+}
+
+func (r *protoReader) bool() bool {
+	return r.int() != 0
+}
+
+func (r *protoReader) double() float64 {
+	if !r.expect(wireFixed64) {
+		return 0
+	}
+	if len(r.buf) < 8 {
+		r.fail("unexpected end of fixed64")
+		return 0
+	}
+	var bits uint64
+	for i := 0; i < 8; i++ {
+		bits |= uint64(r.buf[i]) << (8 * i)
+	}
+	r.buf = r.buf[8:]
+	return math.Float64frombits(bits)
+}
+
+func (r *protoReader) bytes() []byte {
+	if !r.expect(wireBytes) {
+		return nil
+	}
+	n := r.uvarint()
+	if n > uint64(len(r.buf)) {
+		r.fail("unexpected end of length-delimited field")
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *protoReader) string() string {
+	return string(r.bytes())
+}
+
+func (r *protoReader) token() Token {
+	v := r.int()
+	if v < 0 || v >= int64(len(protoTokens)) {
+		r.fail("unknown token %d", v)
+		return ILLEGAL
+	}
+	return protoTokens[v]
+}
+
+func (r *protoReader) skip() {
+	switch r.wire {
+	case wireVarint:
+		r.uvarint()
+	case wireFixed64:
+		r.double()
+	case wireBytes:
+		r.bytes()
+	case wireFixed32:
+		if len(r.buf) < 4 {
+			r.fail("unexpected end of fixed32")
+			return
+		}
+		r.buf = r.buf[4:]
+	default:
+		r.fail("unsupported wire type %d", r.wire)
+	}
+}
+
+// message reads an embedded message with fn called for each of its fields.
+func (r *protoReader) message(fn func(r *protoReader, field int)) {
+	sub := &protoReader{buf: r.bytes()}
+	if r.err != nil {
+		return
+	}
+	for field, ok := sub.next(); ok; field, ok = sub.next() {
+		fn(sub, field)
+	}
+	if sub.err != nil {
+		r.fail("%v", sub.err)
+	}
+}
+
+func (r *protoReader) comments() *CommentGroup {
+	g := &CommentGroup{}
+	r.message(func(r *protoReader, field int) {
+		if field != 1 {
+			r.skip()
+			return
+		}
+		c := &Comment{}
+		r.message(func(r *protoReader, field int) {
+			switch field {
+			case 1:
+				c.Text = r.string()
+			case 2:
+				c.lpos = r.pos()
+			case 3:
+				c.rpos = r.pos()
+			case 4:
+				c.trailing = r.bool()
+			default:
+				r.skip()
+			}
+		})
+		g.List = append(g.List, c)
+	})
+	if len(g.List) == 0 {
+		return nil
+	}
+	return g
+}
+
+func (r *protoReader) trigger() *Trigger {
+	t := &Trigger{}
+	for field, ok := r.next(); ok; field, ok = r.next() {
+		switch field {
+		case 1:
+			t.Doc = r.comments()
+		case 2:
+			t.SetDoc = r.comments()
+		case 3:
+			t.initVars()
+			if v := r.assign(); v != nil {
+				if err := t.SetVar(v); err != nil {
+					r.fail("%v", err)
+				}
+			}
+		case 4:
+			t.WhenDoc = r.comments()
+		case 5:
+			t.When = r.expr()
+		case 6:
+			t.WhenComment = r.comments()
+		case 7:
+			t.RepeatDoc = r.comments()
+		case 8:
+			t.RepeatCount = r.expr()
+		case 9:
+			t.RepeatInterval = r.expr()
+		case 10:
+			t.ResetDoc = r.comments()
+		case 11:
+			t.ResetAfter = r.expr()
+		case 12:
+			t.Comment = r.comments()
+		case 13:
+			t.lpos = r.pos()
+		case 14:
+			t.rpos = r.pos()
+		case 15:
+			t.RepeatComment = r.comments()
+		case 16:
+			t.ResetComment = r.comments()
+		default:
+			r.skip()
+		}
+	}
+	if r.err == nil && t.When == nil {
+		r.fail("trigger without when")
+	}
+	return t
+}
+
+func (r *protoReader) assign() *Assign {
+	v := &Assign{Left: &Ident{}}
+	r.message(func(r *protoReader, field int) {
+		switch field {
+		case 1:
+			v.Doc = r.comments()
+		case 2:
+			r.message(func(r *protoReader, field int) {
+				switch field {
+				case 1:
+					v.Left.Val = r.string()
+				case 2:
+					v.Left.lpos = r.pos()
+				case 3:
+					v.Left.rpos = r.pos()
+				default:
+					r.skip()
+				}
+			})
+		case 3:
+			v.Right = r.expr()
+		case 4:
+			v.Comment = r.comments()
+		case 5:
+			v.TokPos = r.pos()
+		default:
+			r.skip()
+		}
+	})
+	if r.err == nil && (v.Left.Val == "" || v.Right == nil) {
+		r.fail("incomplete variable %q", v.Left.Val)
+	}
+	return v
+}
+
+// expr reads an Expr message, it fails if the message has no node.
+func (r *protoReader) expr() Expr {
+	var expr Expr
+	var lpos, rpos Pos
+	r.message(func(r *protoReader, field int) {
+		switch field {
+		case 1:
+			lpos = r.pos()
+		case 2:
+			rpos = r.pos()
+		default:
+			if field > 2 && field <= 33 {
+				expr = r.node(field)
+				return
+			}
+			r.skip()
+		}
+	})
+	if r.err != nil {
+		return nil
+	}
+	if expr == nil {
+		r.fail("expression without node")
+		return nil
+	}
+	setSpan(expr, lpos, rpos)
+	return expr
+}
+
+func (r *protoReader) exprOf(typ string, ok func(Expr) bool) Expr {
+	expr := r.expr()
+	if expr != nil && !ok(expr) {
+		r.fail("got %s, want %s", formatExpr(expr), typ)
+		return nil
+	}
+	return expr
+}
+
+func (r *protoReader) duration() *DurationTyp {
+	expr := r.exprOf("duration", func(e Expr) bool { _, ok := e.(*DurationTyp); return ok })
+	d, _ := expr.(*DurationTyp)
+	return d
+}
+
+func (r *protoReader) distance() *DistanceTyp {
+	expr := r.exprOf("distance", func(e Expr) bool { _, ok := e.(*DistanceTyp); return ok })
+	d, _ := expr.(*DistanceTyp)
+	return d
+}
+
+func (r *protoReader) coord() (p [2]float64) {
+	r.message(func(r *protoReader, field int) {
+		switch field {
+		case 1:
+			p[0] = r.double()
+		case 2:
+			p[1] = r.double()
+		default:
+			r.skip()
+		}
+	})
+	return
+}
+
+func (r *protoReader) set(m *map[string]struct{}) {
+	if *m == nil {
+		*m = make(map[string]struct{})
+	}
+	(*m)[r.string()] = struct{}{}
+}
+
+func (r *protoReader) node(field int) Expr {
+	switch field {
+	case 3:
+		e := &BinaryExpr{}
+		r.message(func(r *protoReader, field int) {
+			switch field {
+			case 1:
+				e.Op = r.token()
+			case 2:
+				e.Left = r.expr()
+			case 3:
+				e.Right = r.expr()
+			case 4:
+				e.Comment = r.comments()
+			case 5:
+				e.OpPos = r.pos()
+			default:
+				r.skip()
+			}
+		})
+		if e.Left == nil || e.Right == nil {
+			r.fail("incomplete binary expression")
+		}
+		return e
+	case 4:
+		e := &UnaryExpr{}
+		r.message(func(r *protoReader, field int) {
+			switch field {
+			case 1:
+				e.Op = r.token()
+			case 2:
+				e.X = r.expr()
+			case 3:
+				e.OpPos = r.pos()
+			default:
+				r.skip()
+			}
+		})
+		if e.X == nil {
+			r.fail("incomplete unary expression")
+		}
+		return e
+	case 5:
+		e := &ParenExpr{}
+		r.message(func(r *protoReader, field int) {
+			if field == 1 {
+				e.Expr = r.expr()
+				return
+			}
+			r.skip()
+		})
+		if e.Expr == nil {
+			r.fail("incomplete parenthesized expression")
+		}
+		return e
+	case 6:
+		e := &CallExpr{}
+		r.message(func(r *protoReader, field int) {
+			switch field {
+			case 1:
+				e.Func = r.string()
+			case 2:
+				e.Args = append(e.Args, r.expr())
+			default:
+				r.skip()
+			}
+		})
+		return e
+	case 7:
+		e := &WindowExpr{}
+		r.message(func(r *protoReader, field int) {
+			switch field {
+			case 1:
+				e.Func = r.string()
+			case 2:
+				e.X = r.expr()
+			case 3:
+				e.Window = r.duration()
+			default:
+				r.skip()
+			}
+		})
+		if e.X == nil || e.Window == nil {
+			r.fail("incomplete window %s", e.Func)
+		}
+		return e
+	case 8:
+		e := &HistoryExpr{}
+		r.message(func(r *protoReader, field int) {
+			switch field {
+			case 1:
+				e.Func = r.string()
+			case 2:
+				x := r.exprOf("selector", func(e Expr) bool { _, ok := e.(*Selector); return ok })
+				e.X, _ = x.(*Selector)
+			case 3:
+				e.Amount = r.expr()
+			case 4:
+				e.Within = r.duration()
+			default:
+				r.skip()
+			}
+		})
+		if e.X == nil || (e.Amount == nil) != (e.Within == nil) {
+			r.fail("incomplete history %s", e.Func)
+		}
+		return e
+	case 9:
+		e := &Selector{}
+		r.message(func(r *protoReader, field int) {
+			switch field {
+			case 1:
+				e.Ident = r.string()
+			case 2:
+				r.set(&e.Args)
+			case 3:
+				r.set(&e.Groups)
+			case 4:
+				r.set(&e.Tags)
+			case 5:
+				e.Wildcard = r.bool()
+			case 6:
+				e.Quantifier = r.token()
+			case 7:
+				e.Props = append(e.Props, r.expr())
+			default:
+				r.skip()
+			}
+		})
+		return e
+	case 10:
+		r.message(func(r *protoReader, _ int) { r.skip() })
+		return &WildcardTyp{}
+	case 11:
+		e := &BooleanTyp{}
+		r.message(func(r *protoReader, field int) {
+			if field == 1 {
+				e.Val = r.bool()
+				return
+			}
+			r.skip()
+		})
+		return e
+	case 12:
+		e := &IntTyp{}
+		r.message(func(r *protoReader, field int) {
+			if field == 1 {
+				e.Val = int(r.int())
+				return
+			}
+			r.skip()
+		})
+		return e
+	case 13:
+		e := &FloatTyp{}
+		r.message(func(r *protoReader, field int) {
+			if field == 1 {
+				e.Val = r.double()
+				return
+			}
+			r.skip()
+		})
+		return e
+	case 14:
+		e := &StringTyp{}
+		r.message(func(r *protoReader, field int) {
+			if field == 1 {
+				e.Val = r.string()
+				return
+			}
+			r.skip()
+		})
+		return e
+	case 15:
+		e := &PercentTyp{}
+		r.message(func(r *protoReader, field int) {
+			if field == 1 {
+				e.Val = r.double()
+				return
+			}
+			r.skip()
+		})
+		return e
+	case 16:
+		e := &DurationTyp{}
+		r.message(func(r *protoReader, field int) {
+			if field == 1 {
+				e.Val = time.Duration(r.int())
+				return
+			}
+			r.skip()
+		})
+		return e
+	case 17:
+		e := &TemperatureTyp{}
+		r.message(func(r *protoReader, field int) {
+			switch field {
+			case 1:
+				e.Val = r.double()
+			case 2:
+				e.U = Unit(r.int())
+			case 3:
+				e.Vec = Sign(r.int())
+			default:
+				r.skip()
+			}
+		})
+		return e
+	case 18:
+		e := &PressureTyp{}
+		r.message(func(r *protoReader, field int) { e.Val, e.U = r.measure(field, e.Val, e.U) })
+		return e
+	case 19:
+		e := &DistanceTyp{}
+		r.message(func(r *protoReader, field int) { e.Val, e.U = r.measure(field, e.Val, e.U) })
+		return e
+	case 20:
+		e := &SpeedTyp{}
+		r.message(func(r *protoReader, field int) { e.Val, e.U = r.measure(field, e.Val, e.U) })
+		return e
+	case 21:
+		e := &TimeTyp{}
+		r.message(func(r *protoReader, field int) {
+			switch field {
+			case 1:
+				e.Hours = int(r.int())
+			case 2:
+				e.Minutes = int(r.int())
+			case 3:
+				e.Seconds = int(r.int())
+			case 4:
+				e.U = Unit(r.int())
+			default:
+				r.skip()
+			}
+		})
+		return e
+	case 22:
+		e := &DateTyp{}
+		r.message(func(r *protoReader, field int) {
+			switch field {
+			case 1:
+				e.Year = int(r.int())
+			case 2:
+				e.Month = int(r.int())
+			case 3:
+				e.Day = int(r.int())
+			default:
+				r.skip()
+			}
+		})
+		return e
+	case 23:
+		e := &WeekdayTyp{}
+		r.message(func(r *protoReader, field int) {
+			if field == 1 {
+				e.Val = int(r.int())
+				return
+			}
+			r.skip()
+		})
+		return e
+	case 24:
+		e := &MonthTyp{}
+		r.message(func(r *protoReader, field int) {
+			if field == 1 {
+				e.Val = int(r.int())
+				return
+			}
+			r.skip()
+		})
+		return e
+	case 25:
+		e := &CellTyp{}
+		r.message(func(r *protoReader, field int) {
+			switch field {
+			case 1:
+				e.Kind = r.token()
+			case 2:
+				e.Val = r.string()
+			default:
+				r.skip()
+			}
+		})
+		return e
+	case 26:
+		e := &Ref{}
+		r.message(func(r *protoReader, field int) {
+			if field == 1 {
+				e.ID = r.string()
+				return
+			}
+			r.skip()
+		})
+		return e
+	case 27:
+		e := &Range{}
+		r.message(func(r *protoReader, field int) {
+			switch field {
+			case 1:
+				e.Low = r.expr()
+			case 2:
+				e.High = r.expr()
+			default:
+				r.skip()
+			}
+		})
+		if e.Low == nil || e.High == nil {
+			r.fail("incomplete range")
+		}
+		return e
+	case 28:
+		e := &ArrayTyp{}
+		r.message(func(r *protoReader, field int) {
+			switch field {
+			case 1:
+				e.Kind = r.token()
+			case 2:
+				e.List = append(e.List, r.expr())
+			default:
+				r.skip()
+			}
+		})
+		return e
+	case 29:
+		e := &GeometryPointTyp{}
+		r.message(func(r *protoReader, field int) {
+			switch field {
+			case 1:
+				e.Val = r.coord()
+			case 2:
+				e.Radius = r.distance()
+			default:
+				r.skip()
+			}
+		})
+		return e
+	case 30:
+		e := &GeometryLineTyp{}
+		r.message(func(r *protoReader, field int) {
+			switch field {
+			case 1:
+				e.Val = append(e.Val, r.coord())
+			case 2:
+				e.Margin = r.distance()
+			default:
+				r.skip()
+			}
+		})
+		return e
+	case 31:
+		e := &GeometryPolygonTyp{}
+		r.message(func(r *protoReader, field int) {
+			if field != 1 {
+				r.skip()
+				return
+			}
+			var ring [][2]float64
+			r.message(func(r *protoReader, field int) {
+				if field == 1 {
+					ring = append(ring, r.coord())
+					return
+				}
+				r.skip()
+			})
+			e.Val = append(e.Val, ring)
+		})
+		return e
+	case 32:
+		e := &GeometryMultiObjectTyp{}
+		r.message(func(r *protoReader, field int) {
+			switch field {
+			case 1:
+				e.Kind = r.token()
+			case 2:
+				e.Val = append(e.Val, r.expr())
+			default:
+				r.skip()
+			}
+		})
+		return e
+	case 33:
+		e := &GeometryCollectionTyp{}
+		r.message(func(r *protoReader, field int) {
+			if field == 1 {
+				e.Objects = append(e.Objects, r.expr())
+				return
+			}
+			r.skip()
+		})
+		return e
+	}
+	r.skip()
+	return nil
+}
+
+// measure reads the fields of a value with a unit.
+func (r *protoReader) measure(field int, val float64, u Unit) (float64, Unit) {
+	switch field {
+	case 1:
+		val = r.double()
+	case 2:
+		u = Unit(r.int())
+	default:
+		r.skip()
+	}
+	return val, u
+}
+
+// setSpan sets the start and end offsets of a decoded expression.
+// Offsets of binary and unary expressions derive from their operands.
+func setSpan(expr Expr, lpos, rpos Pos) {
+	switch typ := expr.(type) {
+	case *ParenExpr:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *CallExpr:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *WindowExpr:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *HistoryExpr:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *Selector:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *WildcardTyp:
+		typ.lpos = lpos
+	case *BooleanTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *IntTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *FloatTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *StringTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *PercentTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *DurationTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *TemperatureTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *PressureTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *DistanceTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *SpeedTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *TimeTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *DateTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *WeekdayTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *MonthTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *CellTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *Ref:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *Range:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *ArrayTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *GeometryPointTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *GeometryLineTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *GeometryPolygonTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *GeometryMultiObjectTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	case *GeometryCollectionTyp:
+		typ.lpos, typ.rpos = lpos, rpos
+	}
+}
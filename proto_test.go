@@ -0,0 +1,127 @@
+package geoqlparser
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestProtoRoundTrip(t *testing.T) {
+	testCases := []string{
+		`trigger when tracker_osi*tracker_miu >= 300Bar repeat 1 every 1s`,
+		`// speed control
+trigger
+set
+	// upper limit
+	max = 60Kph; // in kph
+when
+	tracker_speed > @max // too fast
+	or tracker_speed < 10Kph // too slow
+reset after 1h
+// end`,
+		`trigger set depot=point[13.4, 52.5]:500M; zone=polygon[[[1, 1], [2, 1], [2, 2], [1, 1]], [[1.2, 1.1], [1.5, 1.1], [1.5, 1.4], [1.2, 1.1]]];
+		when tracker_coords in @depot and not (tracker_coords intersects @zone) xor tracker_coords nearby line[[1, 1], [-2.5, 2]]:1Km`,
+		`when tracker_temp in -30C .. +5.5F and tracker_speed{"a", "b"} > 60Mph and all tracker_fuel{group:"trucks", tag:"eu"} < 10%`,
+		`when tracker_time in time[9:00AM .. 5:30PM] and tracker_day in date[2030-10-02, 2031-01-01] and tracker_wd in [Mon, Fri] and tracker_m in Jan .. Mar`,
+		`when tracker_coords in multipolygon[polygon[[[1, 1], [2, 1], [1, 1]]]] or tracker_coords in collection[point[1, 1], multipoint[point[2, 2], point[3, 3]]]`,
+		`when avg(tracker_speed, 5m) > 80Kph for 10m and rising(tracker_temp, 2C, 5m) or abs(tracker_delta - 1) > 0 and changed(tracker_status)`,
+		`when tracker_coords in h3[8928308280fffff] or tracker_coords in geohash[u4pr, u4ps] or tracker_coords in s2[464f3 .. 464f7]`,
+		`when tracker_coords enters point[1, 1] or tracker_coords dwells in point[1, 1]:10M for 5m or tracker_a :1Km, 2h > 0`,
+		`when tracker_s{*, "a"} == "x" and tracker_tags == ["a", "b"] and tracker_on != false and tracker_n mod 2 == -1`,
+	}
+	for _, src := range testCases {
+		stmt, err := ParseWithMode(src, ParseComments)
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+		want := stmt.(*Trigger)
+		data, err := MarshalProto(want)
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+		have, err := UnmarshalProto(data)
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+		a, b := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+		if err = Format(a, want); err != nil {
+			t.Fatal(err)
+		}
+		if err = Format(b, have); err != nil {
+			t.Fatal(err)
+		}
+		if a.String() != b.String() {
+			t.Fatalf("have\n%s\nwant\n%s", b, a)
+		}
+		if !reflect.DeepEqual(spans(have), spans(want)) {
+			t.Fatalf("%s: have spans %v, want %v", src, spans(have), spans(want))
+		}
+		again, err := MarshalProto(have)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(again, data) {
+			t.Fatalf("%s: encoding is not stable", src)
+		}
+	}
+}
+
+func spans(t *Trigger) [][2]Pos {
+	var list [][2]Pos
+	f := func(expr Expr) bool {
+		if expr == nil {
+			return false
+		}
+		list = append(list, [2]Pos{expr.Pos(), expr.End()})
+		return true
+	}
+	for _, v := range t.Vars {
+		Visit(v.Right, f)
+	}
+	Visit(t.When, f)
+	return append(list, [2]Pos{t.Pos(), t.End()})
+}
+
+func TestProtoWireFormat(t *testing.T) {
+	stmt, err := Parse(`when tracker_on`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := MarshalProto(stmt.(*Trigger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Trigger.when {pos: 5, end: 14, selector {ident: "tracker_on", wildcard: true}}, Trigger.end
+	want := "2a" + "14" + "0805" + "100e" + "4a0e" + "0a0a747261636b65725f6f6e" + "2801" + "700f"
+	if have := hex.EncodeToString(data); have != want {
+		t.Fatalf("have %s, want %s", have, want)
+	}
+}
+
+func TestUnmarshalProtoErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		data string
+	}{
+		{name: "empty", data: ""},
+		{name: "truncated", data: "2a12"},
+		{name: "expression without node", data: "2a020805"},
+		{name: "wrong wire type", data: "2a03" + "0905"},
+		{name: "unknown token", data: "2a04" + "1a02" + "0863"},
+		{name: "window without duration", data: "2a0c" + "3a0a" + "0a03617667" + "1203" + "5201" + "00"},
+	}
+	for _, tc := range testCases {
+		data, _ := hex.DecodeString(tc.data)
+		if _, err := UnmarshalProto(data); err == nil {
+			t.Fatalf("%s: have nil, want error", tc.name)
+		}
+	}
+	// unknown fields are skipped
+	stmt, _ := Parse(`when tracker_on`)
+	data, _ := MarshalProto(stmt.(*Trigger))
+	data = append(data, 0xf8, 0x07, 0x01, 0x85, 0x08, 1, 2, 3, 4)
+	if _, err := UnmarshalProto(data); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,433 @@
+package geoqlparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Mapping maps the selectors of a trigger to the columns of a table, e.g.
+// Mapping{"tracker_speed": "speed", "tracker_coords": "geom"}.
+type Mapping map[string]string
+
+// TranslateError lists the expressions of a trigger that cannot be translated.
+type TranslateError struct {
+	Target string
+	Exprs  []Expr
+}
+
+func (e *TranslateError) Error() string {
+	list := make([]string, len(e.Exprs))
+	for i, expr := range e.Exprs {
+		list[i] = fmt.Sprintf("%s at %d", formatExpr(expr), expr.Pos())
+	}
+	return fmt.Sprintf("geoql: cannot translate to %s: %s", e.Target, strings.Join(list, ", "))
+}
+
+// ToSQL translates Trigger.When to a parameterized PostgreSQL condition for a WHERE clause
+// of a PostGIS table. The arguments are numbered $1, $2 and so on. Geometries are WKT
+// in SRID 4326, intersects becomes ST_Intersects or ST_DWithin for circles and lines
+// with a margin. Numbers are normalized to Kph, meters, C, Bar and seconds.
+// Windows, history, geofence transitions and cells cannot be translated
+// and are reported by a *TranslateError.
+func ToSQL(t *Trigger, m Mapping) (string, []interface{}, error) {
+	w := &sqlWriter{trigger: t, m: m}
+	where := w.expr(t.When)
+	if len(w.failed) > 0 {
+		return "", nil, &TranslateError{Target: "sql", Exprs: w.failed}
+	}
+	return where, w.args, nil
+}
+
+type sqlWriter struct {
+	trigger *Trigger
+	m       Mapping
+	args    []interface{}
+	failed  []Expr
+}
+
+func (w *sqlWriter) fail(expr Expr) (string, int) {
+	w.failed = append(w.failed, expr)
+	return "NULL", sqlAtom
+}
+
+func (w *sqlWriter) param(v interface{}) string {
+	w.args = append(w.args, v)
+	return "$" + strconv.Itoa(len(w.args))
+}
+
+func (w *sqlWriter) resolve(expr Expr) Expr {
+	expr = unparen(expr)
+	if ref, ok := expr.(*Ref); ok {
+		if assign, err := w.trigger.findAssign(ref.ID); err == nil {
+			return assign.Right
+		}
+	}
+	return expr
+}
+
+// Precedence of the SQL operators, higher binds tighter.
+const (
+	sqlOr = iota + 1
+	sqlAnd
+	sqlNot
+	sqlCmp
+	sqlBetween
+	sqlAdd
+	sqlMul
+	sqlAtom
+)
+
+var sqlOps = map[Token]struct {
+	op   string
+	prec int
+}{
+	OR: {"OR", sqlOr}, AND: {"AND", sqlAnd}, XOR: {"<>", sqlCmp},
+	LSS: {"<", sqlCmp}, LEQ: {"<=", sqlCmp}, GTR: {">", sqlCmp}, GEQ: {">=", sqlCmp},
+	EQL: {"=", sqlCmp}, LEQL: {"=", sqlCmp}, NOT_EQ: {"<>", sqlCmp}, LNEQ: {"<>", sqlCmp},
+	ADD: {"+", sqlAdd}, SUB: {"-", sqlAdd}, MUL: {"*", sqlMul}, QUO: {"/", sqlMul}, REM: {"%", sqlMul},
+}
+
+func (w *sqlWriter) expr(expr Expr) string {
+	sql, _ := w.node(expr)
+	return sql
+}
+
+// operand translates the expression and parenthesizes it if it binds looser than prec.
+func (w *sqlWriter) operand(expr Expr, prec int) string {
+	sql, p := w.node(expr)
+	if p < prec {
+		return "(" + sql + ")"
+	}
+	return sql
+}
+
+// node returns the translated expression and the precedence of its operator.
+func (w *sqlWriter) node(expr Expr) (string, int) {
+	switch typ := expr.(type) {
+	case *ParenExpr:
+		return w.node(typ.Expr)
+	case *UnaryExpr:
+		return "NOT " + w.operand(typ.X, sqlNot), sqlNot
+	case *BinaryExpr:
+		switch typ.Op {
+		case IN, NOT_IN:
+			return w.in(typ)
+		case INTERSECTS, NOT_INTERSECTS:
+			return w.intersects(typ)
+		}
+		op, ok := sqlOps[typ.Op]
+		if !ok {
+			return w.fail(typ)
+		}
+		left, right := op.prec, op.prec+1
+		switch op.prec {
+		case sqlAnd, sqlOr:
+			right = op.prec
+		case sqlCmp:
+			// comparisons are not associative, a > 1 <> b = 2 is an error
+			left = op.prec + 1
+		}
+		return w.operand(typ.Left, left) + " " + op.op + " " + w.operand(typ.Right, right), op.prec
+	case *Selector:
+		column, ok := w.m[typ.Ident]
+		if !ok || typ.multi() || len(typ.Props) > 0 {
+			return w.fail(typ)
+		}
+		return column, sqlAtom
+	case *Ref:
+		resolved := w.resolve(typ)
+		if resolved == typ {
+			return w.fail(typ)
+		}
+		return w.node(resolved)
+	case *CallExpr:
+		return w.call(typ)
+	case *StringTyp:
+		return w.param(typ.Val), sqlAtom
+	case *BooleanTyp:
+		return w.param(typ.Val), sqlAtom
+	case *IntTyp:
+		return w.param(typ.Val), sqlAtom
+	case *DateTyp:
+		return w.param(fmt.Sprintf("%04d-%02d-%02d", typ.Year, typ.Month, typ.Day)) + "::date", sqlAtom
+	case *TimeTyp:
+		v, _, _ := baseValue(typ)
+		sec := int(v)
+		return w.param(fmt.Sprintf("%02d:%02d:%02d", sec/3600, sec/60%60, sec%60)) + "::time", sqlAtom
+	case *GeometryPointTyp, *GeometryLineTyp, *GeometryPolygonTyp,
+		*GeometryMultiObjectTyp, *GeometryCollectionTyp:
+		wkt, ok := toWKT(typ)
+		if !ok {
+			return w.fail(typ)
+		}
+		return "ST_GeomFromText(" + w.param(wkt) + ", 4326)", sqlAtom
+	}
+	if v, dim, ok := baseValue(expr); ok && dim != dimTime && dim != dimDate {
+		return w.param(v), sqlAtom
+	}
+	return w.fail(expr)
+}
+
+// or joins the conditions, negated if not is set.
+func or(conds []string, not bool) (string, int) {
+	switch {
+	case len(conds) == 1 && not:
+		return "NOT " + conds[0], sqlNot
+	case len(conds) == 1:
+		return conds[0], sqlAtom
+	case not:
+		return "NOT (" + strings.Join(conds, " OR ") + ")", sqlNot
+	}
+	return strings.Join(conds, " OR "), sqlOr
+}
+
+func (w *sqlWriter) in(e *BinaryExpr) (string, int) {
+	not := e.Op == NOT_IN
+	right := w.resolve(e.Right)
+	if isGeometryLit(right) {
+		return w.intersects(e)
+	}
+	switch typ := right.(type) {
+	case *Selector:
+		cond := w.operand(e.Left, sqlCmp+1) + " = ANY(" + w.expr(typ) + ")"
+		if not {
+			return "NOT " + cond, sqlNot
+		}
+		return cond, sqlCmp
+	case *Range:
+		op := " BETWEEN "
+		if not {
+			op = " NOT BETWEEN "
+		}
+		return w.operand(e.Left, sqlBetween+1) + op + w.operand(typ.Low, sqlBetween+1) +
+			" AND " + w.operand(typ.High, sqlBetween+1), sqlBetween
+	case *ArrayTyp:
+		left := w.operand(e.Left, sqlBetween+1)
+		var values, conds []string
+		for _, item := range typ.List {
+			if r, ok := w.resolve(item).(*Range); ok {
+				conds = append(conds, left+" BETWEEN "+w.operand(r.Low, sqlBetween+1)+
+					" AND "+w.operand(r.High, sqlBetween+1))
+				continue
+			}
+			values = append(values, w.expr(item))
+		}
+		if len(values) > 0 && len(conds) == 0 {
+			op := " IN ("
+			if not {
+				op = " NOT IN ("
+			}
+			return left + op + strings.Join(values, ", ") + ")", sqlBetween
+		}
+		if len(values) > 0 {
+			conds = append([]string{left + " IN (" + strings.Join(values, ", ") + ")"}, conds...)
+		}
+		return or(conds, not)
+	}
+	return w.fail(e)
+}
+
+func (w *sqlWriter) intersects(e *BinaryExpr) (string, int) {
+	not := e.Op == NOT_IN || e.Op == NOT_INTERSECTS
+	left, right := e.Left, w.resolve(e.Right)
+	if !isGeometryLit(right) {
+		l := w.resolve(left)
+		if !isGeometryLit(l) {
+			return or([]string{"ST_Intersects(" + w.expr(left) + ", " + w.expr(right) + ")"}, not)
+		}
+		left, right = e.Right, l
+	}
+	col := w.expr(left)
+	parts, ok := geometryParts(right)
+	if !ok {
+		return w.fail(right)
+	}
+	conds := make([]string, 0, len(parts))
+	for _, part := range parts {
+		geom := "ST_GeomFromText(" + w.param(part.wkt) + ", 4326)"
+		if part.margin > 0 {
+			conds = append(conds, "ST_DWithin("+col+"::geography, "+geom+"::geography, "+w.param(part.margin)+")")
+		} else {
+			conds = append(conds, "ST_Intersects("+col+", "+geom+")")
+		}
+	}
+	return or(conds, not)
+}
+
+var sqlFuncs = map[string]string{
+	"abs": "abs", "round": "round", "floor": "floor", "ceil": "ceil", "sqrt": "sqrt", "pow": "power",
+}
+
+var sqlDateParts = map[string]string{
+	"hour": "hour", "minute": "minute", "day": "day", "weekday": "dow", "month": "month", "year": "year",
+}
+
+func (w *sqlWriter) call(e *CallExpr) (string, int) {
+	args := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = w.expr(arg)
+	}
+	if fn, ok := sqlFuncs[e.Func]; ok {
+		return fn + "(" + strings.Join(args, ", ") + ")", sqlAtom
+	}
+	if part, ok := sqlDateParts[e.Func]; ok && len(args) == 1 {
+		return "extract(" + part + " from to_timestamp(" + args[0] + "))", sqlAtom
+	}
+	switch e.Func {
+	case "distance":
+		if len(args) == 2 {
+			return "ST_Distance(" + args[0] + "::geography, " + args[1] + "::geography)", sqlAtom
+		}
+	case "area":
+		if len(args) == 1 {
+			return "ST_Area(" + args[0] + "::geography)", sqlAtom
+		}
+	case "length":
+		if len(args) == 1 {
+			return "ST_Length(" + args[0] + "::geography)", sqlAtom
+		}
+	}
+	return w.fail(e)
+}
+
+func isGeometryLit(expr Expr) bool {
+	switch expr.(type) {
+	case *GeometryPointTyp, *GeometryLineTyp, *GeometryPolygonTyp,
+		*GeometryMultiObjectTyp, *GeometryCollectionTyp:
+		return true
+	}
+	return false
+}
+
+// geometryPart is a geometry in WKT and the distance in meters
+// within which a position intersects it.
+type geometryPart struct {
+	wkt    string
+	margin float64
+}
+
+// geometryParts splits the geometry into the parts with different margins.
+func geometryParts(expr Expr) ([]geometryPart, bool) {
+	var list []Expr
+	switch typ := expr.(type) {
+	case *GeometryMultiObjectTyp:
+		list = typ.Val
+	case *GeometryCollectionTyp:
+		list = typ.Objects
+	default:
+		wkt, ok := toWKT(expr)
+		return []geometryPart{{wkt: wkt, margin: margin(expr)}}, ok
+	}
+	var hasMargin bool
+	for _, item := range list {
+		hasMargin = hasMargin || margin(item) > 0
+	}
+	if !hasMargin {
+		wkt, ok := toWKT(expr)
+		return []geometryPart{{wkt: wkt}}, ok
+	}
+	parts := make([]geometryPart, 0, len(list))
+	for _, item := range list {
+		p, ok := geometryParts(item)
+		if !ok {
+			return nil, false
+		}
+		parts = append(parts, p...)
+	}
+	return parts, true
+}
+
+func margin(expr Expr) (m float64) {
+	switch typ := expr.(type) {
+	case *GeometryPointTyp:
+		if typ.Radius != nil {
+			m, _, _ = baseValue(typ.Radius)
+		}
+	case *GeometryLineTyp:
+		if typ.Margin != nil {
+			m, _, _ = baseValue(typ.Margin)
+		}
+	}
+	return
+}
+
+// toWKT returns the well-known text of the geometry. Radiuses and margins are dropped.
+func toWKT(expr Expr) (string, bool) {
+	b := &strings.Builder{}
+	ok := writeWKT(b, expr, true)
+	return b.String(), ok
+}
+
+func writeWKT(b *strings.Builder, expr Expr, tagged bool) bool {
+	tag := func(name string) {
+		if tagged {
+			b.WriteString(name)
+		}
+	}
+	switch typ := expr.(type) {
+	case *GeometryPointTyp:
+		tag("POINT")
+		b.WriteString("(")
+		writeWKTPoints(b, [][2]float64{typ.Val})
+		b.WriteString(")")
+	case *GeometryLineTyp:
+		tag("LINESTRING")
+		b.WriteString("(")
+		writeWKTPoints(b, typ.Val)
+		b.WriteString(")")
+	case *GeometryPolygonTyp:
+		tag("POLYGON")
+		b.WriteString("(")
+		for i, ring := range typ.Val {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString("(")
+			writeWKTPoints(b, ring)
+			b.WriteString(")")
+		}
+		b.WriteString(")")
+	case *GeometryMultiObjectTyp:
+		switch typ.Kind {
+		case GEOMETRY_MULTIPOINT:
+			tag("MULTIPOINT")
+		case GEOMETRY_MULTILINE:
+			tag("MULTILINESTRING")
+		case GEOMETRY_MULTIPOLYGON:
+			tag("MULTIPOLYGON")
+		}
+		return writeWKTList(b, typ.Val, false)
+	case *GeometryCollectionTyp:
+		tag("GEOMETRYCOLLECTION")
+		return writeWKTList(b, typ.Objects, true)
+	default:
+		return false
+	}
+	return true
+}
+
+func writeWKTList(b *strings.Builder, list []Expr, tagged bool) bool {
+	b.WriteString("(")
+	for i, item := range list {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if !writeWKT(b, item, tagged) {
+			return false
+		}
+	}
+	b.WriteString(")")
+	return len(list) > 0
+}
+
+func writeWKTPoints(b *strings.Builder, points [][2]float64) {
+	for i, p := range points {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(strconv.FormatFloat(p[0], 'f', -1, 64))
+		b.WriteString(" ")
+		b.WriteString(strconv.FormatFloat(p[1], 'f', -1, 64))
+	}
+}
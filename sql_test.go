@@ -0,0 +1,148 @@
+package geoqlparser
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestToSQL(t *testing.T) {
+	m := Mapping{
+		"tracker_speed":  "speed",
+		"tracker_model":  "model",
+		"tracker_coords": "geom",
+		"tracker_temp":   "temp",
+		"tracker_time":   "ts",
+		"tracker_tags":   "tags",
+		"tracker_on":     "engine_on",
+	}
+	testCases := []struct {
+		name  string
+		s     string
+		where string
+		args  []interface{}
+	}{
+		{
+			name:  "comparisons",
+			s:     `when tracker_speed > 50Mph and (tracker_model eq "ER54x3" or tracker_on != true)`,
+			where: `speed > $1 AND (model = $2 OR engine_on <> $3)`,
+			args:  []interface{}{80.4672, "ER54x3", true},
+		},
+		{
+			name:  "units",
+			s:     `when tracker_temp in 32F .. 40C and tracker_speed * 2 < 1.5Km`,
+			where: `temp BETWEEN $1 AND $2 AND speed * $3 < $4`,
+			args:  []interface{}{0.0, 40.0, 2, 1500.0},
+		},
+		{
+			name:  "array",
+			s:     `trigger set m=["A", "B"]; when tracker_model not in @m and tracker_speed in [1 .. 2, 5 .. 10]`,
+			where: `model NOT IN ($1, $2) AND (speed BETWEEN $3 AND $4 OR speed BETWEEN $5 AND $6)`,
+			args:  []interface{}{"A", "B", 1, 2, 5, 10},
+		},
+		{
+			name:  "array column",
+			s:     `when "urgent" in tracker_tags and not tracker_speed > 1`,
+			where: `$1 = ANY(tags) AND NOT speed > $2`,
+			args:  []interface{}{"urgent", 1},
+		},
+		{
+			name:  "xor",
+			s:     `when tracker_speed > 1 and tracker_on xor (tracker_speed - 1) * 2 > 3 or tracker_on`,
+			where: `(speed > $1 AND engine_on) <> ((speed - $2) * $3 > $4) OR engine_on`,
+			args:  []interface{}{1, 1, 2, 3},
+		},
+		{
+			name:  "xor of comparisons",
+			s:     `when tracker_speed > 1 xor tracker_model == "x"`,
+			where: `(speed > $1) <> (model = $2)`,
+			args:  []interface{}{1, "x"},
+		},
+		{
+			name:  "intersects",
+			s:     `when tracker_coords intersects polygon[[[1, 1], [2, 1], [2, 2], [1, 1]]]`,
+			where: `ST_Intersects(geom, ST_GeomFromText($1, 4326))`,
+			args:  []interface{}{"POLYGON((1 1, 2 1, 2 2, 1 1))"},
+		},
+		{
+			name:  "circle",
+			s:     `trigger set depot=point[13.4, 52.5]:500M; when tracker_coords in @depot`,
+			where: `ST_DWithin(geom::geography, ST_GeomFromText($1, 4326)::geography, $2)`,
+			args:  []interface{}{"POINT(13.4 52.5)", 500.0},
+		},
+		{
+			name: "multi with margins",
+			s:    `when line[[1, 1], [2, 2]]:10M not intersects tracker_coords or tracker_coords in multipoint[point[1, 1]:1Km, point[3, 3]]`,
+			where: `NOT ST_DWithin(geom::geography, ST_GeomFromText($1, 4326)::geography, $2) OR ` +
+				`ST_DWithin(geom::geography, ST_GeomFromText($3, 4326)::geography, $4) OR ST_Intersects(geom, ST_GeomFromText($5, 4326))`,
+			args: []interface{}{"LINESTRING(1 1, 2 2)", 10.0, "POINT(1 1)", 1000.0, "POINT(3 3)"},
+		},
+		{
+			name:  "collection",
+			s:     `when tracker_coords intersects collection[point[1, 1], multipoint[point[2, 2], point[3, 3]]]`,
+			where: `ST_Intersects(geom, ST_GeomFromText($1, 4326))`,
+			args:  []interface{}{"GEOMETRYCOLLECTION(POINT(1 1), MULTIPOINT((2 2), (3 3)))"},
+		},
+		{
+			name:  "functions",
+			s:     `when distance(tracker_coords, point[1, 2]) < 2Km and hour(tracker_time) in 9 .. 17 and abs(tracker_speed) > 1`,
+			where: `ST_Distance(geom::geography, ST_GeomFromText($1, 4326)::geography) < $2 AND extract(hour from to_timestamp(ts)) BETWEEN $3 AND $4 AND abs(speed) > $5`,
+			args:  []interface{}{"POINT(1 2)", 2000.0, 9, 17, 1},
+		},
+		{
+			name:  "date and time",
+			s:     `when tracker_time > date[2030-10-02] and tracker_time in time[9:00AM .. 5:30PM]`,
+			where: `ts > $1::date AND ts BETWEEN $2::time AND $3::time`,
+			args:  []interface{}{"2030-10-02", "09:00:00", "17:30:00"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := Parse(tc.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			where, args, err := ToSQL(stmt.(*Trigger), m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if where != tc.where {
+				t.Fatalf("have %s, want %s", where, tc.where)
+			}
+			if !reflect.DeepEqual(args, tc.args) {
+				t.Fatalf("have %#v, want %#v", args, tc.args)
+			}
+		})
+	}
+}
+
+func TestToSQLErrors(t *testing.T) {
+	m := Mapping{"tracker_speed": "speed", "tracker_coords": "geom"}
+	testCases := []struct {
+		s    string
+		want []string
+	}{
+		{s: `when tracker_unknown > 1`, want: []string{"tracker_unknown"}},
+		{s: `when avg(tracker_speed, 5m) > 1 or tracker_speed > 1 for 1m`, want: []string{"avg(tracker_speed, 5m0s)", "tracker_speed > 1 for 1m0s"}},
+		{s: `when tracker_coords enters point[1, 1] and tracker_coords in h3[8928308280fffff]`, want: []string{"tracker_coords enters point[1, 1]", "tracker_coords in h3[8928308280fffff]"}},
+		{s: `when any tracker_speed{"a", "b"} > 1`, want: []string{`any tracker_speed{"a", "b"}`}},
+	}
+	for _, tc := range testCases {
+		stmt, err := Parse(tc.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = ToSQL(stmt.(*Trigger), m)
+		var terr *TranslateError
+		if !errors.As(err, &terr) {
+			t.Fatalf("%s: have %v, want *TranslateError", tc.s, err)
+		}
+		have := make([]string, len(terr.Exprs))
+		for i, expr := range terr.Exprs {
+			have[i] = formatExpr(expr)
+		}
+		if !reflect.DeepEqual(have, tc.want) {
+			t.Fatalf("%s: have %q, want %q", tc.s, have, tc.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package geoqlparser
+
+import (
+	"sort"
+	"strings"
+)
+
+// didYouMean returns the hint with the candidates closest to word,
+// or an empty string if none is close enough.
+func didYouMean(word string, candidates []string) string {
+	list := suggest(word, candidates)
+	switch len(list) {
+	case 0:
+		return ""
+	case 1:
+		return "did you mean " + list[0] + "?"
+	}
+	return "did you mean " + strings.Join(list[:len(list)-1], ", ") + " or " + list[len(list)-1] + "?"
+}
+
+// suggest returns the sorted candidates at the smallest edit distance from word.
+// A candidate is close enough if at most a third of word, but at least
+// one character, is edited.
+func suggest(word string, candidates []string) []string {
+	limit := len(word) / 3
+	if limit < 1 {
+		limit = 1
+	}
+	var list []string
+	for _, c := range candidates {
+		d := editDistance(word, c)
+		if d == 0 || d > limit || d >= len(c) {
+			continue
+		}
+		if d < limit {
+			limit, list = d, list[:0]
+		}
+		list = append(list, c)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// editDistance returns the optimal string alignment distance of a and b,
+// the number of inserted, deleted, substituted and transposed bytes.
+func editDistance(a, b string) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = minInt(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
+
+func minInt(n int, rest ...int) int {
+	for _, m := range rest {
+		if m < n {
+			n = m
+		}
+	}
+	return n
+}
+
+// keywordNames returns the keywords that are words.
+func keywordNames() []string {
+	names := make([]string, 0, len(keywords))
+	for name := range keywords {
+		if name[0] >= 'a' && name[0] <= 'z' {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// unitSpellings returns the spellings of the units of numbers.
+func unitSpellings() []string {
+	names := make([]string, 0, len(unitNames))
+	for name := range unitNames {
+		if isPercentUnit(name) || isPressureUnit(name) || isDistanceUnit(name) ||
+			isSpeedUnit(name) || isTemperatureUnit(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// names returns the names of the declared selectors.
+func (d Dictionary) names() []string {
+	names := make([]string, 0, len(d))
+	for name := range d {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,164 @@
+package geoqlparser
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	testCases := []struct {
+		a, b string
+		want int
+	}{
+		{a: "", b: "", want: 0},
+		{a: "and", b: "", want: 3},
+		{a: "and", b: "and", want: 0},
+		{a: "adn", b: "and", want: 1},
+		{a: "intersect", b: "intersects", want: 1},
+		{a: "kmh", b: "kph", want: 1},
+		{a: "wehn", b: "when", want: 1},
+		{a: "s_flot", b: "s_float", want: 1},
+		{a: "ca", b: "abc", want: 3},
+	}
+	for _, tc := range testCases {
+		if have := editDistance(tc.a, tc.b); have != tc.want {
+			t.Fatalf("editDistance(%q, %q): have %d, want %d", tc.a, tc.b, have, tc.want)
+		}
+	}
+}
+
+func TestDidYouMean(t *testing.T) {
+	testCases := []struct {
+		word       string
+		candidates []string
+		want       string
+	}{
+		{word: "wehn", candidates: []string{"trigger", "when"}, want: "did you mean when?"},
+		{word: "kmh", candidates: []string{"mph", "kph", "km", "c"}, want: "did you mean km or kph?"},
+		{word: "tracker_speedd", candidates: []string{"tracker_speed", "tracker_sped"}, want: "did you mean tracker_speed?"},
+		{word: "xyz", candidates: []string{"and", "or"}, want: ""},
+		{word: "when", candidates: []string{"when"}, want: ""},
+		{word: "k", candidates: []string{"c", "f"}, want: ""},
+	}
+	for _, tc := range testCases {
+		if have := didYouMean(tc.word, tc.candidates); have != tc.want {
+			t.Fatalf("didYouMean(%q): have %q, want %q", tc.word, have, tc.want)
+		}
+	}
+}
+
+func TestParseSuggestions(t *testing.T) {
+	testCases := []struct {
+		s    string
+		err  string
+		hint string
+	}{
+		{
+			s:    `when tracker_speed in 10Kmh .. 40Kmh`,
+			err:  "unknown unit Kmh",
+			hint: "did you mean Km or Kph?",
+		},
+		{
+			s:    `when tracker_pressure > 2psl`,
+			err:  "unknown unit psl",
+			hint: "did you mean psi?",
+		},
+		{
+			s:    `when tracker_speed > 10mhp`,
+			err:  "invalid duration 10mhp",
+			hint: "did you mean mph?",
+		},
+		{
+			s:    `when tracker intersect polygon[[1, 1], [1, 2], [2, 2], [1, 1]]`,
+			err:  "unexpected intersect after the statement",
+			hint: "did you mean intersects?",
+		},
+		{
+			s:    `when a > 1 adn b < 2`,
+			err:  "unexpected adn after the statement",
+			hint: "did you mean and?",
+		},
+		{
+			s:    `when a > 1 qwerty b`,
+			err:  "unexpected qwerty after the statement",
+			hint: "join the conditions with and, or or xor",
+		},
+		{
+			s:    `wehn a > 1`,
+			err:  "expected trigger or when",
+			hint: "did you mean when?",
+		},
+		{
+			s:    `trigger sett a = 1 when b`,
+			err:  "invalid trigger: expected set or when",
+			hint: "did you mean set?",
+		},
+		{
+			s:    `when a > 1 repeat 5 evrey 10s`,
+			err:  "invalid repeat: expected every or times",
+			hint: "did you mean every?",
+		},
+		{
+			s:    `when a > 1 reset aftre 1h`,
+			err:  "invalid reset: expected after",
+			hint: "did you mean after?",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.s, func(t *testing.T) {
+			_, err := Parse(tc.s)
+			var pe *Error
+			if !errors.As(err, &pe) {
+				t.Fatalf("have %v, want *Error", err)
+			}
+			if pe.Err == nil || pe.Err.Error() != tc.err {
+				t.Fatalf("have error %v, want %s", pe.Err, tc.err)
+			}
+			if pe.Hint != tc.hint {
+				t.Fatalf("have hint %q, want %q", pe.Hint, tc.hint)
+			}
+		})
+	}
+}
+
+func TestCheckTypeSuggestions(t *testing.T) {
+	testCases := []struct {
+		s    string
+		err  string
+		hint string
+	}{
+		{
+			s:    `when s_int > 1 and s_flot < 2`,
+			err:  "selector type s_flot not declared",
+			hint: "did you mean s_float?",
+		},
+		{
+			s:    `when abs(s_flaot) > 2`,
+			err:  "selector type s_flaot not declared",
+			hint: "did you mean s_float?",
+		},
+		{
+			s:   `when s_int > 1 and qwerty < 2`,
+			err: "selector type qwerty not declared",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.s, func(t *testing.T) {
+			stmt, err := Parse(tc.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = CheckType(stmt, describeSelectors)
+			var te *TypeError
+			if !errors.As(err, &te) {
+				t.Fatalf("have %v, want *TypeError", err)
+			}
+			if te.Error() != tc.err {
+				t.Fatalf("have error %s, want %s", te, tc.err)
+			}
+			if te.Hint != tc.hint {
+				t.Fatalf("have hint %q, want %q", te.Hint, tc.hint)
+			}
+		})
+	}
+}
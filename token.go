@@ -14,17 +14,28 @@ type (
 )
 
 type Tokenizer struct {
-	s   scanner.Scanner
-	hop int
-	tok rune
-	lit string
-	err error
+	s        scanner.Scanner
+	hop      int
+	tok      rune
+	lit      string
+	mode     Mode
+	line     int
+	comments []*Comment
+	err      error
 }
 
 func NewTokenizer(r io.Reader) *Tokenizer {
-	s := &Tokenizer{s: scanner.Scanner{}}
+	return newTokenizer(r, 0)
+}
+
+func newTokenizer(r io.Reader, mode Mode) *Tokenizer {
+	s := &Tokenizer{s: scanner.Scanner{}, mode: mode}
 	s.s.Mode = scanner.ScanIdents | scanner.ScanFloats | scanner.ScanStrings
 	s.s.Init(r)
+	if mode&ParseComments != 0 {
+		// Init resets the mode to GoTokens, which skips comments.
+		s.s.Mode &^= scanner.SkipComments
+	}
 	s.s.Error = func(_ *scanner.Scanner, msg string) {
 		s.err = errors.New(msg)
 	}
@@ -34,12 +45,31 @@ func NewTokenizer(r io.Reader) *Tokenizer {
 func (t *Tokenizer) next() (rune, string) {
 	if t.hop != 0 {
 		t.hop = 0
-	} else {
+		return t.tok, t.lit
+	}
+	for {
 		t.tok, t.lit = t.s.Scan(), t.s.TokenText()
+		if t.tok != scanner.Comment {
+			break
+		}
+		t.comments = append(t.comments, &Comment{
+			Text:     t.lit,
+			lpos:     Pos(t.s.Offset),
+			rpos:     Pos(t.s.Offset + len(t.lit)),
+			trailing: t.s.Line == t.line,
+		})
 	}
+	t.line = t.s.Line
 	return t.tok, t.lit
 }
 
+// Comments returns and forgets the comments scanned so far.
+func (t *Tokenizer) Comments() []*Comment {
+	list := t.comments
+	t.comments = nil
+	return list
+}
+
 func (t *Tokenizer) Reset() {
 	t.hop = 1
 }
@@ -48,6 +78,31 @@ func (t *Tokenizer) Unwind() {
 	t.hop = 0
 }
 
+// peek skips white space and returns the next character without scanning it.
+func (t *Tokenizer) peek() rune {
+	if t.hop != 0 {
+		return t.tok
+	}
+	ch := t.s.Peek()
+	for t.s.Whitespace&(1<<uint(ch)) != 0 {
+		t.s.Next()
+		ch = t.s.Peek()
+	}
+	return ch
+}
+
+// scanWord skips white space and reads the letters and digits that follow
+// without scanning them as tokens, e.g. the index of h3[8928308280fffff].
+func (t *Tokenizer) scanWord() (string, Pos) {
+	t.peek()
+	pos := Pos(t.s.Pos().Offset)
+	var b strings.Builder
+	for ch := t.s.Peek(); ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'; ch = t.s.Peek() {
+		b.WriteRune(t.s.Next())
+	}
+	return b.String(), pos
+}
+
 func (t *Tokenizer) ErrorCount() int {
 	return t.s.ErrorCount
 }
@@ -129,7 +184,7 @@ func (t *Tokenizer) Scan() (tok Token, lit string) {
 			tok = LNEQ
 			lit = KeywordString(tok)
 		default:
-			tok = ILLEGAL
+			tok = NOT
 			t.Reset()
 		}
 	case '>':
@@ -189,14 +244,24 @@ func (t *Tokenizer) Scan() (tok Token, lit string) {
 			kwd = BOOLEAN
 		case "not":
 			found = true
+			kwd = NOT
 			r, s = t.next()
-			lit = strings.ToLower(s)
-			notlit := "not " + lit
+			notlit := "not " + strings.ToLower(s)
 			notkwd, exists := keywords[notlit]
-			if exists {
-				found = true
+			if r == scanner.Ident && exists {
 				kwd = notkwd
 				lit = notlit
+			} else {
+				t.Reset()
+			}
+		case "dwells":
+			r, s = t.next()
+			if r == scanner.Ident && strings.ToLower(s) == "in" {
+				found = true
+				kwd = DWELLS
+				lit = KeywordString(kwd)
+			} else {
+				t.Reset()
 			}
 		default:
 			kwd, found = keywords[lit]
@@ -214,15 +279,19 @@ func (op Token) Precedence() (n int) {
 	switch op {
 	case OR:
 		n = 1
-	case AND:
+	case XOR:
 		n = 2
-	case LSS, LEQ, GTR, GEQ, EQL, LEQL, LNEQ, INTERSECTS, NOT_INTERSECTS,
-		IN, NOT_IN, NEARBY, NOT_NEARBY, NOT_EQ:
+	case AND:
 		n = 3
-	case ADD, SUB:
+	case NOT:
 		n = 4
-	case MUL, QUO, REM:
+	case LSS, LEQ, GTR, GEQ, EQL, LEQL, LNEQ, INTERSECTS, NOT_INTERSECTS,
+		IN, NOT_IN, NEARBY, NOT_NEARBY, NOT_EQ, FOR, ENTERS, EXITS, DWELLS:
 		n = 5
+	case ADD, SUB:
+		n = 6
+	case MUL, QUO, REM:
+		n = 7
 	}
 	return
 }
@@ -74,9 +74,29 @@ func TestTokenizerScan(t *testing.T) {
 			want: []Token{REPEAT, INT},
 			str:  "repeat  24H",
 		},
+		{
+			name: "NOT,XOR",
+			want: []Token{NOT, SELECTOR, XOR, NOT, LPAREN, NOT, NOT_IN, NOT_IN},
+			str:  "not a xor !(not not in not in",
+		},
+		{
+			name: "FOR",
+			want: []Token{SELECTOR, GTR, INT, FOR, INT, SELECTOR},
+			str:  "a > 1 for 10 m",
+		},
+		{
+			name: "ENTERS,EXITS,DWELLS",
+			want: []Token{ENTERS, EXITS, DWELLS, SELECTOR, SELECTOR},
+			str:  "enters exits dwells in dwells a",
+		},
+		{
+			name: "ANY,ALL",
+			want: []Token{ANY, SELECTOR, ALL, SELECTOR},
+			str:  "any a ALL b",
+		},
 		{
 			name: "ILLEGAL",
-			want: []Token{ILLEGAL, ILLEGAL, ILLEGAL},
+			want: []Token{NOT, NOT, ILLEGAL},
 			str:  "!! |> &",
 		},
 		{
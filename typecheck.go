@@ -16,18 +16,48 @@ const (
 	ArrayInt
 	ArrayFloat
 	ArrayString
+	// Geometry is a geometry or a [lon, lat] coordinate.
+	Geometry
+	// Any accepts a value of any type. It is only valid as a function parameter.
+	Any
 )
 
-type Dictionary map[string]SelectorType
+func (t SelectorType) String() (s string) {
+	switch t {
+	case Int:
+		s = "int"
+	case Float:
+		s = "float"
+	case String:
+		s = "string"
+	case Boolean:
+		s = "boolean"
+	case ArrayInt:
+		s = "array of int"
+	case ArrayFloat:
+		s = "array of float"
+	case ArrayString:
+		s = "array of string"
+	case Geometry:
+		s = "geometry"
+	case Any:
+		s = "any"
+	}
+	return
+}
+
+// Dictionary declares the selectors, e.g. dict["tracker_speed"] = Float.
+// Selectors with properties are declared with a SelectorDecl.
+type Dictionary map[string]Declaration
 
 func Dict() Dictionary { return make(Dictionary) }
 
 func (d Dictionary) lookup(selectorName string) (SelectorType, error) {
-	typ, ok := d[selectorName]
-	if !ok {
+	decl, ok := d[selectorName]
+	if !ok || decl == nil {
 		return -1, fmt.Errorf("selector type %s not declared", selectorName)
 	}
-	return typ, nil
+	return decl.declType(), nil
 }
 
 var (
@@ -40,6 +70,7 @@ var (
 	opArrayString = &ArrayTyp{List: []Expr{opString}}
 	opRangeInt    = &Range{Low: opInt}
 	opRangeFloat  = &Range{Low: opFloat}
+	opGeometry    = &GeometryPointTyp{}
 )
 
 type ruleTyp uint
@@ -56,6 +87,7 @@ const (
 	isArrayString
 	isGeometry
 	isBoolean
+	isDuration
 )
 
 var rules = map[Token]map[ruleTyp][]ruleTyp{
@@ -65,6 +97,15 @@ var rules = map[Token]map[ruleTyp][]ruleTyp{
 	AND: {
 		isBoolean: {isBoolean},
 	},
+	XOR: {
+		isBoolean: {isBoolean},
+	},
+	NOT: {
+		isBoolean: nil,
+	},
+	FOR: {
+		isBoolean: {isDuration},
+	},
 	EQL: {
 		isInt:         {isInt, isFloat},
 		isFloat:       {isInt, isFloat},
@@ -174,8 +215,25 @@ var rules = map[Token]map[ruleTyp][]ruleTyp{
 		isFloat:    {isGeometry},
 		isInt:      {isGeometry},
 	},
+	ENTERS: {
+		isGeometry: {isGeometry},
+		isFloat:    {isGeometry},
+		isInt:      {isGeometry},
+	},
+	EXITS: {
+		isGeometry: {isGeometry},
+		isFloat:    {isGeometry},
+		isInt:      {isGeometry},
+	},
+	DWELLS: {
+		isGeometry: {isGeometry},
+		isFloat:    {isGeometry},
+		isInt:      {isGeometry},
+	},
 }
 
+// CheckType checks the types of the condition of the statement
+// with the selectors declared in dict. Errors are *TypeError.
 func CheckType(stmt Statement, dict Dictionary) (err error) {
 	switch typ := stmt.(type) {
 	case *Trigger:
@@ -244,7 +302,17 @@ loop:
 	return
 }
 
+// walk returns the type of the expression. Errors are *TypeError
+// at the innermost expression that does not check.
 func (tc *checker) walk(expr Expr) (Expr, error) {
+	x, err := tc.walkExpr(expr)
+	if _, ok := err.(*TypeError); err != nil && !ok {
+		err = &TypeError{Pos: expr.Pos(), End: expr.End(), Err: err}
+	}
+	return x, err
+}
+
+func (tc *checker) walkExpr(expr Expr) (Expr, error) {
 	switch typ := expr.(type) {
 	case *ParenExpr:
 		return tc.walk(typ.Expr)
@@ -259,17 +327,57 @@ func (tc *checker) walk(expr Expr) (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
+		if err = tc.checkDelta(typ); err != nil {
+			return nil, err
+		}
 		return tc.eval(left, right, typ.Op)
+	case *UnaryExpr:
+		x, err := tc.walk(typ.X)
+		if err != nil {
+			return nil, err
+		}
+		return tc.evalUnary(x, typ.Op)
+	case *CallExpr:
+		return tc.evalCall(typ)
+	case *WindowExpr:
+		return tc.evalWindow(typ)
+	case *HistoryExpr:
+		return tc.evalHistory(typ)
+	case *Selector:
+		if _, err := tc.dict.lookup(typ.Ident); err != nil {
+			return nil, &TypeError{Pos: typ.Pos(), End: typ.End(), Err: err,
+				Hint: didYouMean(typ.Ident, tc.dict.names())}
+		}
+		if err := tc.checkProps(typ); err != nil {
+			return nil, err
+		}
 	}
 	return expr, nil
 }
 
+func (tc *checker) evalUnary(x Expr, op Token) (Expr, error) {
+	for typ := range rules[op] {
+		if tc.is(typ, x) {
+			return opBoolean, nil
+		}
+	}
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("invalid operator: ")
+	buf.WriteString(KeywordString(op))
+	buf.WriteString(" ")
+	x.format(buf, "", true)
+	buf.WriteString(" (mismatched types)")
+	return nil, errors.New(buf.String())
+}
+
 func (tc *checker) is(rt ruleTyp, in Expr) (ok bool) {
 	switch rt {
 	case isGeometry:
 		ok = tc.isGeometry(in)
 	case isBoolean:
 		ok = tc.isBoolean(in)
+	case isDuration:
+		ok = tc.isDuration(in)
 	case isInt:
 		ok = tc.isInt(in)
 	case isFloat:
@@ -290,6 +398,31 @@ func (tc *checker) is(rt ruleTyp, in Expr) (ok bool) {
 	return
 }
 
+// isType reports whether the expression can be passed as a function argument of the type.
+func (tc *checker) isType(typ SelectorType, in Expr) (ok bool) {
+	switch typ {
+	case Any:
+		ok = true
+	case Int:
+		ok = tc.isInt(in)
+	case Float:
+		ok = tc.isNumber(in)
+	case String:
+		ok = tc.isString(in)
+	case Boolean:
+		ok = tc.isBoolean(in)
+	case ArrayInt:
+		ok = tc.isArray(in, INT)
+	case ArrayFloat:
+		ok = tc.isArray(in, FLOAT) || tc.isArray(in, INT)
+	case ArrayString:
+		ok = tc.isArray(in, STRING)
+	case Geometry:
+		ok = tc.isGeometry(in) || tc.isArray(in, FLOAT) || tc.isArray(in, INT)
+	}
+	return
+}
+
 func (tc *checker) toExpr(left, right ruleTyp, op Token) (expr Expr) {
 	switch op {
 	case ADD:
@@ -316,13 +449,13 @@ func (tc *checker) toExpr(left, right ruleTyp, op Token) (expr Expr) {
 		case left == isInt && right == isInt:
 			expr = opInt
 		}
-	case AND, OR, EQL, LEQL, NOT_EQ, LNEQ, GEQ, LEQ, GTR, LSS:
+	case AND, OR, XOR, FOR, EQL, LEQL, NOT_EQ, LNEQ, GEQ, LEQ, GTR, LSS:
 		expr = opBoolean
 	case IN, NOT_IN:
 		expr = opBoolean
 	case NEARBY, NOT_NEARBY:
 		expr = opBoolean
-	case INTERSECTS, NOT_INTERSECTS:
+	case INTERSECTS, NOT_INTERSECTS, ENTERS, EXITS, DWELLS:
 		expr = opBoolean
 	}
 	return
@@ -355,6 +488,20 @@ func (tc *checker) isBoolean(expr Expr) (ok bool) {
 	return
 }
 
+func (tc *checker) isDuration(in Expr) (ok bool) {
+	switch typ := in.(type) {
+	case *DurationTyp:
+		ok = true
+	case *Ref:
+		assign, err := tc.trigger.findAssign(typ.ID)
+		if err != nil {
+			return
+		}
+		_, ok = assign.Right.(*DurationTyp)
+	}
+	return
+}
+
 func (tc *checker) isString(in Expr) (ok bool) {
 	switch typ := in.(type) {
 	case *StringTyp:
@@ -446,8 +593,10 @@ func (tc *checker) isArray(in Expr, typ Token) (ok bool) {
 func (tc *checker) isGeometry(in Expr) (ok bool) {
 	switch typ := in.(type) {
 	case *GeometryCollectionTyp, *GeometryLineTyp, *GeometryPointTyp,
-		*GeometryMultiObjectTyp:
+		*GeometryPolygonTyp, *GeometryMultiObjectTyp:
 		ok = true
+	case *CellTyp, *ArrayTyp, *Range:
+		ok = isCellSet(typ)
 	case *Ref:
 		assign, err := tc.trigger.findAssign(typ.ID)
 		if err != nil {
@@ -455,9 +604,17 @@ func (tc *checker) isGeometry(in Expr) (ok bool) {
 		}
 		switch assign.Right.(type) {
 		case *GeometryCollectionTyp, *GeometryLineTyp, *GeometryPointTyp,
-			*GeometryMultiObjectTyp:
+			*GeometryPolygonTyp, *GeometryMultiObjectTyp:
 			ok = true
+		default:
+			ok = isCellSet(assign.Right)
+		}
+	case *Selector:
+		selector, err := tc.getSelectorType(typ.Ident)
+		if err != nil {
+			return
 		}
+		ok = selector == opGeometry
 	}
 	return
 }
@@ -529,9 +686,15 @@ func (tc *checker) getSelectorType(selectorName string) (expr Expr, err error) {
 	if err != nil {
 		return nil, err
 	}
-	switch typ {
-	default:
+	if expr = typeExpr(typ); expr == nil {
 		err = fmt.Errorf("cannot find selector type '%s'", selectorName)
+	}
+	return
+}
+
+// typeExpr returns the placeholder expression of the type, or nil for Any.
+func typeExpr(typ SelectorType) (expr Expr) {
+	switch typ {
 	case Int:
 		expr = opInt
 	case Float:
@@ -546,6 +709,8 @@ func (tc *checker) getSelectorType(selectorName string) (expr Expr, err error) {
 		expr = opArrayFloat
 	case ArrayString:
 		expr = opArrayString
+	case Geometry:
+		expr = opGeometry
 	}
 	return
 }
@@ -181,6 +181,18 @@ func TestCheck(t *testing.T) {
 				{n: "string_bool_bad", l: `"on"`, r: "true", e: true},
 			},
 		},
+		{
+			name: "logicalOps",
+			ops:  []Token{AND, OR, XOR},
+			want: []checkSpec{
+				{n: "bool_bool_ok", l: "true", r: "false"},
+				{n: "bool_sbool_ok", l: "true", r: "s_bool"},
+				{n: "cmp_cmp_ok", l: "s_int > 1", r: "s_float < 2"},
+				{n: "not_bool_ok", l: "not s_bool", r: "true"},
+				{n: "bool_int_bad", l: "true", r: "1", e: true},
+				{n: "string_bool_bad", l: `"on"`, r: "true", e: true},
+			},
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -202,3 +214,22 @@ func TestCheck(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckNot(t *testing.T) {
+	testCases := []struct {
+		s   string
+		err bool
+	}{
+		{s: `when not s_bool`},
+		{s: `when ! s_bool`},
+		{s: `when not (s_int > 1 and s_float < 2)`},
+		{s: `when not not s_int in [1, 2]`},
+		{s: `trigger set ref=true; when not @ref`},
+		{s: `when not s_int`, err: true},
+		{s: `when not "on"`, err: true},
+		{s: `when not s_int + 1`, err: true},
+	}
+	for _, tc := range testCases {
+		checkAndTest(t, tc.s, tc.s, tc.err)
+	}
+}
@@ -122,34 +122,23 @@ func isSpeedUnit(s string) (ok bool) {
 	return
 }
 
-func unitFromString(in string) (out Unit) {
-	switch in {
-	default:
-		out = Unknown
-	case "%", "PCT", "Pct":
-		out = Percent
-	case "rkm", "rKM", "Rkm", "km", "Km":
-		out = Kilometer
-	case "rm", "rM", "Rm", "M", "met":
-		out = Meter
-	case "kph", "KPH", "Kph":
-		out = Kph
-	case "mph", "Mph", "MPH":
-		out = Mph
-	case "c", "C":
-		out = Celsius
-	case "f", "F":
-		out = Fahrenheit
-	case "bar", "Bar", "BAR":
-		out = Bar
-	case "Psi", "PSI", "si", "psi":
-		out = Psi
-	case "am", "Am", "AM":
-		out = AM
-	case "pm", "Pm", "PM":
-		out = PM
-	}
-	return
+// unitNames are the spellings of the units.
+var unitNames = map[string]Unit{
+	"%": Percent, "PCT": Percent, "Pct": Percent,
+	"rkm": Kilometer, "rKM": Kilometer, "Rkm": Kilometer, "km": Kilometer, "Km": Kilometer,
+	"rm": Meter, "rM": Meter, "Rm": Meter, "M": Meter, "met": Meter,
+	"kph": Kph, "KPH": Kph, "Kph": Kph,
+	"mph": Mph, "Mph": Mph, "MPH": Mph,
+	"c": Celsius, "C": Celsius,
+	"f": Fahrenheit, "F": Fahrenheit,
+	"bar": Bar, "Bar": Bar, "BAR": Bar,
+	"Psi": Psi, "PSI": Psi, "si": Psi, "psi": Psi,
+	"am": AM, "Am": AM, "AM": AM,
+	"pm": PM, "Pm": PM, "PM": PM,
+}
+
+func unitFromString(in string) Unit {
+	return unitNames[in]
 }
 
 func (v Sign) String() (s string) {
@@ -161,3 +150,88 @@ func (v Sign) String() (s string) {
 	}
 	return
 }
+
+// dimension groups literals that can be compared after unit normalization.
+type dimension uint8
+
+const (
+	dimUnknown dimension = iota
+	dimNumber
+	dimPercent
+	dimSpeed
+	dimDistance
+	dimTemperature
+	dimPressure
+	dimDuration
+	dimTime
+	dimDate
+	dimWeekday
+	dimMonth
+	dimString
+	dimBoolean
+)
+
+const (
+	kphPerMph     = 1.609344
+	metersPerKm   = 1000
+	barPerPsi     = 0.0689475729
+	secondsPerDay = 24 * 60 * 60
+)
+
+// baseValue returns the value of a literal in the base unit of its dimension:
+// Kph for speed, meters for distance, Celsius for temperature, Bar for pressure,
+// seconds for durations and time of day.
+func baseValue(expr Expr) (val float64, dim dimension, ok bool) {
+	ok = true
+	switch typ := expr.(type) {
+	default:
+		ok = false
+	case *IntTyp:
+		val, dim = float64(typ.Val), dimNumber
+	case *FloatTyp:
+		val, dim = typ.Val, dimNumber
+	case *PercentTyp:
+		val, dim = typ.Val, dimPercent
+	case *SpeedTyp:
+		val, dim = typ.Val, dimSpeed
+		if typ.U == Mph {
+			val *= kphPerMph
+		}
+	case *DistanceTyp:
+		val, dim = typ.Val, dimDistance
+		if typ.U == Kilometer {
+			val *= metersPerKm
+		}
+	case *TemperatureTyp:
+		val, dim = typ.Val, dimTemperature
+		if typ.Vec == Minus {
+			val = -val
+		}
+		if typ.U == Fahrenheit {
+			val = (val - 32) * 5 / 9
+		}
+	case *PressureTyp:
+		val, dim = typ.Val, dimPressure
+		if typ.U == Psi {
+			val *= barPerPsi
+		}
+	case *DurationTyp:
+		val, dim = typ.Val.Seconds(), dimDuration
+	case *TimeTyp:
+		h := typ.Hours
+		switch {
+		case typ.U == AM && h == 12:
+			h = 0
+		case typ.U == PM && h < 12:
+			h += 12
+		}
+		val, dim = float64(h*3600+typ.Minutes*60+typ.Seconds), dimTime
+	case *DateTyp:
+		val, dim = float64(typ.Year*10000+typ.Month*100+typ.Day), dimDate
+	case *WeekdayTyp:
+		val, dim = float64(typ.Val), dimWeekday
+	case *MonthTyp:
+		val, dim = float64(typ.Val), dimMonth
+	}
+	return
+}
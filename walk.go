@@ -23,6 +23,21 @@ func Walk(v Visitor, expr Expr) {
 	case *BinaryExpr:
 		Walk(v, typ.Left)
 		Walk(v, typ.Right)
+	case *UnaryExpr:
+		Walk(v, typ.X)
+	case *CallExpr:
+		for i := 0; i < len(typ.Args); i++ {
+			Walk(v, typ.Args[i])
+		}
+	case *WindowExpr:
+		Walk(v, typ.X)
+		Walk(v, typ.Window)
+	case *HistoryExpr:
+		Walk(v, typ.X)
+		if typ.Amount != nil {
+			Walk(v, typ.Amount)
+			Walk(v, typ.Within)
+		}
 	case *ArrayTyp:
 		for i := 0; i < len(typ.List); i++ {
 			Walk(v, typ.List[i])
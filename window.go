@@ -0,0 +1,238 @@
+package geoqlparser
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultWindowSize is the number of samples WindowState keeps
+// per device and window expression when no size is given.
+const DefaultWindowSize = 256
+
+var windowFuncs = map[string]struct{}{
+	"avg":   {},
+	"min":   {},
+	"max":   {},
+	"sum":   {},
+	"count": {},
+}
+
+func isWindowFunc(name string) bool {
+	_, ok := windowFuncs[name]
+	return ok
+}
+
+func (s *parser) windowExpr(call *CallExpr) (Expr, error) {
+	if len(call.Args) != 2 {
+		s.err = fmt.Errorf("invalid window %s: got %d arguments, expected %s(selector, duration)",
+			call.Func, len(call.Args), call.Func)
+		return nil, s.error()
+	}
+	window, ok := call.Args[1].(*DurationTyp)
+	if !ok || window.Val <= 0 {
+		s.err = fmt.Errorf("invalid window %s: got %s, expected positive duration",
+			call.Func, formatExpr(call.Args[1]))
+		return nil, s.error()
+	}
+	return &WindowExpr{
+		Func:   call.Func,
+		X:      call.Args[0],
+		Window: window,
+		lpos:   call.lpos,
+		rpos:   call.rpos,
+	}, nil
+}
+
+func (tc *checker) evalWindow(e *WindowExpr) (Expr, error) {
+	x, err := tc.walk(e.X)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case e.Func == "count":
+		return opInt, nil
+	case !tc.isNumber(x):
+		return nil, fmt.Errorf("invalid window %s: %s is not a number", formatExpr(e), formatExpr(e.X))
+	case e.Func != "avg" && tc.isInt(x):
+		return opInt, nil
+	}
+	return opFloat, nil
+}
+
+// WindowState keeps the recent samples of window expressions and the start
+// of the periods of for qualifiers per device. Samples are stored in a ring
+// buffer of a fixed size, the oldest samples are dropped when it is full,
+// even if they are still within the window. The aggregates then cover only
+// the last samples, so the size must be at least the number of samples
+// a device sends within the longest window. Window expressions that are formatted
+// the same, e.g. avg(tracker_speed, 5m) of two triggers, share the samples.
+// WindowState is safe for concurrent use.
+type WindowState struct {
+	mu      sync.Mutex
+	size    int
+	devices map[string]*deviceState
+}
+
+type deviceState struct {
+	windows map[string]*ring
+	holds   map[string]time.Time
+}
+
+type sample struct {
+	at  time.Time
+	val float64
+}
+
+type ring struct {
+	buf  []sample
+	head int
+	n    int
+}
+
+// push appends the sample and returns the oldest sample if it was dropped
+// to make room for it.
+func (r *ring) push(s sample) (dropped sample, ok bool) {
+	if r.n < len(r.buf) {
+		r.buf[(r.head+r.n)%len(r.buf)] = s
+		r.n++
+		return sample{}, false
+	}
+	dropped = r.buf[r.head]
+	r.buf[r.head] = s
+	r.head = (r.head + 1) % len(r.buf)
+	return dropped, true
+}
+
+func (r *ring) at(i int) sample {
+	return r.buf[(r.head+i)%len(r.buf)]
+}
+
+// NewWindowState creates a state that keeps at most size samples
+// per device and window expression.
+func NewWindowState(size int) *WindowState {
+	if size <= 0 {
+		size = DefaultWindowSize
+	}
+	return &WindowState{size: size, devices: make(map[string]*deviceState)}
+}
+
+func (s *WindowState) device(id string) *deviceState {
+	d, ok := s.devices[id]
+	if !ok {
+		d = &deviceState{windows: make(map[string]*ring), holds: make(map[string]time.Time)}
+		s.devices[id] = d
+	}
+	return d
+}
+
+// Observe records the value of the window operand of the device at the time.
+// The sample is recorded once if it is observed again for an expression that
+// shares the samples, so Observe may be called for each window expression.
+// It reports an error if the sample is older than the last recorded one and
+// is not recorded, or if the buffer is full and the sample it drops is still
+// within the window.
+func (s *WindowState) Observe(device string, e *WindowExpr, at time.Time, val float64) error {
+	key := formatExpr(e)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.device(device)
+	r, ok := d.windows[key]
+	if !ok {
+		r = &ring{buf: make([]sample, s.size)}
+		d.windows[key] = r
+	}
+	if r.n > 0 {
+		last := r.at(r.n - 1)
+		if last.at.Equal(at) && last.val == val {
+			return nil
+		}
+		if at.Before(last.at) {
+			return fmt.Errorf("geoql: %s: sample at %s is older than the last one at %s, dropped",
+				key, at.Format(time.RFC3339Nano), last.at.Format(time.RFC3339Nano))
+		}
+	}
+	dropped, ok := r.push(sample{at: at, val: val})
+	if ok && dropped.at.After(at.Add(-e.Window.Val)) {
+		return fmt.Errorf("geoql: %s: more than %d samples within the window, dropped the sample at %s",
+			key, s.size, dropped.at.Format(time.RFC3339Nano))
+	}
+	return nil
+}
+
+// Value returns the aggregate of the samples of the device within the window
+// that ends at now. It reports false if the window of avg, min or max is empty.
+func (s *WindowState) Value(device string, e *WindowExpr, now time.Time) (float64, bool) {
+	key := formatExpr(e)
+	from := now.Add(-e.Window.Val)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sum, count float64
+	min, max := math.Inf(1), math.Inf(-1)
+	if d, ok := s.devices[device]; ok {
+		if r, ok := d.windows[key]; ok {
+			for i := r.n - 1; i >= 0; i-- {
+				smp := r.at(i)
+				if smp.at.After(now) {
+					continue
+				}
+				if !smp.at.After(from) {
+					break
+				}
+				sum += smp.val
+				count++
+				min = math.Min(min, smp.val)
+				max = math.Max(max, smp.val)
+			}
+		}
+	}
+	switch e.Func {
+	case "count":
+		return count, true
+	case "sum":
+		return sum, true
+	}
+	if count == 0 {
+		return 0, false
+	}
+	switch e.Func {
+	case "min":
+		return min, true
+	case "max":
+		return max, true
+	}
+	return sum / count, true
+}
+
+// Hold records the result of the condition of a for qualifier, e.g.
+// tracker_temp > 8C for 10m, and reports whether the condition of the device
+// has been true without interruption for at least the qualifier duration.
+// For other expressions Hold returns the result of the condition.
+func (s *WindowState) Hold(device string, e *BinaryExpr, at time.Time, cond bool) bool {
+	dur, ok := e.Right.(*DurationTyp)
+	if e.Op != FOR || !ok {
+		return cond
+	}
+	key := formatExpr(e)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.device(device)
+	if !cond {
+		delete(d.holds, key)
+		return false
+	}
+	since, ok := d.holds[key]
+	if !ok {
+		d.holds[key] = at
+		since = at
+	}
+	return at.Sub(since) >= dur.Val
+}
+
+// Forget drops the state of the device.
+func (s *WindowState) Forget(device string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.devices, device)
+}
@@ -0,0 +1,258 @@
+package geoqlparser
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestParseWindow(t *testing.T) {
+	testCases := []struct {
+		name string
+		s    string
+		want string
+		err  bool
+	}{
+		{
+			name: "average",
+			s:    `when avg(tracker_speed, 5m) > 80Kph`,
+			want: `>(avg(tracker_speed, 5m0s), 80Kph)`,
+		},
+		{
+			name: "expression operand",
+			s:    `when max(tracker_a - tracker_b, 1h30m) < 2 or count(tracker_alarm, 10s) >= 3`,
+			want: `or(<(max(tracker_a-tracker_b, 1h30m0s), 2), >=(count(tracker_alarm, 10s), 3))`,
+		},
+		{
+			name: "for qualifier",
+			s:    `when tracker_temp > 8C for 10m and tracker_door == true`,
+			want: `and(for(>(tracker_temp, 8C), 10m0s), ==(tracker_door, true))`,
+		},
+		{
+			name: "for qualifier of a group",
+			s:    `when (tracker_a > 1 or tracker_b > 1) for 1m`,
+			want: `for((or(>(tracker_a, 1), >(tracker_b, 1))), 1m0s)`,
+		},
+		{
+			name: "not binds the qualified condition",
+			s:    `when not tracker_a > 1 for 1m`,
+			want: `not(for(>(tracker_a, 1), 1m0s))`,
+		},
+		{
+			name: "window without duration",
+			s:    `when avg(tracker_speed) > 1`,
+			err:  true,
+		},
+		{
+			name: "window with a number",
+			s:    `when avg(tracker_speed, 5) > 1`,
+			err:  true,
+		},
+		{
+			name: "empty window",
+			s:    `when min(tracker_speed, 0s) > 1`,
+			err:  true,
+		},
+		{
+			name: "for without duration",
+			s:    `when tracker_a > 1 for 10`,
+			err:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := Parse(tc.s)
+			if tc.err {
+				if err == nil {
+					t.Fatal("have nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := sexpr(stmt.(*Trigger).When); have != tc.want {
+				t.Fatalf("have %s, want %s", have, tc.want)
+			}
+			buf := bytes.NewBuffer(nil)
+			if err = Format(buf, stmt); err != nil {
+				t.Fatal(err)
+			}
+			again, err := Parse(buf.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have := sexpr(again.(*Trigger).When); have != tc.want {
+				t.Fatalf("have %s, want %s after format", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckWindow(t *testing.T) {
+	dict := Dict()
+	dict["s_int"] = Int
+	dict["s_float"] = Float
+	dict["s_string"] = String
+	dict["s_bool"] = Boolean
+	testCases := []struct {
+		name string
+		s    string
+		err  bool
+	}{
+		{name: "average", s: `when avg(s_float, 5m) > 80Kph and avg(s_int, 5m) > 1.5`},
+		{name: "count of strings", s: `when count(s_string, 1m) > 2`},
+		{name: "for", s: `when s_float > 8C for 10m and s_bool for 1m`},
+		{name: "for variable", s: `trigger set d=10m; when s_bool == true for 1m`},
+		{name: "average of strings", s: `when avg(s_string, 1m) > 2`, err: true},
+		{name: "count compared to string", s: `when count(s_int, 1m) == "a"`, err: true},
+		{name: "for of a number", s: `when s_int for 1m > 1`, err: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stmt, err := Parse(tc.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = CheckType(stmt, dict)
+			if have, want := err != nil, tc.err; have != want {
+				t.Fatalf("have %v, want error %v", err, want)
+			}
+		})
+	}
+}
+
+func windowOf(t *testing.T, s string) *WindowExpr {
+	stmt, err := Parse("when " + s + " > 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stmt.(*Trigger).When.(*BinaryExpr).Left.(*WindowExpr)
+}
+
+func TestWindowStateValue(t *testing.T) {
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	state := NewWindowState(4)
+	avg := windowOf(t, "avg(tracker_speed, 3m)")
+	for i, v := range []float64{10, 20, 30, 40, 50} {
+		state.Observe("dev", avg, start.Add(time.Duration(i)*time.Minute), v)
+	}
+	state.Observe("dev", avg, start, 1000)
+
+	now := start.Add(4 * time.Minute)
+	testCases := []struct {
+		window string
+		now    time.Time
+		want   float64
+		ok     bool
+	}{
+		{window: "avg(tracker_speed, 3m)", now: now, want: 40, ok: true},
+		{window: "avg(tracker_speed, 3m)", now: now.Add(-time.Minute), want: 30, ok: true},
+		{window: "avg(tracker_speed, 3m)", now: now.Add(time.Hour)},
+	}
+	for _, tc := range testCases {
+		have, ok := state.Value("dev", windowOf(t, tc.window), tc.now)
+		if have != tc.want || ok != tc.ok {
+			t.Fatalf("%s: have %v %v, want %v %v", tc.window, have, ok, tc.want, tc.ok)
+		}
+	}
+
+	funcs := map[string]float64{"min": 20, "max": 50, "sum": 140, "count": 4, "avg": 35}
+	for fn, want := range funcs {
+		e := windowOf(t, fn+"(tracker_a, 1h)")
+		for i, v := range []float64{10, 20, 30, 40, 50} {
+			state.Observe("dev", e, start.Add(time.Duration(i)*time.Minute), v)
+		}
+		if have, _ := state.Value("dev", e, now); have != want {
+			t.Fatalf("%s: have %v, want %v", fn, have, want)
+		}
+		if have, ok := state.Value("other", e, now); have != 0 || ok != (fn == "sum" || fn == "count") {
+			t.Fatalf("%s: have %v %v for unknown device", fn, have, ok)
+		}
+	}
+
+	state.Forget("dev")
+	if _, ok := state.Value("dev", avg, now); ok {
+		t.Fatal("have samples after forget")
+	}
+}
+
+func TestWindowStateDropped(t *testing.T) {
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	state := NewWindowState(2)
+	avg := windowOf(t, "avg(tracker_speed, 90s)")
+	steps := []struct {
+		after time.Duration
+		err   bool
+	}{
+		{after: time.Minute},
+		{after: 2 * time.Minute},
+		{after: 30 * time.Second, err: true},
+		// drops the sample of the first minute, out of the window
+		{after: 3 * time.Minute},
+		// drops the sample of the second minute, within the window
+		{after: 3*time.Minute + time.Second, err: true},
+	}
+	for _, step := range steps {
+		err := state.Observe("dev", avg, start.Add(step.after), 1)
+		if (err != nil) != step.err {
+			t.Fatalf("%s: have %v, want error %v", step.after, err, step.err)
+		}
+	}
+}
+
+func TestWindowStateShared(t *testing.T) {
+	stmt, err := Parse(`when count(tracker_speed, 1h) > 2 or count(tracker_speed, 1h) > 3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	when := stmt.(*Trigger).When.(*BinaryExpr)
+	a := when.Left.(*BinaryExpr).Left.(*WindowExpr)
+	b := when.Right.(*BinaryExpr).Left.(*WindowExpr)
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	state := NewWindowState(0)
+	for i := 0; i < 3; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		for _, e := range []*WindowExpr{a, b} {
+			if err := state.Observe("dev", e, at, 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, e := range []*WindowExpr{a, b} {
+		if have, _ := state.Value("dev", e, start.Add(3*time.Minute)); have != 3 {
+			t.Fatalf("have %v, want each sample counted once", have)
+		}
+	}
+}
+
+func TestWindowStateHold(t *testing.T) {
+	stmt, err := Parse(`when tracker_temp > 8C for 10m`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hold := stmt.(*Trigger).When.(*BinaryExpr)
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	state := NewWindowState(0)
+	steps := []struct {
+		after time.Duration
+		cond  bool
+		want  bool
+	}{
+		{after: 0, cond: true},
+		{after: 5 * time.Minute, cond: true},
+		{after: 10 * time.Minute, cond: true, want: true},
+		{after: 11 * time.Minute, cond: false},
+		{after: 12 * time.Minute, cond: true},
+		{after: 21 * time.Minute, cond: true},
+		{after: 22 * time.Minute, cond: true, want: true},
+	}
+	for _, step := range steps {
+		if have := state.Hold("dev", hold, start.Add(step.after), step.cond); have != step.want {
+			t.Fatalf("after %s: have %v, want %v", step.after, have, step.want)
+		}
+	}
+	if state.Hold("other", hold, start, true) {
+		t.Fatal("have hold of other device")
+	}
+}